@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"github.com/Kosench/go-url-shortener/internal/botdetect"
 	"github.com/Kosench/go-url-shortener/internal/cache"
 	"github.com/Kosench/go-url-shortener/internal/config"
 	"github.com/Kosench/go-url-shortener/internal/database"
+	"github.com/Kosench/go-url-shortener/internal/events"
+	"github.com/Kosench/go-url-shortener/internal/geoip"
 	"github.com/Kosench/go-url-shortener/internal/handler"
 	"github.com/Kosench/go-url-shortener/internal/repository"
 	"github.com/Kosench/go-url-shortener/internal/service"
@@ -47,6 +50,7 @@ func main() {
 		MinIdleConns: cfg.Redis.MinIdleConns,
 		MaxRetries:   cfg.Redis.MaxRetries,
 		CacheTTL:     cfg.Redis.CacheTTL,
+		Namespace:    cfg.Redis.Namespace,
 	})
 	if err != nil {
 		log.Printf("⚠️  Failed to connect to Redis (running without cache): %v", err)
@@ -76,9 +80,188 @@ func main() {
 		urlRepo = repository.NewPostgresURLRepository(db)
 	}
 
+	// Счетчики попыток ввода пароля защищенных ссылок и использования квот
+	var passwordLimiter cache.RateLimiter = cache.NewMemoryRateLimiter()
+	keyBuilder := cache.NewKeyBuilder(cfg.Redis.Namespace)
+	if redisClient != nil {
+		passwordLimiter = redisClient
+		keyBuilder = redisClient.GetKeyBuilder()
+	}
+
+	if cfg.App.SecretKey == "" {
+		log.Printf("⚠️  app.secret_key is not set, unlock cookies and creator bans will not survive restart")
+	}
+
+	// База GeoIP: следим за файлом до остановки сервера
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+
+	var geoLocator handler.GeoLocator
+	if cfg.App.GeoIPDatabase != "" {
+		locator, err := geoip.Open(cfg.App.GeoIPDatabase)
+		if err != nil {
+			log.Printf("⚠️  Failed to load GeoIP database (geo rules disabled): %v", err)
+		} else {
+			geoLocator = locator
+			if err := locator.Watch(watchCtx); err != nil {
+				log.Printf("⚠️  GeoIP database will not be reloaded automatically: %v", err)
+			}
+			log.Printf("✅ GeoIP database loaded from %s", cfg.App.GeoIPDatabase)
+		}
+	}
+
+	// Определение ботов: переходы превью, краулеров и сканеров не засчитываются
+	botConfig := botdetect.Config{
+		IPRangesFile: cfg.App.BotIPRanges,
+		Counter:      passwordLimiter,
+		KeyBuilder:   keyBuilder,
+		BurstLimit:   cfg.App.BotBurstLimit,
+		BurstWindow:  time.Duration(cfg.App.BotBurstWindow) * time.Second,
+	}
+	botDetector, err := botdetect.New(botConfig)
+	if err != nil {
+		log.Printf("⚠️  Failed to load crawler IP ranges (checking User-Agent and rate only): %v", err)
+		botConfig.IPRangesFile = ""
+		botDetector, _ = botdetect.New(botConfig)
+	}
+
+	// Журнал аудита изменений ссылок, доменов, ключей и workspaces
+	auditLog := service.NewAuditLog(repository.NewPostgresAuditRepository(db))
+
+	// Webhooks: доставки отправляются в фоне до остановки сервера
+	webhookService := service.NewWebhookService(repository.NewPostgresWebhookRepository(db), service.WebhookConfig{
+		Audit: auditLog,
+	})
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	go webhookService.Run(webhookCtx)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+
+	// Outbox: события ссылок и переходов публикуются в приемники и webhooks
+	eventSinks := []service.EventSink{webhookService.Sink()}
+	for _, name := range cfg.Outbox.Sinks {
+		switch name {
+		case "stdout":
+			eventSinks = append(eventSinks, events.NewStdoutSink())
+		case "file":
+			fileSink, err := events.OpenFileSink(cfg.Outbox.FilePath)
+			if err != nil {
+				log.Fatal("Failed to open event file:", err)
+			}
+			defer fileSink.Close()
+			eventSinks = append(eventSinks, fileSink)
+		case "http":
+			if cfg.Outbox.HTTPURL == "" {
+				log.Fatal("outbox.http_url is required for http event sink")
+			}
+			eventSinks = append(eventSinks, events.NewHTTPSink(cfg.Outbox.HTTPURL, nil))
+		case "redis_stream":
+			if redisClient == nil {
+				log.Printf("⚠️  Redis is unavailable, redis_stream event sink disabled")
+				continue
+			}
+			eventSinks = append(eventSinks, events.NewStreamSink(redisClient, keyBuilder.Stream(cfg.Outbox.RedisStream), cfg.Outbox.StreamMaxLen))
+		default:
+			log.Fatalf("Unknown event sink %q", name)
+		}
+	}
+	outboxRelay := service.NewOutboxRelay(repository.NewPostgresOutboxRepository(db), eventSinks, service.OutboxConfig{
+		BatchSize:    cfg.Outbox.BatchSize,
+		PollInterval: time.Duration(cfg.Outbox.PollInterval) * time.Millisecond,
+		Retention:    time.Duration(cfg.Outbox.Retention) * time.Hour,
+	})
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	defer stopOutbox()
+	go outboxRelay.Run(outboxCtx)
+
+	workspaceService := service.NewWorkspaceService(
+		repository.NewPostgresWorkspaceRepository(db),
+		repository.NewPostgresAPIKeyRepository(db),
+		urlRepo,
+		service.WorkspaceConfig{
+			Counters:   passwordLimiter,
+			KeyBuilder: keyBuilder,
+			Audit:      auditLog,
+		},
+	)
+	workspaceHandler := handler.NewWorkspaceHandler(workspaceService, handler.WorkspaceConfig{
+		AdminToken:    cfg.App.AdminToken,
+		RequireAPIKey: cfg.App.RequireAPIKey,
+	})
+
+	// Переходы в реальном времени: через Redis pub/sub их получают потоки SSE
+	// всех экземпляров сервиса, без Redis - только этого
+	var livePubSub cache.PubSub = cache.NewMemoryPubSub()
+	if redisClient != nil {
+		livePubSub = redisClient
+	}
+	liveClicks := service.NewLiveClicks(livePubSub, keyBuilder)
+	liveCtx, stopLive := context.WithCancel(context.Background())
+	defer stopLive()
+	go liveClicks.Run(liveCtx)
+
+	// Уникальные посетители: HyperLogLog в Redis, без Redis - отпечатки в Postgres
+	var visitorRepo repository.VisitorRepository
+	if redisClient != nil {
+		visitorRepo = repository.NewRedisVisitorRepository(redisClient)
+	} else {
+		visitorRepo = repository.NewPostgresVisitorRepository(db)
+	}
+
+	// Карточки страниц назначения загружаются в фоне после создания ссылки
+	var linkPreviews *service.LinkPreviews
+	previewCtx, stopPreviews := context.WithCancel(context.Background())
+	defer stopPreviews()
+	if cfg.App.LinkPreviews {
+		linkPreviews = service.NewLinkPreviews(urlRepo, service.PreviewConfig{
+			Timeout:  time.Duration(cfg.App.LinkPreviewTimeout) * time.Second,
+			MaxBytes: cfg.App.LinkPreviewMaxBytes,
+		})
+		go linkPreviews.Run(previewCtx)
+	}
+
 	baseURL := cfg.GetBaseURL()
-	urlService := service.NewURLService(urlRepo, baseURL)
-	urlHandler := handler.NewURLHandler(urlService)
+	urlService := service.NewURLServiceWithConfig(urlRepo, baseURL, service.Config{
+		SecretKey:               cfg.App.SecretKey,
+		UnlockTTL:               time.Duration(cfg.App.UnlockTTL) * time.Second,
+		MaxPasswordAttempts:     cfg.App.PasswordMaxAttempts,
+		MaxLinkPasswordAttempts: cfg.App.PasswordMaxLinkAttempts,
+		PasswordAttemptWindow:   time.Duration(cfg.App.PasswordAttemptWindow) * time.Second,
+		RateLimiter:             passwordLimiter,
+		ClickRepository:         repository.NewPostgresClickRepository(db),
+		DomainRepository:        repository.NewPostgresDomainRepository(db),
+		Workspaces:              workspaceService,
+		KeyBuilder:              keyBuilder,
+		Audit:                   auditLog,
+		LiveClicks:              liveClicks,
+		VisitorRepository:       visitorRepo,
+		Previews:                linkPreviews,
+		Moderation:              repository.NewPostgresModerationRepository(db),
+	})
+	// Проверка доступности страниц назначения в фоне
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	if cfg.Health.Enabled {
+		healthChecker := service.NewHealthChecker(urlService, service.HealthConfig{
+			Timeout:          time.Duration(cfg.Health.Timeout) * time.Second,
+			RecheckInterval:  time.Duration(cfg.Health.RecheckInterval) * time.Minute,
+			HostInterval:     time.Duration(cfg.Health.HostInterval) * time.Millisecond,
+			FailureThreshold: cfg.Health.FailureThreshold,
+			BatchSize:        cfg.Health.BatchSize,
+			Workers:          cfg.Health.Workers,
+			ExcludedHosts:    cfg.Health.ExcludedHosts,
+		})
+		go healthChecker.Run(healthCtx)
+	}
+
+	urlHandler := handler.NewURLHandlerWithConfig(urlService, handler.Config{
+		ComingSoonURL:           cfg.App.ComingSoonURL,
+		PreviewMode:             cfg.App.PreviewMode,
+		DefaultRedirectType:     cfg.App.DefaultRedirectType,
+		PermanentRedirectMaxAge: time.Duration(cfg.App.PermanentRedirectMaxAge) * time.Second,
+		GeoLocator:              geoLocator,
+		BotDetector:             botDetector,
+	})
 
 	if cfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
@@ -87,11 +270,12 @@ func main() {
 	router := gin.Default()
 
 	// Middleware
+	router.Use(handler.RequestContext())
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.GetAllowedOrigins(),
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "X-Owner-Token", "X-API-Key", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID"},
 		AllowCredentials: false,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -170,16 +354,66 @@ func main() {
 	// API routes
 	apiV1 := router.Group("/api")
 	{
-		apiV1.POST("/urls", urlHandler.CreateURL)
-		apiV1.GET("/urls/:shortCode", urlHandler.GetURL)
+		// Административный API: токен администратора вместо API-ключа
+		admin := apiV1.Group("/workspaces", workspaceHandler.RequireAdmin())
+		admin.POST("", workspaceHandler.CreateWorkspace)
+		admin.PUT("/:id/quota", workspaceHandler.UpdateQuota)
+
+		// Очередь модерации: жалобы на ссылки и решения по ним
+		moderation := apiV1.Group("/moderation", workspaceHandler.RequireAdmin())
+		moderation.GET("/queue", urlHandler.ModerationQueue)
+		moderation.GET("/urls/:id/reports", urlHandler.ListReports)
+		moderation.POST("/urls/:id/dismiss", urlHandler.DismissReports)
+		moderation.POST("/urls/:id/suspend", urlHandler.SuspendURL)
+		moderation.POST("/urls/:id/unsuspend", urlHandler.UnsuspendURL)
+		moderation.POST("/urls/:id/ban", urlHandler.BanURL)
+
+		// Жалобы принимаются без API-ключа и не расходуют квоту запросов
+		apiV1.POST("/report/:shortCode", urlHandler.ReportURL)
+	}
+
+	api := apiV1.Group("", workspaceHandler.Authenticate())
+	{
+		api.POST("/urls", urlHandler.CreateURL)
+		api.GET("/urls", urlHandler.ListURLs)
+		api.GET("/urls/broken", urlHandler.ListBrokenURLs)
+		api.GET("/urls/:shortCode", urlHandler.GetURL)
+		api.PATCH("/urls/:shortCode", urlHandler.UpdateURL)
+		api.DELETE("/urls/:shortCode", urlHandler.DeleteURL)
+		api.POST("/urls/:shortCode/disable", urlHandler.DisableURL)
+		api.POST("/urls/:shortCode/enable", urlHandler.EnableURL)
+		api.POST("/urls/:shortCode/restore", urlHandler.RestoreURL)
+		api.GET("/urls/:shortCode/versions", urlHandler.ListURLVersions)
+		api.POST("/urls/:shortCode/rollback", urlHandler.RollbackURL)
+		api.GET("/urls/:shortCode/stats", urlHandler.GetStats)
+		api.GET("/urls/:shortCode/live", urlHandler.StreamClicks)
+		api.POST("/domains", urlHandler.CreateDomain)
+		api.GET("/domains", urlHandler.ListDomains)
+		api.GET("/workspace", workspaceHandler.GetWorkspace)
+		api.PATCH("/workspace", workspaceHandler.UpdateWorkspace)
+		api.GET("/workspace/live", urlHandler.StreamWorkspaceClicks)
+
+		api.POST("/keys", workspaceHandler.CreateAPIKey)
+		api.GET("/keys", workspaceHandler.ListAPIKeys)
+		api.DELETE("/keys/:id", workspaceHandler.DeleteAPIKey)
+		api.GET("/audit", workspaceHandler.ListAuditLog)
+
+		api.POST("/webhooks", webhookHandler.CreateWebhook)
+		api.GET("/webhooks", webhookHandler.ListWebhooks)
+		api.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+		api.POST("/webhooks/:id/deliveries/:deliveryID/replay", webhookHandler.ReplayDelivery)
 
 		// Stats endpoint (если есть Redis)
 		if redisClient != nil {
-			apiV1.GET("/stats", StatsHandler(redisClient))
+			api.GET("/stats", StatsHandler(redisClient))
 		}
 	}
 
 	router.GET("/:shortCode", urlHandler.RedirectURL)
+	router.GET("/:shortCode/*rest", urlHandler.RedirectURL)
+	router.POST("/:shortCode", urlHandler.PostRedirectURL)
+	router.POST("/:shortCode/*rest", urlHandler.PostRedirectURL)
 
 	// HTTP Server
 	srv := &http.Server{
@@ -193,8 +427,8 @@ func main() {
 	// Запускаем сервер
 	go func() {
 		log.Printf("🚀 Server starting on %s", cfg.GetServerAddress())
-		log.Printf("📝 API endpoints: POST/GET /api/urls")
-		log.Printf("🔗 Redirect endpoint: GET /{shortCode}")
+		log.Printf("📝 API endpoints: POST/GET /api/urls, GET /api/urls/{shortCode}/stats")
+		log.Printf("🔗 Redirect endpoint: GET /{shortCode}, info page: GET /{shortCode}+")
 		if redisClient != nil {
 			log.Printf("⚡ Cache enabled (Redis)")
 		}
@@ -215,8 +449,14 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Останавливаем handler workers
+	// Останавливаем handler workers, публикацию событий, доставку webhooks,
+	// загрузку карточек ссылок и потоки переходов SSE
 	urlHandler.Shutdown()
+	stopOutbox()
+	stopWebhooks()
+	stopPreviews()
+	stopHealth()
+	stopLive()
 
 	// Останавливаем HTTP сервер
 	if err := srv.Shutdown(ctx); err != nil {
@@ -231,7 +471,7 @@ func RedisRateLimitMiddleware(redis *cache.RedisClient, maxRequests int, window
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		clientIP := c.ClientIP()
-		key := cache.CacheKeys.RateLimit(clientIP)
+		key := redis.GetKeyBuilder().RateLimit(clientIP)
 
 		// Используем Redis для подсчета запросов
 		count, err := redis.IncrementRateLimit(ctx, key, window)
@@ -0,0 +1,148 @@
+// Package access описывает права ролей участников workspace и проверяет
+// их для участника, от имени которого выполняется запрос
+package access
+
+import (
+	"context"
+	"strconv"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// Права на операции API
+const (
+	CreateLinks   = "links:create"
+	ReadLinks     = "links:read"
+	UpdateLinks   = "links:update"
+	DeleteLinks   = "links:delete"
+	ReadAnalytics = "analytics:read"
+	ReadDomains   = "domains:read"
+	ManageDomains = "domains:manage"
+	ReadWorkspace = "workspace:read"
+	// ManageWorkspace - настройки workspace, общие для всех его ссылок
+	ManageWorkspace = "workspace:manage"
+	ManageAPIKeys   = "keys:manage"
+	ReadAudit       = "audit:read"
+	// ManageWebhooks - подписки на события и их доставки. Доставки содержат
+	// данные всех ссылок workspace, поэтому право только у owner и admin
+	ManageWebhooks = "webhooks:manage"
+)
+
+// matrix - права каждой роли. Роль не наследует права других ролей:
+// все права перечислены явно, чтобы матрицу можно было читать построчно
+var matrix = map[string][]string{
+	model.RoleOwner: {
+		CreateLinks, ReadLinks, UpdateLinks, DeleteLinks, ReadAnalytics,
+		ReadDomains, ManageDomains, ReadWorkspace, ManageWorkspace, ManageAPIKeys,
+		ReadAudit, ManageWebhooks,
+	},
+	model.RoleAdmin: {
+		CreateLinks, ReadLinks, UpdateLinks, DeleteLinks, ReadAnalytics,
+		ReadDomains, ManageDomains, ReadWorkspace, ManageWorkspace, ManageAPIKeys,
+		ReadAudit, ManageWebhooks,
+	},
+	model.RoleEditor: {
+		CreateLinks, ReadLinks, UpdateLinks, DeleteLinks, ReadAnalytics,
+		ReadDomains, ReadWorkspace,
+	},
+	model.RoleViewer: {
+		ReadLinks, ReadAnalytics, ReadDomains, ReadWorkspace,
+	},
+}
+
+// rank упорядочивает роли: ключ можно выдать или отозвать только с ролью
+// не выше своей. Так admin не может выдать себе ключ owner
+var rank = map[string]int{
+	model.RoleViewer: 1,
+	model.RoleEditor: 2,
+	model.RoleAdmin:  3,
+	model.RoleOwner:  4,
+}
+
+// Can сообщает, есть ли у роли право permission
+func Can(role, permission string) bool {
+	for _, granted := range matrix[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanGrant сообщает, может ли роль granter выдавать и отзывать ключи с ролью role
+func CanGrant(granter, role string) bool {
+	return rank[granter] > 0 && rank[granter] >= rank[role]
+}
+
+// Principal - участник workspace, от имени которого выполняется запрос
+type Principal struct {
+	WorkspaceID int64
+	Role        string
+	// KeyID - API-ключ запроса, 0 - анонимный запрос
+	KeyID int64
+	// Admin - запрос с токеном администратора сервиса. Такой участник
+	// не работает в workspace и не имеет прав ролей
+	Admin bool
+}
+
+// Authenticated сообщает, что запрос подтвержден API-ключом
+func (p Principal) Authenticated() bool {
+	return p.KeyID != 0
+}
+
+// Actor - кто выполняет запрос, в виде для журнала аудита:
+// admin, api_key:<id> или anonymous
+func (p Principal) Actor() string {
+	switch {
+	case p.Admin:
+		return "admin"
+	case p.Authenticated():
+		return "api_key:" + strconv.FormatInt(p.KeyID, 10)
+	default:
+		return "anonymous"
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст запроса участника p
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает участника запроса
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Check проверяет, что участник запроса работает в workspaceID и его роль
+// дает право permission
+func Check(ctx context.Context, workspaceID int64, permission string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return apperrors.ErrUnauthorized
+	}
+
+	if p.WorkspaceID != workspaceID || !Can(p.Role, permission) {
+		return apperrors.NewPermissionError(p.Role, permission)
+	}
+
+	return nil
+}
+
+// CheckGrant проверяет, что участник запроса может выдавать и отзывать
+// ключи с ролью role (см. CanGrant)
+func CheckGrant(ctx context.Context, role string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return apperrors.ErrUnauthorized
+	}
+
+	if !CanGrant(p.Role, role) {
+		return apperrors.NewPermissionError(p.Role, "grant:"+role)
+	}
+
+	return nil
+}
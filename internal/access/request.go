@@ -0,0 +1,25 @@
+package access
+
+import "context"
+
+// RequestInfo - сведения о запросе для журнала аудита
+type RequestInfo struct {
+	// ID - идентификатор запроса (X-Request-ID)
+	ID string
+	// IP - адрес клиента
+	IP string
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo возвращает контекст запроса со сведениями info
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext возвращает сведения о запросе. Вне HTTP-запроса
+// (фоновые задачи) они пустые
+func RequestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
@@ -0,0 +1,288 @@
+// Package botdetect отличает переходы ботов (превью ссылок в мессенджерах,
+// сканеры безопасности, поисковые краулеры) от переходов людей, чтобы боты
+// не накручивали счетчики переходов
+package botdetect
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/cache"
+)
+
+const (
+	defaultBurstLimit  = 30
+	defaultBurstWindow = 10 * time.Second
+)
+
+// Причины, по которым посетитель признан ботом, кроме сигнатур User-Agent
+const (
+	// ReasonEmptyUserAgent - браузеры всегда передают User-Agent
+	ReasonEmptyUserAgent = "empty_user_agent"
+	// ReasonBurst - слишком частые переходы с одного IP
+	ReasonBurst = "burst"
+	// crawlerIPPrefix - префикс причины для адресов из списка краулеров
+	crawlerIPPrefix = "crawler_ip:"
+)
+
+// signature - подстрока User-Agent (в нижнем регистре) и имя бота
+type signature struct {
+	match string
+	name  string
+}
+
+// signatures проверяются по порядку: конкретные боты раньше общих слов
+// вроде "bot", чтобы в статистике было видно, кто именно открывал ссылку
+var signatures = []signature{
+	// Превью ссылок в мессенджерах и соцсетях
+	{"slackbot", "slackbot"},
+	{"slack-imgproxy", "slackbot"},
+	// Telegram представляется как "TelegramBot (like TwitterBot)"
+	{"telegrambot", "telegrambot"},
+	{"twitterbot", "twitterbot"},
+	{"facebookexternalhit", "facebook"},
+	{"facebookcatalog", "facebook"},
+	{"meta-externalagent", "facebook"},
+	{"linkedinbot", "linkedinbot"},
+	{"discordbot", "discordbot"},
+	{"whatsapp", "whatsapp"},
+	{"skypeuripreview", "skype"},
+	{"vkshare", "vkshare"},
+	{"pinterestbot", "pinterestbot"},
+	{"redditbot", "redditbot"},
+	{"embedly", "embedly"},
+	{"iframely", "iframely"},
+	{"mastodon", "mastodon"},
+	// Поисковые краулеры
+	{"googlebot", "googlebot"},
+	{"google-inspectiontool", "googlebot"},
+	{"bingbot", "bingbot"},
+	{"yandex", "yandexbot"},
+	{"baiduspider", "baiduspider"},
+	{"duckduckbot", "duckduckbot"},
+	{"applebot", "applebot"},
+	{"petalbot", "petalbot"},
+	{"ahrefsbot", "ahrefsbot"},
+	{"semrushbot", "semrushbot"},
+	{"mj12bot", "mj12bot"},
+	{"gptbot", "gptbot"},
+	// Сканеры безопасности и почтовые шлюзы
+	{"urlscan", "urlscan"},
+	{"virustotal", "virustotal"},
+	{"safebrowsing", "safebrowsing"},
+	{"barracuda", "barracuda"},
+	{"proofpoint", "proofpoint"},
+	{"mimecast", "mimecast"},
+	// Автоматические клиенты
+	{"headlesschrome", "headless_browser"},
+	{"phantomjs", "headless_browser"},
+	{"curl/", "curl"},
+	{"wget/", "wget"},
+	{"python-requests", "http_library"},
+	{"python-urllib", "http_library"},
+	{"go-http-client", "http_library"},
+	{"okhttp", "http_library"},
+	{"java/", "http_library"},
+	{"libwww-perl", "http_library"},
+	// Общие признаки: адрес страницы о краулере и слова bot, crawler, spider
+	{"+http", "bot"},
+	{"bot", "bot"},
+	{"crawler", "crawler"},
+	{"spider", "crawler"},
+	{"preview", "link_preview"},
+}
+
+// unfurlers - боты, которые строят карточку ссылки для мессенджеров и
+// соцсетей. Им можно отдать страницу с тегами Open Graph вместо редиректа
+var unfurlers = map[string]bool{
+	"slackbot":     true,
+	"telegrambot":  true,
+	"twitterbot":   true,
+	"facebook":     true,
+	"linkedinbot":  true,
+	"discordbot":   true,
+	"whatsapp":     true,
+	"skype":        true,
+	"vkshare":      true,
+	"pinterestbot": true,
+	"redditbot":    true,
+	"embedly":      true,
+	"iframely":     true,
+	"mastodon":     true,
+	"link_preview": true,
+}
+
+// IsUnfurler сообщает, что User-Agent принадлежит сервису превью ссылок.
+// Поисковые краулеры и сканеры сюда не относятся: им нужен настоящий редирект
+func IsUnfurler(userAgent string) bool {
+	return unfurlers[MatchUserAgent(userAgent)]
+}
+
+// MatchUserAgent возвращает имя бота по сигнатуре User-Agent или пустую
+// строку, если User-Agent похож на браузер
+func MatchUserAgent(userAgent string) string {
+	if strings.TrimSpace(userAgent) == "" {
+		return ReasonEmptyUserAgent
+	}
+
+	// Телефоны Cubot содержат "bot" в названии модели
+	ua := strings.ReplaceAll(strings.ToLower(userAgent), "cubot", "")
+	for _, sig := range signatures {
+		if strings.Contains(ua, sig.match) {
+			return sig.name
+		}
+	}
+	return ""
+}
+
+// IPRange - подсеть краулера из файла
+type IPRange struct {
+	Prefix netip.Prefix
+	Name   string
+}
+
+// ParseIPRanges читает подсети краулеров: по одной на строку в формате
+// "<CIDR или IP> [имя]", строки с # - комментарии
+func ParseIPRanges(r io.Reader) ([]IPRange, error) {
+	var ranges []IPRange
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		prefix, err := parsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		name := "crawler"
+		if len(fields) > 1 {
+			name = fields[1]
+		}
+		ranges = append(ranges, IPRange{Prefix: prefix, Name: name})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// parsePrefix принимает подсеть или отдельный адрес
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Config - настройки Detector
+type Config struct {
+	// IPRangesFile - файл с подсетями краулеров (пусто - не проверяются)
+	IPRangesFile string
+	// Counter - счетчики переходов по IP (Redis или in-memory)
+	Counter cache.RateLimiter
+	// KeyBuilder - построитель ключей счетчиков с namespace приложения
+	KeyBuilder *cache.KeyBuilder
+	// BurstLimit - сколько переходов с одного IP за BurstWindow допустимо
+	// для человека, следующие считаются переходами бота
+	BurstLimit  int
+	BurstWindow time.Duration
+}
+
+// Detector классифицирует посетителя по User-Agent, адресу и частоте
+// переходов
+type Detector struct {
+	ranges      []IPRange
+	counter     cache.RateLimiter
+	keys        *cache.KeyBuilder
+	burstLimit  int64
+	burstWindow time.Duration
+}
+
+// New создает классификатор, незаданные поля Config заменяются значениями
+// по умолчанию. Ошибка возвращается, если не удалось прочитать файл подсетей
+func New(cfg Config) (*Detector, error) {
+	if cfg.Counter == nil {
+		cfg.Counter = cache.NewMemoryRateLimiter()
+	}
+	if cfg.KeyBuilder == nil {
+		cfg.KeyBuilder = cache.DefaultKeyBuilder
+	}
+	if cfg.BurstLimit <= 0 {
+		cfg.BurstLimit = defaultBurstLimit
+	}
+	if cfg.BurstWindow <= 0 {
+		cfg.BurstWindow = defaultBurstWindow
+	}
+
+	d := &Detector{
+		counter:     cfg.Counter,
+		keys:        cfg.KeyBuilder,
+		burstLimit:  int64(cfg.BurstLimit),
+		burstWindow: cfg.BurstWindow,
+	}
+
+	if cfg.IPRangesFile != "" {
+		file, err := os.Open(cfg.IPRangesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open crawler IP ranges: %w", err)
+		}
+		defer file.Close()
+
+		if d.ranges, err = ParseIPRanges(file); err != nil {
+			return nil, fmt.Errorf("failed to parse crawler IP ranges %s: %w", cfg.IPRangesFile, err)
+		}
+	}
+
+	return d, nil
+}
+
+// Detect возвращает причину, по которой посетитель признан ботом, или
+// пустую строку для человека. Каждый переход человека учитывается
+// в счетчике частоты его IP
+func (d *Detector) Detect(ctx context.Context, userAgent, clientIP string) string {
+	if bot := MatchUserAgent(userAgent); bot != "" {
+		return bot
+	}
+
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	for _, r := range d.ranges {
+		if r.Prefix.Contains(addr) {
+			return crawlerIPPrefix + r.Name
+		}
+	}
+
+	count, err := d.counter.IncrementRateLimit(ctx, d.keys.ClickBurst(addr.String()), d.burstWindow)
+	if err != nil {
+		// Без счетчика переход считается переходом человека
+		log.Printf("Failed to count clicks from %s: %v", clientIP, err)
+		return ""
+	}
+	if count > d.burstLimit {
+		return ReasonBurst
+	}
+
+	return ""
+}
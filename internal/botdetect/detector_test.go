@@ -0,0 +1,136 @@
+package botdetect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"", ReasonEmptyUserAgent},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "slackbot"},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", "facebook"},
+		{"TelegramBot (like TwitterBot)", "telegrambot"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "googlebot"},
+		{"curl/8.4.0", "curl"},
+		{"python-requests/2.31.0", "http_library"},
+		{"Mozilla/5.0 (compatible; SomeNewCrawler/1.0)", "crawler"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36", ""},
+		// Телефон Cubot - не бот
+		{"Mozilla/5.0 (Linux; Android 11; CUBOT KINGKONG 5) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MatchUserAgent(tt.userAgent); got != tt.want {
+			t.Errorf("MatchUserAgent(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestIsUnfurler(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"TelegramBot (like TwitterBot)", true},
+		{"WhatsApp/2.23.20.0", true},
+		{"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", false},
+		{"curl/8.4.0", false},
+		{"", false},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsUnfurler(tt.userAgent); got != tt.want {
+			t.Errorf("IsUnfurler(%q) = %v, want %v", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestParseIPRanges(t *testing.T) {
+	input := `# Краулеры
+66.249.64.0/19 googlebot
+157.55.39.1 bingbot   # отдельный адрес
+
+2001:4860:4801::/48
+`
+
+	ranges, err := ParseIPRanges(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseIPRanges() unexpected error = %v", err)
+	}
+
+	want := []string{"66.249.64.0/19 googlebot", "157.55.39.1/32 bingbot", "2001:4860:4801::/48 crawler"}
+	if len(ranges) != len(want) {
+		t.Fatalf("ParseIPRanges() = %v, want %v", ranges, want)
+	}
+	for i, r := range ranges {
+		if got := r.Prefix.String() + " " + r.Name; got != want[i] {
+			t.Errorf("ParseIPRanges()[%d] = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if _, err := ParseIPRanges(strings.NewReader("not-an-ip\n")); err == nil {
+		t.Error("ParseIPRanges() expected error for invalid address")
+	}
+}
+
+func TestDetector_Detect(t *testing.T) {
+	ctx := context.Background()
+	browser := "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+	path := filepath.Join(t.TempDir(), "crawlers.txt")
+	if err := os.WriteFile(path, []byte("66.249.64.0/19 googlebot\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	detector, err := New(Config{IPRangesFile: path, BurstLimit: 3})
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	t.Run("user agent", func(t *testing.T) {
+		if got := detector.Detect(ctx, "Twitterbot/1.0", "192.0.2.1"); got != "twitterbot" {
+			t.Errorf("Detect() = %q, want twitterbot", got)
+		}
+	})
+
+	t.Run("crawler ip", func(t *testing.T) {
+		if got := detector.Detect(ctx, browser, "66.249.66.1"); got != "crawler_ip:googlebot" {
+			t.Errorf("Detect() = %q, want crawler_ip:googlebot", got)
+		}
+		// IPv4 в IPv6-представлении тоже находится в подсети
+		if got := detector.Detect(ctx, browser, "::ffff:66.249.66.1"); got != "crawler_ip:googlebot" {
+			t.Errorf("Detect() mapped = %q, want crawler_ip:googlebot", got)
+		}
+	})
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if got := detector.Detect(ctx, browser, "198.51.100.7"); got != "" {
+				t.Fatalf("Detect() click %d = %q, want human", i+1, got)
+			}
+		}
+		if got := detector.Detect(ctx, browser, "198.51.100.7"); got != ReasonBurst {
+			t.Errorf("Detect() = %q, want %s", got, ReasonBurst)
+		}
+		// Другой адрес не затронут
+		if got := detector.Detect(ctx, browser, "198.51.100.8"); got != "" {
+			t.Errorf("Detect() other ip = %q, want human", got)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := New(Config{IPRangesFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+			t.Error("New() expected error for missing file")
+		}
+	})
+}
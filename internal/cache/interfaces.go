@@ -33,6 +33,18 @@ type CounterCache interface {
 // RateLimiter - интерфейс для rate limiting
 type RateLimiter interface {
 	IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error)
+	// GetRateLimit возвращает значение счетчика без увеличения
+	GetRateLimit(ctx context.Context, key string) (int64, error)
+}
+
+// PubSub - рассылка сообщений всем подписчикам канала, в том числе
+// в других экземплярах сервиса. Доставка не гарантируется: сообщения,
+// отправленные без подписчиков или медленному подписчику, теряются
+type PubSub interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	// Subscribe подписывается на канал. Канал сообщений закрывается
+	// после отмены ctx
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
 }
 
 // CacheManager - полный интерфейс кэша (композиция интерфейсов)
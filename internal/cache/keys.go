@@ -3,18 +3,25 @@ package cache
 import (
 	"crypto/md5"
 	"fmt"
+	"strconv"
 )
 
 // KeyPrefix - префиксы для разных типов ключей
 type KeyPrefix string
 
 const (
-	PrefixURL       KeyPrefix = "url"     // url:shortCode
+	PrefixURL       KeyPrefix = "url"     // ws:ID:url:shortCode
+	PrefixRoute     KeyPrefix = "route"   // route:shortCode -> ID workspace ссылки
 	PrefixShort     KeyPrefix = "short"   // short:hash(originalURL)
 	PrefixClicks    KeyPrefix = "clicks"  // clicks:shortCode
 	PrefixRateLimit KeyPrefix = "rate"    // rate:clientIP
 	PrefixSession   KeyPrefix = "session" // session:sessionID
 	PrefixTemp      KeyPrefix = "tmp"     // tmp:uniqueID
+	PrefixPassword  KeyPrefix = "pwd"     // pwd:shortCode:clientIP
+	PrefixQuota     KeyPrefix = "quota"   // quota:resource:period
+	PrefixStream    KeyPrefix = "stream"  // stream:name
+	PrefixLive      KeyPrefix = "live"    // live:clicks (канал pub/sub)
+	PrefixUnique    KeyPrefix = "unique"  // unique:urlID[:day] (HyperLogLog)
 )
 
 // KeyBuilder - построитель ключей кэша
@@ -27,6 +34,24 @@ func NewKeyBuilder(namespace string) *KeyBuilder {
 	return &KeyBuilder{namespace: namespace}
 }
 
+// WithNamespace возвращает построитель для вложенного namespace, например
+// для отдельного домена: "brnd.link:url:abc123". Пустой namespace
+// возвращает текущий построитель
+func (k *KeyBuilder) WithNamespace(namespace string) *KeyBuilder {
+	if namespace == "" {
+		return k
+	}
+	if k.namespace != "" {
+		namespace = k.namespace + ":" + namespace
+	}
+	return NewKeyBuilder(namespace)
+}
+
+// ForWorkspace возвращает построитель для namespace workspace (ws:ID)
+func (k *KeyBuilder) ForWorkspace(workspaceID int64) *KeyBuilder {
+	return k.WithNamespace("ws:" + strconv.FormatInt(workspaceID, 10))
+}
+
 // Build создает ключ с префиксом и опциональным namespace
 func (k *KeyBuilder) Build(prefix KeyPrefix, parts ...string) string {
 	key := string(prefix)
@@ -47,6 +72,12 @@ func (k *KeyBuilder) URL(shortCode string) string {
 	return k.Build(PrefixURL, shortCode)
 }
 
+// Route создает ключ, по которому редирект находит workspace ссылки, чтобы
+// прочитать ее запись из namespace этого workspace
+func (k *KeyBuilder) Route(shortCode string) string {
+	return k.Build(PrefixRoute, shortCode)
+}
+
 // ShortCode создает ключ для обратного маппинга (originalURL -> shortCode)
 func (k *KeyBuilder) ShortCode(originalURL string) string {
 	hash := hashURL(originalURL)
@@ -63,6 +94,47 @@ func (k *KeyBuilder) RateLimit(clientIP string) string {
 	return k.Build(PrefixRateLimit, clientIP)
 }
 
+// ClickBurst создает ключ счетчика переходов с одного IP (выявление ботов)
+func (k *KeyBuilder) ClickBurst(clientIP string) string {
+	return k.Build(PrefixRateLimit, "clicks", clientIP)
+}
+
+// PasswordAttempts создает ключ для счетчика попыток ввода пароля ссылки
+// с одного IP
+func (k *KeyBuilder) PasswordAttempts(shortCode, clientIP string) string {
+	return k.Build(PrefixPassword, shortCode, clientIP)
+}
+
+// LinkPasswordAttempts создает ключ для счетчика попыток ввода пароля
+// ссылки со всех IP
+func (k *KeyBuilder) LinkPasswordAttempts(shortCode string) string {
+	return k.Build(PrefixPassword, shortCode)
+}
+
+// Quota создает ключ счетчика использования квоты за период (например, 2026-10)
+func (k *KeyBuilder) Quota(resource, period string) string {
+	return k.Build(PrefixQuota, resource, period)
+}
+
+// Stream создает ключ Redis Stream (например, stream:events)
+func (k *KeyBuilder) Stream(name string) string {
+	return k.Build(PrefixStream, name)
+}
+
+// LiveClicks создает имя канала pub/sub с переходами для SSE
+func (k *KeyBuilder) LiveClicks() string {
+	return k.Build(PrefixLive, "clicks")
+}
+
+// UniqueVisitors создает ключ HyperLogLog посетителей ссылки за день
+// (day в формате 2006-01-02) или за все время (day == "")
+func (k *KeyBuilder) UniqueVisitors(urlID int64, day string) string {
+	if day == "" {
+		return k.Build(PrefixUnique, strconv.FormatInt(urlID, 10))
+	}
+	return k.Build(PrefixUnique, strconv.FormatInt(urlID, 10), day)
+}
+
 // Session создает ключ для сессии
 func (k *KeyBuilder) Session(sessionID string) string {
 	return k.Build(PrefixSession, sessionID)
@@ -92,13 +164,15 @@ var DefaultKeyBuilder = NewKeyBuilder("")
 
 // Shortcuts для обратной совместимости
 var CacheKeys = struct {
-	URL       func(string) string
-	ShortCode func(string) string
-	Clicks    func(string) string
-	RateLimit func(string) string
+	URL              func(string) string
+	ShortCode        func(string) string
+	Clicks           func(string) string
+	RateLimit        func(string) string
+	PasswordAttempts func(string, string) string
 }{
-	URL:       DefaultKeyBuilder.URL,
-	ShortCode: DefaultKeyBuilder.ShortCode,
-	Clicks:    DefaultKeyBuilder.Clicks,
-	RateLimit: DefaultKeyBuilder.RateLimit,
+	URL:              DefaultKeyBuilder.URL,
+	ShortCode:        DefaultKeyBuilder.ShortCode,
+	Clicks:           DefaultKeyBuilder.Clicks,
+	RateLimit:        DefaultKeyBuilder.RateLimit,
+	PasswordAttempts: DefaultKeyBuilder.PasswordAttempts,
 }
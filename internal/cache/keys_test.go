@@ -0,0 +1,25 @@
+package cache
+
+import "testing"
+
+func TestKeyBuilder_Namespaces(t *testing.T) {
+	keys := NewKeyBuilder("")
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"link of main domain", keys.ForWorkspace(7).URL("abc123"), "ws:7:url:abc123"},
+		{"link of branded domain", keys.ForWorkspace(7).WithNamespace("brnd.link").URL("abc123"), "ws:7:brnd.link:url:abc123"},
+		{"route of main domain", keys.Route("abc123"), "route:abc123"},
+		{"route of branded domain", keys.WithNamespace("brnd.link").Route("abc123"), "brnd.link:route:abc123"},
+		{"empty namespace", keys.WithNamespace("").URL("abc123"), "url:abc123"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: key = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
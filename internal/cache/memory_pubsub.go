@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+var _ PubSub = (*MemoryPubSub)(nil)
+
+// MemoryPubSub - in-memory реализация PubSub для работы без Redis.
+// Сообщения получают только подписчики этого экземпляра сервиса
+type MemoryPubSub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+// NewMemoryPubSub создает новый in-memory pub/sub
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{
+		subscribers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+// Publish отправляет сообщение подписчикам канала. Подписчик с заполненным
+// буфером сообщение не получает, как и медленный подписчик Redis
+func (m *MemoryPubSub) Publish(ctx context.Context, channel string, message []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for messages := range m.subscribers[channel] {
+		select {
+		case messages <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe подписывается на канал до отмены ctx
+func (m *MemoryPubSub) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	messages := make(chan []byte, pubSubBufferSize)
+
+	m.mu.Lock()
+	if m.subscribers[channel] == nil {
+		m.subscribers[channel] = make(map[chan []byte]struct{})
+	}
+	m.subscribers[channel][messages] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subscribers[channel], messages)
+		if len(m.subscribers[channel]) == 0 {
+			delete(m.subscribers, channel)
+		}
+		close(messages)
+	}()
+
+	return messages, nil
+}
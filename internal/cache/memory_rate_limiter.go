@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ RateLimiter = (*MemoryRateLimiter)(nil)
+
+// memorySweepInterval - как часто удаляются счетчики с истекшим окном
+const memorySweepInterval = time.Minute
+
+// MemoryRateLimiter - in-memory реализация RateLimiter для работы без Redis.
+// Считает запросы в фиксированном окне, как и RedisClient.IncrementRateLimit
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	counters  map[string]*memoryCounter
+	nextSweep time.Time
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// NewMemoryRateLimiter создает новый in-memory rate limiter
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		counters: make(map[string]*memoryCounter),
+	}
+}
+
+// IncrementRateLimit увеличивает счетчик ключа. Окно отсчитывается от
+// первого запроса и не продлевается следующими
+func (m *MemoryRateLimiter) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	if key == "" {
+		return 0, NewCacheError("increment", key, ErrInvalidCacheKey)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.After(m.nextSweep) {
+		m.evictExpired(now)
+		m.nextSweep = now.Add(memorySweepInterval)
+	}
+
+	counter, ok := m.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		counter = &memoryCounter{expiresAt: now.Add(window)}
+		m.counters[key] = counter
+	}
+
+	counter.count++
+
+	return counter.count, nil
+}
+
+// GetRateLimit возвращает текущее значение счетчика (0, если окно истекло)
+func (m *MemoryRateLimiter) GetRateLimit(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter, ok := m.counters[key]
+	if !ok || time.Now().After(counter.expiresAt) {
+		return 0, nil
+	}
+	return counter.count, nil
+}
+
+// evictExpired удаляет счетчики с истекшим окном. Вызывается не чаще раза
+// в memorySweepInterval: истекший счетчик и так не учитывается при чтении
+func (m *MemoryRateLimiter) evictExpired(now time.Time) {
+	for key, counter := range m.counters {
+		if now.After(counter.expiresAt) {
+			delete(m.counters, key)
+		}
+	}
+}
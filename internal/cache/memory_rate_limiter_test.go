@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter_FixedWindow(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+	ctx := context.Background()
+	window := 100 * time.Millisecond
+
+	// Запросы через 0, 40 и 80 мс, затем проверка через 120 мс: окно от
+	// первого запроса истекло, от последнего - еще нет
+	for want := int64(1); want <= 3; want++ {
+		if got, _ := limiter.IncrementRateLimit(ctx, "key", window); got != want {
+			t.Fatalf("IncrementRateLimit() = %d, want %d", got, want)
+		}
+		time.Sleep(window * 2 / 5)
+	}
+
+	// Запросы внутри окна его не продлевают: счет начинается заново
+	if got, _ := limiter.IncrementRateLimit(ctx, "key", window); got != 1 {
+		t.Errorf("IncrementRateLimit() after window = %d, want 1", got)
+	}
+	if got, _ := limiter.GetRateLimit(ctx, "other"); got != 0 {
+		t.Errorf("GetRateLimit() of unknown key = %d, want 0", got)
+	}
+	if _, err := limiter.IncrementRateLimit(ctx, "", window); err == nil {
+		t.Error("IncrementRateLimit() with empty key should fail")
+	}
+}
@@ -15,8 +15,12 @@ var (
 	_ CounterCache = (*RedisClient)(nil)
 	_ RateLimiter  = (*RedisClient)(nil)
 	_ CacheManager = (*RedisClient)(nil)
+	_ PubSub       = (*RedisClient)(nil)
 )
 
+// pubSubBufferSize - сколько сообщений канала подписки ждут чтения
+const pubSubBufferSize = 256
+
 // RedisClient - реализация кэша на основе Redis
 type RedisClient struct {
 	client     *redis.Client
@@ -242,13 +246,14 @@ func (r *RedisClient) SetClickCount(ctx context.Context, shortCode string, count
 
 // === Реализация интерфейса RateLimiter ===
 
-// IncrementRateLimit увеличивает счетчик для rate limiting
+// IncrementRateLimit увеличивает счетчик для rate limiting. Окно
+// фиксированное: TTL задается только новому ключу (EXPIRE NX, Redis 7+)
 func (r *RedisClient) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
-	// Используем pipeline для атомарности
-	pipe := r.client.Pipeline()
+	// MULTI/EXEC: ключ не останется без TTL между командами
+	pipe := r.client.TxPipeline()
 
 	incr := pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, window)
+	pipe.ExpireNX(ctx, key, window)
 
 	_, err := pipe.Exec(ctx)
 	if err != nil {
@@ -258,6 +263,63 @@ func (r *RedisClient) IncrementRateLimit(ctx context.Context, key string, window
 	return incr.Val(), nil
 }
 
+// GetRateLimit возвращает текущее значение счетчика (0, если его нет)
+func (r *RedisClient) GetRateLimit(ctx context.Context, key string) (int64, error) {
+	result, err := r.client.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, NewCacheError("get", key, err)
+	}
+
+	return result, nil
+}
+
+// === HyperLogLog ===
+
+// AddToHyperLogLog добавляет элементы в HyperLogLog ключа. ttl > 0 задает
+// время жизни ключа
+func (r *RedisClient) AddToHyperLogLog(ctx context.Context, key string, ttl time.Duration, elements ...string) error {
+	values := make([]interface{}, len(elements))
+	for i, element := range elements {
+		values[i] = element
+	}
+
+	pipe := r.client.Pipeline()
+	pipe.PFAdd(ctx, key, values...)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return NewCacheError("pfadd", key, err)
+	}
+
+	return nil
+}
+
+// CountHyperLogLogs возвращает приблизительное число элементов каждого
+// ключа (0 для отсутствующих) за один запрос
+func (r *RedisClient) CountHyperLogLogs(ctx context.Context, keys []string) ([]int64, error) {
+	pipe := r.client.Pipeline()
+	counts := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		counts[i] = pipe.PFCount(ctx, key)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, NewCacheError("pfcount", fmt.Sprint(keys), err)
+	}
+
+	result := make([]int64, len(keys))
+	for i, count := range counts {
+		result[i] = count.Val()
+	}
+
+	return result, nil
+}
+
 // === Реализация интерфейса CacheManager ===
 
 // FlushCache очищает весь кэш (использовать осторожно!)
@@ -372,7 +434,93 @@ func (r *RedisClient) Info(ctx context.Context) (map[string]string, error) {
 	return result, nil
 }
 
+// AddToStream добавляет запись в Redis Stream. maxLen > 0 ограничивает
+// длину потока приблизительно (MAXLEN ~), старые записи вытесняются
+func (r *RedisClient) AddToStream(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	if stream == "" {
+		return "", NewCacheError("xadd", stream, ErrInvalidCacheKey)
+	}
+
+	id, err := r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: values,
+	}).Result()
+	if err != nil {
+		return "", NewCacheError("xadd", stream, err)
+	}
+
+	return id, nil
+}
+
+// Publish отправляет сообщение подписчикам канала
+func (r *RedisClient) Publish(ctx context.Context, channel string, message []byte) error {
+	if err := r.client.Publish(ctx, channel, message).Err(); err != nil {
+		return NewCacheError("publish", channel, err)
+	}
+	return nil
+}
+
+// Subscribe подписывается на канал отдельным соединением. При обрыве
+// соединения go-redis переподключается и восстанавливает подписку
+func (r *RedisClient) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	pubsub := r.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, NewCacheError("subscribe", channel, err)
+	}
+
+	messages := make(chan []byte, pubSubBufferSize)
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+
+		incoming := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-incoming:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// DefaultTTL возвращает TTL кэша по умолчанию
+func (r *RedisClient) DefaultTTL() time.Duration {
+	return r.ttl
+}
+
 // GetKeyBuilder возвращает построитель ключей
 func (r *RedisClient) GetKeyBuilder() *KeyBuilder {
 	return r.keyBuilder
 }
+
+// WithNamespace возвращает клиент с тем же соединением, ключи которого
+// (в том числе счетчиков кликов) строятся во вложенном namespace
+func (r *RedisClient) WithNamespace(namespace string) *RedisClient {
+	if namespace == "" {
+		return r
+	}
+	scoped := *r
+	scoped.keyBuilder = r.keyBuilder.WithNamespace(namespace)
+	return &scoped
+}
+
+// ForWorkspace возвращает клиент с ключами в namespace workspace (ws:ID)
+func (r *RedisClient) ForWorkspace(workspaceID int64) *RedisClient {
+	scoped := *r
+	scoped.keyBuilder = r.keyBuilder.ForWorkspace(workspaceID)
+	return &scoped
+}
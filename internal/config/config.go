@@ -11,6 +11,8 @@ type Config struct {
 	Database DatabaseConfig `mapstructure:"database"`
 	App      AppConfig      `mapstructure:"app"`
 	Redis    RedisConfig    `mapstructure:"redis"`
+	Outbox   OutboxConfig   `mapstructure:"outbox"`
+	Health   HealthConfig   `mapstructure:"health"`
 }
 
 type ServerConfig struct {
@@ -32,6 +34,46 @@ type AppConfig struct {
 	MaxRetries      int      `mapstructure:"max_retries"`
 	Environment     string   `mapstructure:"environment"`
 	AllowedOrigins  []string `mapstructure:"allowed_origins"`
+
+	// Защищенные паролем ссылки
+	SecretKey               string `mapstructure:"secret_key"`
+	UnlockTTL               int    `mapstructure:"unlock_ttl"` // в секундах
+	PasswordMaxAttempts     int    `mapstructure:"password_max_attempts"`
+	PasswordMaxLinkAttempts int    `mapstructure:"password_max_link_attempts"`
+	PasswordAttemptWindow   int    `mapstructure:"password_attempt_window"` // в секундах
+
+	// ComingSoonURL - куда вести посетителей еще не активированных ссылок
+	ComingSoonURL string `mapstructure:"coming_soon_url"`
+	// PreviewMode - страница подтверждения перед редиректом для всех ссылок
+	PreviewMode bool `mapstructure:"preview_mode"`
+
+	// Редиректы: тип по умолчанию (301, 302, 307, 308, meta, js) и время
+	// кэширования постоянных редиректов браузерами и CDN
+	DefaultRedirectType     string `mapstructure:"default_redirect_type"`
+	PermanentRedirectMaxAge int    `mapstructure:"permanent_redirect_max_age"` // в секундах
+
+	// GeoIPDatabase - путь к базе MaxMind (GeoLite2-City.mmdb или Country).
+	// Пусто - гео-правила не срабатывают, страна в статистике не определяется
+	GeoIPDatabase string `mapstructure:"geoip_database"`
+
+	// Определение ботов: файл подсетей краулеров (пусто - не проверяются)
+	// и сколько переходов с одного IP за окно допустимо для человека
+	BotIPRanges    string `mapstructure:"bot_ip_ranges"`
+	BotBurstLimit  int    `mapstructure:"bot_burst_limit"`
+	BotBurstWindow int    `mapstructure:"bot_burst_window"` // в секундах
+
+	// Карточки страниц назначения (Open Graph): загрузка в фоне после
+	// создания ссылки, время на страницу и сколько байт страницы читать
+	LinkPreviews        bool  `mapstructure:"link_previews"`
+	LinkPreviewTimeout  int   `mapstructure:"link_preview_timeout"` // в секундах
+	LinkPreviewMaxBytes int64 `mapstructure:"link_preview_max_bytes"`
+
+	// AdminToken - токен административного API (создание workspaces, квоты).
+	// Пусто - административный API отключен
+	AdminToken string `mapstructure:"admin_token"`
+	// RequireAPIKey запрещает анонимные запросы к API (иначе они относятся
+	// к workspace по умолчанию)
+	RequireAPIKey bool `mapstructure:"require_api_key"`
 }
 
 type RedisConfig struct {
@@ -43,6 +85,38 @@ type RedisConfig struct {
 	MinIdleConns int    `mapstructure:"min_idle_conns"`
 	MaxRetries   int    `mapstructure:"max_retry"`
 	CacheTTL     int    `mapstructure:"cache_ttl"`
+	// Namespace - префикс всех ключей сервиса (общий Redis для нескольких окружений)
+	Namespace string `mapstructure:"namespace"`
+}
+
+// OutboxConfig - публикация доменных событий (создание, изменение,
+// удаление ссылок и переходы) из outbox
+type OutboxConfig struct {
+	// Sinks - приемники событий: stdout, file, http, redis_stream.
+	// Подписки webhooks получают события всегда
+	Sinks        []string `mapstructure:"sinks"`
+	FilePath     string   `mapstructure:"file_path"`
+	HTTPURL      string   `mapstructure:"http_url"`
+	RedisStream  string   `mapstructure:"redis_stream"`
+	StreamMaxLen int64    `mapstructure:"stream_max_len"`
+	BatchSize    int      `mapstructure:"batch_size"`
+	PollInterval int      `mapstructure:"poll_interval"` // в миллисекундах
+	Retention    int      `mapstructure:"retention"`     // в часах
+}
+
+// HealthConfig - периодическая проверка доступности страниц назначения
+type HealthConfig struct {
+	Enabled         bool `mapstructure:"enabled"`
+	RecheckInterval int  `mapstructure:"recheck_interval"` // в минутах
+	Timeout         int  `mapstructure:"timeout"`          // в секундах
+	// HostInterval - пауза между запросами к одному хосту
+	HostInterval int `mapstructure:"host_interval"` // в миллисекундах
+	// FailureThreshold - неудачных проверок подряд до отметки "недоступна"
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	BatchSize        int `mapstructure:"batch_size"`
+	Workers          int `mapstructure:"workers"`
+	// ExcludedHosts - хосты (с поддоменами), которые не проверяются
+	ExcludedHosts []string `mapstructure:"excluded_hosts"`
 }
 
 func Load() (*Config, error) {
@@ -66,6 +140,24 @@ func Load() (*Config, error) {
 	viper.SetDefault("app.max_retries", 5)
 	viper.SetDefault("app.environment", "development")
 	viper.SetDefault("app.allowed_origins", []string{"*"})
+	viper.SetDefault("app.secret_key", "")
+	viper.SetDefault("app.unlock_ttl", 1800)
+	viper.SetDefault("app.password_max_attempts", 5)
+	viper.SetDefault("app.password_max_link_attempts", 50)
+	viper.SetDefault("app.password_attempt_window", 900)
+	viper.SetDefault("app.coming_soon_url", "")
+	viper.SetDefault("app.preview_mode", false)
+	viper.SetDefault("app.default_redirect_type", "302")
+	viper.SetDefault("app.permanent_redirect_max_age", 86400)
+	viper.SetDefault("app.geoip_database", "")
+	viper.SetDefault("app.bot_ip_ranges", "")
+	viper.SetDefault("app.bot_burst_limit", 30)
+	viper.SetDefault("app.bot_burst_window", 10)
+	viper.SetDefault("app.link_previews", true)
+	viper.SetDefault("app.link_preview_timeout", 5)
+	viper.SetDefault("app.link_preview_max_bytes", 524288)
+	viper.SetDefault("app.admin_token", "")
+	viper.SetDefault("app.require_api_key", false)
 
 	// Redis defaults
 	viper.SetDefault("redis.host", "localhost")
@@ -76,6 +168,27 @@ func Load() (*Config, error) {
 	viper.SetDefault("redis.min_idle_conns", 5)
 	viper.SetDefault("redis.max_retry", 3)
 	viper.SetDefault("redis.cache_ttl", 3600)
+	viper.SetDefault("redis.namespace", "")
+
+	// Outbox defaults
+	viper.SetDefault("outbox.sinks", []string{})
+	viper.SetDefault("outbox.file_path", "events.ndjson")
+	viper.SetDefault("outbox.http_url", "")
+	viper.SetDefault("outbox.redis_stream", "events")
+	viper.SetDefault("outbox.stream_max_len", 100000)
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.poll_interval", 1000)
+	viper.SetDefault("outbox.retention", 168)
+
+	// Health check defaults
+	viper.SetDefault("health.enabled", true)
+	viper.SetDefault("health.recheck_interval", 360)
+	viper.SetDefault("health.timeout", 10)
+	viper.SetDefault("health.host_interval", 1000)
+	viper.SetDefault("health.failure_threshold", 3)
+	viper.SetDefault("health.batch_size", 100)
+	viper.SetDefault("health.workers", 4)
+	viper.SetDefault("health.excluded_hosts", []string{})
 
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("URLSHORT")
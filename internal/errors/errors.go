@@ -10,8 +10,97 @@ var (
 	ErrURLAlreadyExists = errors.New("URL already exists")
 	ErrInvalidURL       = errors.New("invalid URL")
 	ErrInvalidShortCode = errors.New("invalid short code")
+
+	// ErrInvalidPassword - неверный пароль защищенной ссылки
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrTooManyAttempts - превышен лимит попыток ввода пароля
+	ErrTooManyAttempts = errors.New("too many attempts")
+
+	// ErrURLExhausted - исчерпан лимит переходов по ссылке
+	ErrURLExhausted = errors.New("URL click limit reached")
+
+	// ErrURLNotYetActive - время активации ссылки еще не наступило
+	ErrURLNotYetActive = errors.New("URL is not active yet")
+	// ErrURLExpired - окно активности ссылки закончилось
+	ErrURLExpired = errors.New("URL has expired")
+	// ErrURLDisabled - ссылка отключена участником workspace
+	ErrURLDisabled = errors.New("URL is disabled")
+	// ErrURLSuspended - ссылка приостановлена или заблокирована модерацией
+	ErrURLSuspended = errors.New("URL is suspended by moderation")
+	// ErrBanned - автор (workspace или посетитель) заблокирован модерацией
+	ErrBanned = errors.New("banned by moderation")
+	// ErrURLConflict - ссылку изменили параллельно между чтением и записью
+	ErrURLConflict = errors.New("URL was modified concurrently")
+	// ErrVersionNotFound - у ссылки нет ревизии с таким номером
+	ErrVersionNotFound = errors.New("link version not found")
+
+	// ErrForbidden - операция доступна только владельцу ссылки
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrDomainNotFound - брендированный домен не зарегистрирован
+	ErrDomainNotFound = errors.New("domain not found")
+
+	// ErrUnauthorized - API-ключ не передан или недействителен
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrWorkspaceNotFound - workspace не существует
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	// ErrAPIKeyNotFound - API-ключ не найден в workspace
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrQuotaExceeded - исчерпана квота workspace (см. QuotaError)
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrPermissionDenied - роли не хватает прав на операцию (см. PermissionError)
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrWebhookNotFound - подписки нет в workspace
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound - доставки события нет у подписки
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
 )
 
+// PermissionError - роли участника workspace не хватает права Permission
+type PermissionError struct {
+	Role       string
+	Permission string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("role %s has no permission %s", e.Role, e.Permission)
+}
+
+// Is позволяет проверять права через errors.Is(err, ErrPermissionDenied)
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrPermissionDenied
+}
+
+func NewPermissionError(role, permission string) *PermissionError {
+	return &PermissionError{
+		Role:       role,
+		Permission: permission,
+	}
+}
+
+// QuotaError - исчерпана квота workspace на ресурс (links, clicks, api_requests)
+type QuotaError struct {
+	Resource string
+	Limit    int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("workspace quota exceeded for %s (limit %d)", e.Resource, e.Limit)
+}
+
+// Is позволяет проверять квоты через errors.Is(err, ErrQuotaExceeded)
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+func NewQuotaError(resource string, limit int64) *QuotaError {
+	return &QuotaError{
+		Resource: resource,
+		Limit:    limit,
+	}
+}
+
 type ValidationError struct {
 	Field   string
 	Message string
@@ -62,6 +151,9 @@ var (
 
 	// ErrShortCodeExists — короткий код уже существует (конфликт уникальности)
 	ErrShortCodeExists = NewBusinessError("SHORT_CODE_EXISTS", "short code already exists", nil)
+
+	// ErrDomainExists — домен уже зарегистрирован
+	ErrDomainExists = NewBusinessError("DOMAIN_EXISTS", "domain already exists", nil)
 )
 
 // IsValidationError проверяет является ли ошибка ошибкой валидации
@@ -0,0 +1,181 @@
+// Package events - приемники доменных событий из outbox: stdout, файл NDJSON,
+// HTTP endpoint и Redis Streams. Каждый приемник получает тело события
+// (WebhookEvent в JSON) и не знает о его содержимом
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	// maxErrorBody - сколько байт ответа HTTP приемника попадает в ошибку
+	maxErrorBody = 512
+)
+
+// WriterSink пишет события в io.Writer по одному JSON на строку (NDJSON)
+type WriterSink struct {
+	name string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink создает приемник, пишущий в w
+func NewWriterSink(name string, w io.Writer) *WriterSink {
+	return &WriterSink{name: name, w: w}
+}
+
+// NewStdoutSink создает приемник, печатающий события в stdout
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink("stdout", os.Stdout)
+}
+
+// FileSink дописывает события в файл NDJSON
+type FileSink struct {
+	*WriterSink
+	file *os.File
+}
+
+// OpenFileSink открывает (или создает) файл для дописывания событий
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open event file: %w", err)
+	}
+	return &FileSink{WriterSink: NewWriterSink("file", file), file: file}, nil
+}
+
+// Close закрывает файл
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// Name возвращает имя приемника
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+// Publish записывает пачку одним вызовом Write, чтобы строки разных пачек
+// не перемешивались
+func (s *WriterSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	var buf bytes.Buffer
+	for i := range events {
+		if err := json.Compact(&buf, events[i].Payload); err != nil {
+			return fmt.Errorf("event %s: %w", events[i].EventID, err)
+		}
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+// HTTPSink отправляет пачку событий POST-запросом: тело - JSON массив
+// событий. Любой ответ кроме 2xx считается ошибкой, пачка будет отправлена
+// повторно
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink создает HTTP приемник. client == nil - клиент с таймаутом
+// по умолчанию
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	return &HTTPSink{url: url, client: client}
+}
+
+// Name возвращает имя приемника
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+// Publish отправляет события одним запросом
+func (s *HTTPSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	batch := make([]json.RawMessage, len(events))
+	for i := range events {
+		batch[i] = events[i].Payload
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-url-shortener-events/1.0")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// StreamWriter - запись в Redis Stream (реализуется cache.RedisClient)
+type StreamWriter interface {
+	AddToStream(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error)
+}
+
+// StreamSink добавляет каждое событие отдельной записью в Redis Stream.
+// Поля записи: id, type, workspace_id и payload (тело события)
+type StreamSink struct {
+	redis  StreamWriter
+	stream string
+	maxLen int64
+}
+
+// NewStreamSink создает приемник Redis Streams. maxLen > 0 ограничивает
+// длину потока
+func NewStreamSink(redis StreamWriter, stream string, maxLen int64) *StreamSink {
+	return &StreamSink{redis: redis, stream: stream, maxLen: maxLen}
+}
+
+// Name возвращает имя приемника
+func (s *StreamSink) Name() string {
+	return "redis_stream"
+}
+
+// Publish добавляет события в поток по порядку
+func (s *StreamSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	for i := range events {
+		event := &events[i]
+		_, err := s.redis.AddToStream(ctx, s.stream, s.maxLen, map[string]interface{}{
+			"id":           event.EventID,
+			"type":         event.Type,
+			"workspace_id": strconv.FormatInt(event.WorkspaceID, 10),
+			"payload":      string(event.Payload),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
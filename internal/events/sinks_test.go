@@ -0,0 +1,92 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+func testEvents() []model.OutboxEvent {
+	return []model.OutboxEvent{
+		{EventID: "evt_1", WorkspaceID: 1, Type: model.EventLinkCreated, Payload: json.RawMessage(`{"id": "evt_1", "type": "link.created"}`)},
+		{EventID: "evt_2", WorkspaceID: 1, Type: model.EventLinkClicked, Payload: json.RawMessage(`{"id": "evt_2", "type": "link.clicked"}`)},
+	}
+}
+
+func TestWriterSink_WritesNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink("test", &buf)
+
+	if err := sink.Publish(context.Background(), testEvents()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	want := `{"id":"evt_1","type":"link.created"}` + "\n" + `{"id":"evt_2","type":"link.clicked"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestHTTPSink_PostsBatch(t *testing.T) {
+	var got []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("body is not a JSON array: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	if err := NewHTTPSink(server.URL, nil).Publish(context.Background(), testEvents()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(got) != 2 || got[0]["id"] != "evt_1" || got[1]["id"] != "evt_2" {
+		t.Errorf("received = %v", got)
+	}
+}
+
+func TestHTTPSink_Non2xxIsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := NewHTTPSink(server.URL, nil).Publish(context.Background(), testEvents())
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Publish() error = %v, want status 503", err)
+	}
+}
+
+type fakeStream struct {
+	entries []map[string]interface{}
+}
+
+func (f *fakeStream) AddToStream(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	f.entries = append(f.entries, values)
+	return "0-1", nil
+}
+
+func TestStreamSink_AddsEntryPerEvent(t *testing.T) {
+	stream := &fakeStream{}
+	if err := NewStreamSink(stream, "events", 1000).Publish(context.Background(), testEvents()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if len(stream.entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(stream.entries))
+	}
+	if stream.entries[1]["id"] != "evt_2" || stream.entries[1]["type"] != model.EventLinkClicked || stream.entries[1]["workspace_id"] != "1" {
+		t.Errorf("entry = %v", stream.entries[1])
+	}
+}
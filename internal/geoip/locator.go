@@ -0,0 +1,168 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// reloadDelay - пауза перед перечитыванием файла после изменения: при
+// копировании базы приходит серия событий записи, читать нужно готовый файл
+const reloadDelay = time.Second
+
+// Locator определяет местоположение по IP с помощью локальной базы
+// GeoIP2/GeoLite2 Country или City. Базу можно заменить на диске без
+// перезапуска: Watch перечитает файл и атомарно подменит reader
+type Locator struct {
+	path   string
+	reader atomic.Pointer[maxminddb.Reader]
+}
+
+// Open загружает базу из файла
+func Open(path string) (*Locator, error) {
+	l := &Locator{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload перечитывает файл базы. При ошибке продолжает работать прежняя база
+func (l *Locator) Reload() error {
+	buffer, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+
+	reader, err := maxminddb.FromBytes(buffer)
+	if err != nil {
+		return fmt.Errorf("failed to parse GeoIP database %s: %w", l.path, err)
+	}
+
+	l.reader.Store(reader)
+	return nil
+}
+
+// Locate возвращает страну, регион и город для IP-адреса. Для неизвестных
+// и некорректных адресов возвращается пустое местоположение
+func (l *Locator) Locate(ip string) model.Location {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return model.Location{}
+	}
+
+	var record cityRecord
+	_, found, err := l.reader.Load().LookupNetwork(net.IP(addr.Unmap().AsSlice()), &record)
+	if err != nil {
+		log.Printf("GeoIP lookup failed for %s: %v", ip, err)
+		return model.Location{}
+	}
+	if !found {
+		return model.Location{}
+	}
+
+	return record.location()
+}
+
+// cityRecord - поля записи в схеме GeoIP2 Country/City, нужные для
+// определения местоположения
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// location извлекает страну, регион и город из записи
+func (r *cityRecord) location() model.Location {
+	var location model.Location
+
+	location.Country = r.Country.ISOCode
+	if location.Country == "" {
+		// Для анонимных сетей страна может быть только зарегистрированной
+		location.Country = r.RegisteredCountry.ISOCode
+	}
+
+	if len(r.Subdivisions) > 0 && r.Subdivisions[0].ISOCode != "" && location.Country != "" {
+		location.Region = location.Country + "-" + r.Subdivisions[0].ISOCode
+	}
+
+	location.City = r.City.Names["en"]
+
+	return location
+}
+
+// Watch следит за файлом базы и перечитывает его при замене. Отслеживается
+// каталог, а не файл: обновления обычно заменяют файл переименованием
+func (l *Locator) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create GeoIP watcher: %w", err)
+	}
+
+	if err := watcher.Add(filepath.Dir(l.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch GeoIP database directory: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		name := filepath.Clean(l.path)
+		timer := time.NewTimer(0)
+		<-timer.C
+
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != name || !event.Has(fsnotify.Create|fsnotify.Write) {
+					continue
+				}
+				timer.Reset(reloadDelay)
+
+			case <-timer.C:
+				if err := l.Reload(); err != nil {
+					log.Printf("GeoIP reload failed, keeping previous database: %v", err)
+					continue
+				}
+				metadata := l.reader.Load().Metadata
+				log.Printf("GeoIP database reloaded: %s (built %s)",
+					metadata.DatabaseType, time.Unix(int64(metadata.BuildEpoch), 0).UTC().Format(time.DateOnly))
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("GeoIP watcher error: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
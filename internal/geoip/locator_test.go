@@ -0,0 +1,378 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// metadataMarker отделяет метаданные от данных в конце файла MaxMind DB
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator - 16 нулевых байт между деревом поиска и данными
+const dataSectionSeparator = 16
+
+// Типы значений секции данных формата MaxMind DB, которые пишет testDBWriter
+const (
+	typePointer = 1
+	typeString  = 2
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeUint64  = 9
+	typeArray   = 11
+)
+
+// testDBWriter собирает минимальную базу в формате MaxMind DB для тестов
+type testDBWriter struct {
+	ipVersion  int
+	recordSize int
+	root       *testNode
+	data       bytes.Buffer
+	strings    map[string]int
+}
+
+type testNode struct {
+	children [2]*testNode
+	records  [2]int
+	id       int
+}
+
+func newTestNode() *testNode {
+	return &testNode{records: [2]int{-1, -1}}
+}
+
+func newTestDBWriter(ipVersion, recordSize int) *testDBWriter {
+	return &testDBWriter{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		root:       newTestNode(),
+		strings:    make(map[string]int),
+	}
+}
+
+// insert добавляет сеть с записью, уже закодированной в секцию данных
+func (w *testDBWriter) insert(prefix netip.Prefix, dataOffset int) {
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	var raw []byte
+	if w.ipVersion == 6 {
+		a := addr.As16()
+		raw = a[:]
+		if addr.Is4() {
+			// IPv4 в базах IPv6 хранится в поддереве ::/96, а не ::ffff:0:0/96
+			a4 := addr.As4()
+			raw = append(make([]byte, 12), a4[:]...)
+			bits += 96
+		}
+	} else {
+		a := addr.As4()
+		raw = a[:]
+	}
+
+	node := w.root
+	for i := 0; i < bits; i++ {
+		bit := int(raw[i/8]>>(7-uint(i%8))) & 1
+		if i == bits-1 {
+			node.records[bit] = dataOffset
+			return
+		}
+		if node.children[bit] == nil {
+			node.children[bit] = newTestNode()
+		}
+		node = node.children[bit]
+	}
+}
+
+func (w *testDBWriter) writeControl(buf *bytes.Buffer, valueType, size int) {
+	if valueType > 7 {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(valueType - 7))
+		return
+	}
+	buf.WriteByte(byte(valueType<<5 | size))
+}
+
+// writeString кодирует строку; повторные строки записываются указателем
+func (w *testDBWriter) writeString(buf *bytes.Buffer, s string) {
+	if buf == &w.data {
+		if offset, ok := w.strings[s]; ok {
+			buf.WriteByte(byte(typePointer<<5 | (offset>>8)&0x7))
+			buf.WriteByte(byte(offset))
+			return
+		}
+		w.strings[s] = buf.Len()
+	}
+	w.writeControl(buf, typeString, len(s))
+	buf.WriteString(s)
+}
+
+func (w *testDBWriter) writeUint(buf *bytes.Buffer, valueType int, n uint64) {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	w.writeControl(buf, valueType, len(b))
+	buf.Write(b)
+}
+
+func (w *testDBWriter) writeValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case string:
+		w.writeString(buf, v)
+	case map[string]any:
+		w.writeControl(buf, typeMap, len(v))
+		for key, item := range v {
+			w.writeString(buf, key)
+			w.writeValue(buf, item)
+		}
+	case []any:
+		w.writeControl(buf, typeArray, len(v))
+		for _, item := range v {
+			w.writeValue(buf, item)
+		}
+	}
+}
+
+// addRecord кодирует запись в секцию данных и возвращает ее смещение
+func (w *testDBWriter) addRecord(record map[string]any) int {
+	offset := w.data.Len()
+	w.writeValue(&w.data, record)
+	return offset
+}
+
+func (w *testDBWriter) bytes() []byte {
+	var nodes []*testNode
+	queue := []*testNode{w.root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		node.id = len(nodes)
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+	nodeCount := len(nodes)
+
+	var out bytes.Buffer
+	for _, node := range nodes {
+		var records [2]uint32
+		for bit := 0; bit < 2; bit++ {
+			switch {
+			case node.children[bit] != nil:
+				records[bit] = uint32(node.children[bit].id)
+			case node.records[bit] >= 0:
+				records[bit] = uint32(nodeCount + dataSectionSeparator + node.records[bit])
+			default:
+				records[bit] = uint32(nodeCount)
+			}
+		}
+
+		left, right := records[0], records[1]
+		switch w.recordSize {
+		case 24:
+			out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left),
+				byte((left>>24)<<4 | (right>>24)&0x0F),
+				byte(right >> 16), byte(right >> 8), byte(right)})
+		}
+	}
+
+	out.Write(make([]byte, dataSectionSeparator))
+	out.Write(w.data.Bytes())
+	out.Write(metadataMarker)
+
+	var metadata bytes.Buffer
+	w.writeControl(&metadata, typeMap, 6)
+	w.writeString(&metadata, "binary_format_major_version")
+	w.writeUint(&metadata, typeUint16, 2)
+	w.writeString(&metadata, "node_count")
+	w.writeUint(&metadata, typeUint32, uint64(nodeCount))
+	w.writeString(&metadata, "record_size")
+	w.writeUint(&metadata, typeUint16, uint64(w.recordSize))
+	w.writeString(&metadata, "ip_version")
+	w.writeUint(&metadata, typeUint16, uint64(w.ipVersion))
+	w.writeString(&metadata, "database_type")
+	w.writeString(&metadata, "Test-City")
+	w.writeString(&metadata, "build_epoch")
+	w.writeUint(&metadata, typeUint64, 1700000000)
+	out.Write(metadata.Bytes())
+
+	return out.Bytes()
+}
+
+func buildTestDB(t testing.TB, ipVersion, recordSize int) []byte {
+	t.Helper()
+
+	w := newTestDBWriter(ipVersion, recordSize)
+	w.insert(netip.MustParsePrefix("1.2.3.0/24"), w.addRecord(map[string]any{
+		"country":      map[string]any{"iso_code": "DE"},
+		"subdivisions": []any{map[string]any{"iso_code": "BE"}},
+		"city":         map[string]any{"names": map[string]any{"en": "Berlin"}},
+	}))
+	w.insert(netip.MustParsePrefix("8.8.0.0/16"), w.addRecord(map[string]any{
+		"registered_country": map[string]any{"iso_code": "US"},
+	}))
+	if ipVersion == 6 {
+		w.insert(netip.MustParsePrefix("2001:db8::/32"), w.addRecord(map[string]any{
+			"country": map[string]any{"iso_code": "FR"},
+			"city":    map[string]any{"names": map[string]any{"en": "Paris"}},
+		}))
+	}
+	return w.bytes()
+}
+
+func TestLocator_Formats(t *testing.T) {
+	tests := []struct {
+		name       string
+		ipVersion  int
+		recordSize int
+	}{
+		{"ipv4 database, 24-bit records", 4, 24},
+		{"ipv6 database, 28-bit records", 6, 28},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+			if err := os.WriteFile(path, buildTestDB(t, tt.ipVersion, tt.recordSize), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			locator, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			metadata := locator.reader.Load().Metadata
+			if metadata.DatabaseType != "Test-City" || metadata.RecordSize != uint(tt.recordSize) {
+				t.Errorf("Metadata = %+v", metadata)
+			}
+
+			want := model.Location{Country: "DE", Region: "DE-BE", City: "Berlin"}
+			if got := locator.Locate("1.2.3.4"); got != want {
+				t.Errorf("Locate(1.2.3.4) = %+v, want %+v", got, want)
+			}
+			if got := locator.Locate("9.9.9.9"); got != (model.Location{}) {
+				t.Errorf("Locate(9.9.9.9) = %+v, want empty", got)
+			}
+		})
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	db := buildTestDB(t, 4, 24)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"garbage", []byte("not a database")},
+		{"truncated", db[:20]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(path); err == nil {
+				t.Error("Open() expected error")
+			}
+		})
+	}
+}
+
+func TestLocator_CorruptRecord(t *testing.T) {
+	// Запись - указатель сама на себя: декодер не должен зациклиться
+	w := newTestDBWriter(4, 24)
+	offset := w.data.Len()
+	w.data.Write([]byte{typePointer << 5, byte(offset)})
+	w.insert(netip.MustParsePrefix("1.2.3.0/24"), offset)
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := os.WriteFile(path, w.bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	locator, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if got := locator.Locate("1.2.3.4"); got != (model.Location{}) {
+		t.Errorf("Locate() = %+v, want empty for corrupt record", got)
+	}
+}
+
+// FuzzLocator проверяет, что поврежденная база не роняет процесс
+func FuzzLocator(f *testing.F) {
+	f.Add(buildTestDB(f, 4, 24))
+	f.Add(buildTestDB(f, 6, 28))
+
+	ips := []string{"1.2.3.4", "8.8.8.8", "2001:db8::1", "127.0.0.1"}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		locator, err := Open(path)
+		if err != nil {
+			return
+		}
+		for _, ip := range ips {
+			locator.Locate(ip)
+		}
+	})
+}
+
+func TestLocator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := os.WriteFile(path, buildTestDB(t, 6, 28), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	locator, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want model.Location
+	}{
+		{"1.2.3.4", model.Location{Country: "DE", Region: "DE-BE", City: "Berlin"}},
+		{"::ffff:1.2.3.4", model.Location{Country: "DE", Region: "DE-BE", City: "Berlin"}},
+		{"8.8.8.8", model.Location{Country: "US"}},
+		{"2001:db8::1", model.Location{Country: "FR", City: "Paris"}},
+		{"127.0.0.1", model.Location{}},
+		{"not-an-ip", model.Location{}},
+	}
+
+	for _, tt := range tests {
+		if got := locator.Locate(tt.ip); got != tt.want {
+			t.Errorf("Locate(%s) = %+v, want %+v", tt.ip, got, tt.want)
+		}
+	}
+
+	// Битый файл не должен заменить рабочую базу
+	if err := os.WriteFile(path, []byte("broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := locator.Reload(); err == nil {
+		t.Error("Reload() expected error for broken file")
+	}
+	if got := locator.Locate("1.2.3.4"); got.Country != "DE" {
+		t.Errorf("Locate() after failed reload = %+v, want previous database", got)
+	}
+}
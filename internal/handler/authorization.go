@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/Kosench/go-url-shortener/internal/access"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// authorizedURLService проверяет права участника workspace (access.Principal
+// из контекста запроса) перед вызовом сервиса. Методы редиректа публичные
+// и проходят к сервису без проверки
+type authorizedURLService struct {
+	URLServiceInterface
+}
+
+func (s authorizedURLService) CreateShortURL(ctx context.Context, workspaceID int64, req *model.CreateURLRequest) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.CreateLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.CreateShortURL(ctx, workspaceID, req)
+}
+
+func (s authorizedURLService) GetURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.ReadLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.GetURL(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+// ListURLs перечисляет ссылки workspace. Анонимный участник workspace по
+// умолчанию видит только свои ссылки, поэтому список требует API-ключ
+func (s authorizedURLService) ListURLs(ctx context.Context, workspaceID int64, filter model.URLFilter) (*model.URLPage, error) {
+	if err := access.Check(ctx, workspaceID, access.ReadLinks); err != nil {
+		return nil, err
+	}
+	if p, _ := access.FromContext(ctx); !p.Authenticated() {
+		return nil, apperrors.ErrUnauthorized
+	}
+	return s.URLServiceInterface.ListURLs(ctx, workspaceID, filter)
+}
+
+func (s authorizedURLService) UpdateURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, req *model.UpdateURLRequest) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.UpdateLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.UpdateURL(ctx, workspaceID, domain, shortCode, ownerToken, req)
+}
+
+func (s authorizedURLService) DisableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.UpdateLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.DisableURL(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+func (s authorizedURLService) EnableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.UpdateLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.EnableURL(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+func (s authorizedURLService) DeleteURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) error {
+	if err := access.Check(ctx, workspaceID, access.DeleteLinks); err != nil {
+		return err
+	}
+	return s.URLServiceInterface.DeleteURL(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+func (s authorizedURLService) RestoreURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.DeleteLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.RestoreURL(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+func (s authorizedURLService) ListURLVersions(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) ([]model.LinkVersion, error) {
+	if err := access.Check(ctx, workspaceID, access.ReadLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.ListURLVersions(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+func (s authorizedURLService) RollbackURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, version int) (*model.URLResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.UpdateLinks); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.RollbackURL(ctx, workspaceID, domain, shortCode, ownerToken, version)
+}
+
+func (s authorizedURLService) GetStats(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLStats, error) {
+	if err := access.Check(ctx, workspaceID, access.ReadAnalytics); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.GetStats(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+func (s authorizedURLService) WatchClicks(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (<-chan model.ClickEvent, func(), error) {
+	if err := access.Check(ctx, workspaceID, access.ReadAnalytics); err != nil {
+		return nil, nil, err
+	}
+	return s.URLServiceInterface.WatchClicks(ctx, workspaceID, domain, shortCode, ownerToken)
+}
+
+// WatchWorkspaceClicks раскрывает переходы по всем ссылкам workspace. Анонимный
+// участник workspace по умолчанию видит только свои ссылки (по токену
+// владельца), поэтому поток workspace требует API-ключ
+func (s authorizedURLService) WatchWorkspaceClicks(ctx context.Context, workspaceID int64) (<-chan model.ClickEvent, func(), error) {
+	if err := access.Check(ctx, workspaceID, access.ReadAnalytics); err != nil {
+		return nil, nil, err
+	}
+	if p, _ := access.FromContext(ctx); !p.Authenticated() {
+		return nil, nil, apperrors.ErrUnauthorized
+	}
+	return s.URLServiceInterface.WatchWorkspaceClicks(ctx, workspaceID)
+}
+
+func (s authorizedURLService) CreateDomain(ctx context.Context, workspaceID int64, req *model.CreateDomainRequest) (*model.Domain, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageDomains); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.CreateDomain(ctx, workspaceID, req)
+}
+
+func (s authorizedURLService) ListDomains(ctx context.Context, workspaceID int64) ([]model.Domain, error) {
+	if err := access.Check(ctx, workspaceID, access.ReadDomains); err != nil {
+		return nil, err
+	}
+	return s.URLServiceInterface.ListDomains(ctx, workspaceID)
+}
+
+// authorizedWorkspaceService проверяет права участника на данные workspace.
+// Аутентификация и учет квот выполняются до появления участника, а создание
+// workspaces и квоты защищены токеном администратора - они проходят без проверки
+type authorizedWorkspaceService struct {
+	WorkspaceServiceInterface
+}
+
+func (s authorizedWorkspaceService) DescribeWorkspace(ctx context.Context, id int64) (*model.WorkspaceResponse, error) {
+	if err := access.Check(ctx, id, access.ReadWorkspace); err != nil {
+		return nil, err
+	}
+	return s.WorkspaceServiceInterface.DescribeWorkspace(ctx, id)
+}
+
+func (s authorizedWorkspaceService) UpdateWorkspace(ctx context.Context, id int64, req *model.UpdateWorkspaceRequest) (*model.Workspace, error) {
+	if err := access.Check(ctx, id, access.ManageWorkspace); err != nil {
+		return nil, err
+	}
+	return s.WorkspaceServiceInterface.UpdateWorkspace(ctx, id, req)
+}
+
+func (s authorizedWorkspaceService) CreateAPIKey(ctx context.Context, workspaceID int64, req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageAPIKeys); err != nil {
+		return nil, err
+	}
+
+	role := req.Role
+	if role == "" {
+		role = model.RoleEditor
+	}
+	if err := access.CheckGrant(ctx, role); err != nil {
+		return nil, err
+	}
+
+	return s.WorkspaceServiceInterface.CreateAPIKey(ctx, workspaceID, req)
+}
+
+func (s authorizedWorkspaceService) ListAPIKeys(ctx context.Context, workspaceID int64) ([]model.APIKey, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageAPIKeys); err != nil {
+		return nil, err
+	}
+	return s.WorkspaceServiceInterface.ListAPIKeys(ctx, workspaceID)
+}
+
+func (s authorizedWorkspaceService) DeleteAPIKey(ctx context.Context, workspaceID, id int64) error {
+	if err := access.Check(ctx, workspaceID, access.ManageAPIKeys); err != nil {
+		return err
+	}
+
+	keys, err := s.WorkspaceServiceInterface.ListAPIKeys(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			if err := access.CheckGrant(ctx, key.Role); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.WorkspaceServiceInterface.DeleteAPIKey(ctx, workspaceID, id)
+}
+
+func (s authorizedWorkspaceService) ListAuditLog(ctx context.Context, workspaceID int64, filter model.AuditFilter) (*model.AuditPage, error) {
+	if err := access.Check(ctx, workspaceID, access.ReadAudit); err != nil {
+		return nil, err
+	}
+	return s.WorkspaceServiceInterface.ListAuditLog(ctx, workspaceID, filter)
+}
+
+// authorizedWebhookService проверяет право участника на подписки workspace
+type authorizedWebhookService struct {
+	WebhookServiceInterface
+}
+
+func (s authorizedWebhookService) CreateWebhook(ctx context.Context, workspaceID int64, req *model.CreateWebhookRequest) (*model.WebhookResponse, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageWebhooks); err != nil {
+		return nil, err
+	}
+	return s.WebhookServiceInterface.CreateWebhook(ctx, workspaceID, req)
+}
+
+func (s authorizedWebhookService) ListWebhooks(ctx context.Context, workspaceID int64) ([]model.Webhook, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageWebhooks); err != nil {
+		return nil, err
+	}
+	return s.WebhookServiceInterface.ListWebhooks(ctx, workspaceID)
+}
+
+func (s authorizedWebhookService) DeleteWebhook(ctx context.Context, workspaceID, id int64) error {
+	if err := access.Check(ctx, workspaceID, access.ManageWebhooks); err != nil {
+		return err
+	}
+	return s.WebhookServiceInterface.DeleteWebhook(ctx, workspaceID, id)
+}
+
+func (s authorizedWebhookService) ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageWebhooks); err != nil {
+		return nil, err
+	}
+	return s.WebhookServiceInterface.ListDeliveries(ctx, workspaceID, webhookID, limit)
+}
+
+func (s authorizedWebhookService) ReplayDelivery(ctx context.Context, workspaceID, webhookID, deliveryID int64) (*model.WebhookDelivery, error) {
+	if err := access.Check(ctx, workspaceID, access.ManageWebhooks); err != nil {
+		return nil, err
+	}
+	return s.WebhookServiceInterface.ReplayDelivery(ctx, workspaceID, webhookID, deliveryID)
+}
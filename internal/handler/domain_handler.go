@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDomain регистрирует брендированный домен workspace для коротких ссылок
+func (h *URLHandler) CreateDomain(c *gin.Context) {
+	var req model.CreateDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	domain, err := h.urlService.CreateDomain(c.Request.Context(), workspaceID(c), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, domain)
+}
+
+// ListDomains возвращает брендированные домены workspace
+func (h *URLHandler) ListDomains(c *gin.Context) {
+	domains, err := h.urlService.ListDomains(c.Request.Context(), workspaceID(c))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domains": domains})
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateURL меняет настройки ссылки workspace
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	shortCode, ok := shortCodeParam(c)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	response, err := h.urlService.UpdateURL(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader), &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DisableURL отключает ссылку, переходы по ней отвечают 410
+func (h *URLHandler) DisableURL(c *gin.Context) {
+	h.changeURL(c, h.urlService.DisableURL)
+}
+
+// EnableURL включает отключенную ссылку
+func (h *URLHandler) EnableURL(c *gin.Context) {
+	h.changeURL(c, h.urlService.EnableURL)
+}
+
+// RestoreURL восстанавливает удаленную ссылку
+func (h *URLHandler) RestoreURL(c *gin.Context) {
+	h.changeURL(c, h.urlService.RestoreURL)
+}
+
+// DeleteURL удаляет ссылку (ее можно восстановить через RestoreURL)
+func (h *URLHandler) DeleteURL(c *gin.Context) {
+	shortCode, ok := shortCodeParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.urlService.DeleteURL(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader)); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListURLVersions возвращает историю ревизий настроек ссылки
+func (h *URLHandler) ListURLVersions(c *gin.Context) {
+	shortCode, ok := shortCodeParam(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.urlService.ListURLVersions(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// RollbackURL возвращает ссылке настройки одной из прежних ревизий
+func (h *URLHandler) RollbackURL(c *gin.Context) {
+	shortCode, ok := shortCodeParam(c)
+	if !ok {
+		return
+	}
+
+	var req model.RollbackURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	response, err := h.urlService.RollbackURL(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader), req.Version)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// changeURL выполняет операцию над ссылкой без тела запроса и отвечает
+// ее новым состоянием
+func (h *URLHandler) changeURL(c *gin.Context, change func(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error)) {
+	shortCode, ok := shortCodeParam(c)
+	if !ok {
+		return
+	}
+
+	response, err := change(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// shortCodeParam проверяет формат параметра :shortCode, отвечая 400 при ошибке
+func shortCodeParam(c *gin.Context) (string, bool) {
+	shortCode := c.Param("shortCode")
+	if !isValidShortCode(shortCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid short code format",
+		})
+		return "", false
+	}
+	return shortCode, true
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// liveHeartbeatInterval - как часто в поток SSE отправляется комментарий,
+// чтобы прокси не закрывали простаивающее соединение
+const liveHeartbeatInterval = 15 * time.Second
+
+// StreamClicks отправляет переходы по ссылке в реальном времени как
+// Server-Sent Events (событие click, данные - ClickEvent в JSON)
+func (h *URLHandler) StreamClicks(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	if !isValidShortCode(shortCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid short code format",
+		})
+		return
+	}
+
+	clicks, stop, err := h.urlService.WatchClicks(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	defer stop()
+
+	streamClicks(c, clicks)
+}
+
+// StreamWorkspaceClicks отправляет переходы по всем ссылкам workspace
+func (h *URLHandler) StreamWorkspaceClicks(c *gin.Context) {
+	clicks, stop, err := h.urlService.WatchWorkspaceClicks(c.Request.Context(), workspaceID(c))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	defer stop()
+
+	streamClicks(c, clicks)
+}
+
+// streamClicks пишет переходы в поток SSE, пока клиент не отключится или
+// сервис не закроет канал при остановке
+func streamClicks(c *gin.Context, clicks <-chan model.ClickEvent) {
+	// WriteTimeout сервера оборвал бы долгий поток
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+		case click, ok := <-clicks:
+			if !ok {
+				return
+			}
+			c.SSEvent("click", click)
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ReportURL принимает жалобу на ссылку от любого посетителя. Ссылка ищется
+// на домене запроса, как при переходе. Ответ не сообщает, была ли жалоба
+// этого посетителя уже в очереди
+func (h *URLHandler) ReportURL(c *gin.Context) {
+	shortCode, ok := shortCodeParam(c)
+	if !ok {
+		return
+	}
+
+	domain, ok := h.resolveDomain(c)
+	if !ok {
+		return
+	}
+
+	var req model.CreateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	if err := h.urlService.ReportURL(c.Request.Context(), domain, shortCode, &req); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "received",
+		"message": "Thank you, the report will be reviewed",
+	})
+}
+
+// ModerationQueue возвращает ссылки с открытыми жалобами
+func (h *URLHandler) ModerationQueue(c *gin.Context) {
+	limit, err := intQuery(c, "limit")
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	items, err := h.urlService.ModerationQueue(c.Request.Context(), int(limit))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// ListReports возвращает последние жалобы на ссылку
+func (h *URLHandler) ListReports(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	reports, err := h.urlService.ListReports(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// DismissReports отклоняет открытые жалобы на ссылку
+func (h *URLHandler) DismissReports(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.urlService.DismissReports(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SuspendURL приостанавливает ссылку: переходы показывают предупреждение
+func (h *URLHandler) SuspendURL(c *gin.Context) {
+	h.moderateURL(c, h.urlService.SuspendURL)
+}
+
+// BanURL блокирует ссылку навсегда (и ее автора, если ban_creator)
+func (h *URLHandler) BanURL(c *gin.Context) {
+	h.moderateURL(c, h.urlService.BanURL)
+}
+
+// UnsuspendURL снимает приостановку ссылки
+func (h *URLHandler) UnsuspendURL(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.urlService.UnsuspendURL(c.Request.Context(), id)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// moderateURL выполняет решение модератора. Тело запроса необязательно
+func (h *URLHandler) moderateURL(c *gin.Context,
+	decide func(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error)) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	var req model.ModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	response, err := decide(c.Request.Context(), id, &req)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// renderSuspended отвечает на переход по ссылке, ограниченной модерацией:
+// предупреждение без адреса назначения
+func (h *URLHandler) renderSuspended(c *gin.Context, url *model.URL) {
+	c.Header("Cache-Control", "no-store")
+	c.HTML(http.StatusForbidden, "suspended.html", gin.H{
+		"ShortCode": url.ShortCode,
+		"Banned":    url.Moderation.IsBanned(),
+	})
+}
@@ -0,0 +1,536 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/botdetect"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// unlockCookiePrefix - префикс cookie разблокированной паролем ссылки
+	unlockCookiePrefix = "unlock_"
+	// variantCookiePrefix - префикс cookie с закрепленным вариантом A/B-теста
+	variantCookiePrefix = "variant_"
+	// variantCookieTTL - сколько посетитель остается на выбранном варианте
+	variantCookieTTL = 30 * 24 * time.Hour
+	// infoSuffix - суффикс короткой ссылки для страницы информации (/abc123+)
+	infoSuffix = "+"
+	// defaultPermanentMaxAge - время кэширования постоянных редиректов по умолчанию
+	defaultPermanentMaxAge = 24 * time.Hour
+)
+
+// RedirectURL обрабатывает переход по короткой ссылке. Маршрут также
+// регистрируется как /:shortCode/*rest для проброса пути в назначение
+func (h *URLHandler) RedirectURL(c *gin.Context) {
+	shortCode, showInfo := strings.CutSuffix(c.Param("shortCode"), infoSuffix)
+
+	// Валидация формата short code
+	if !isValidShortCode(shortCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid short code format",
+		})
+		return
+	}
+
+	domain, ok := h.resolveDomain(c)
+	if !ok {
+		return
+	}
+
+	if showInfo && c.Param("rest") == "" {
+		h.renderInfoPage(c, domain, shortCode)
+		return
+	}
+
+	target, ok := h.resolveAvailable(c, domain, shortCode)
+	if !ok {
+		return
+	}
+
+	// Сервис превью ссылок получает карточку, заданную владельцем, вместо
+	// редиректа. Люди и поисковые краулеры по-прежнему уходят на назначение
+	if !target.url.SocialPreview.IsZero() && botdetect.IsUnfurler(target.visit.UserAgent) {
+		h.renderSocialPreview(c, target)
+		return
+	}
+
+	// Защищенная ссылка: без действующей cookie показываем форму ввода пароля
+	if target.url.IsPasswordProtected() && !h.isUnlocked(c, target.url) {
+		h.renderPasswordPage(c, http.StatusUnauthorized, "")
+		return
+	}
+
+	// Режим предпросмотра: показываем назначение и ждем подтверждения
+	if target.url.PreviewMode || h.previewMode {
+		h.renderPreviewPage(c, target.url, target.destination)
+		return
+	}
+
+	h.completeRedirect(c, target)
+}
+
+// PostRedirectURL принимает формы страниц короткой ссылки: ввод пароля
+// и подтверждение перехода со страницы предпросмотра
+func (h *URLHandler) PostRedirectURL(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	if !isValidShortCode(shortCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid short code format",
+		})
+		return
+	}
+
+	domain, ok := h.resolveDomain(c)
+	if !ok {
+		return
+	}
+
+	target, ok := h.resolveAvailable(c, domain, shortCode)
+	if !ok {
+		return
+	}
+
+	if c.PostForm("action") == "confirm" {
+		if target.url.IsPasswordProtected() && !h.isUnlocked(c, target.url) {
+			h.renderPasswordPage(c, http.StatusUnauthorized, "")
+			return
+		}
+
+		h.completeRedirect(c, target)
+		return
+	}
+
+	h.unlock(c, target.url)
+}
+
+// redirectTarget - ссылка, посетитель и назначение, вычисленное для него
+type redirectTarget struct {
+	url         *model.URL
+	visit       *model.Visit
+	destination string
+}
+
+// resolveDomain определяет по заголовку Host, в пространстве кодов какого
+// домена искать ссылку. Если это не удалось, ответ уже отправлен
+func (h *URLHandler) resolveDomain(c *gin.Context) (string, bool) {
+	domain, err := h.urlService.ResolveDomain(c.Request.Context(), c.Request.Host)
+	if err != nil {
+		h.handleError(c, err)
+		return "", false
+	}
+	return domain, true
+}
+
+// resolveAvailable получает ссылку, проверяет окно активности и вычисляет
+// назначение для этого перехода. Если ссылку нельзя открыть, ответ уже
+// отправлен и возвращается false
+func (h *URLHandler) resolveAvailable(c *gin.Context, domain, shortCode string) (*redirectTarget, bool) {
+	url, err := h.urlService.ResolveURL(c.Request.Context(), domain, shortCode)
+	if err != nil {
+		h.handleError(c, err)
+		return nil, false
+	}
+
+	// Несуществующий путь после кода - 404 еще до формы пароля
+	visit := h.newVisit(c, url)
+	destination, err := h.urlService.DestinationFor(url, visit)
+	if err != nil {
+		h.handleError(c, err)
+		return nil, false
+	}
+
+	// Закрепляем вариант сразу: страницы пароля и предпросмотра должны
+	// вести туда же, куда потом уйдет редирект
+	if url.StickyVariants && visit.Variant != "" && visit.Variant != visit.StickyVariant {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     variantCookiePrefix + url.ShortCode,
+			Value:    visit.Variant,
+			Path:     "/" + url.ShortCode,
+			Expires:  time.Now().Add(variantCookieTTL),
+			HttpOnly: true,
+			Secure:   c.Request.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	// Доступность проверяем до пароля: неактивная ссылка не должна
+	// показывать форму ввода
+	if !h.checkAvailable(c, url, visit) {
+		return nil, false
+	}
+
+	return &redirectTarget{url: url, visit: visit, destination: destination}, true
+}
+
+// checkAvailable решает, куда ведет переход: на основное назначение,
+// запасное или страницу ошибки. Правила по порядку:
+//  1. ссылка приостановлена или заблокирована модерацией - страница
+//     предупреждения, запасное назначение не используется;
+//  2. ссылка еще не активна - страница "скоро будет доступна";
+//  3. ссылка отключена, истекла или исчерпала лимит переходов - запасное
+//     назначение ссылки или workspace, а без него - ошибка;
+//  4. мониторинг отметил основное назначение недоступным, и посетитель
+//     направлен именно на него - запасное назначение, если оно задано.
+//     Проверяется только OriginalURL, поэтому посетители, которых правило
+//     или A/B-тест направили на другой адрес, уходят туда;
+//  5. иначе - назначение, вычисленное для посетителя.
+//
+// Возвращает true для вычисленного назначения, иначе ответ уже отправлен
+func (h *URLHandler) checkAvailable(c *gin.Context, url *model.URL, visit *model.Visit) bool {
+	err := h.urlService.CheckAvailability(url)
+	if err == nil && url.IsExhausted() {
+		err = apperrors.ErrURLExhausted
+	}
+
+	switch {
+	case err == nil:
+		if !url.Health.IsBroken() || !visit.Primary {
+			return true
+		}
+		if fallback := h.urlService.FallbackFor(c.Request.Context(), url); fallback != "" {
+			h.redirectToFallback(c, fallback)
+			return false
+		}
+		return true
+	case errors.Is(err, apperrors.ErrURLSuspended):
+		h.renderSuspended(c, url)
+	case errors.Is(err, apperrors.ErrURLNotYetActive):
+		h.renderComingSoon(c, url)
+	case errors.Is(err, apperrors.ErrURLDisabled),
+		errors.Is(err, apperrors.ErrURLExpired),
+		errors.Is(err, apperrors.ErrURLExhausted):
+		h.fallbackOrError(c, url, err)
+	default:
+		h.handleError(c, err)
+	}
+	return false
+}
+
+// fallbackOrError отправляет посетителя недоступной ссылки на запасное
+// назначение, а если его нет - отвечает ошибкой err
+func (h *URLHandler) fallbackOrError(c *gin.Context, url *model.URL, err error) {
+	fallback := h.urlService.FallbackFor(c.Request.Context(), url)
+	if fallback == "" {
+		h.handleError(c, err)
+		return
+	}
+	h.redirectToFallback(c, fallback)
+}
+
+// redirectToFallback выполняет редирект на запасное назначение. Он всегда
+// временный и не кэшируется: ссылка может снова стать доступной. Переход
+// на запасное назначение не засчитывается как клик по ссылке
+func (h *URLHandler) redirectToFallback(c *gin.Context, fallback string) {
+	status := http.StatusFound
+	if c.Request.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(status, fallback)
+}
+
+// newVisit собирает данные запроса, влияющие на назначение
+func (h *URLHandler) newVisit(c *gin.Context, url *model.URL) *model.Visit {
+	visit := &model.Visit{
+		Query:     c.Request.URL.Query(),
+		ExtraPath: c.Param("rest"),
+		UserAgent: c.Request.UserAgent(),
+		Referrer:  c.Request.Referer(),
+		ClientIP:  c.ClientIP(),
+	}
+
+	if h.geoLocator != nil {
+		visit.Location = h.geoLocator.Locate(c.ClientIP())
+	}
+
+	if url.StickyVariants {
+		visit.StickyVariant, _ = c.Cookie(variantCookiePrefix + url.ShortCode)
+	}
+
+	return visit
+}
+
+// completeRedirect засчитывает клик и отправляет посетителя на назначение
+// с учетом типа редиректа ссылки
+func (h *URLHandler) completeRedirect(c *gin.Context, target *redirectTarget) {
+	url, destination := target.url, target.destination
+	if h.botDetector != nil {
+		target.visit.Bot = h.botDetector.Detect(c.Request.Context(), target.visit.UserAgent, target.visit.ClientIP)
+	}
+	event := model.NewClickEvent(url, target.visit, time.Now())
+
+	// Бот не открывает ссылку с лимитом кликов: превью в мессенджере не
+	// должно "использовать" одноразовую ссылку, а назначение без списания
+	// лимита не раскрывается. Бот получает только карточку превью
+	if event.Bot != "" && url.IsClickLimited() {
+		h.renderSocialPreview(c, target)
+		return
+	}
+
+	// Квота кликов workspace проверяется до списания лимита ссылки,
+	// чтобы отклоненный переход не расходовал одноразовую ссылку
+	if err := h.urlService.AdmitClick(c.Request.Context(), url); err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	// Переход бота сохраняется отдельно от переходов людей
+	if event.Bot != "" {
+		h.trackClick(url, event)
+		h.redirect(c, url, destination)
+		return
+	}
+
+	if url.IsClickLimited() {
+		// Лимит кликов списываем синхронно: иначе два параллельных
+		// перехода по одноразовой ссылке успели бы пройти оба
+		if err := h.urlService.ConsumeClick(c.Request.Context(), url, event); err != nil {
+			// Лимит исчерпан параллельным переходом после проверки доступности
+			if errors.Is(err, apperrors.ErrURLExhausted) {
+				h.fallbackOrError(c, url, err)
+				return
+			}
+			h.handleError(c, err)
+			return
+		}
+		event.Counted = true
+	}
+
+	h.trackClick(url, event)
+	h.redirect(c, url, destination)
+}
+
+// trackClick ставит запись перехода в очередь (неблокирующе)
+func (h *URLHandler) trackClick(url *model.URL, event *model.ClickEvent) {
+	if h.clickWorker != nil {
+		h.clickWorker.AddJob(ClickJob{
+			ShortCode: url.ShortCode,
+			Event:     event,
+			Service:   h.urlService,
+		})
+	}
+}
+
+// redirect отправляет посетителя на назначение с учетом типа редиректа ссылки
+func (h *URLHandler) redirect(c *gin.Context, url *model.URL, destination string) {
+	redirectType := h.redirectType(url)
+	if model.IsPageRedirect(redirectType) {
+		h.renderRedirectPage(c, destination, redirectType)
+		return
+	}
+
+	status := redirectStatus(redirectType)
+	if c.Request.Method == http.MethodPost {
+		// 303 превращает POST формы подтверждения в GET к назначению
+		status = http.StatusSeeOther
+	}
+
+	c.Header("Cache-Control", h.redirectCacheControl(c, url, redirectType))
+	c.Redirect(status, destination)
+}
+
+// redirectType возвращает тип редиректа ссылки с учетом значения по умолчанию
+func (h *URLHandler) redirectType(url *model.URL) string {
+	if url.RedirectType != "" {
+		return url.RedirectType
+	}
+	if h.defaultRedirectType != "" {
+		return h.defaultRedirectType
+	}
+	return model.DefaultRedirectType
+}
+
+// redirectCacheControl разрешает кэшировать только постоянные редиректы ссылок
+// без состояния. Временные отдаются с no-store, чтобы каждый переход доходил
+// до сервера и учитывался в статистике
+func (h *URLHandler) redirectCacheControl(c *gin.Context, url *model.URL, redirectType string) string {
+	if !model.IsPermanentRedirect(redirectType) || url.HasPerVisitState() || c.Request.Method != http.MethodGet {
+		return "no-store"
+	}
+
+	maxAge := h.permanentMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultPermanentMaxAge
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+// redirectStatus переводит тип редиректа в HTTP-статус
+func redirectStatus(redirectType string) int {
+	switch redirectType {
+	case model.RedirectMovedPermanently:
+		return http.StatusMovedPermanently
+	case model.RedirectTemporary:
+		return http.StatusTemporaryRedirect
+	case model.RedirectPermanent:
+		return http.StatusPermanentRedirect
+	default:
+		return http.StatusFound
+	}
+}
+
+// renderRedirectPage выполняет редирект HTML-страницей (meta refresh или JS).
+// Назначение уже проверено при создании ссылки, поэтому помечается как
+// безопасный URL - иначе html/template заменит собственную схему приложения
+func (h *URLHandler) renderRedirectPage(c *gin.Context, destination, redirectType string) {
+	c.Header("Cache-Control", "no-store")
+	c.HTML(http.StatusOK, "redirect.html", gin.H{
+		"Destination": template.URL(destination),
+		"JavaScript":  redirectType == model.RedirectJavaScript,
+	})
+}
+
+// unlock проверяет пароль из формы. При успехе выдает подписанную cookie
+// и отправляет обратно на тот же адрес (с путем и query string)
+func (h *URLHandler) unlock(c *gin.Context, url *model.URL) {
+	shortCode := url.ShortCode
+	back := c.Request.URL.RequestURI()
+
+	if !url.IsPasswordProtected() {
+		c.Redirect(http.StatusSeeOther, back)
+		return
+	}
+
+	err := h.urlService.VerifyPassword(c.Request.Context(), url, c.PostForm("password"), c.ClientIP())
+	switch {
+	case errors.Is(err, apperrors.ErrInvalidPassword):
+		h.renderPasswordPage(c, http.StatusUnauthorized, "Неверный пароль")
+		return
+	case errors.Is(err, apperrors.ErrTooManyAttempts):
+		h.renderPasswordPage(c, http.StatusTooManyRequests, "Слишком много попыток. Попробуйте позже.")
+		return
+	case err != nil:
+		h.handleError(c, err)
+		return
+	}
+
+	token, expiresAt := h.urlService.IssueUnlockToken(url)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     unlockCookiePrefix + shortCode,
+		Value:    token,
+		Path:     "/" + shortCode,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	c.Redirect(http.StatusSeeOther, back)
+}
+
+// isUnlocked проверяет cookie, выданную после ввода верного пароля
+func (h *URLHandler) isUnlocked(c *gin.Context, url *model.URL) bool {
+	token, err := c.Cookie(unlockCookiePrefix + url.ShortCode)
+	if err != nil {
+		return false
+	}
+	return h.urlService.VerifyUnlockToken(url, token)
+}
+
+// renderInfoPage показывает информацию о ссылке вместо редиректа (/abc123+).
+// Страница публичная, поэтому скрытое от API назначение не попадает и сюда
+func (h *URLHandler) renderInfoPage(c *gin.Context, domain, shortCode string) {
+	response, err := h.urlService.GetPublicURL(c.Request.Context(), domain, shortCode)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.HTML(http.StatusOK, "info.html", gin.H{
+		"URL":         response,
+		"Destination": webURL(response.OriginalURL),
+	})
+}
+
+// renderPreviewPage показывает страницу подтверждения перед редиректом.
+// Форма отправляется на тот же адрес, чтобы сохранить путь и query string.
+// Теги Open Graph страницы назначения дают карточку при пересылке ссылки
+func (h *URLHandler) renderPreviewPage(c *gin.Context, url *model.URL, destination string) {
+	c.Header("Cache-Control", "no-store")
+	c.HTML(http.StatusOK, "preview.html", gin.H{
+		"Action":      c.Request.URL.RequestURI(),
+		"Destination": webURL(destination),
+		"Preview":     url.URLMetadata,
+	})
+}
+
+// renderSocialPreview отдает сервису превью страницу с тегами Open Graph.
+// Недостающие поля берутся из карточки назначения, кроме защищенных паролем
+// ссылок и ссылок с лимитом кликов: их назначение не должно раскрываться.
+// Переход записывается как переход бота и не расходует лимит кликов
+func (h *URLHandler) renderSocialPreview(c *gin.Context, target *redirectTarget) {
+	url := target.url
+	card := url.SocialPreview
+	destination := ""
+	if !url.IsPasswordProtected() && !url.IsClickLimited() {
+		card = card.Or(url.URLMetadata)
+		destination = target.destination
+	}
+
+	if target.visit.Bot == "" {
+		target.visit.Bot = botdetect.MatchUserAgent(target.visit.UserAgent)
+	}
+	h.trackClick(url, model.NewClickEvent(url, target.visit, time.Now()))
+
+	c.Header("Cache-Control", "no-store")
+	c.HTML(http.StatusOK, "social.html", gin.H{
+		"Preview":     card,
+		"Destination": destination,
+	})
+}
+
+// renderComingSoon отвечает на переход по еще не активированной ссылке
+func (h *URLHandler) renderComingSoon(c *gin.Context, url *model.URL) {
+	c.Header("Cache-Control", "no-store")
+
+	if url.NotBefore != nil {
+		retryAfter := int(time.Until(*url.NotBefore).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	if h.comingSoonURL != "" {
+		c.Redirect(http.StatusFound, h.comingSoonURL)
+		return
+	}
+
+	c.HTML(http.StatusServiceUnavailable, "coming_soon.html", gin.H{
+		"ShortCode":   url.ShortCode,
+		"ActivatesAt": url.NotBefore,
+	})
+}
+
+func (h *URLHandler) renderPasswordPage(c *gin.Context, status int, message string) {
+	c.Header("Cache-Control", "no-store")
+	c.HTML(status, "password.html", gin.H{
+		"Action": c.Request.URL.RequestURI(),
+		"Error":  message,
+	})
+}
+
+// webURL помечает адрес назначения как безопасный для шаблона, чтобы
+// html/template не перекодировал query string. Адреса со схемой, отличной
+// от http(s), не выводятся
+func webURL(destination string) template.URL {
+	parsed, err := neturl.Parse(destination)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return ""
+	}
+	return template.URL(destination)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"regexp"
+
+	"github.com/Kosench/go-url-shortener/internal/access"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader - идентификатор запроса: принимается от прокси или
+// клиента и возвращается в ответе
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRegex - допустимый внешний идентификатор; остальные заменяются
+// сгенерированным, чтобы в журнал аудита не попадал произвольный текст
+var requestIDRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// RequestContext добавляет в контекст запроса его идентификатор и IP клиента
+// (access.RequestInfo) для журнала аудита
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !requestIDRegex.MatchString(requestID) {
+			requestID, _ = utils.GenerateToken(8)
+		}
+		c.Header(requestIDHeader, requestID)
+
+		info := access.RequestInfo{ID: requestID, IP: c.ClientIP()}
+		c.Request = c.Request.WithContext(access.WithRequestInfo(c.Request.Context(), info))
+		c.Next()
+	}
+}
@@ -19,16 +19,90 @@ var (
 	shortCodeRegex = regexp.MustCompile("^[a-zA-Z0-9]{4,10}$")
 )
 
+// ownerTokenHeader - заголовок с токеном владельца ссылки
+const ownerTokenHeader = "X-Owner-Token"
+
+// domainQueryParam - домен ссылки в запросах API (пусто - основной домен)
+const domainQueryParam = "domain"
+
 type URLServiceInterface interface {
-	CreateShortURL(ctx context.Context, req *model.CreateURLRequest) (*model.URLResponse, error)
-	GetURL(ctx context.Context, shortCode string) (*model.URLResponse, error)
-	GetOriginalURL(ctx context.Context, shortCode string) (string, error)
-	RecordClick(ctx context.Context, shortCode string) error
+	CreateShortURL(ctx context.Context, workspaceID int64, req *model.CreateURLRequest) (*model.URLResponse, error)
+	GetURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error)
+	ListURLs(ctx context.Context, workspaceID int64, filter model.URLFilter) (*model.URLPage, error)
+	UpdateURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, req *model.UpdateURLRequest) (*model.URLResponse, error)
+	DisableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error)
+	EnableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error)
+	DeleteURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) error
+	RestoreURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error)
+	ListURLVersions(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) ([]model.LinkVersion, error)
+	RollbackURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, version int) (*model.URLResponse, error)
+	GetPublicURL(ctx context.Context, domain, shortCode string) (*model.URLResponse, error)
+	GetOriginalURL(ctx context.Context, domain, shortCode string) (string, error)
+	ResolveDomain(ctx context.Context, host string) (string, error)
+	ResolveURL(ctx context.Context, domain, shortCode string) (*model.URL, error)
+	CheckAvailability(url *model.URL) error
+	FallbackFor(ctx context.Context, url *model.URL) string
+	DestinationFor(url *model.URL, visit *model.Visit) (string, error)
+	VerifyPassword(ctx context.Context, url *model.URL, password, clientIP string) error
+	IssueUnlockToken(url *model.URL) (string, time.Time)
+	VerifyUnlockToken(url *model.URL, token string) bool
+	AdmitClick(ctx context.Context, url *model.URL) error
+	ConsumeClick(ctx context.Context, url *model.URL, event *model.ClickEvent) error
+	RecordClick(ctx context.Context, domain, shortCode string) error
+	TrackClick(ctx context.Context, event *model.ClickEvent) error
+	GetStats(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLStats, error)
+	WatchClicks(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (<-chan model.ClickEvent, func(), error)
+	WatchWorkspaceClicks(ctx context.Context, workspaceID int64) (<-chan model.ClickEvent, func(), error)
+	CreateDomain(ctx context.Context, workspaceID int64, req *model.CreateDomainRequest) (*model.Domain, error)
+	ListDomains(ctx context.Context, workspaceID int64) ([]model.Domain, error)
+	ReportURL(ctx context.Context, domain, shortCode string, req *model.CreateReportRequest) error
+	ModerationQueue(ctx context.Context, limit int) ([]model.ModerationItem, error)
+	ListReports(ctx context.Context, urlID int64) ([]model.AbuseReport, error)
+	DismissReports(ctx context.Context, urlID int64) (*model.URLResponse, error)
+	SuspendURL(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error)
+	UnsuspendURL(ctx context.Context, urlID int64) (*model.URLResponse, error)
+	BanURL(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error)
+}
+
+// GeoLocator определяет местоположение посетителя по IP
+type GeoLocator interface {
+	Locate(ip string) model.Location
+}
+
+// BotDetector отличает переходы ботов и краулеров от переходов людей
+type BotDetector interface {
+	// Detect возвращает причину, по которой посетитель признан ботом,
+	// или пустую строку для человека
+	Detect(ctx context.Context, userAgent, clientIP string) string
+}
+
+// Config - настройки URLHandler
+type Config struct {
+	// ComingSoonURL - куда отправлять посетителей ссылки, которая еще не
+	// активирована. Если пусто, отображается страница "скоро"
+	ComingSoonURL string
+	// PreviewMode включает страницу подтверждения перед редиректом для всех ссылок
+	PreviewMode bool
+	// DefaultRedirectType - тип редиректа для ссылок, где он не задан
+	DefaultRedirectType string
+	// PermanentRedirectMaxAge - сколько браузеры и CDN могут кэшировать 301/308
+	PermanentRedirectMaxAge time.Duration
+	// GeoLocator - база GeoIP для гео-правил и статистики (nil - отключено)
+	GeoLocator GeoLocator
+	// BotDetector - классификатор ботов (nil - все переходы считаются
+	// переходами людей)
+	BotDetector BotDetector
 }
 
 type URLHandler struct {
-	urlService  URLServiceInterface
-	clickWorker *ClickWorkerPool
+	urlService          URLServiceInterface
+	clickWorker         *ClickWorkerPool
+	comingSoonURL       string
+	previewMode         bool
+	defaultRedirectType string
+	permanentMaxAge     time.Duration
+	geoLocator          GeoLocator
+	botDetector         BotDetector
 }
 
 // ClickWorkerPool для обработки записи кликов
@@ -42,6 +116,7 @@ type ClickWorkerPool struct {
 
 type ClickJob struct {
 	ShortCode string
+	Event     *model.ClickEvent
 	Service   URLServiceInterface
 }
 
@@ -70,7 +145,7 @@ func (p *ClickWorkerPool) worker() {
 		select {
 		case job := <-p.jobQueue:
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			if err := job.Service.RecordClick(ctx, job.ShortCode); err != nil {
+			if err := job.Service.TrackClick(ctx, job.Event); err != nil {
 				log.Printf("Failed to record click for shortCode %s: %v", job.ShortCode, err)
 			}
 			cancel()
@@ -98,9 +173,26 @@ func (p *ClickWorkerPool) Shutdown() {
 }
 
 func NewURLHandler(urlService *service.URLService) *URLHandler {
+	return NewURLHandlerWithConfig(urlService, Config{})
+}
+
+// NewURLHandlerWithConfig создает обработчик с дополнительными настройками
+func NewURLHandlerWithConfig(urlService *service.URLService, cfg Config) *URLHandler {
+	if cfg.DefaultRedirectType != "" && !model.IsValidRedirectType(cfg.DefaultRedirectType) {
+		log.Printf("Unknown default redirect type %q, falling back to %s", cfg.DefaultRedirectType, model.DefaultRedirectType)
+		cfg.DefaultRedirectType = ""
+	}
+
 	return &URLHandler{
-		urlService:  urlService,
-		clickWorker: NewClickWorkerPool(10), // 10 воркеров для записи кликов
+		// Права участников workspace проверяются перед вызовом сервиса
+		urlService:          authorizedURLService{urlService},
+		clickWorker:         NewClickWorkerPool(10), // 10 воркеров для записи кликов
+		comingSoonURL:       cfg.ComingSoonURL,
+		previewMode:         cfg.PreviewMode,
+		defaultRedirectType: cfg.DefaultRedirectType,
+		permanentMaxAge:     cfg.PermanentRedirectMaxAge,
+		geoLocator:          cfg.GeoLocator,
+		botDetector:         cfg.BotDetector,
 	}
 }
 
@@ -122,7 +214,7 @@ func (h *URLHandler) CreateURL(c *gin.Context) {
 	}
 
 	// Создаем URL
-	response, err := h.urlService.CreateShortURL(c.Request.Context(), &req)
+	response, err := h.urlService.CreateShortURL(c.Request.Context(), workspaceID(c), &req)
 	if err != nil {
 		h.handleError(c, err)
 		return
@@ -143,7 +235,7 @@ func (h *URLHandler) GetURL(c *gin.Context) {
 		return
 	}
 
-	response, err := h.urlService.GetURL(c.Request.Context(), shortCode)
+	response, err := h.urlService.GetURL(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader))
 	if err != nil {
 		h.handleError(c, err)
 		return
@@ -152,10 +244,47 @@ func (h *URLHandler) GetURL(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *URLHandler) RedirectURL(c *gin.Context) {
+// ListURLs возвращает ссылки workspace от новых к старым. Параметры запроса:
+// q - поиск по коду, назначению, заголовку и описанию страницы, limit
+// и before - курсор next_cursor предыдущей страницы
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	h.listURLs(c, model.URLFilter{})
+}
+
+// ListBrokenURLs возвращает ссылки, назначение которых признано недоступным
+// проверкой. Параметры те же, что у ListURLs
+func (h *URLHandler) ListBrokenURLs(c *gin.Context) {
+	h.listURLs(c, model.URLFilter{Broken: true})
+}
+
+func (h *URLHandler) listURLs(c *gin.Context, filter model.URLFilter) {
+	filter.Query = c.Query("q")
+
+	var err error
+	if filter.BeforeID, err = intQuery(c, "before"); err != nil {
+		h.handleError(c, err)
+		return
+	}
+	limit, err := intQuery(c, "limit")
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+	filter.Limit = int(limit)
+
+	page, err := h.urlService.ListURLs(c.Request.Context(), workspaceID(c), filter)
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetStats возвращает статистику переходов по ссылке (только владельцу)
+func (h *URLHandler) GetStats(c *gin.Context) {
 	shortCode := c.Param("shortCode")
 
-	// Валидация формата short code
 	if !isValidShortCode(shortCode) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "invalid_request",
@@ -164,25 +293,22 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 		return
 	}
 
-	// Получаем оригинальный URL
-	originalURL, err := h.urlService.GetOriginalURL(c.Request.Context(), shortCode)
+	stats, err := h.urlService.GetStats(c.Request.Context(), workspaceID(c), c.Query(domainQueryParam), shortCode, c.GetHeader(ownerTokenHeader))
 	if err != nil {
 		h.handleError(c, err)
 		return
 	}
 
-	// Добавляем задачу записи клика в очередь (неблокирующе)
-	h.clickWorker.AddJob(ClickJob{
-		ShortCode: shortCode,
-		Service:   h.urlService,
-	})
-
-	// Выполняем редирект (HTTP 302 - Found)
-	c.Redirect(http.StatusFound, originalURL)
+	c.JSON(http.StatusOK, stats)
 }
 
 // handleError обрабатывает ошибки и возвращает соответствующие HTTP коды
 func (h *URLHandler) handleError(c *gin.Context, err error) {
+	writeError(c, err)
+}
+
+// writeError отвечает на ошибку сервиса соответствующим HTTP кодом
+func writeError(c *gin.Context, err error) {
 	// Проверяем ValidationError
 	if apperrors.IsValidationError(err) {
 		validationErr := apperrors.GetValidationError(err)
@@ -194,6 +320,117 @@ func (h *URLHandler) handleError(c *gin.Context, err error) {
 		return
 	}
 
+	// Ошибки проверки пароля
+	if errors.Is(err, apperrors.ErrInvalidPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "invalid_password",
+			"message": "Invalid password",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrTooManyAttempts) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "too_many_attempts",
+			"message": "Too many attempts. Please try again later.",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrUnauthorized) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "Valid API key required",
+		})
+		return
+	}
+
+	var quotaErr *apperrors.QuotaError
+	if errors.As(err, &quotaErr) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":    "quota_exceeded",
+			"message":  "Workspace quota exceeded",
+			"resource": quotaErr.Resource,
+			"limit":    quotaErr.Limit,
+		})
+		return
+	}
+
+	var permissionErr *apperrors.PermissionError
+	if errors.As(err, &permissionErr) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":      "permission_denied",
+			"message":    "Your role does not allow this operation",
+			"role":       permissionErr.Role,
+			"permission": permissionErr.Permission,
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "Owner token required",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrURLSuspended) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "url_suspended",
+			"message": "This link has been suspended by moderation",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrBanned) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "banned",
+			"message": "This account has been banned by moderation",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrURLExpired) {
+		c.JSON(http.StatusGone, gin.H{
+			"error":   "url_expired",
+			"message": "This link has expired",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrURLDisabled) {
+		c.JSON(http.StatusGone, gin.H{
+			"error":   "url_disabled",
+			"message": "This link has been disabled",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrURLExhausted) {
+		c.JSON(http.StatusGone, gin.H{
+			"error":   "url_exhausted",
+			"message": "This link has reached its click limit",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrURLConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "url_conflict",
+			"message": "The link was modified by another request, please retry",
+		})
+		return
+	}
+
+	if errors.Is(err, apperrors.ErrVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "version_not_found",
+			"message": "Link version not found",
+		})
+		return
+	}
+
 	// Проверяем URL not found
 	if errors.Is(err, apperrors.ErrURLNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -203,13 +440,22 @@ func (h *URLHandler) handleError(c *gin.Context, err error) {
 		return
 	}
 
+	if errors.Is(err, apperrors.ErrWorkspaceNotFound) || errors.Is(err, apperrors.ErrAPIKeyNotFound) ||
+		errors.Is(err, apperrors.ErrWebhookNotFound) || errors.Is(err, apperrors.ErrDeliveryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "not_found",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Проверяем BusinessError
 	if apperrors.IsBusinessError(err) {
 		businessErr := apperrors.GetBusinessError(err)
 
 		// Определяем HTTP статус на основе кода ошибки
 		statusCode := http.StatusInternalServerError
-		if businessErr.Code == "SHORT_CODE_EXISTS" {
+		if businessErr.Code == "SHORT_CODE_EXISTS" || businessErr.Code == "DOMAIN_EXISTS" {
 			statusCode = http.StatusConflict
 		}
 
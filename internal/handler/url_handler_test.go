@@ -5,29 +5,50 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Kosench/go-url-shortener/internal/access"
 	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
 	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type mockURLService struct {
-	urls       map[string]*model.URLResponse
+	urls      map[string]*model.URLResponse
+	passwords map[string]string
+	events    []*model.ClickEvent
+	lastVisit *model.Visit
+	domains   []model.Domain
+	deleted   map[string]*model.URLResponse
+	// workspace - workspace, переданный в последний вызов API
+	workspace  int64
+	clickQuota bool
+	// live - переходы для потоков SSE
+	live chan model.ClickEvent
+	// workspaceFallback - запасное назначение workspace ссылок
+	workspaceFallback string
+	// reports - жалобы по коротким кодам
+	reports    map[string][]model.CreateReportRequest
 	shouldFail bool
 	failType   string
 }
 
 func newMockURLService() *mockURLService {
 	return &mockURLService{
-		urls: make(map[string]*model.URLResponse),
+		urls:      make(map[string]*model.URLResponse),
+		passwords: make(map[string]string),
 	}
 }
 
-func (m *mockURLService) CreateShortURL(ctx context.Context, req *model.CreateURLRequest) (*model.URLResponse, error) {
+func (m *mockURLService) CreateShortURL(ctx context.Context, workspaceID int64, req *model.CreateURLRequest) (*model.URLResponse, error) {
+	m.workspace = workspaceID
 	if m.shouldFail {
 		switch m.failType {
 		case "validation":
@@ -52,7 +73,106 @@ func (m *mockURLService) CreateShortURL(ctx context.Context, req *model.CreateUR
 	return response, nil
 }
 
-func (m *mockURLService) GetURL(ctx context.Context, shortCode string) (*model.URLResponse, error) {
+func (m *mockURLService) GetURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	m.workspace = workspaceID
+	return m.GetPublicURL(ctx, domain, shortCode)
+}
+
+// ListURLs, как и сервис, не перечисляет общий workspace по умолчанию
+func (m *mockURLService) ListURLs(ctx context.Context, workspaceID int64, filter model.URLFilter) (*model.URLPage, error) {
+	m.workspace = workspaceID
+	if workspaceID == model.DefaultWorkspaceID {
+		return nil, apperrors.ErrForbidden
+	}
+
+	page := &model.URLPage{URLs: make([]*model.URLResponse, 0)}
+	for _, response := range m.urls {
+		if filter.Broken && (response.Health == nil || !response.Health.IsBroken()) {
+			continue
+		}
+		if filter.Query == "" || strings.Contains(response.Title, filter.Query) {
+			page.URLs = append(page.URLs, response)
+		}
+	}
+	return page, nil
+}
+
+func (m *mockURLService) UpdateURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, req *model.UpdateURLRequest) (*model.URLResponse, error) {
+	return m.changeURL(workspaceID, domain, shortCode, func(response *model.URLResponse) {
+		if req.URL != nil {
+			response.OriginalURL = *req.URL
+		}
+		if req.MaxClicks != nil {
+			response.MaxClicks = *req.MaxClicks
+		}
+	})
+}
+
+func (m *mockURLService) DisableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	return m.changeURL(workspaceID, domain, shortCode, func(response *model.URLResponse) {
+		now := time.Now()
+		response.DisabledAt = &now
+	})
+}
+
+func (m *mockURLService) EnableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	return m.changeURL(workspaceID, domain, shortCode, func(response *model.URLResponse) {
+		response.DisabledAt = nil
+	})
+}
+
+// В моке удаленные ссылки хранятся отдельно от m.urls
+func (m *mockURLService) DeleteURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) error {
+	response, err := m.changeURL(workspaceID, domain, shortCode, func(*model.URLResponse) {})
+	if err != nil {
+		return err
+	}
+	if m.deleted == nil {
+		m.deleted = make(map[string]*model.URLResponse)
+	}
+	m.deleted[mockURLKey(domain, shortCode)] = response
+	delete(m.urls, mockURLKey(domain, shortCode))
+	return nil
+}
+
+func (m *mockURLService) RestoreURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	m.workspace = workspaceID
+	key := mockURLKey(domain, shortCode)
+	if response, exists := m.deleted[key]; exists {
+		m.urls[key] = response
+		delete(m.deleted, key)
+	}
+	return m.GetPublicURL(ctx, domain, shortCode)
+}
+
+func (m *mockURLService) ListURLVersions(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) ([]model.LinkVersion, error) {
+	response, err := m.changeURL(workspaceID, domain, shortCode, func(*model.URLResponse) {})
+	if err != nil {
+		return nil, err
+	}
+	return []model.LinkVersion{{Version: 1, Settings: model.LinkSettings{OriginalURL: response.OriginalURL}}}, nil
+}
+
+func (m *mockURLService) RollbackURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, version int) (*model.URLResponse, error) {
+	if version != 1 {
+		return nil, apperrors.ErrVersionNotFound
+	}
+	return m.changeURL(workspaceID, domain, shortCode, func(response *model.URLResponse) {
+		response.Version++
+	})
+}
+
+func (m *mockURLService) changeURL(workspaceID int64, domain, shortCode string, change func(response *model.URLResponse)) (*model.URLResponse, error) {
+	m.workspace = workspaceID
+	response, exists := m.urls[mockURLKey(domain, shortCode)]
+	if !exists {
+		return nil, apperrors.ErrURLNotFound
+	}
+	change(response)
+	return response, nil
+}
+
+func (m *mockURLService) GetPublicURL(ctx context.Context, domain, shortCode string) (*model.URLResponse, error) {
 	if m.shouldFail {
 		return nil, errors.New("service error")
 	}
@@ -61,7 +181,7 @@ func (m *mockURLService) GetURL(ctx context.Context, shortCode string) (*model.U
 		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
 	}
 
-	response, exists := m.urls[shortCode]
+	response, exists := m.urls[mockURLKey(domain, shortCode)]
 	if !exists {
 		return nil, apperrors.ErrURLNotFound
 	}
@@ -69,7 +189,43 @@ func (m *mockURLService) GetURL(ctx context.Context, shortCode string) (*model.U
 	return response, nil
 }
 
-func (m *mockURLService) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
+// mockURLKey - ключ ссылки в моке: код уникален в пределах домена
+func mockURLKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+// В моке зарегистрированы домены из m.domains, остальные хосты - основной домен
+func (m *mockURLService) ResolveDomain(ctx context.Context, host string) (string, error) {
+	for _, domain := range m.domains {
+		if domain.Hostname == host {
+			return host, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *mockURLService) CreateDomain(ctx context.Context, workspaceID int64, req *model.CreateDomainRequest) (*model.Domain, error) {
+	m.workspace = workspaceID
+	for _, domain := range m.domains {
+		if domain.Hostname == req.Hostname {
+			return nil, apperrors.ErrDomainExists
+		}
+	}
+
+	domain := model.Domain{ID: int64(len(m.domains) + 1), WorkspaceID: workspaceID, Hostname: req.Hostname, CreatedAt: time.Now()}
+	m.domains = append(m.domains, domain)
+	return &domain, nil
+}
+
+func (m *mockURLService) ListDomains(ctx context.Context, workspaceID int64) ([]model.Domain, error) {
+	m.workspace = workspaceID
+	return m.domains, nil
+}
+
+func (m *mockURLService) GetOriginalURL(ctx context.Context, domain, shortCode string) (string, error) {
 	if m.shouldFail {
 		return "", errors.New("service error")
 	}
@@ -86,12 +242,238 @@ func (m *mockURLService) GetOriginalURL(ctx context.Context, shortCode string) (
 	return response.OriginalURL, nil
 }
 
-func (m *mockURLService) RecordClick(ctx context.Context, shortCode string) error {
+func (m *mockURLService) ResolveURL(ctx context.Context, domain, shortCode string) (*model.URL, error) {
+	if m.shouldFail {
+		return nil, errors.New("service error")
+	}
+
+	response, exists := m.urls[mockURLKey(domain, shortCode)]
+	if !exists {
+		return nil, apperrors.ErrURLNotFound
+	}
+
+	var health model.LinkHealth
+	if response.Health != nil {
+		health = *response.Health
+	}
+	var moderation model.Moderation
+	if response.Moderation != nil {
+		moderation = *response.Moderation
+	}
+
+	return &model.URL{
+		ID:             response.ID,
+		OriginalURL:    response.OriginalURL,
+		ShortCode:      response.ShortCode,
+		ClickCount:     response.ClickCount,
+		CreatedAt:      response.CreatedAt,
+		PasswordHash:   m.passwords[shortCode],
+		MaxClicks:      response.MaxClicks,
+		NotBefore:      response.NotBefore,
+		NotAfter:       response.NotAfter,
+		PreviewMode:    response.PreviewMode,
+		RedirectType:   response.RedirectType,
+		ForwardQuery:   response.ForwardQuery,
+		ForwardPath:    response.ForwardPath,
+		Rules:          response.Rules,
+		Variants:       response.Variants,
+		StickyVariants: response.StickyVariants,
+		Domain:         domain,
+		DisabledAt:     response.DisabledAt,
+		URLMetadata:    response.URLMetadata,
+		SocialPreview:  response.SocialPreview,
+		FallbackURL:    response.FallbackURL,
+		Health:         health,
+		Moderation:     moderation,
+	}, nil
+}
+
+func (m *mockURLService) DestinationFor(url *model.URL, visit *model.Visit) (string, error) {
+	m.lastVisit = visit
+
+	// Правила в моке: ОС по подстроке User-Agent
+	for _, rule := range url.Rules {
+		if rule.Kind == model.RuleKindOS && strings.Contains(visit.UserAgent, rule.Value) {
+			visit.Primary = rule.Destination == url.OriginalURL
+			return rule.Destination, nil
+		}
+	}
+
+	// Варианты в моке: закрепленный или последний
+	if len(url.Variants) > 0 {
+		variant := url.Variants[len(url.Variants)-1]
+		if sticky, ok := url.Variants.Find(visit.StickyVariant); ok {
+			variant = sticky
+		}
+		visit.Variant = variant.Name
+		visit.Primary = variant.Destination == url.OriginalURL
+		return variant.Destination, nil
+	}
+	visit.Primary = true
+
+	extraPath := strings.TrimSuffix(visit.ExtraPath, "/")
+	if extraPath != "" && !url.ForwardPath {
+		return "", apperrors.ErrURLNotFound
+	}
+
+	destination := url.OriginalURL + extraPath
+	if url.ForwardQuery && len(visit.Query) > 0 {
+		destination += "?" + visit.Query.Encode()
+	}
+	return destination, nil
+}
+
+func (m *mockURLService) FallbackFor(ctx context.Context, url *model.URL) string {
+	if url.FallbackURL != "" {
+		return url.FallbackURL
+	}
+	return m.workspaceFallback
+}
+
+func (m *mockURLService) CheckAvailability(url *model.URL) error {
+	if url.Moderation.IsRestricted() {
+		return apperrors.ErrURLSuspended
+	}
+	if url.IsDisabled() {
+		return apperrors.ErrURLDisabled
+	}
+	now := time.Now()
+	if url.IsPendingAt(now) {
+		return apperrors.ErrURLNotYetActive
+	}
+	if url.IsExpiredAt(now) {
+		return apperrors.ErrURLExpired
+	}
+	return nil
+}
+
+func (m *mockURLService) ReportURL(ctx context.Context, domain, shortCode string, req *model.CreateReportRequest) error {
+	if !model.IsValidReportReason(req.Reason) {
+		return apperrors.NewValidationError("reason", "reason must be one of phishing, malware, spam, other")
+	}
+	if _, exists := m.urls[mockURLKey(domain, shortCode)]; !exists {
+		return apperrors.ErrURLNotFound
+	}
+	if m.reports == nil {
+		m.reports = make(map[string][]model.CreateReportRequest)
+	}
+	m.reports[shortCode] = append(m.reports[shortCode], *req)
+	return nil
+}
+
+func (m *mockURLService) ModerationQueue(ctx context.Context, limit int) ([]model.ModerationItem, error) {
+	items := make([]model.ModerationItem, 0)
+	for code, reports := range m.reports {
+		items = append(items, model.ModerationItem{
+			URL:           m.urls[code],
+			ReportSummary: model.ReportSummary{OpenReports: int64(len(reports))},
+		})
+	}
+	return items, nil
+}
+
+func (m *mockURLService) ListReports(ctx context.Context, urlID int64) ([]model.AbuseReport, error) {
+	response, err := m.urlByID(urlID)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]model.AbuseReport, 0)
+	for _, req := range m.reports[response.ShortCode] {
+		reports = append(reports, model.AbuseReport{URLID: urlID, Reason: req.Reason, Details: req.Details, Status: model.ReportOpen})
+	}
+	return reports, nil
+}
+
+func (m *mockURLService) DismissReports(ctx context.Context, urlID int64) (*model.URLResponse, error) {
+	response, err := m.urlByID(urlID)
+	if err != nil {
+		return nil, err
+	}
+	delete(m.reports, response.ShortCode)
+	return response, nil
+}
+
+func (m *mockURLService) SuspendURL(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error) {
+	return m.moderate(urlID, model.ModerationSuspended, req.Reason)
+}
+
+func (m *mockURLService) BanURL(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error) {
+	return m.moderate(urlID, model.ModerationBanned, req.Reason)
+}
+
+func (m *mockURLService) UnsuspendURL(ctx context.Context, urlID int64) (*model.URLResponse, error) {
+	response, err := m.urlByID(urlID)
+	if err != nil {
+		return nil, err
+	}
+	if response.Moderation != nil && response.Moderation.IsBanned() {
+		return nil, apperrors.NewValidationError("status", "banned links cannot be reinstated")
+	}
+	response.Moderation = nil
+	return response, nil
+}
+
+func (m *mockURLService) moderate(urlID int64, status, reason string) (*model.URLResponse, error) {
+	response, err := m.urlByID(urlID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	response.Moderation = &model.Moderation{Status: status, Reason: reason, At: &now}
+	delete(m.reports, response.ShortCode)
+	return response, nil
+}
+
+func (m *mockURLService) urlByID(id int64) (*model.URLResponse, error) {
+	for _, response := range m.urls {
+		if response.ID == id {
+			return response, nil
+		}
+	}
+	return nil, apperrors.ErrURLNotFound
+}
+
+func (m *mockURLService) AdmitClick(ctx context.Context, url *model.URL) error {
+	if m.clickQuota {
+		return apperrors.NewQuotaError("clicks", 1000)
+	}
+	return nil
+}
+
+func (m *mockURLService) ConsumeClick(ctx context.Context, url *model.URL, event *model.ClickEvent) error {
+	response := m.urls[url.ShortCode]
+	if response.ClickCount >= response.MaxClicks {
+		return apperrors.ErrURLExhausted
+	}
+	response.ClickCount++
+	return nil
+}
+
+// В моке "хэш" пароля совпадает с самим паролем
+func (m *mockURLService) VerifyPassword(ctx context.Context, url *model.URL, password, clientIP string) error {
+	if password == "locked" {
+		return apperrors.ErrTooManyAttempts
+	}
+	if password != url.PasswordHash {
+		return apperrors.ErrInvalidPassword
+	}
+	return nil
+}
+
+func (m *mockURLService) IssueUnlockToken(url *model.URL) (string, time.Time) {
+	return "token-" + url.ShortCode, time.Now().Add(time.Hour)
+}
+
+func (m *mockURLService) VerifyUnlockToken(url *model.URL, token string) bool {
+	return token == "token-"+url.ShortCode
+}
+
+func (m *mockURLService) RecordClick(ctx context.Context, domain, shortCode string) error {
 	if m.shouldFail {
 		return errors.New("service error")
 	}
 
-	response, exists := m.urls[shortCode]
+	response, exists := m.urls[mockURLKey(domain, shortCode)]
 	if !exists {
 		return apperrors.ErrURLNotFound
 	}
@@ -100,6 +482,55 @@ func (m *mockURLService) RecordClick(ctx context.Context, shortCode string) erro
 	return nil
 }
 
+func (m *mockURLService) TrackClick(ctx context.Context, event *model.ClickEvent) error {
+	m.events = append(m.events, event)
+	if event.Counted {
+		return nil
+	}
+	return m.RecordClick(ctx, event.Domain, event.ShortCode)
+}
+
+// В моке токен владельца ссылки - "owner-" + короткий код
+func (m *mockURLService) GetStats(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLStats, error) {
+	m.workspace = workspaceID
+	response, exists := m.urls[mockURLKey(domain, shortCode)]
+	if !exists {
+		return nil, apperrors.ErrURLNotFound
+	}
+	if ownerToken != "owner-"+shortCode {
+		return nil, apperrors.ErrForbidden
+	}
+
+	return &model.URLStats{
+		ShortCode:   shortCode,
+		TotalClicks: response.ClickCount,
+		Countries:   []model.StatBucket{{Value: "DE", Clicks: response.ClickCount}},
+		Cities:      []model.StatBucket{},
+	}, nil
+}
+
+func (m *mockURLService) WatchClicks(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (<-chan model.ClickEvent, func(), error) {
+	if _, err := m.GetStats(ctx, workspaceID, domain, shortCode, ownerToken); err != nil {
+		return nil, nil, err
+	}
+	return m.liveClicks(), func() {}, nil
+}
+
+func (m *mockURLService) WatchWorkspaceClicks(ctx context.Context, workspaceID int64) (<-chan model.ClickEvent, func(), error) {
+	m.workspace = workspaceID
+	return m.liveClicks(), func() {}, nil
+}
+
+// liveClicks возвращает заданные переходы, без них - закрытый канал,
+// чтобы поток SSE сразу завершился
+func (m *mockURLService) liveClicks() <-chan model.ClickEvent {
+	if m.live == nil {
+		m.live = make(chan model.ClickEvent)
+		close(m.live)
+	}
+	return m.live
+}
+
 func TestURLHandler_CreateURL(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -285,4 +716,2116 @@ func TestURLHandler_RedirectURL(t *testing.T) {
 			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusNotFound)
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestURLHandler_PasswordProtectedRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "abc123",
+		OriginalURL: "https://example.com",
+		CreatedAt:   time.Now(),
+	}
+	mockService.passwords["abc123"] = "secret"
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", handler.RedirectURL)
+	router.POST("/:shortCode", handler.PostRedirectURL)
+
+	postPassword := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}}
+		req := httptest.NewRequest("POST", "/abc123", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("prompt without cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/abc123", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+
+		if strings.Contains(w.Body.String(), "https://example.com") {
+			t.Error("RedirectURL() password page leaks destination")
+		}
+
+		if !strings.Contains(w.Body.String(), `name="password"`) {
+			t.Error("RedirectURL() should render password form")
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		w := postPassword("wrong")
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("PostRedirectURL() status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("PostRedirectURL() should not set cookie for wrong password")
+		}
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		w := postPassword("locked")
+
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("PostRedirectURL() status = %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("correct password then redirect with cookie", func(t *testing.T) {
+		w := postPassword("secret")
+
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("PostRedirectURL() status = %d, want %d", w.Code, http.StatusSeeOther)
+		}
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != unlockCookiePrefix+"abc123" {
+			t.Fatalf("PostRedirectURL() cookies = %v, want unlock cookie", cookies)
+		}
+
+		if !cookies[0].HttpOnly {
+			t.Error("PostRedirectURL() cookie should be HttpOnly")
+		}
+
+		req := httptest.NewRequest("GET", "/abc123", nil)
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusFound {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusFound)
+		}
+
+		if location := w.Header().Get("Location"); location != "https://example.com" {
+			t.Errorf("RedirectURL() Location = %s, want https://example.com", location)
+		}
+	})
+
+	t.Run("forged cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/abc123", nil)
+		req.AddCookie(&http.Cookie{Name: unlockCookiePrefix + "abc123", Value: "forged"})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestURLHandler_OneTimeRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["once12"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "once12",
+		OriginalURL: "https://example.com/invite",
+		MaxClicks:   1,
+		CreatedAt:   time.Now(),
+	}
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	req := httptest.NewRequest("GET", "/once12", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("RedirectURL() first visit status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	req = httptest.NewRequest("GET", "/once12", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("RedirectURL() second visit status = %d, want %d", w.Code, http.StatusGone)
+	}
+
+	if w.Header().Get("Location") != "" {
+		t.Error("RedirectURL() exhausted link should not redirect")
+	}
+}
+
+func TestURLHandler_ActivationWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	mockService := newMockURLService()
+	mockService.urls["soon12"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "soon12",
+		OriginalURL: "https://example.com/campaign",
+		NotBefore:   &future,
+	}
+	mockService.urls["gone12"] = &model.URLResponse{
+		ID:          2,
+		ShortCode:   "gone12",
+		OriginalURL: "https://example.com/old",
+		NotAfter:    &past,
+	}
+
+	newRouter := func(handler *URLHandler) *gin.Engine {
+		router := gin.New()
+		router.LoadHTMLGlob("../../web/static/*")
+		router.GET("/:shortCode", handler.RedirectURL)
+		return router
+	}
+
+	t.Run("coming soon page", func(t *testing.T) {
+		router := newRouter(&URLHandler{urlService: mockService})
+
+		req := httptest.NewRequest("GET", "/soon12", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("RedirectURL() should set Retry-After for pending link")
+		}
+
+		if strings.Contains(w.Body.String(), "https://example.com/campaign") {
+			t.Error("RedirectURL() coming soon page leaks destination")
+		}
+	})
+
+	t.Run("coming soon fallback URL", func(t *testing.T) {
+		router := newRouter(&URLHandler{urlService: mockService, comingSoonURL: "https://example.com/soon"})
+
+		req := httptest.NewRequest("GET", "/soon12", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusFound {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusFound)
+		}
+
+		if location := w.Header().Get("Location"); location != "https://example.com/soon" {
+			t.Errorf("RedirectURL() Location = %s, want https://example.com/soon", location)
+		}
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		router := newRouter(&URLHandler{urlService: mockService})
+
+		req := httptest.NewRequest("GET", "/gone12", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusGone {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusGone)
+		}
+	})
+}
+
+func TestURLHandler_InfoAndPreviewPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	createdAt := time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "abc123",
+		OriginalURL: "https://example.com/page?a=1&b=2#frag",
+		ShortURL:    "http://localhost:8080/abc123",
+		ClickCount:  42,
+		CreatedAt:   createdAt,
+	}
+	mockService.urls["prev12"] = &model.URLResponse{
+		ID:          2,
+		ShortCode:   "prev12",
+		OriginalURL: "https://example.com/preview?a=1&b=2#frag",
+		PreviewMode: true,
+		CreatedAt:   createdAt,
+		URLMetadata: model.URLMetadata{
+			Title:       "Launch <day>",
+			Description: "Everything about the launch",
+			ImageURL:    "https://example.com/cover.png?size=large&v=2",
+		},
+	}
+	mockService.urls["js1234"] = &model.URLResponse{
+		ID:          3,
+		ShortCode:   "js1234",
+		OriginalURL: "javascript:alert(1)",
+		CreatedAt:   createdAt,
+	}
+
+	newRouter := func(handler *URLHandler) *gin.Engine {
+		router := gin.New()
+		router.LoadHTMLGlob("../../web/static/*")
+		router.GET("/:shortCode", handler.RedirectURL)
+		router.POST("/:shortCode", handler.PostRedirectURL)
+		return router
+	}
+	router := newRouter(&URLHandler{urlService: mockService})
+
+	t.Run("info page", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/abc123+", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("RedirectURL() status = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		body := w.Body.String()
+		// Адрес выводится как есть: query string не перекодируется
+		for _, want := range []string{
+			`<a href="https://example.com/page?a=1&amp;b=2#frag" rel="nofollow noopener">https://example.com/page?a=1&amp;b=2#frag</a>`,
+			"02.01.2026",
+			"42",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("RedirectURL() info page missing %q", want)
+			}
+		}
+
+		if mockService.urls["abc123"].ClickCount != 42 {
+			t.Error("RedirectURL() info page should not record a click")
+		}
+	})
+
+	t.Run("info page skips non-web destination", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/js1234+", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("RedirectURL() status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if strings.Contains(w.Body.String(), "javascript:") {
+			t.Error("RedirectURL() info page should not render a non-http(s) destination")
+		}
+	})
+
+	t.Run("per-link preview", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/prev12", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("RedirectURL() status = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		if !strings.Contains(w.Body.String(), `<div class="destination">https://example.com/preview?a=1&amp;b=2#frag</div>`) {
+			t.Error("RedirectURL() preview page should show destination")
+		}
+
+		// Карточка страницы назначения - в тегах Open Graph, с экранированием
+		for _, want := range []string{
+			`<meta property="og:title" content="Launch &lt;day&gt;">`,
+			`<meta property="og:description" content="Everything about the launch">`,
+			`<meta property="og:image" content="https://example.com/cover.png?size=large&amp;v=2">`,
+		} {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("RedirectURL() preview page missing %s", want)
+			}
+		}
+
+		if w.Header().Get("Location") != "" {
+			t.Error("RedirectURL() preview page should not redirect")
+		}
+	})
+
+	t.Run("confirm preview", func(t *testing.T) {
+		form := url.Values{"action": {"confirm"}}
+		req := httptest.NewRequest("POST", "/prev12", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("PostRedirectURL() status = %d, want %d", w.Code, http.StatusSeeOther)
+		}
+
+		if location := w.Header().Get("Location"); location != "https://example.com/preview?a=1&b=2#frag" {
+			t.Errorf("PostRedirectURL() Location = %s, want https://example.com/preview?a=1&b=2#frag", location)
+		}
+	})
+
+	t.Run("global preview mode", func(t *testing.T) {
+		router := newRouter(&URLHandler{urlService: mockService, previewMode: true})
+
+		req := httptest.NewRequest("GET", "/abc123", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("confirm still requires password", func(t *testing.T) {
+		mockService.passwords["prev12"] = "secret"
+		defer delete(mockService.passwords, "prev12")
+
+		form := url.Values{"action": {"confirm"}}
+		req := httptest.NewRequest("POST", "/prev12", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("PostRedirectURL() status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestURLHandler_RedirectTypes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		link           *model.URLResponse
+		defaultType    string
+		expectedStatus int
+		cacheControl   string
+	}{
+		{
+			name:           "default is 302 without caching",
+			link:           &model.URLResponse{OriginalURL: "https://example.com"},
+			expectedStatus: http.StatusFound,
+			cacheControl:   "no-store",
+		},
+		{
+			name:           "global default 307",
+			link:           &model.URLResponse{OriginalURL: "https://example.com"},
+			defaultType:    model.RedirectTemporary,
+			expectedStatus: http.StatusTemporaryRedirect,
+			cacheControl:   "no-store",
+		},
+		{
+			name:           "per-link 301 is cacheable",
+			link:           &model.URLResponse{OriginalURL: "https://example.com", RedirectType: model.RedirectMovedPermanently},
+			defaultType:    model.RedirectTemporary,
+			expectedStatus: http.StatusMovedPermanently,
+			cacheControl:   "public, max-age=86400",
+		},
+		{
+			name:           "per-link 308 is cacheable",
+			link:           &model.URLResponse{OriginalURL: "https://example.com", RedirectType: model.RedirectPermanent},
+			expectedStatus: http.StatusPermanentRedirect,
+			cacheControl:   "public, max-age=86400",
+		},
+		{
+			name:           "permanent with click limit is not cached",
+			link:           &model.URLResponse{OriginalURL: "https://example.com", RedirectType: model.RedirectPermanent, MaxClicks: 10},
+			expectedStatus: http.StatusPermanentRedirect,
+			cacheControl:   "no-store",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := newMockURLService()
+			tt.link.ShortCode = "abc123"
+			mockService.urls["abc123"] = tt.link
+
+			handler := &URLHandler{urlService: mockService, defaultRedirectType: tt.defaultType}
+			router := gin.New()
+			router.GET("/:shortCode", handler.RedirectURL)
+
+			req := httptest.NewRequest("GET", "/abc123", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("RedirectURL() status = %d, want %d", w.Code, tt.expectedStatus)
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("RedirectURL() Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+		})
+	}
+}
+
+func TestURLHandler_PageRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["meta12"] = &model.URLResponse{
+		ShortCode:    "meta12",
+		OriginalURL:  "myapp://open?item=1",
+		RedirectType: model.RedirectMetaRefresh,
+	}
+	mockService.urls["js1234"] = &model.URLResponse{
+		ShortCode:    "js1234",
+		OriginalURL:  "myapp://open?item=2",
+		RedirectType: model.RedirectJavaScript,
+	}
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	t.Run("meta refresh", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/meta12", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusOK)
+		}
+
+		if !strings.Contains(w.Body.String(), `content="0;url=myapp://open?item=1"`) {
+			t.Errorf("RedirectURL() body missing meta refresh: %s", w.Body.String())
+		}
+	})
+
+	t.Run("javascript", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/js1234", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if !strings.Contains(w.Body.String(), `window.location.replace("myapp://open?item=2")`) {
+			t.Errorf("RedirectURL() body missing JS redirect: %s", w.Body.String())
+		}
+
+		if strings.Contains(w.Body.String(), `http-equiv="refresh"`) {
+			t.Error("RedirectURL() JS mode should not include meta refresh")
+		}
+	})
+}
+
+func TestURLHandler_Passthrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["plain1"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "plain1",
+		OriginalURL: "https://example.com",
+		CreatedAt:   time.Now(),
+	}
+	mockService.urls["fwd123"] = &model.URLResponse{
+		ID:           2,
+		ShortCode:    "fwd123",
+		OriginalURL:  "https://example.com",
+		CreatedAt:    time.Now(),
+		ForwardQuery: true,
+		ForwardPath:  true,
+	}
+	mockService.urls["lock12"] = &model.URLResponse{
+		ID:           3,
+		ShortCode:    "lock12",
+		OriginalURL:  "https://example.com",
+		CreatedAt:    time.Now(),
+		ForwardQuery: true,
+		ForwardPath:  true,
+	}
+	mockService.passwords["lock12"] = "secret"
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", handler.RedirectURL)
+	router.GET("/:shortCode/*rest", handler.RedirectURL)
+	router.POST("/:shortCode", handler.PostRedirectURL)
+	router.POST("/:shortCode/*rest", handler.PostRedirectURL)
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"query ignored without passthrough", "/plain1?a=1", http.StatusFound, "https://example.com"},
+		{"extra path without passthrough", "/plain1/docs", http.StatusNotFound, ""},
+		{"trailing slash", "/plain1/", http.StatusFound, "https://example.com"},
+		{"query forwarded", "/fwd123?a=1", http.StatusFound, "https://example.com?a=1"},
+		{"path and query forwarded", "/fwd123/docs?a=1", http.StatusFound, "https://example.com/docs?a=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("RedirectURL() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("RedirectURL() Location = %s, want %s", location, tt.wantLocation)
+			}
+		})
+	}
+
+	t.Run("password form keeps path and query", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/lock12/docs?a=1", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("RedirectURL() status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+		if !strings.Contains(w.Body.String(), `action="/lock12/docs?a=1"`) {
+			t.Error("RedirectURL() password form should post back to the same path and query")
+		}
+
+		form := url.Values{"password": {"secret"}}
+		req = httptest.NewRequest("POST", "/lock12/docs?a=1", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("PostRedirectURL() status = %d, want %d", w.Code, http.StatusSeeOther)
+		}
+		if location := w.Header().Get("Location"); location != "/lock12/docs?a=1" {
+			t.Errorf("PostRedirectURL() Location = %s, want /lock12/docs?a=1", location)
+		}
+	})
+}
+
+type staticGeoLocator map[string]model.Location
+
+func (l staticGeoLocator) Locate(ip string) model.Location {
+	return l[ip]
+}
+
+func TestURLHandler_GeoLocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "abc123",
+		OriginalURL: "https://example.com",
+		CreatedAt:   time.Now(),
+	}
+
+	handler := &URLHandler{
+		urlService: mockService,
+		geoLocator: staticGeoLocator{"192.0.2.1": {Country: "DE", Region: "DE-BE", City: "Berlin"}},
+	}
+	router := gin.New()
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	req := httptest.NewRequest("GET", "/abc123", nil)
+	req.RemoteAddr = "192.0.2.1:12345"
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("RedirectURL() status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	want := model.Location{Country: "DE", Region: "DE-BE", City: "Berlin"}
+	if mockService.lastVisit == nil || mockService.lastVisit.Location != want {
+		t.Errorf("RedirectURL() visit = %+v, want location %+v", mockService.lastVisit, want)
+	}
+}
+
+// userAgentBotDetector признает ботом любой User-Agent с "bot"
+type userAgentBotDetector struct{}
+
+func (userAgentBotDetector) Detect(ctx context.Context, userAgent, clientIP string) string {
+	if strings.Contains(strings.ToLower(userAgent), "bot") {
+		return "bot"
+	}
+	return ""
+}
+
+func TestURLHandler_BotClicks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["once12"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "once12",
+		OriginalURL: "https://example.com/invite",
+		MaxClicks:   1,
+		CreatedAt:   time.Now(),
+	}
+
+	mockService.urls["open12"] = &model.URLResponse{
+		ID:          2,
+		ShortCode:   "open12",
+		OriginalURL: "https://example.com/blog",
+		CreatedAt:   time.Now(),
+	}
+
+	handler := &URLHandler{urlService: mockService, botDetector: userAgentBotDetector{}}
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	visit := func(path, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Превью в мессенджере не расходует одноразовую ссылку и не узнает назначение
+	for i := 0; i < 2; i++ {
+		w := visit("/once12", "Slackbot-LinkExpanding 1.0")
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+			t.Fatalf("RedirectURL() bot = %d %q, want 200 without redirect", w.Code, w.Header().Get("Location"))
+		}
+		if strings.Contains(w.Body.String(), "example.com/invite") {
+			t.Errorf("RedirectURL() bot page reveals destination: %s", w.Body.String())
+		}
+	}
+	if mockService.lastVisit == nil || mockService.lastVisit.Bot != "bot" {
+		t.Errorf("RedirectURL() visit = %+v, want bot", mockService.lastVisit)
+	}
+	if clicks := mockService.urls["once12"].ClickCount; clicks != 0 {
+		t.Errorf("RedirectURL() bot consumed %d clicks, want 0", clicks)
+	}
+
+	if w := visit("/once12", "Mozilla/5.0"); w.Code != http.StatusFound {
+		t.Errorf("RedirectURL() human status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if mockService.lastVisit.Bot != "" {
+		t.Errorf("RedirectURL() human visit Bot = %q, want empty", mockService.lastVisit.Bot)
+	}
+	if w := visit("/once12", "Mozilla/5.0"); w.Code != http.StatusGone {
+		t.Errorf("RedirectURL() second human status = %d, want %d", w.Code, http.StatusGone)
+	}
+
+	// Ссылку без лимита бот открывает, но в пределах квоты кликов workspace
+	if w := visit("/open12", "Googlebot/2.1"); w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/blog" {
+		t.Errorf("RedirectURL() bot on open link = %d %q, want 302", w.Code, w.Header().Get("Location"))
+	}
+	mockService.clickQuota = true
+	if w := visit("/open12", "Googlebot/2.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("RedirectURL() bot over click quota status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestURLHandler_SocialPreview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["card12"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "card12",
+		OriginalURL: "https://example.com/launch",
+		CreatedAt:   time.Now(),
+		URLMetadata: model.URLMetadata{
+			Title:       "Страница назначения",
+			Description: "Описание со страницы",
+		},
+		SocialPreview: model.URLMetadata{
+			Title:    `Запуск <"продукта">`,
+			ImageURL: "https://cdn.example.com/launch.png",
+		},
+	}
+	mockService.urls["plain1"] = &model.URLResponse{
+		ID:          2,
+		ShortCode:   "plain1",
+		OriginalURL: "https://example.com",
+		CreatedAt:   time.Now(),
+	}
+	mockService.urls["secret"] = &model.URLResponse{
+		ID:            3,
+		ShortCode:     "secret",
+		OriginalURL:   "https://example.com/private",
+		CreatedAt:     time.Now(),
+		URLMetadata:   model.URLMetadata{Title: "Закрытая страница"},
+		SocialPreview: model.URLMetadata{Description: "Только по паролю"},
+	}
+	mockService.passwords["secret"] = "hash"
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	visit := func(path, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("unfurler gets card", func(t *testing.T) {
+		w := visit("/card12", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+			t.Fatalf("RedirectURL() status = %d, location = %q, want 200 page", w.Code, w.Header().Get("Location"))
+		}
+		body := w.Body.String()
+		for _, want := range []string{
+			`<meta property="og:title" content="Запуск &lt;&#34;продукта&#34;&gt;">`,
+			`<meta property="og:description" content="Описание со страницы">`,
+			`<meta property="og:image" content="https://cdn.example.com/launch.png">`,
+			`https://example.com/launch`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("RedirectURL() body missing %q", want)
+			}
+		}
+		if mockService.lastVisit.Bot != "slackbot" {
+			t.Errorf("RedirectURL() visit Bot = %q, want slackbot", mockService.lastVisit.Bot)
+		}
+	})
+
+	t.Run("human is redirected", func(t *testing.T) {
+		w := visit("/card12", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/126.0")
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/launch" {
+			t.Errorf("RedirectURL() status = %d, location = %q, want redirect", w.Code, w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("no overrides", func(t *testing.T) {
+		if w := visit("/plain1", "TelegramBot (like TwitterBot)"); w.Code != http.StatusFound {
+			t.Errorf("RedirectURL() status = %d, want %d", w.Code, http.StatusFound)
+		}
+	})
+
+	t.Run("password protected", func(t *testing.T) {
+		w := visit("/secret", "TelegramBot (like TwitterBot)")
+		if w.Code != http.StatusOK {
+			t.Fatalf("RedirectURL() status = %d, want %d", w.Code, http.StatusOK)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "Только по паролю") {
+			t.Error("RedirectURL() body missing override description")
+		}
+		if strings.Contains(body, "Закрытая страница") || strings.Contains(body, "example.com/private") {
+			t.Error("RedirectURL() revealed destination of password-protected link")
+		}
+	})
+}
+
+func TestURLHandler_Fallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	past := time.Now().Add(-time.Hour)
+	broken := &model.LinkHealth{StatusCode: http.StatusNotFound, Error: "unexpected status 404", Failures: 3, BrokenSince: &past}
+
+	mockService := newMockURLService()
+	mockService.urls["off123"] = &model.URLResponse{
+		ID: 1, ShortCode: "off123", OriginalURL: "https://example.com/off",
+		DisabledAt: &past, FallbackURL: "https://example.com/own",
+	}
+	mockService.urls["old123"] = &model.URLResponse{
+		ID: 2, ShortCode: "old123", OriginalURL: "https://example.com/old", NotAfter: &past,
+	}
+	mockService.urls["used12"] = &model.URLResponse{
+		ID: 3, ShortCode: "used12", OriginalURL: "https://example.com/once", MaxClicks: 1, ClickCount: 1,
+	}
+	mockService.urls["dead12"] = &model.URLResponse{
+		ID: 4, ShortCode: "dead12", OriginalURL: "https://example.com/dead", Health: broken,
+	}
+	mockService.urls["abtest"] = &model.URLResponse{
+		ID: 5, ShortCode: "abtest", OriginalURL: "https://example.com/dead", Health: broken,
+		Variants: model.Variants{{Name: "a", Destination: "https://example.com/a", Weight: 1}},
+	}
+	mockService.urls["app123"] = &model.URLResponse{
+		ID: 6, ShortCode: "app123", OriginalURL: "https://example.com/dead", Health: broken,
+		Rules: []model.RoutingRule{{Kind: model.RuleKindOS, Value: model.OSiOS, Destination: "https://apps.apple.com/app/id1"}},
+	}
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	visit := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	t.Run("without workspace fallback", func(t *testing.T) {
+		tests := []struct {
+			path     string
+			status   int
+			location string
+		}{
+			{"/off123", http.StatusFound, "https://example.com/own"},
+			{"/old123", http.StatusGone, ""},
+			{"/used12", http.StatusGone, ""},
+			// Без запасного назначения ведем на основное, даже недоступное
+			{"/dead12", http.StatusFound, "https://example.com/dead"},
+			{"/abtest", http.StatusFound, "https://example.com/a"},
+		}
+		for _, tt := range tests {
+			w := visit(tt.path)
+			if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+			}
+		}
+	})
+
+	mockService.workspaceFallback = "https://example.com/workspace"
+
+	t.Run("with workspace fallback", func(t *testing.T) {
+		tests := []struct {
+			path     string
+			location string
+		}{
+			// Собственное запасное назначение важнее назначения workspace
+			{"/off123", "https://example.com/own"},
+			{"/old123", "https://example.com/workspace"},
+			{"/used12", "https://example.com/workspace"},
+			{"/dead12", "https://example.com/workspace"},
+			// Мониторинг проверяет только OriginalURL, вариант не подменяется
+			{"/abtest", "https://example.com/a"},
+			{"/app123", "https://example.com/workspace"},
+		}
+		for _, tt := range tests {
+			w := visit(tt.path)
+			if w.Code != http.StatusFound || w.Header().Get("Location") != tt.location {
+				t.Errorf("GET %s = %d %q, want 302 %q", tt.path, w.Code, w.Header().Get("Location"), tt.location)
+			}
+		}
+
+		if got := visit("/old123").Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("fallback Cache-Control = %q, want no-store", got)
+		}
+		if len(mockService.events) != 0 {
+			t.Errorf("fallback redirects recorded %d clicks, want 0", len(mockService.events))
+		}
+		if w := visit("/nope12"); w.Code != http.StatusNotFound {
+			t.Errorf("GET unknown link = %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("routing rule avoids broken destination", func(t *testing.T) {
+		tests := []struct {
+			userAgent string
+			location  string
+		}{
+			// Правило ведет на рабочий адрес - запасное назначение не нужно
+			{model.OSiOS, "https://apps.apple.com/app/id1"},
+			{"Mozilla/5.0 (Windows NT 10.0)", "https://example.com/workspace"},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", "/app123", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusFound || w.Header().Get("Location") != tt.location {
+				t.Errorf("GET /app123 as %q = %d %q, want 302 %q", tt.userAgent, w.Code, w.Header().Get("Location"), tt.location)
+			}
+		}
+	})
+}
+
+func TestURLHandler_Moderation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["scam12"] = &model.URLResponse{
+		ID: 1, ShortCode: "scam12", OriginalURL: "https://example.com/login", FallbackURL: "https://example.com/own",
+	}
+	mockService.urls["safe12"] = &model.URLResponse{ID: 2, ShortCode: "safe12", OriginalURL: "https://example.org"}
+	mockService.workspaceFallback = "https://example.com/workspace"
+
+	router := newAPIRouter(mockService, &WorkspaceHandler{service: newMockWorkspaceService(), adminToken: "secret"}, newMockWebhookService())
+	router.LoadHTMLGlob("../../web/static/*")
+	router.GET("/:shortCode", (&URLHandler{urlService: mockService}).RedirectURL)
+
+	request := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("X-Admin-Token", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("report", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			path   string
+			body   string
+			status int
+		}{
+			{"accepted without API key", "/api/report/scam12", `{"reason": "phishing", "details": "asks for bank password"}`, http.StatusAccepted},
+			{"missing reason", "/api/report/scam12", `{"details": "x"}`, http.StatusBadRequest},
+			{"unknown reason", "/api/report/scam12", `{"reason": "ugly"}`, http.StatusBadRequest},
+			{"invalid json", "/api/report/scam12", `{`, http.StatusBadRequest},
+			{"unknown link", "/api/report/nope12", `{"reason": "spam"}`, http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if w := request("POST", tt.path, tt.body, ""); w.Code != tt.status {
+					t.Errorf("POST %s status = %d, want %d: %s", tt.path, w.Code, tt.status, w.Body.String())
+				}
+			})
+		}
+		if reports := mockService.reports["scam12"]; len(reports) != 1 || reports[0].Reason != model.ReportPhishing {
+			t.Errorf("reports = %+v, want one phishing report", reports)
+		}
+	})
+
+	t.Run("admin token required", func(t *testing.T) {
+		paths := []struct{ method, path string }{
+			{"GET", "/api/moderation/queue"},
+			{"GET", "/api/moderation/urls/1/reports"},
+			{"POST", "/api/moderation/urls/1/dismiss"},
+			{"POST", "/api/moderation/urls/1/suspend"},
+			{"POST", "/api/moderation/urls/1/unsuspend"},
+			{"POST", "/api/moderation/urls/1/ban"},
+		}
+		for _, tt := range paths {
+			if w := request(tt.method, tt.path, "", "wrong"); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with wrong token status = %d, want 401", tt.method, tt.path, w.Code)
+			}
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		w := request("GET", "/api/moderation/queue", "", "secret")
+		var body struct {
+			Items []model.ModerationItem `json:"items"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusOK || len(body.Items) != 1 || body.Items[0].URL.ShortCode != "scam12" || body.Items[0].OpenReports != 1 {
+			t.Errorf("GET queue = %d %s", w.Code, w.Body.String())
+		}
+		if w := request("GET", "/api/moderation/urls/1/reports", "", "secret"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "bank password") {
+			t.Errorf("GET reports = %d %s", w.Code, w.Body.String())
+		}
+		if w := request("GET", "/api/moderation/urls/99/reports", "", "secret"); w.Code != http.StatusNotFound {
+			t.Errorf("GET reports of unknown link = %d, want 404", w.Code)
+		}
+		if w := request("POST", "/api/moderation/urls/abc/suspend", "", "secret"); w.Code != http.StatusBadRequest {
+			t.Errorf("POST suspend with invalid id = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("suspended link shows warning", func(t *testing.T) {
+		// Тело решения необязательно
+		if w := request("POST", "/api/moderation/urls/1/suspend", "", "secret"); w.Code != http.StatusOK {
+			t.Fatalf("POST suspend = %d %s", w.Code, w.Body.String())
+		}
+
+		// Приостановка важнее запасного назначения
+		w := request("GET", "/scam12", "", "")
+		if w.Code != http.StatusForbidden || w.Header().Get("Location") != "" {
+			t.Errorf("GET suspended link = %d %q, want 403 without redirect", w.Code, w.Header().Get("Location"))
+		}
+		if !strings.Contains(w.Body.String(), "приостановлена") || strings.Contains(w.Body.String(), "example.com") {
+			t.Errorf("suspended page should warn without revealing destination: %s", w.Body.String())
+		}
+		if got := w.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("suspended page Cache-Control = %q, want no-store", got)
+		}
+		if len(mockService.events) != 0 {
+			t.Errorf("suspended link recorded %d clicks, want 0", len(mockService.events))
+		}
+		if w := request("GET", "/safe12", "", ""); w.Code != http.StatusFound {
+			t.Errorf("GET other link = %d, want 302", w.Code)
+		}
+
+		if w := request("POST", "/api/moderation/urls/1/unsuspend", "", "secret"); w.Code != http.StatusOK {
+			t.Fatalf("POST unsuspend = %d %s", w.Code, w.Body.String())
+		}
+		if w := request("GET", "/scam12", "", ""); w.Code != http.StatusFound {
+			t.Errorf("GET reinstated link = %d, want 302", w.Code)
+		}
+	})
+
+	t.Run("banned link", func(t *testing.T) {
+		w := request("POST", "/api/moderation/urls/1/ban", `{"reason": "phishing", "ban_creator": true}`, "secret")
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST ban = %d %s", w.Code, w.Body.String())
+		}
+		if w := request("GET", "/scam12", "", ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "заблокирована") {
+			t.Errorf("GET banned link = %d, want 403 ban page", w.Code)
+		}
+		if w := request("POST", "/api/moderation/urls/1/unsuspend", "", "secret"); w.Code != http.StatusBadRequest {
+			t.Errorf("POST unsuspend of banned link = %d, want 400", w.Code)
+		}
+	})
+}
+
+func TestURLHandler_GetStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "abc123",
+		OriginalURL: "https://example.com",
+		ClickCount:  3,
+		CreatedAt:   time.Now(),
+	}
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.GET("/api/urls/:shortCode/stats", handler.GetStats)
+
+	tests := []struct {
+		name           string
+		shortCode      string
+		ownerToken     string
+		expectedStatus int
+	}{
+		{"owner", "abc123", "owner-abc123", http.StatusOK},
+		{"without token", "abc123", "", http.StatusForbidden},
+		{"unknown link", "zzz999", "owner-zzz999", http.StatusNotFound},
+		{"invalid code", "a!", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/urls/"+tt.shortCode+"/stats", nil)
+			if tt.ownerToken != "" {
+				req.Header.Set(ownerTokenHeader, tt.ownerToken)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("GetStats() status = %d, want %d", w.Code, tt.expectedStatus)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var stats model.URLStats
+				if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+					t.Fatalf("GetStats() invalid JSON: %v", err)
+				}
+				if stats.TotalClicks != 3 || len(stats.Countries) != 1 {
+					t.Errorf("GetStats() = %+v", stats)
+				}
+			}
+		})
+	}
+}
+
+func TestURLHandler_StreamClicks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com"}
+	// Канал закрыт после перехода: поток отправляет его и завершается
+	mockService.live = make(chan model.ClickEvent, 1)
+	mockService.live <- model.ClickEvent{ID: 7, URLID: 1, ShortCode: "abc123", Country: "DE"}
+	close(mockService.live)
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.GET("/api/urls/:shortCode/live", handler.StreamClicks)
+
+	req := httptest.NewRequest("GET", "/api/urls/abc123/live", nil)
+	req.Header.Set(ownerTokenHeader, "owner-abc123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("StreamClicks() status = %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "event:click\n") || !strings.Contains(body, `"short_code":"abc123"`) || !strings.Contains(body, `"country":"DE"`) {
+		t.Errorf("StreamClicks() body = %q, want click event", body)
+	}
+
+	req = httptest.NewRequest("GET", "/api/urls/abc123/live", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("StreamClicks() without owner token status = %d, want 403", w.Code)
+	}
+}
+
+func TestURLHandler_StickyVariant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{
+		ID:          1,
+		ShortCode:   "abc123",
+		OriginalURL: "https://example.com",
+		CreatedAt:   time.Now(),
+		Variants: []model.Variant{
+			{Name: "a", Destination: "https://example.com/a", Weight: 1},
+			{Name: "b", Destination: "https://example.com/b", Weight: 1},
+		},
+		StickyVariants: true,
+	}
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	t.Run("new visitor gets cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/abc123", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if location := w.Header().Get("Location"); location != "https://example.com/b" {
+			t.Errorf("RedirectURL() Location = %s, want https://example.com/b", location)
+		}
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != variantCookiePrefix+"abc123" || cookies[0].Value != "b" {
+			t.Fatalf("RedirectURL() cookies = %v, want variant cookie", cookies)
+		}
+		if cookies[0].Path != "/abc123" || !cookies[0].HttpOnly {
+			t.Errorf("RedirectURL() cookie = %+v, want HttpOnly cookie scoped to link", cookies[0])
+		}
+	})
+
+	t.Run("returning visitor keeps variant", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/abc123", nil)
+		req.AddCookie(&http.Cookie{Name: variantCookiePrefix + "abc123", Value: "a"})
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if location := w.Header().Get("Location"); location != "https://example.com/a" {
+			t.Errorf("RedirectURL() Location = %s, want https://example.com/a", location)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("RedirectURL() should not reset cookie for unchanged variant")
+		}
+	})
+}
+
+func TestURLHandler_BrandedDomains(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.domains = []model.Domain{{ID: 1, Hostname: "go.brand.com"}}
+	mockService.urls["sale"] = &model.URLResponse{ID: 1, ShortCode: "sale", OriginalURL: "https://example.com/default"}
+	mockService.urls["go.brand.com/sale"] = &model.URLResponse{ID: 2, ShortCode: "sale", OriginalURL: "https://example.com/brand"}
+
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.GET("/:shortCode", handler.RedirectURL)
+	router.GET("/api/urls/:shortCode", handler.GetURL)
+	router.POST("/api/domains", handler.CreateDomain)
+
+	t.Run("redirect by host", func(t *testing.T) {
+		tests := []struct {
+			host     string
+			location string
+		}{
+			{"go.brand.com", "https://example.com/brand"},
+			{"localhost:8080", "https://example.com/default"},
+		}
+
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", "/sale", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusFound || w.Header().Get("Location") != tt.location {
+				t.Errorf("RedirectURL() on %s = %d %s, want %s", tt.host, w.Code, w.Header().Get("Location"), tt.location)
+			}
+		}
+	})
+
+	t.Run("api domain parameter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/urls/sale?domain=go.brand.com", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		var response model.URLResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK || response.OriginalURL != "https://example.com/brand" {
+			t.Errorf("GetURL() = %d %+v, want branded link", w.Code, response)
+		}
+	})
+
+	t.Run("create domain", func(t *testing.T) {
+		for _, want := range []int{http.StatusCreated, http.StatusConflict} {
+			req := httptest.NewRequest("POST", "/api/domains", strings.NewReader(`{"hostname": "brnd.link"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != want {
+				t.Errorf("CreateDomain() status = %d, want %d", w.Code, want)
+			}
+		}
+	})
+}
+
+// mockWorkspaceService: workspace 1 - по умолчанию, ключ "sk_acme" - владелец
+// workspace 2, ключи "sk_<роль>" - участники workspace 2 с этой ролью
+type mockWorkspaceService struct {
+	workspaces  map[int64]*model.Workspace
+	apiRequests map[int64]int64
+	keys        []model.APIKey
+	audit       []model.AuditEntry
+	// auditFilter - фильтр последнего запроса журнала
+	auditFilter model.AuditFilter
+}
+
+func newMockWorkspaceService() *mockWorkspaceService {
+	return &mockWorkspaceService{
+		workspaces: map[int64]*model.Workspace{
+			model.DefaultWorkspaceID: {ID: model.DefaultWorkspaceID, Name: "default"},
+			2:                        {ID: 2, Name: "acme", Quota: model.Quota{APIRequestsPerMonth: 3}},
+		},
+		apiRequests: make(map[int64]int64),
+	}
+}
+
+func (m *mockWorkspaceService) Authenticate(ctx context.Context, rawKey string) (*model.Workspace, *model.APIKey, error) {
+	role := strings.TrimPrefix(rawKey, "sk_")
+	if rawKey == "sk_acme" {
+		role = model.RoleOwner
+	}
+	if !model.IsValidRole(role) {
+		return nil, nil, apperrors.ErrUnauthorized
+	}
+	return m.workspaces[2], &model.APIKey{ID: 100, WorkspaceID: 2, Role: role}, nil
+}
+
+func (m *mockWorkspaceService) GetWorkspace(ctx context.Context, id int64) (*model.Workspace, error) {
+	workspace, exists := m.workspaces[id]
+	if !exists {
+		return nil, apperrors.ErrWorkspaceNotFound
+	}
+	return workspace, nil
+}
+
+func (m *mockWorkspaceService) ConsumeAPIRequest(ctx context.Context, workspace *model.Workspace) error {
+	m.apiRequests[workspace.ID]++
+	if limit := workspace.Quota.APIRequestsPerMonth; limit > 0 && m.apiRequests[workspace.ID] > limit {
+		return apperrors.NewQuotaError("api_requests", limit)
+	}
+	return nil
+}
+
+func (m *mockWorkspaceService) CreateWorkspace(ctx context.Context, req *model.CreateWorkspaceRequest) (*model.CreateWorkspaceResponse, error) {
+	workspace := model.Workspace{ID: int64(len(m.workspaces) + 1), Name: req.Name, Quota: req.Quota}
+	m.workspaces[workspace.ID] = &workspace
+	return &model.CreateWorkspaceResponse{Workspace: workspace, APIKey: model.APIKeyResponse{Key: "sk_new"}}, nil
+}
+
+func (m *mockWorkspaceService) DescribeWorkspace(ctx context.Context, id int64) (*model.WorkspaceResponse, error) {
+	workspace, err := m.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &model.WorkspaceResponse{Workspace: *workspace, Usage: model.Usage{APIRequestsThisMonth: m.apiRequests[id]}}, nil
+}
+
+func (m *mockWorkspaceService) UpdateQuota(ctx context.Context, id int64, quota model.Quota) (*model.Workspace, error) {
+	workspace, err := m.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	workspace.Quota = quota
+	return workspace, nil
+}
+
+func (m *mockWorkspaceService) UpdateWorkspace(ctx context.Context, id int64, req *model.UpdateWorkspaceRequest) (*model.Workspace, error) {
+	workspace, err := m.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.FallbackURL != nil {
+		workspace.FallbackURL = *req.FallbackURL
+	}
+	return workspace, nil
+}
+
+func (m *mockWorkspaceService) CreateAPIKey(ctx context.Context, workspaceID int64, req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
+	role := req.Role
+	if role == "" {
+		role = model.RoleEditor
+	}
+	key := model.APIKey{ID: int64(len(m.keys) + 1), WorkspaceID: workspaceID, Name: req.Name, Role: role}
+	m.keys = append(m.keys, key)
+	return &model.APIKeyResponse{APIKey: key, Key: "sk_generated"}, nil
+}
+
+func (m *mockWorkspaceService) ListAPIKeys(ctx context.Context, workspaceID int64) ([]model.APIKey, error) {
+	keys := make([]model.APIKey, 0)
+	for _, key := range m.keys {
+		if key.WorkspaceID == workspaceID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockWorkspaceService) DeleteAPIKey(ctx context.Context, workspaceID, id int64) error {
+	for i, key := range m.keys {
+		if key.ID == id && key.WorkspaceID == workspaceID {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.ErrAPIKeyNotFound
+}
+
+func (m *mockWorkspaceService) ListAuditLog(ctx context.Context, workspaceID int64, filter model.AuditFilter) (*model.AuditPage, error) {
+	m.auditFilter = filter
+	entries := make([]model.AuditEntry, 0)
+	for _, entry := range m.audit {
+		if entry.WorkspaceID == workspaceID && (filter.Action == "" || entry.Action == filter.Action) {
+			entries = append(entries, entry)
+		}
+	}
+	return &model.AuditPage{Entries: entries}, nil
+}
+
+// newWorkspaceRouter собирает API как в main.go: сервисы за проверкой прав
+func newWorkspaceRouter(urlService URLServiceInterface, workspaceHandler *WorkspaceHandler) *gin.Engine {
+	return newAPIRouter(urlService, workspaceHandler, newMockWebhookService())
+}
+
+// newAPIRouter повторяет маршруты API из main.go с проверкой прав
+func newAPIRouter(urlService URLServiceInterface, workspaceHandler *WorkspaceHandler, webhooks WebhookServiceInterface) *gin.Engine {
+	urlHandler := &URLHandler{urlService: authorizedURLService{urlService}}
+	workspaceHandler.service = authorizedWorkspaceService{workspaceHandler.service}
+	webhookHandler := &WebhookHandler{service: authorizedWebhookService{webhooks}}
+
+	router := gin.New()
+	router.POST("/api/workspaces", workspaceHandler.RequireAdmin(), workspaceHandler.CreateWorkspace)
+	router.PUT("/api/workspaces/:id/quota", workspaceHandler.RequireAdmin(), workspaceHandler.UpdateQuota)
+
+	moderation := router.Group("/api/moderation", workspaceHandler.RequireAdmin())
+	moderation.GET("/queue", urlHandler.ModerationQueue)
+	moderation.GET("/urls/:id/reports", urlHandler.ListReports)
+	moderation.POST("/urls/:id/dismiss", urlHandler.DismissReports)
+	moderation.POST("/urls/:id/suspend", urlHandler.SuspendURL)
+	moderation.POST("/urls/:id/unsuspend", urlHandler.UnsuspendURL)
+	moderation.POST("/urls/:id/ban", urlHandler.BanURL)
+	router.POST("/api/report/:shortCode", urlHandler.ReportURL)
+
+	api := router.Group("/api", workspaceHandler.Authenticate())
+	api.POST("/urls", urlHandler.CreateURL)
+	api.GET("/urls", urlHandler.ListURLs)
+	api.GET("/urls/broken", urlHandler.ListBrokenURLs)
+	api.GET("/urls/:shortCode", urlHandler.GetURL)
+	api.PATCH("/urls/:shortCode", urlHandler.UpdateURL)
+	api.DELETE("/urls/:shortCode", urlHandler.DeleteURL)
+	api.POST("/urls/:shortCode/disable", urlHandler.DisableURL)
+	api.POST("/urls/:shortCode/enable", urlHandler.EnableURL)
+	api.POST("/urls/:shortCode/restore", urlHandler.RestoreURL)
+	api.GET("/urls/:shortCode/versions", urlHandler.ListURLVersions)
+	api.POST("/urls/:shortCode/rollback", urlHandler.RollbackURL)
+	api.GET("/urls/:shortCode/stats", urlHandler.GetStats)
+	api.GET("/urls/:shortCode/live", urlHandler.StreamClicks)
+	api.POST("/domains", urlHandler.CreateDomain)
+	api.GET("/domains", urlHandler.ListDomains)
+	api.GET("/workspace", workspaceHandler.GetWorkspace)
+	api.PATCH("/workspace", workspaceHandler.UpdateWorkspace)
+	api.GET("/workspace/live", urlHandler.StreamWorkspaceClicks)
+	api.POST("/keys", workspaceHandler.CreateAPIKey)
+	api.GET("/keys", workspaceHandler.ListAPIKeys)
+	api.DELETE("/keys/:id", workspaceHandler.DeleteAPIKey)
+	api.GET("/audit", workspaceHandler.ListAuditLog)
+	api.POST("/webhooks", webhookHandler.CreateWebhook)
+	api.GET("/webhooks", webhookHandler.ListWebhooks)
+	api.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+	api.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+	api.POST("/webhooks/:id/deliveries/:deliveryID/replay", webhookHandler.ReplayDelivery)
+	return router
+}
+
+func TestWorkspaceHandler_Authenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	workspaces := newMockWorkspaceService()
+	router := newWorkspaceRouter(mockService, &WorkspaceHandler{service: workspaces})
+
+	createURL := func(header, value string) int {
+		req := httptest.NewRequest("POST", "/api/urls", strings.NewReader(`{"url": "https://example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		status    int
+		workspace int64
+	}{
+		{"anonymous", "", "", http.StatusCreated, model.DefaultWorkspaceID},
+		{"api key header", "X-API-Key", "sk_acme", http.StatusCreated, 2},
+		{"bearer token", "Authorization", "Bearer sk_acme", http.StatusCreated, 2},
+		{"invalid key", "X-API-Key", "sk_wrong", http.StatusUnauthorized, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService.workspace = 0
+			if status := createURL(tt.header, tt.value); status != tt.status {
+				t.Errorf("CreateURL() status = %d, want %d", status, tt.status)
+			}
+			if mockService.workspace != tt.workspace {
+				t.Errorf("CreateURL() workspace = %d, want %d", mockService.workspace, tt.workspace)
+			}
+		})
+	}
+
+	t.Run("api request quota", func(t *testing.T) {
+		// Квота acme - 3 запроса, два уже израсходованы выше
+		if status := createURL("X-API-Key", "sk_acme"); status != http.StatusCreated {
+			t.Fatalf("CreateURL() status = %d, want %d", status, http.StatusCreated)
+		}
+
+		req := httptest.NewRequest("GET", "/api/domains", nil)
+		req.Header.Set("X-API-Key", "sk_acme")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusTooManyRequests || response["error"] != "quota_exceeded" || response["resource"] != "api_requests" {
+			t.Errorf("ListDomains() over quota = %d %v, want 429 quota_exceeded", w.Code, response)
+		}
+	})
+
+	t.Run("require api key", func(t *testing.T) {
+		router := newWorkspaceRouter(mockService, &WorkspaceHandler{service: workspaces, requireAPIKey: true})
+
+		req := httptest.NewRequest("GET", "/api/domains", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("ListDomains() without key status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestWorkspaceHandler_APIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	workspaces := newMockWorkspaceService()
+	workspaces.workspaces[2].Quota = model.Quota{}
+	router := newWorkspaceRouter(newMockURLService(), &WorkspaceHandler{service: workspaces})
+
+	request := func(method, path, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Анонимный доступ к workspace по умолчанию не позволяет управлять ключами
+	if w := request("POST", "/api/keys", `{"name": "ci"}`, ""); w.Code != http.StatusForbidden {
+		t.Errorf("CreateAPIKey() anonymous status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w := request("POST", "/api/keys", `{"name": "ci"}`, "sk_acme")
+	var created model.APIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Key == "" || created.WorkspaceID != 2 {
+		t.Fatalf("CreateAPIKey() = %d %+v", w.Code, created)
+	}
+
+	w = request("GET", "/api/keys", "", "sk_acme")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"ci"`) || strings.Contains(w.Body.String(), "sk_generated") {
+		t.Errorf("ListAPIKeys() = %d %s, want key metadata without secret", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/keys/abc", http.StatusBadRequest},
+		{"/api/keys/1", http.StatusNoContent},
+		{"/api/keys/1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := request("DELETE", tt.path, "", "sk_acme"); w.Code != tt.status {
+			t.Errorf("DeleteAPIKey(%s) status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+
+	w = request("GET", "/api/workspace", "", "sk_acme")
+	var described model.WorkspaceResponse
+	json.Unmarshal(w.Body.Bytes(), &described)
+	if w.Code != http.StatusOK || described.ID != 2 || described.Usage.APIRequestsThisMonth == 0 {
+		t.Errorf("GetWorkspace() = %d %+v", w.Code, described)
+	}
+}
+
+func TestWorkspaceHandler_Admin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	workspaces := newMockWorkspaceService()
+	urlService := newMockURLService()
+
+	request := func(router *gin.Engine, method, path, body, token string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("X-Admin-Token", token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	disabled := newWorkspaceRouter(urlService, &WorkspaceHandler{service: workspaces})
+	if status := request(disabled, "POST", "/api/workspaces", `{"name": "x"}`, "anything"); status != http.StatusForbidden {
+		t.Errorf("CreateWorkspace() without admin token configured status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	router := newWorkspaceRouter(urlService, &WorkspaceHandler{service: workspaces, adminToken: "secret"})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		status int
+	}{
+		{"wrong token", "POST", "/api/workspaces", `{"name": "x"}`, "wrong", http.StatusUnauthorized},
+		{"create", "POST", "/api/workspaces", `{"name": "beta", "quota": {"links": 10}}`, "secret", http.StatusCreated},
+		{"update quota", "PUT", "/api/workspaces/2/quota", `{"links": 5}`, "secret", http.StatusOK},
+		{"unknown workspace", "PUT", "/api/workspaces/42/quota", `{"links": 5}`, "secret", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := request(router, tt.method, tt.path, tt.body, tt.token); status != tt.status {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, status, tt.status)
+			}
+		})
+	}
+
+	if workspaces.workspaces[2].Quota.Links != 5 {
+		t.Errorf("UpdateQuota() Links = %d, want 5", workspaces.workspaces[2].Quota.Links)
+	}
+}
+
+func TestURLHandler_ClickQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com", MaxClicks: 1}
+	mockService.clickQuota = true
+	handler := &URLHandler{urlService: mockService}
+	router := gin.New()
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	req := httptest.NewRequest("GET", "/abc123", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("RedirectURL() over click quota status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	// Отклоненный переход не расходует лимит ссылки
+	if mockService.urls["abc123"].ClickCount != 0 {
+		t.Errorf("RedirectURL() ClickCount = %d, want 0", mockService.urls["abc123"].ClickCount)
+	}
+}
+
+func TestURLHandler_ListBrokenURLs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	brokenSince := time.Now().Add(-time.Hour)
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com"}
+	mockService.urls["gone12"] = &model.URLResponse{
+		ID:          2,
+		ShortCode:   "gone12",
+		OriginalURL: "https://example.com/removed",
+		Health:      &model.LinkHealth{StatusCode: http.StatusNotFound, Failures: 3, BrokenSince: &brokenSince},
+	}
+	router := newWorkspaceRouter(mockService, &WorkspaceHandler{service: newMockWorkspaceService()})
+
+	req := httptest.NewRequest("GET", "/api/urls/broken", nil)
+	req.Header.Set("X-API-Key", "sk_"+model.RoleViewer)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ListBrokenURLs() status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var page model.URLPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("ListBrokenURLs() invalid JSON: %v", err)
+	}
+	if len(page.URLs) != 1 || page.URLs[0].ShortCode != "gone12" || page.URLs[0].Health.StatusCode != http.StatusNotFound {
+		t.Errorf("ListBrokenURLs() = %s, want only gone12", w.Body.String())
+	}
+}
+
+func TestAuthorization_Endpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		created   = http.StatusCreated
+		ok        = http.StatusOK
+		deleted   = http.StatusNoContent
+		forbidden = http.StatusForbidden
+	)
+
+	// Ожидаемый статус для анонимного запроса и каждой роли
+	type statuses struct {
+		anonymous, owner, admin, editor, viewer int
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   statuses
+	}{
+		{"create link", "POST", "/api/urls", `{"url": "https://example.com"}`, statuses{created, created, created, created, forbidden}},
+		{"list links", "GET", "/api/urls?q=launch", "", statuses{http.StatusUnauthorized, ok, ok, ok, ok}},
+		{"list broken links", "GET", "/api/urls/broken", "", statuses{http.StatusUnauthorized, ok, ok, ok, ok}},
+		{"get link", "GET", "/api/urls/abc123", "", statuses{ok, ok, ok, ok, ok}},
+		{"update link", "PATCH", "/api/urls/abc123", `{"max_clicks": 3}`, statuses{ok, ok, ok, ok, forbidden}},
+		{"disable link", "POST", "/api/urls/abc123/disable", "", statuses{ok, ok, ok, ok, forbidden}},
+		{"delete link", "DELETE", "/api/urls/abc123", "", statuses{deleted, deleted, deleted, deleted, forbidden}},
+		{"restore link", "POST", "/api/urls/abc123/restore", "", statuses{ok, ok, ok, ok, forbidden}},
+		{"link versions", "GET", "/api/urls/abc123/versions", "", statuses{ok, ok, ok, ok, ok}},
+		{"rollback link", "POST", "/api/urls/abc123/rollback", `{"version": 1}`, statuses{ok, ok, ok, ok, forbidden}},
+		{"link stats", "GET", "/api/urls/abc123/stats", "", statuses{ok, ok, ok, ok, ok}},
+		{"link live clicks", "GET", "/api/urls/abc123/live", "", statuses{ok, ok, ok, ok, ok}},
+		{"create domain", "POST", "/api/domains", `{"hostname": "%s.example"}`, statuses{forbidden, created, created, forbidden, forbidden}},
+		{"list domains", "GET", "/api/domains", "", statuses{ok, ok, ok, ok, ok}},
+		{"get workspace", "GET", "/api/workspace", "", statuses{ok, ok, ok, ok, ok}},
+		{"update workspace", "PATCH", "/api/workspace", `{"fallback_url": "https://example.com/gone"}`, statuses{forbidden, ok, ok, forbidden, forbidden}},
+		{"workspace live clicks", "GET", "/api/workspace/live", "", statuses{http.StatusUnauthorized, ok, ok, ok, ok}},
+		{"create key", "POST", "/api/keys", `{"role": "viewer"}`, statuses{forbidden, created, created, forbidden, forbidden}},
+		{"list keys", "GET", "/api/keys", "", statuses{forbidden, ok, ok, forbidden, forbidden}},
+		{"delete key", "DELETE", "/api/keys/%d", "", statuses{forbidden, deleted, deleted, forbidden, forbidden}},
+		{"audit log", "GET", "/api/audit", "", statuses{forbidden, ok, ok, forbidden, forbidden}},
+		{"create webhook", "POST", "/api/webhooks", `{"url": "https://crm.example/hooks"}`, statuses{forbidden, created, created, forbidden, forbidden}},
+		{"list webhooks", "GET", "/api/webhooks", "", statuses{forbidden, ok, ok, forbidden, forbidden}},
+		{"webhook deliveries", "GET", "/api/webhooks/1/deliveries", "", statuses{forbidden, ok, ok, forbidden, forbidden}},
+		{"replay delivery", "POST", "/api/webhooks/1/deliveries/1/replay", "", statuses{forbidden, http.StatusAccepted, http.StatusAccepted, forbidden, forbidden}},
+		{"delete webhook", "DELETE", "/api/webhooks/1", "", statuses{forbidden, deleted, deleted, forbidden, forbidden}},
+	}
+
+	for _, tt := range tests {
+		for _, role := range []string{"", model.RoleOwner, model.RoleAdmin, model.RoleEditor, model.RoleViewer} {
+			want := map[string]int{
+				"":               tt.want.anonymous,
+				model.RoleOwner:  tt.want.owner,
+				model.RoleAdmin:  tt.want.admin,
+				model.RoleEditor: tt.want.editor,
+				model.RoleViewer: tt.want.viewer,
+			}[role]
+
+			name := role
+			if name == "" {
+				name = "anonymous"
+			}
+
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				mockService := newMockURLService()
+				mockService.urls["abc123"] = &model.URLResponse{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com"}
+				workspaces := newMockWorkspaceService()
+				workspaces.workspaces[2].Quota = model.Quota{}
+				router := newWorkspaceRouter(mockService, &WorkspaceHandler{service: workspaces})
+
+				path, body := tt.path, tt.body
+				if strings.Contains(path, "%d") {
+					// Удаляется ключ viewer, созданный в workspace участника
+					workspace := int64(2)
+					if role == "" {
+						workspace = model.DefaultWorkspaceID
+					}
+					key, _ := workspaces.CreateAPIKey(context.Background(), workspace, &model.CreateAPIKeyRequest{Role: model.RoleViewer})
+					path = fmt.Sprintf(path, key.ID)
+				}
+				if strings.Contains(body, "%s") {
+					body = fmt.Sprintf(body, name)
+				}
+
+				req := httptest.NewRequest(tt.method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Owner-Token", "owner-abc123")
+				if role != "" {
+					req.Header.Set("X-API-Key", "sk_"+role)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != want {
+					t.Fatalf("%s %s as %s status = %d, want %d: %s", tt.method, path, name, w.Code, want, w.Body.String())
+				}
+				if want == forbidden && !strings.Contains(w.Body.String(), "permission_denied") {
+					t.Errorf("%s %s as %s body = %s, want permission_denied", tt.method, path, name, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestAuthorization_RoleEscalation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	workspaces := newMockWorkspaceService()
+	workspaces.workspaces[2].Quota = model.Quota{}
+	ownerKey, _ := workspaces.CreateAPIKey(context.Background(), 2, &model.CreateAPIKeyRequest{Role: model.RoleOwner})
+	router := newWorkspaceRouter(newMockURLService(), &WorkspaceHandler{service: workspaces})
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"admin cannot issue owner key", "sk_admin", "POST", "/api/keys", `{"role": "owner"}`, http.StatusForbidden},
+		{"admin issues admin key", "sk_admin", "POST", "/api/keys", `{"role": "admin"}`, http.StatusCreated},
+		{"admin cannot revoke owner key", "sk_admin", "DELETE", fmt.Sprintf("/api/keys/%d", ownerKey.ID), "", http.StatusForbidden},
+		{"owner issues owner key", "sk_owner", "POST", "/api/keys", `{"role": "owner"}`, http.StatusCreated},
+		{"owner revokes owner key", "sk_owner", "DELETE", fmt.Sprintf("/api/keys/%d", ownerKey.ID), "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", tt.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+			}
+		})
+	}
+
+	t.Run("other workspace", func(t *testing.T) {
+		ctx := access.WithPrincipal(context.Background(), access.Principal{WorkspaceID: 2, Role: model.RoleOwner, KeyID: 1})
+		service := authorizedURLService{newMockURLService()}
+
+		if _, err := service.ListDomains(ctx, model.DefaultWorkspaceID); !errors.Is(err, apperrors.ErrPermissionDenied) {
+			t.Errorf("ListDomains() in other workspace error = %v, want ErrPermissionDenied", err)
+		}
+		if _, err := service.ListDomains(context.Background(), 2); !errors.Is(err, apperrors.ErrUnauthorized) {
+			t.Errorf("ListDomains() without principal error = %v, want ErrUnauthorized", err)
+		}
+	})
+}
+
+func TestURLHandler_LinkLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockService := newMockURLService()
+	mockService.urls["abc123"] = &model.URLResponse{ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com"}
+	router := newWorkspaceRouter(mockService, &WorkspaceHandler{service: newMockWorkspaceService()})
+	handler := &URLHandler{urlService: mockService}
+	router.GET("/:shortCode", handler.RedirectURL)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		redirect int
+	}{
+		{"update", "PATCH", "/api/urls/abc123", `{"url": "https://example.org"}`, http.StatusOK, http.StatusFound},
+		{"invalid JSON", "PATCH", "/api/urls/abc123", `{"max_clicks": "many"}`, http.StatusBadRequest, http.StatusFound},
+		{"invalid code", "POST", "/api/urls/a!/disable", "", http.StatusBadRequest, http.StatusFound},
+		{"disable", "POST", "/api/urls/abc123/disable", "", http.StatusOK, http.StatusGone},
+		{"enable", "POST", "/api/urls/abc123/enable", "", http.StatusOK, http.StatusFound},
+		{"delete", "DELETE", "/api/urls/abc123", "", http.StatusNoContent, http.StatusNotFound},
+		{"update deleted", "PATCH", "/api/urls/abc123", `{}`, http.StatusNotFound, http.StatusNotFound},
+		{"restore", "POST", "/api/urls/abc123/restore", "", http.StatusOK, http.StatusFound},
+		{"versions", "GET", "/api/urls/abc123/versions", "", http.StatusOK, http.StatusFound},
+		{"rollback", "POST", "/api/urls/abc123/rollback", `{"version": 1}`, http.StatusOK, http.StatusFound},
+		{"rollback unknown", "POST", "/api/urls/abc123/rollback", `{"version": 7}`, http.StatusNotFound, http.StatusFound},
+		{"rollback without version", "POST", "/api/urls/abc123/rollback", `{}`, http.StatusBadRequest, http.StatusFound},
+	}
+
+	for _, step := range steps {
+		w := request(step.method, step.path, step.body)
+		if w.Code != step.status {
+			t.Fatalf("%s: %s %s status = %d, want %d: %s", step.name, step.method, step.path, w.Code, step.status, w.Body.String())
+		}
+
+		w = request("GET", "/abc123", "")
+		if w.Code != step.redirect {
+			t.Fatalf("%s: redirect status = %d, want %d", step.name, w.Code, step.redirect)
+		}
+		if w.Code == http.StatusGone && !strings.Contains(w.Body.String(), "url_disabled") {
+			t.Errorf("%s: redirect body = %s, want url_disabled", step.name, w.Body.String())
+		}
+		if w.Code == http.StatusFound && w.Header().Get("Location") != "https://example.org" {
+			t.Errorf("%s: Location = %s, want updated destination", step.name, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestWorkspaceHandler_AuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	workspaces := newMockWorkspaceService()
+	workspaces.workspaces[2].Quota = model.Quota{}
+	workspaces.audit = []model.AuditEntry{
+		{ID: 1, WorkspaceID: 2, Actor: "api_key:100", Action: model.AuditCreate, ResourceType: model.AuditResourceLink, ResourceID: "abc123"},
+		{ID: 2, WorkspaceID: 2, Actor: "api_key:100", Action: model.AuditDelete, ResourceType: model.AuditResourceLink, ResourceID: "abc123"},
+		{ID: 3, WorkspaceID: model.DefaultWorkspaceID, Actor: "anonymous", Action: model.AuditDelete, ResourceType: model.AuditResourceLink, ResourceID: "xyz789"},
+	}
+	router := newWorkspaceRouter(newMockURLService(), &WorkspaceHandler{service: workspaces})
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-API-Key", "sk_acme")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/api/audit?action=delete&resource_type=link&since=2026-10-01T00:00:00Z&limit=10&before=50")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/audit status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var page model.AuditPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to decode audit page: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].ID != 2 {
+		t.Errorf("GET /api/audit entries = %+v, want only delete of own workspace", page.Entries)
+	}
+
+	filter := workspaces.auditFilter
+	if filter.ResourceType != model.AuditResourceLink || filter.Limit != 10 || filter.BeforeID != 50 ||
+		filter.Since == nil || !filter.Since.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ListAuditLog() filter = %+v", filter)
+	}
+
+	for _, query := range []string{"since=yesterday", "limit=-1", "before=abc"} {
+		if w := request("/api/audit?" + query); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/audit?%s status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var info access.RequestInfo
+	router := gin.New()
+	router.Use(RequestContext())
+	router.GET("/", func(c *gin.Context) {
+		info = access.RequestInfoFromContext(c.Request.Context())
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		keep      bool
+	}{
+		{"from proxy", "req-42.a_b", true},
+		{"generated", "", false},
+		{"replaced invalid", "<script>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "203.0.113.9:1234"
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if info.IP != "203.0.113.9" || info.ID == "" {
+				t.Errorf("RequestInfo = %+v, want client IP and request ID", info)
+			}
+			if (info.ID == tt.requestID) != tt.keep {
+				t.Errorf("RequestInfo.ID = %q, header %q, keep = %v", info.ID, tt.requestID, tt.keep)
+			}
+			if w.Header().Get("X-Request-ID") != info.ID {
+				t.Errorf("X-Request-ID response header = %q, want %q", w.Header().Get("X-Request-ID"), info.ID)
+			}
+		})
+	}
+}
+
+// mockWebhookService: у workspaces 1 и 2 есть подписка с ID 1 и одна ее доставка
+type mockWebhookService struct {
+	webhooks   []model.Webhook
+	deliveries []model.WebhookDelivery
+	limit      int
+}
+
+func newMockWebhookService() *mockWebhookService {
+	m := &mockWebhookService{}
+	for _, workspaceID := range []int64{model.DefaultWorkspaceID, 2} {
+		m.webhooks = append(m.webhooks, model.Webhook{ID: 1, WorkspaceID: workspaceID, URL: "https://crm.example/hooks"})
+		m.deliveries = append(m.deliveries, model.WebhookDelivery{
+			ID: 1, WebhookID: 1, WorkspaceID: workspaceID, Event: model.EventLinkCreated,
+			Payload: json.RawMessage(`{"type":"link.created"}`), Status: model.DeliveryDead, Attempts: 8,
+		})
+	}
+	return m
+}
+
+func (m *mockWebhookService) CreateWebhook(ctx context.Context, workspaceID int64, req *model.CreateWebhookRequest) (*model.WebhookResponse, error) {
+	if err := utils.ValidateURL(req.URL); err != nil {
+		return nil, err
+	}
+	webhook := model.Webhook{ID: int64(len(m.webhooks) + 1), WorkspaceID: workspaceID, URL: req.URL, Events: req.Events, Secret: "whsec_generated"}
+	m.webhooks = append(m.webhooks, webhook)
+	return &model.WebhookResponse{Webhook: webhook, Secret: webhook.Secret}, nil
+}
+
+func (m *mockWebhookService) ListWebhooks(ctx context.Context, workspaceID int64) ([]model.Webhook, error) {
+	webhooks := make([]model.Webhook, 0)
+	for _, webhook := range m.webhooks {
+		if webhook.WorkspaceID == workspaceID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookService) DeleteWebhook(ctx context.Context, workspaceID, id int64) error {
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id && webhook.WorkspaceID == workspaceID {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.ErrWebhookNotFound
+}
+
+func (m *mockWebhookService) ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	m.limit = limit
+	deliveries := make([]model.WebhookDelivery, 0)
+	for _, delivery := range m.deliveries {
+		if delivery.WorkspaceID == workspaceID && delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookService) ReplayDelivery(ctx context.Context, workspaceID, webhookID, deliveryID int64) (*model.WebhookDelivery, error) {
+	for _, delivery := range m.deliveries {
+		if delivery.ID == deliveryID && delivery.WorkspaceID == workspaceID && delivery.WebhookID == webhookID {
+			replay := delivery
+			replay.ID = int64(len(m.deliveries) + 1)
+			replay.Status, replay.Attempts = model.DeliveryPending, 0
+			m.deliveries = append(m.deliveries, replay)
+			return &replay, nil
+		}
+	}
+	return nil, apperrors.ErrDeliveryNotFound
+}
+
+func TestWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	workspaces := newMockWorkspaceService()
+	workspaces.workspaces[2].Quota = model.Quota{}
+	webhooks := newMockWebhookService()
+	router := newAPIRouter(newMockURLService(), &WorkspaceHandler{service: workspaces}, webhooks)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "sk_acme")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/webhooks", `{"url": "https://crm.example/v2", "events": ["link.clicked"]}`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"secret":"whsec_generated"`) {
+		t.Fatalf("POST /api/webhooks = %d %s, want 201 with secret", w.Code, w.Body.String())
+	}
+
+	w = request("GET", "/api/webhooks", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://crm.example/v2") || strings.Contains(w.Body.String(), "whsec_") {
+		t.Errorf("GET /api/webhooks = %d %s, want webhooks without secrets", w.Code, w.Body.String())
+	}
+
+	w = request("GET", "/api/webhooks/1/deliveries?limit=20", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"dead"`) || webhooks.limit != 20 {
+		t.Errorf("GET deliveries = %d %s (limit %d)", w.Code, w.Body.String(), webhooks.limit)
+	}
+
+	w = request("POST", "/api/webhooks/1/deliveries/1/replay", "")
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Errorf("POST replay = %d %s, want 202 with pending delivery", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"invalid url", "POST", "/api/webhooks", `{"url": "ftp://crm.example"}`, http.StatusBadRequest},
+		{"missing url", "POST", "/api/webhooks", `{}`, http.StatusBadRequest},
+		{"invalid limit", "GET", "/api/webhooks/1/deliveries?limit=abc", "", http.StatusBadRequest},
+		{"invalid delivery id", "POST", "/api/webhooks/1/deliveries/abc/replay", "", http.StatusBadRequest},
+		{"unknown delivery", "POST", "/api/webhooks/1/deliveries/99/replay", "", http.StatusNotFound},
+		{"unknown webhook", "DELETE", "/api/webhooks/99", "", http.StatusNotFound},
+		{"delete webhook", "DELETE", "/api/webhooks/1", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := request(tt.method, tt.path, tt.body); w.Code != tt.status {
+				t.Errorf("%s %s status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
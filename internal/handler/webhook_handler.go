@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookServiceInterface interface {
+	CreateWebhook(ctx context.Context, workspaceID int64, req *model.CreateWebhookRequest) (*model.WebhookResponse, error)
+	ListWebhooks(ctx context.Context, workspaceID int64) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, workspaceID, id int64) error
+	ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, workspaceID, webhookID, deliveryID int64) (*model.WebhookDelivery, error)
+}
+
+type WebhookHandler struct {
+	service WebhookServiceInterface
+}
+
+// NewWebhookHandler создает обработчик подписок на события. Права
+// участников проверяются перед вызовом сервиса
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		service: authorizedWebhookService{webhookService},
+	}
+}
+
+// CreateWebhook подписывает URL на события workspace
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req model.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(c.Request.Context(), workspaceID(c), &req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// ListWebhooks возвращает подписки workspace
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks, err := h.service.ListWebhooks(c.Request.Context(), workspaceID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+// DeleteWebhook удаляет подписку workspace
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWebhook(c.Request.Context(), workspaceID(c), id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries возвращает последние доставки подписки (параметр limit)
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	limit, err := intQuery(c, "limit")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(c.Request.Context(), workspaceID(c), id, int(limit))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ReplayDelivery повторно ставит событие доставки в очередь
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryID"), 10, 64)
+	if err != nil || deliveryID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid delivery id",
+		})
+		return
+	}
+
+	delivery, err := h.service.ReplayDelivery(c.Request.Context(), workspaceID(c), id, deliveryID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
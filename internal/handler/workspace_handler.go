@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/access"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// apiKeyHeader - заголовок с API-ключом workspace (альтернатива Authorization: Bearer)
+	apiKeyHeader = "X-API-Key"
+	// adminTokenHeader - заголовок с токеном администратора сервиса
+	adminTokenHeader = "X-Admin-Token"
+)
+
+type WorkspaceServiceInterface interface {
+	Authenticate(ctx context.Context, rawKey string) (*model.Workspace, *model.APIKey, error)
+	GetWorkspace(ctx context.Context, id int64) (*model.Workspace, error)
+	ConsumeAPIRequest(ctx context.Context, workspace *model.Workspace) error
+	CreateWorkspace(ctx context.Context, req *model.CreateWorkspaceRequest) (*model.CreateWorkspaceResponse, error)
+	DescribeWorkspace(ctx context.Context, id int64) (*model.WorkspaceResponse, error)
+	UpdateQuota(ctx context.Context, id int64, quota model.Quota) (*model.Workspace, error)
+	UpdateWorkspace(ctx context.Context, id int64, req *model.UpdateWorkspaceRequest) (*model.Workspace, error)
+	CreateAPIKey(ctx context.Context, workspaceID int64, req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, workspaceID int64) ([]model.APIKey, error)
+	DeleteAPIKey(ctx context.Context, workspaceID, id int64) error
+	ListAuditLog(ctx context.Context, workspaceID int64, filter model.AuditFilter) (*model.AuditPage, error)
+}
+
+// WorkspaceConfig - настройки WorkspaceHandler
+type WorkspaceConfig struct {
+	// AdminToken открывает создание workspaces и изменение квот.
+	// Если пусто, административные endpoints отключены
+	AdminToken string
+	// RequireAPIKey запрещает анонимные запросы к API. Иначе они
+	// относятся к workspace по умолчанию
+	RequireAPIKey bool
+}
+
+type WorkspaceHandler struct {
+	service       WorkspaceServiceInterface
+	adminToken    string
+	requireAPIKey bool
+}
+
+// NewWorkspaceHandler создает обработчик workspaces и API-ключей.
+// Права участников проверяются перед вызовом сервиса
+func NewWorkspaceHandler(workspaceService *service.WorkspaceService, cfg WorkspaceConfig) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		service:       authorizedWorkspaceService{workspaceService},
+		adminToken:    cfg.AdminToken,
+		requireAPIKey: cfg.RequireAPIKey,
+	}
+}
+
+// Authenticate определяет участника запроса по API-ключу (workspace и роль
+// ключа) и учитывает запрос в квоте workspace. Запрос без ключа выполняется
+// в workspace по умолчанию с ролью model.AnonymousRole
+func (h *WorkspaceHandler) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		rawKey := apiKeyFromRequest(c)
+
+		var workspace *model.Workspace
+		principal := access.Principal{Role: model.AnonymousRole}
+		var err error
+		switch {
+		case rawKey != "":
+			var key *model.APIKey
+			workspace, key, err = h.service.Authenticate(ctx, rawKey)
+			if err == nil {
+				principal.Role, principal.KeyID = key.Role, key.ID
+			}
+		case h.requireAPIKey:
+			err = apperrors.ErrUnauthorized
+		default:
+			workspace, err = h.service.GetWorkspace(ctx, model.DefaultWorkspaceID)
+		}
+
+		if err == nil {
+			err = h.service.ConsumeAPIRequest(ctx, workspace)
+		}
+		if err != nil {
+			writeError(c, err)
+			c.Abort()
+			return
+		}
+
+		principal.WorkspaceID = workspace.ID
+		c.Request = c.Request.WithContext(access.WithPrincipal(ctx, principal))
+		c.Next()
+	}
+}
+
+// RequireAdmin пропускает только запросы с токеном администратора
+func (h *WorkspaceHandler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.adminToken == "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "Admin API is disabled",
+			})
+			c.Abort()
+			return
+		}
+
+		token := c.GetHeader(adminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "unauthorized",
+				"message": "Valid admin token required",
+			})
+			c.Abort()
+			return
+		}
+
+		// Операции администратора попадают в журнал аудита от его имени
+		c.Request = c.Request.WithContext(access.WithPrincipal(c.Request.Context(), access.Principal{Admin: true}))
+		c.Next()
+	}
+}
+
+// CreateWorkspace создает workspace и возвращает его первый API-ключ
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	var req model.CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	response, err := h.service.CreateWorkspace(c.Request.Context(), &req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateQuota меняет квоты workspace
+func (h *WorkspaceHandler) UpdateQuota(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	var quota model.Quota
+	if err := c.ShouldBindJSON(&quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	workspace, err := h.service.UpdateQuota(c.Request.Context(), id, quota)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// GetWorkspace возвращает workspace запроса с текущим использованием квот
+func (h *WorkspaceHandler) GetWorkspace(c *gin.Context) {
+	response, err := h.service.DescribeWorkspace(c.Request.Context(), workspaceID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateWorkspace меняет настройки workspace запроса
+func (h *WorkspaceHandler) UpdateWorkspace(c *gin.Context) {
+	var req model.UpdateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	workspace, err := h.service.UpdateWorkspace(c.Request.Context(), workspaceID(c), &req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// CreateAPIKey выдает новый API-ключ workspace
+func (h *WorkspaceHandler) CreateAPIKey(c *gin.Context) {
+	var req model.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid JSON format",
+		})
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(c.Request.Context(), workspaceID(c), &req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys возвращает API-ключи workspace
+func (h *WorkspaceHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.service.ListAPIKeys(c.Request.Context(), workspaceID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// DeleteAPIKey отзывает API-ключ workspace
+func (h *WorkspaceHandler) DeleteAPIKey(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteAPIKey(c.Request.Context(), workspaceID(c), id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListAuditLog возвращает журнал аудита workspace. Параметры запроса:
+// action, resource_type, resource_id, actor, since и until (RFC 3339),
+// limit и before - курсор next_cursor предыдущей страницы
+func (h *WorkspaceHandler) ListAuditLog(c *gin.Context) {
+	filter := model.AuditFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		Actor:        c.Query("actor"),
+	}
+
+	var err error
+	if filter.Since, err = timeQuery(c, "since"); err != nil {
+		writeError(c, err)
+		return
+	}
+	if filter.Until, err = timeQuery(c, "until"); err != nil {
+		writeError(c, err)
+		return
+	}
+	if filter.BeforeID, err = intQuery(c, "before"); err != nil {
+		writeError(c, err)
+		return
+	}
+	limit, err := intQuery(c, "limit")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	filter.Limit = int(limit)
+
+	page, err := h.service.ListAuditLog(c.Request.Context(), workspaceID(c), filter)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// timeQuery разбирает необязательный параметр запроса в формате RFC 3339
+func timeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apperrors.NewValidationError(name, name+" must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+// intQuery разбирает необязательный неотрицательный числовой параметр запроса
+func intQuery(c *gin.Context, name string) (int64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, apperrors.NewValidationError(name, name+" must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// workspaceID возвращает workspace участника запроса. Без middleware
+// Authenticate запрос относится к workspace по умолчанию
+func workspaceID(c *gin.Context) int64 {
+	if p, ok := access.FromContext(c.Request.Context()); ok {
+		return p.WorkspaceID
+	}
+	return model.DefaultWorkspaceID
+}
+
+// apiKeyFromRequest читает API-ключ из X-API-Key или Authorization: Bearer
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		return key
+	}
+
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// idParam разбирает числовой параметр :id, отвечая 400 при ошибке
+func idParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Invalid id",
+		})
+		return 0, false
+	}
+	return id, true
+}
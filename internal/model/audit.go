@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Операции, которые попадают в журнал аудита
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDisable = "disable"
+	AuditEnable  = "enable"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	// AuditRollback - откат настроек ссылки к прежней ревизии
+	AuditRollback = "rollback"
+	// Решения модерации: приостановка ссылки, ее снятие и блокировка
+	// ссылки или workspace
+	AuditSuspend   = "suspend"
+	AuditUnsuspend = "unsuspend"
+	AuditBan       = "ban"
+)
+
+// Типы ресурсов журнала аудита
+const (
+	AuditResourceLink      = "link"
+	AuditResourceDomain    = "domain"
+	AuditResourceAPIKey    = "api_key"
+	AuditResourceWorkspace = "workspace"
+	AuditResourceWebhook   = "webhook"
+)
+
+// AuditEntry - запись журнала аудита. Before и After содержат только
+// изменившиеся поля ресурса (для create - весь ресурс в After, для
+// удаления ключа - весь ресурс в Before)
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	WorkspaceID  int64           `json:"workspace_id"`
+	Actor        string          `json:"actor"`
+	RequestID    string          `json:"request_id,omitempty"`
+	IP           string          `json:"ip,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// PendingAudit собирает запись журнала аудита. Репозиторий вызывает его
+// внутри транзакции изменения, поэтому изменение не сохраняется без записи
+// о нем, а запись уже содержит присвоенные ID
+type PendingAudit func() (*AuditEntry, error)
+
+// AuditFilter - условия выборки журнала. Пустые поля не ограничивают
+// выборку, записи возвращаются от новых к старым
+type AuditFilter struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Actor        string
+	Since        *time.Time
+	Until        *time.Time
+	// BeforeID - курсор: только записи с id меньше BeforeID (0 - с начала)
+	BeforeID int64
+	Limit    int
+}
+
+// AuditPage - страница журнала. NextCursor передается как before
+// для следующей страницы, 0 - страниц больше нет
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextCursor int64        `json:"next_cursor,omitempty"`
+}
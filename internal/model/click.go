@@ -0,0 +1,84 @@
+package model
+
+import "time"
+
+// ClickEvent - отдельный переход по ссылке для аналитики
+type ClickEvent struct {
+	// ID - номер записи в click_events. Событие перехода ссылки с лимитом
+	// уходит в outbox до сохранения записи, тогда ID не заполнен
+	ID         int64     `json:"id,omitempty"`
+	URLID      int64     `json:"url_id"`
+	ShortCode  string    `json:"short_code"`
+	Domain     string    `json:"domain,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Referrer   string    `json:"referrer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	City       string    `json:"city,omitempty"`
+	Variant    string    `json:"variant,omitempty"`
+	// Bot - сигнатура или причина, по которой переход отнесен к ботам
+	// (пусто - переход человека). Переходы ботов не входят в click_count
+	Bot string `json:"bot,omitempty"`
+
+	// WorkspaceID - workspace ссылки, для доставки события подпискам
+	WorkspaceID int64 `json:"-"`
+
+	// ClientIP - адрес посетителя для отпечатка уникальных посетителей,
+	// не сохраняется и не публикуется
+	ClientIP string `json:"-"`
+
+	// Counted - переход уже засчитан в click_count (ConsumeClick ссылки с лимитом)
+	Counted bool `json:"-"`
+}
+
+// NewClickEvent создает событие перехода по ссылке из данных посетителя
+func NewClickEvent(url *URL, visit *Visit, occurredAt time.Time) *ClickEvent {
+	return &ClickEvent{
+		URLID:       url.ID,
+		ShortCode:   url.ShortCode,
+		Domain:      url.Domain,
+		OccurredAt:  occurredAt,
+		Referrer:    visit.Referrer,
+		UserAgent:   visit.UserAgent,
+		Country:     visit.Country,
+		Region:      visit.Region,
+		City:        visit.City,
+		Variant:     visit.Variant,
+		Bot:         visit.Bot,
+		WorkspaceID: url.WorkspaceID,
+		ClientIP:    visit.ClientIP,
+	}
+}
+
+// StatBucket - число переходов для одного значения измерения (страны, города)
+type StatBucket struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// VisitorDayFormat - формат дня в статистике уникальных посетителей
+const VisitorDayFormat = "2006-01-02"
+
+// DailyVisitors - уникальные посетители ссылки за день (UTC)
+type DailyVisitors struct {
+	Date     string `json:"date"`
+	Visitors int64  `json:"visitors"`
+}
+
+// URLStats - статистика переходов по ссылке
+type URLStats struct {
+	ShortCode   string `json:"short_code"`
+	TotalClicks int64  `json:"total_clicks"`
+	// UniqueClicks - приблизительное число уникальных посетителей
+	UniqueClicks int64 `json:"unique_clicks"`
+	// DailyUnique - уникальные посетители по дням за последние 30 дней
+	DailyUnique []DailyVisitors `json:"daily_unique"`
+	// BotClicks - переходы ботов и краулеров (не входят в TotalClicks),
+	// Bots - самые частые из них
+	BotClicks int64        `json:"bot_clicks"`
+	Bots      []StatBucket `json:"bots"`
+	Countries []StatBucket `json:"countries"`
+	Cities    []StatBucket `json:"cities"`
+	Variants  []StatBucket `json:"variants"`
+}
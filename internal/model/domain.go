@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Domain - брендированный домен, на котором открываются короткие ссылки.
+// Коды ссылок уникальны в пределах домена: go.brand.com/sale и brnd.link/sale
+// - разные ссылки
+type Domain struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Hostname    string    `json:"hostname"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateDomainRequest struct {
+	Hostname string `json:"hostname" binding:"required"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// LinkHealth - результат проверки страницы назначения ссылки. Проверяется
+// только OriginalURL: правила и варианты ведут на другие адреса
+type LinkHealth struct {
+	// StatusCode - HTTP-статус последней проверки (0 - ответа не было)
+	StatusCode int `json:"status_code,omitempty"`
+	// LatencyMs - время ответа назначения в миллисекундах
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+	// FinalURL - адрес после всех редиректов
+	FinalURL string `json:"final_url,omitempty"`
+	// Error - причина неудачи: ошибка соединения или статус ответа
+	Error string `json:"error,omitempty"`
+	// Failures - число неудачных проверок подряд
+	Failures  int        `json:"failures,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	// BrokenSince - с какого момента назначение считается недоступным
+	// (nil - доступно)
+	BrokenSince *time.Time `json:"broken_since,omitempty"`
+}
+
+// IsBroken сообщает, что назначение ссылки признано недоступным
+func (h LinkHealth) IsBroken() bool {
+	return h.BrokenSince != nil
+}
@@ -0,0 +1,98 @@
+package model
+
+import "time"
+
+// Причины жалоб на ссылки
+const (
+	ReportPhishing = "phishing"
+	ReportMalware  = "malware"
+	ReportSpam     = "spam"
+	ReportOther    = "other"
+)
+
+// IsValidReportReason проверяет причину жалобы
+func IsValidReportReason(reason string) bool {
+	switch reason {
+	case ReportPhishing, ReportMalware, ReportSpam, ReportOther:
+		return true
+	}
+	return false
+}
+
+// Состояния жалобы: ждет модератора, отклонена или по ней приняты меры
+// (ссылка приостановлена или заблокирована)
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// Решения модерации по ссылке. Приостановку модератор может снять,
+// блокировка - навсегда
+const (
+	ModerationSuspended = "suspended"
+	ModerationBanned    = "banned"
+)
+
+// Moderation - решение модерации по ссылке (пустое - ссылка не ограничена).
+// Ограниченная ссылка вместо редиректа показывает предупреждение
+type Moderation struct {
+	Status string     `json:"status"`
+	Reason string     `json:"reason,omitempty"`
+	At     *time.Time `json:"at,omitempty"`
+}
+
+// IsRestricted сообщает, что ссылка приостановлена или заблокирована
+func (m Moderation) IsRestricted() bool {
+	return m.Status != ""
+}
+
+// IsBanned сообщает, что ссылка заблокирована навсегда
+func (m Moderation) IsBanned() bool {
+	return m.Status == ModerationBanned
+}
+
+// AbuseReport - жалоба посетителя на ссылку
+type AbuseReport struct {
+	ID      int64  `json:"id"`
+	URLID   int64  `json:"url_id"`
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+	// ReporterHash - отпечаток IP отправителя: повторная жалоба того же
+	// посетителя не создает новую, пока открыта прежняя
+	ReporterHash string     `json:"-"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+}
+
+type CreateReportRequest struct {
+	Reason  string `json:"reason" binding:"required"`
+	Details string `json:"details"`
+}
+
+// ReportSummary - открытые жалобы на одну ссылку
+type ReportSummary struct {
+	URLID       int64 `json:"-"`
+	OpenReports int64 `json:"open_reports"`
+	// Reasons - число открытых жалоб по причинам
+	Reasons         map[string]int64 `json:"reasons"`
+	FirstReportedAt time.Time        `json:"first_reported_at"`
+	LastReportedAt  time.Time        `json:"last_reported_at"`
+}
+
+// ModerationItem - ссылка в очереди модерации
+type ModerationItem struct {
+	URL *URLResponse `json:"url"`
+	ReportSummary
+}
+
+// ModerationRequest - решение модератора по ссылке
+type ModerationRequest struct {
+	// Reason - причина для владельца ссылки и журнала аудита
+	Reason string `json:"reason"`
+	// BanCreator - при блокировке заблокировать и автора ссылки: ее
+	// workspace, а для анонимной ссылки - посетителя, создавшего ее.
+	// Все ссылки автора блокируются
+	BanCreator bool `json:"ban_creator"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent - доменное событие, сохраненное в outbox в одной транзакции
+// с изменением, которое его породило. Relay публикует события приемникам
+// и отмечает опубликованными, поэтому событие не теряется и не появляется
+// без изменения, даже если процесс упал между записью и публикацией
+type OutboxEvent struct {
+	ID int64 `json:"-"`
+	// EventID - идентификатор события для получателей: повторные публикации
+	// отправляют тот же ID, по нему можно отбрасывать дубли
+	EventID     string    `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Type        string    `json:"type"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Payload - тело события в формате WebhookEvent
+	Payload json.RawMessage `json:"-"`
+
+	Attempts      int        `json:"-"`
+	NextAttemptAt time.Time  `json:"-"`
+	LastError     string     `json:"-"`
+	PublishedAt   *time.Time `json:"-"`
+}
+
+// PendingEvent собирает событие для outbox. Репозиторий вызывает его внутри
+// транзакции после записи изменения, поэтому данные события уже содержат
+// присвоенные ID (например, ID новой ссылки)
+type PendingEvent func() (*OutboxEvent, error)
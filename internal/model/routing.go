@@ -0,0 +1,106 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Виды правил маршрутизации: по какому признаку посетителя выбирается назначение
+const (
+	RuleKindOS      = "os"
+	RuleKindDevice  = "device"
+	RuleKindCountry = "country"
+	RuleKindRegion  = "region"
+)
+
+// Операционные системы, которые определяются по User-Agent
+const (
+	OSiOS     = "ios"
+	OSAndroid = "android"
+	OSWindows = "windows"
+	OSMacOS   = "macos"
+	OSLinux   = "linux"
+	OSOther   = "other"
+)
+
+// Типы устройств, которые определяются по User-Agent
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// RoutingRule отправляет посетителей, подходящих под условие, на отдельное
+// назначение. Правила проверяются по порядку, первое совпавшее побеждает;
+// если ни одно не подошло, используется основное назначение ссылки
+type RoutingRule struct {
+	Kind        string `json:"kind"`
+	Value       string `json:"value"`
+	Destination string `json:"destination"`
+}
+
+// IsValidRoutingRule проверяет вид правила и допустимость значения для него
+func IsValidRoutingRule(kind, value string) bool {
+	switch kind {
+	case RuleKindOS:
+		switch value {
+		case OSiOS, OSAndroid, OSWindows, OSMacOS, OSLinux, OSOther:
+			return true
+		}
+	case RuleKindDevice:
+		switch value {
+		case DeviceMobile, DeviceTablet, DeviceDesktop:
+			return true
+		}
+	case RuleKindCountry:
+		// ISO 3166-1 alpha-2: DE, US
+		return len(value) == 2 && isUpperAlnum(value, false)
+	case RuleKindRegion:
+		// ISO 3166-2: страна, дефис и код региона до трех символов (US-CA, DE-BE)
+		return len(value) >= 4 && len(value) <= 6 && value[2] == '-' &&
+			isUpperAlnum(value[:2], false) && isUpperAlnum(value[3:], true)
+	}
+	return false
+}
+
+func isUpperAlnum(s string, allowDigits bool) bool {
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (!allowDigits || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// RoutingRules - правила ссылки в порядке проверки. Из БД читаются одной
+// JSON-колонкой, собранной подзапросом к url_routing_rules
+type RoutingRules []RoutingRule
+
+// Scan читает правила из JSON-агрегата
+func (r *RoutingRules) Scan(src any) error {
+	var rules []RoutingRule
+	if err := scanJSON(src, &rules); err != nil {
+		return fmt.Errorf("cannot scan RoutingRules: %w", err)
+	}
+	if len(rules) == 0 {
+		rules = nil
+	}
+	*r = rules
+	return nil
+}
+
+// scanJSON разбирает JSON-значение, прочитанное из БД
+func scanJSON(src any, dst any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported source type %T", src)
+	}
+	return json.Unmarshal(data, dst)
+}
@@ -2,23 +2,343 @@ package model
 
 import "time"
 
+// Типы редиректа: HTTP-статус или HTML-страница для назначений,
+// которые браузер не откроет по заголовку Location (например, deep link приложения)
+const (
+	RedirectMovedPermanently = "301"
+	RedirectFound            = "302"
+	RedirectTemporary        = "307"
+	RedirectPermanent        = "308"
+	RedirectMetaRefresh      = "meta"
+	RedirectJavaScript       = "js"
+
+	DefaultRedirectType = RedirectFound
+)
+
+// Политики разрешения конфликтов при пробросе query string: какой параметр
+// оставить, если он есть и в назначении, и в запросе к короткой ссылке
+const (
+	QueryConflictKeepDestination = "destination"
+	QueryConflictOverride        = "request"
+	QueryConflictAppend          = "append"
+
+	DefaultQueryConflict = QueryConflictKeepDestination
+)
+
+// IsValidQueryConflict проверяет политику конфликтов query string
+func IsValidQueryConflict(policy string) bool {
+	switch policy {
+	case QueryConflictKeepDestination, QueryConflictOverride, QueryConflictAppend:
+		return true
+	}
+	return false
+}
+
+// IsValidRedirectType проверяет тип редиректа
+func IsValidRedirectType(redirectType string) bool {
+	switch redirectType {
+	case RedirectMovedPermanently, RedirectFound, RedirectTemporary, RedirectPermanent,
+		RedirectMetaRefresh, RedirectJavaScript:
+		return true
+	}
+	return false
+}
+
+// IsPermanentRedirect сообщает, что тип редиректа кэшируется браузерами и CDN
+func IsPermanentRedirect(redirectType string) bool {
+	return redirectType == RedirectMovedPermanently || redirectType == RedirectPermanent
+}
+
+// IsPageRedirect сообщает, что редирект выполняется HTML-страницей, а не статусом
+func IsPageRedirect(redirectType string) bool {
+	return redirectType == RedirectMetaRefresh || redirectType == RedirectJavaScript
+}
+
 type URL struct {
 	ID          int64     `json:"id"`
 	OriginalURL string    `json:"original_url"`
 	ShortCode   string    `json:"short_code"`
 	ClickCount  int64     `json:"click_count"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	// PasswordHash - bcrypt-хэш пароля ссылки (пустой, если ссылка не защищена)
+	PasswordHash string `json:"password_hash,omitempty"`
+	// OwnerTokenHash - sha256-хэш токена владельца, выданного при создании
+	OwnerTokenHash string `json:"owner_token_hash,omitempty"`
+	// MaxClicks - максимальное число переходов (0 - без ограничений)
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// NotBefore/NotAfter - окно активности ссылки (nil - без границы)
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// PreviewMode - показывать страницу подтверждения перед редиректом
+	PreviewMode bool `json:"preview_mode,omitempty"`
+	// RedirectType - тип редиректа (пусто - значение по умолчанию из конфигурации)
+	RedirectType string `json:"redirect_type,omitempty"`
+	// ForwardQuery - добавлять query string запроса к назначению
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// QueryConflict - политика для параметров, заданных и в назначении, и в запросе
+	QueryConflict string `json:"query_conflict,omitempty"`
+	// ForwardPath - дописывать путь после короткого кода к пути назначения
+	ForwardPath bool `json:"forward_path,omitempty"`
+	// UTMTemplate - параметры, подставляемые в назначение при каждом переходе
+	UTMTemplate UTMTemplate `json:"utm_template,omitempty"`
+	// Rules - правила выбора назначения по признакам посетителя
+	Rules RoutingRules `json:"rules,omitempty"`
+	// Variants - назначения A/B-теста; если заданы, заменяют OriginalURL
+	Variants Variants `json:"variants,omitempty"`
+	// StickyVariants - закреплять выбранный вариант за посетителем через cookie
+	StickyVariants bool `json:"sticky_variants,omitempty"`
+	// DomainID/Domain - брендированный домен ссылки (nil и пусто - основной)
+	DomainID *int64 `json:"domain_id,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	// WorkspaceID - workspace, которому принадлежит ссылка
+	WorkspaceID int64 `json:"workspace_id"`
+	// DisabledAt - когда ссылка отключена (nil - активна). Отключенная
+	// ссылка не выполняет редирект, но остается доступной через API
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// DeletedAt - когда ссылка удалена (nil - не удалена). Удаленная ссылка
+	// не находится по коду, но ее можно восстановить
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Version - номер текущей ревизии настроек (см. LinkVersion)
+	Version int `json:"version,omitempty"`
+	// URLMetadata - карточка страницы назначения, загружается в фоне после
+	// создания ссылки и смены назначения
+	URLMetadata
+	// SocialPreview - карточка, заданная владельцем: непустые поля заменяют
+	// карточку страницы назначения при превью в мессенджерах и соцсетях
+	SocialPreview URLMetadata `json:"social_preview,omitzero"`
+	// FallbackURL - запасное назначение: куда ведет ссылка, если она
+	// отключена, истекла, исчерпала лимит кликов или ее назначение
+	// недоступно (пусто - запасное назначение workspace)
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// Health - результат последней проверки назначения (см. HealthChecker)
+	Health LinkHealth `json:"health,omitzero"`
+	// Moderation - решение модерации (пусто - ссылка не ограничена).
+	// Владелец ссылки его не меняет
+	Moderation Moderation `json:"moderation,omitzero"`
+	// CreatorHash - отпечаток IP автора анонимной ссылки (workspace по
+	// умолчанию): по нему блокируется автор
+	CreatorHash string `json:"creator_hash,omitempty"`
+
+	// Events - события, которые репозиторий записывает в outbox в одной
+	// транзакции с сохранением ссылки (Create, Update)
+	Events []PendingEvent `json:"-"`
+	// Audit - запись журнала аудита, которую репозиторий добавляет в той
+	// же транзакции (Create, Update). nil - операция не записывается
+	Audit PendingAudit `json:"-"`
+	// LinkQuota - квота ссылок workspace, которую репозиторий проверяет в
+	// транзакции создания или восстановления ссылки (0 - без ограничения)
+	LinkQuota int64 `json:"-"`
+}
+
+// URLMetadata - заголовок, описание и картинка страницы назначения из тегов
+// Open Graph (или <title> и meta description, если их нет)
+type URLMetadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+}
+
+// IsZero сообщает, что карточка пуста
+func (m URLMetadata) IsZero() bool {
+	return m == URLMetadata{}
+}
+
+// Or возвращает карточку, в которой пустые поля m заполнены из fallback
+func (m URLMetadata) Or(fallback URLMetadata) URLMetadata {
+	if m.Title == "" {
+		m.Title = fallback.Title
+	}
+	if m.Description == "" {
+		m.Description = fallback.Description
+	}
+	if m.ImageURL == "" {
+		m.ImageURL = fallback.ImageURL
+	}
+	return m
+}
+
+// IsDisabled сообщает, что ссылка отключена
+func (u *URL) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// IsDeleted сообщает, что ссылка удалена
+func (u *URL) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// HasPerVisitState сообщает, что ответ на переход зависит от состояния ссылки
+// или посетителя. Такие редиректы нельзя кэшировать в браузере и CDN
+func (u *URL) HasPerVisitState() bool {
+	return u.IsPasswordProtected() ||
+		u.IsClickLimited() ||
+		u.NotBefore != nil ||
+		u.NotAfter != nil ||
+		u.PreviewMode ||
+		len(u.UTMTemplate) > 0 ||
+		len(u.Rules) > 0 ||
+		len(u.Variants) > 0
+}
+
+// IsPendingAt сообщает, что ссылка еще не активирована на момент now
+func (u *URL) IsPendingAt(now time.Time) bool {
+	return u.NotBefore != nil && now.Before(*u.NotBefore)
+}
+
+// IsExpiredAt сообщает, что окно активности ссылки закончилось к моменту now
+func (u *URL) IsExpiredAt(now time.Time) bool {
+	return u.NotAfter != nil && !now.Before(*u.NotAfter)
+}
+
+// NextTransition возвращает ближайший после now момент смены состояния
+// ссылки (активация или истечение)
+func (u *URL) NextTransition(now time.Time) (time.Time, bool) {
+	if u.IsPendingAt(now) {
+		return *u.NotBefore, true
+	}
+	if u.NotAfter != nil && now.Before(*u.NotAfter) {
+		return *u.NotAfter, true
+	}
+	return time.Time{}, false
+}
+
+// IsPasswordProtected сообщает, требует ли ссылка пароль перед редиректом
+func (u *URL) IsPasswordProtected() bool {
+	return u.PasswordHash != ""
+}
+
+// IsClickLimited сообщает, ограничено ли число переходов по ссылке
+func (u *URL) IsClickLimited() bool {
+	return u.MaxClicks > 0
+}
+
+// IsExhausted сообщает, что лимит переходов уже исчерпан
+func (u *URL) IsExhausted() bool {
+	return u.IsClickLimited() && u.ClickCount >= u.MaxClicks
 }
 
 type CreateURLRequest struct {
-	URL string `json:"url" binding:"required"`
+	URL      string `json:"url" binding:"required"`
+	Password string `json:"password,omitempty"`
+	// MaxClicks ограничивает число переходов, 1 - одноразовая ссылка
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// NotBefore/NotAfter задают окно активности ссылки (RFC 3339)
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// PreviewMode - показывать назначение и просить подтверждение перед редиректом
+	PreviewMode bool `json:"preview_mode,omitempty"`
+	// RedirectType - 301, 302, 307, 308, meta или js
+	RedirectType string `json:"redirect_type,omitempty"`
+	// ForwardQuery/ForwardPath пробрасывают query string и путь после кода
+	// (/abc123/extra?utm_source=x) в назначение
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// QueryConflict - destination, request или append
+	QueryConflict string `json:"query_conflict,omitempty"`
+	ForwardPath   bool   `json:"forward_path,omitempty"`
+	// UTMTemplate - параметры назначения с плейсхолдерами: {short_code},
+	// {referrer}, {referrer_host}, {country}, {date}
+	UTMTemplate UTMTemplate `json:"utm_template,omitempty"`
+	// Rules - альтернативные назначения по ОС, типу устройства, стране или
+	// региону, например App Store для ios и Google Play для android; url
+	// остается назначением по умолчанию
+	Rules []RoutingRule `json:"rules,omitempty"`
+	// Variants - назначения для A/B-теста с весами. Правила маршрутизации
+	// проверяются раньше, варианты делят только остальной трафик
+	Variants []Variant `json:"variants,omitempty"`
+	// StickyVariants - повторный переход ведет на тот же вариант
+	StickyVariants bool `json:"sticky_variants,omitempty"`
+	// SocialPreview - og:title, og:description и og:image, которые видят
+	// мессенджеры и соцсети вместо карточки страницы назначения
+	SocialPreview *URLMetadata `json:"social_preview,omitempty"`
+	// FallbackURL - куда вести посетителей, когда ссылка недоступна
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// Domain - брендированный домен (например, go.brand.com), зарегистрированный
+	// через /api/v1/domains. Пусто - основной домен приложения
+	Domain string `json:"domain,omitempty"`
 }
 
 type URLResponse struct {
-	ID          int64     `json:"id"`
-	ShortCode   string    `json:"short_code"`
-	OriginalURL string    `json:"original_url"`
-	ShortURL    string    `json:"short_url"`
-	ClickCount  int64     `json:"click_count"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int64  `json:"id"`
+	ShortCode   string `json:"short_code"`
+	OriginalURL string `json:"original_url,omitempty"`
+	ShortURL    string `json:"short_url"`
+	ClickCount  int64  `json:"click_count"`
+	// UniqueClicks - приблизительное число уникальных посетителей (только
+	// в ответе GetURL, в остальных ответах не считается)
+	UniqueClicks      int64         `json:"unique_clicks"`
+	CreatedAt         time.Time     `json:"created_at"`
+	PasswordProtected bool          `json:"password_protected"`
+	MaxClicks         int64         `json:"max_clicks,omitempty"`
+	Exhausted         bool          `json:"exhausted,omitempty"`
+	NotBefore         *time.Time    `json:"not_before,omitempty"`
+	NotAfter          *time.Time    `json:"not_after,omitempty"`
+	PreviewMode       bool          `json:"preview_mode,omitempty"`
+	RedirectType      string        `json:"redirect_type,omitempty"`
+	ForwardQuery      bool          `json:"forward_query,omitempty"`
+	QueryConflict     string        `json:"query_conflict,omitempty"`
+	ForwardPath       bool          `json:"forward_path,omitempty"`
+	UTMTemplate       UTMTemplate   `json:"utm_template,omitempty"`
+	Rules             []RoutingRule `json:"rules,omitempty"`
+	Variants          []Variant     `json:"variants,omitempty"`
+	StickyVariants    bool          `json:"sticky_variants,omitempty"`
+	Domain            string        `json:"domain,omitempty"`
+	DisabledAt        *time.Time    `json:"disabled_at,omitempty"`
+	DeletedAt         *time.Time    `json:"deleted_at,omitempty"`
+	Version           int           `json:"version,omitempty"`
+	URLMetadata
+	SocialPreview URLMetadata `json:"social_preview,omitzero"`
+	FallbackURL   string      `json:"fallback_url,omitempty"`
+	// Health - результат проверки назначения (nil - еще не проверялось)
+	Health *LinkHealth `json:"health,omitempty"`
+	// Moderation - решение модерации (nil - ссылка не ограничена)
+	Moderation *Moderation `json:"moderation,omitempty"`
+
+	// OwnerToken возвращается только один раз - в ответе на создание ссылки
+	OwnerToken string `json:"owner_token,omitempty"`
+}
+
+// UpdateURLRequest - изменение настроек ссылки. Незаданные (nil) поля
+// остаются прежними. Rules и Variants заменяются целиком, пустой список
+// удаляет их. Пароль, домен и код ссылки не меняются
+type UpdateURLRequest struct {
+	URL            *string        `json:"url,omitempty"`
+	MaxClicks      *int64         `json:"max_clicks,omitempty"`
+	NotBefore      *time.Time     `json:"not_before,omitempty"`
+	NotAfter       *time.Time     `json:"not_after,omitempty"`
+	PreviewMode    *bool          `json:"preview_mode,omitempty"`
+	RedirectType   *string        `json:"redirect_type,omitempty"`
+	ForwardQuery   *bool          `json:"forward_query,omitempty"`
+	QueryConflict  *string        `json:"query_conflict,omitempty"`
+	ForwardPath    *bool          `json:"forward_path,omitempty"`
+	UTMTemplate    *UTMTemplate   `json:"utm_template,omitempty"`
+	Rules          *[]RoutingRule `json:"rules,omitempty"`
+	Variants       *[]Variant     `json:"variants,omitempty"`
+	StickyVariants *bool          `json:"sticky_variants,omitempty"`
+	// SocialPreview заменяет карточку целиком, пустая карточка удаляет ее
+	SocialPreview *URLMetadata `json:"social_preview,omitempty"`
+	// FallbackURL - запасное назначение, пустая строка удаляет его
+	FallbackURL *string `json:"fallback_url,omitempty"`
+	// ClearSchedule снимает границы окна активности перед применением
+	// NotBefore/NotAfter
+	ClearSchedule bool `json:"clear_schedule,omitempty"`
+}
+
+// URLFilter - условия выборки ссылок workspace, ссылки возвращаются
+// от новых к старым
+type URLFilter struct {
+	// Query ищет подстроку в коде, назначении, заголовке и описании ссылки
+	Query string
+	// BeforeID - курсор: только ссылки с id меньше BeforeID (0 - с начала)
+	BeforeID int64
+	Limit    int
+	// Broken - только ссылки с недоступным назначением
+	Broken bool
+}
+
+// URLPage - страница списка ссылок. NextCursor передается как before
+// для следующей страницы, 0 - страниц больше нет
+type URLPage struct {
+	URLs       []*URLResponse `json:"urls"`
+	NextCursor int64          `json:"next_cursor,omitempty"`
 }
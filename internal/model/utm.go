@@ -0,0 +1,37 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// UTMTemplate - параметры, которые добавляются к назначению при переходе.
+// Ключ - имя параметра (utm_source, utm_campaign или любой свой), значение -
+// шаблон с плейсхолдерами вида {country} или {referrer_host}
+type UTMTemplate map[string]string
+
+// Value сохраняет шаблон в JSONB-колонку
+func (t UTMTemplate) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]string(t))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan читает шаблон из JSONB-колонки
+func (t *UTMTemplate) Scan(src any) error {
+	var params map[string]string
+	if err := scanJSON(src, &params); err != nil {
+		return fmt.Errorf("cannot scan UTMTemplate: %w", err)
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+	*t = params
+	return nil
+}
@@ -0,0 +1,39 @@
+package model
+
+import "fmt"
+
+// Variant - одно из назначений ссылки для A/B-теста. Посетитель попадает
+// на вариант с вероятностью, пропорциональной весу
+type Variant struct {
+	// Name - метка варианта в статистике (a, b, landing-v2)
+	Name        string `json:"name"`
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`
+}
+
+// Variants - варианты ссылки в порядке создания. Из БД читаются одной
+// JSON-колонкой, собранной подзапросом к url_variants
+type Variants []Variant
+
+// Scan читает варианты из JSON-агрегата
+func (v *Variants) Scan(src any) error {
+	var variants []Variant
+	if err := scanJSON(src, &variants); err != nil {
+		return fmt.Errorf("cannot scan Variants: %w", err)
+	}
+	if len(variants) == 0 {
+		variants = nil
+	}
+	*v = variants
+	return nil
+}
+
+// Find возвращает вариант по имени
+func (v Variants) Find(name string) (Variant, bool) {
+	for _, variant := range v {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
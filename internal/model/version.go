@@ -0,0 +1,100 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LinkSettings - настройки ссылки, которые сохраняются в каждой ревизии:
+// назначение и все, что влияет на редирект. Код, домен, пароль и состояние
+// ссылки (отключена, удалена) в ревизию не входят
+type LinkSettings struct {
+	OriginalURL    string       `json:"original_url"`
+	MaxClicks      int64        `json:"max_clicks,omitempty"`
+	NotBefore      *time.Time   `json:"not_before,omitempty"`
+	NotAfter       *time.Time   `json:"not_after,omitempty"`
+	PreviewMode    bool         `json:"preview_mode,omitempty"`
+	RedirectType   string       `json:"redirect_type,omitempty"`
+	ForwardQuery   bool         `json:"forward_query,omitempty"`
+	QueryConflict  string       `json:"query_conflict,omitempty"`
+	ForwardPath    bool         `json:"forward_path,omitempty"`
+	UTMTemplate    UTMTemplate  `json:"utm_template,omitempty"`
+	Rules          RoutingRules `json:"rules,omitempty"`
+	Variants       Variants     `json:"variants,omitempty"`
+	StickyVariants bool         `json:"sticky_variants,omitempty"`
+	SocialPreview  URLMetadata  `json:"social_preview,omitzero"`
+	FallbackURL    string       `json:"fallback_url,omitempty"`
+}
+
+// Value сохраняет настройки в JSONB-колонку
+func (s LinkSettings) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan читает настройки из JSONB-колонки
+func (s *LinkSettings) Scan(src any) error {
+	var settings LinkSettings
+	if err := scanJSON(src, &settings); err != nil {
+		return fmt.Errorf("cannot scan LinkSettings: %w", err)
+	}
+	*s = settings
+	return nil
+}
+
+// Settings возвращает текущие настройки ссылки
+func (u *URL) Settings() LinkSettings {
+	return LinkSettings{
+		OriginalURL:    u.OriginalURL,
+		MaxClicks:      u.MaxClicks,
+		NotBefore:      u.NotBefore,
+		NotAfter:       u.NotAfter,
+		PreviewMode:    u.PreviewMode,
+		RedirectType:   u.RedirectType,
+		ForwardQuery:   u.ForwardQuery,
+		QueryConflict:  u.QueryConflict,
+		ForwardPath:    u.ForwardPath,
+		UTMTemplate:    u.UTMTemplate,
+		Rules:          u.Rules,
+		Variants:       u.Variants,
+		StickyVariants: u.StickyVariants,
+		SocialPreview:  u.SocialPreview,
+		FallbackURL:    u.FallbackURL,
+	}
+}
+
+// ApplySettings заменяет настройки ссылки настройками ревизии
+func (u *URL) ApplySettings(s LinkSettings) {
+	u.OriginalURL = s.OriginalURL
+	u.MaxClicks = s.MaxClicks
+	u.NotBefore = s.NotBefore
+	u.NotAfter = s.NotAfter
+	u.PreviewMode = s.PreviewMode
+	u.RedirectType = s.RedirectType
+	u.ForwardQuery = s.ForwardQuery
+	u.QueryConflict = s.QueryConflict
+	u.ForwardPath = s.ForwardPath
+	u.UTMTemplate = s.UTMTemplate
+	u.FallbackURL = s.FallbackURL
+	u.Rules = s.Rules
+	u.Variants = s.Variants
+	u.StickyVariants = s.StickyVariants
+	u.SocialPreview = s.SocialPreview
+}
+
+// LinkVersion - ревизия настроек ссылки. Версии нумеруются с 1, откат
+// создает новую ревизию с настройками выбранной
+type LinkVersion struct {
+	Version   int          `json:"version"`
+	Settings  LinkSettings `json:"settings"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RollbackURLRequest struct {
+	Version int `json:"version" binding:"required"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import "net/url"
+
+// Location - местоположение посетителя, определенное по IP
+type Location struct {
+	// Country - ISO-код страны (DE)
+	Country string
+	// Region - ISO 3166-2 код региона (DE-BE)
+	Region string
+	// City - название города на английском
+	City string
+}
+
+// Visit - данные запроса посетителя, влияющие на выбор назначения редиректа
+type Visit struct {
+	// Query - query string запроса к короткой ссылке
+	Query url.Values
+	// ExtraPath - часть пути после короткого кода (/abc123/extra -> /extra)
+	ExtraPath string
+	// UserAgent - заголовок User-Agent запроса
+	UserAgent string
+	// Referrer - заголовок Referer запроса
+	Referrer string
+	// ClientIP - адрес посетителя (для подсчета уникальных посетителей)
+	ClientIP string
+	// Bot - причина, по которой посетитель признан ботом (пусто - человек)
+	Bot string
+	// Location заполняется, если настроена база GeoIP
+	Location
+	// StickyVariant - вариант A/B-теста, закрепленный за посетителем cookie
+	StickyVariant string
+	// Variant - вариант A/B-теста, выбранный для этого перехода
+	Variant string
+	// Primary - переход ведет на основное назначение ссылки (OriginalURL),
+	// а не по правилу маршрутизации или на другой вариант
+	Primary bool
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// События, на которые подписываются webhooks
+const (
+	EventLinkCreated = "link.created"
+	// EventLinkUpdated - изменение настроек или состояния ссылки
+	// (отключение, включение, восстановление, откат)
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+	// EventLinkBroken - назначение ссылки перестало отвечать (см. LinkHealth)
+	EventLinkBroken = "link.broken"
+)
+
+// IsValidEvent проверяет тип события webhook
+func IsValidEvent(event string) bool {
+	switch event {
+	case EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkClicked, EventLinkBroken:
+		return true
+	}
+	return false
+}
+
+// Состояния доставки события webhook
+const (
+	// DeliveryPending - доставка ожидает следующей попытки
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead - попытки исчерпаны, событие перенесено в dead letters
+	DeliveryDead = "dead"
+)
+
+// EventTypes - события подписки, пустой список - все события
+type EventTypes []string
+
+// Value сохраняет события в JSONB-колонку
+func (e EventTypes) Value() (driver.Value, error) {
+	if e == nil {
+		e = EventTypes{}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan читает события из JSONB-колонки
+func (e *EventTypes) Scan(src any) error {
+	var events []string
+	if err := scanJSON(src, &events); err != nil {
+		return fmt.Errorf("cannot scan EventTypes: %w", err)
+	}
+	if len(events) == 0 {
+		events = nil
+	}
+	*e = events
+	return nil
+}
+
+// Webhook - подписка workspace на события: каждое событие отправляется
+// POST-запросом на URL с подписью HMAC-SHA256 секретом подписки
+type Webhook struct {
+	ID          int64      `json:"id"`
+	WorkspaceID int64      `json:"workspace_id"`
+	URL         string     `json:"url"`
+	Events      EventTypes `json:"events"`
+	Secret      string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Subscribed сообщает, подписан ли webhook на событие
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range w.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	// Secret - секрет подписи. Если не задан, генерируется
+	Secret string `json:"secret"`
+}
+
+// WebhookResponse - новая подписка вместе с секретом подписи. Секрет
+// возвращается только при создании
+type WebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookEvent - тело запроса к получателю webhook
+type WebhookEvent struct {
+	// ID - идентификатор события: повторные попытки доставки и replay
+	// отправляют тот же ID, получатель может по нему отбрасывать дубли
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	WorkspaceID int64           `json:"workspace_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// WebhookDelivery - доставка события одному webhook. Payload - тело
+// запроса, неизменное между попытками
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	WorkspaceID    int64           `json:"workspace_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// Target - подписка, куда отправляется доставка (заполняется при выборке
+	// доставок для отправки)
+	Target *Webhook `json:"-"`
+}
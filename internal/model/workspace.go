@@ -0,0 +1,105 @@
+package model
+
+import "time"
+
+// DefaultWorkspaceID - общий workspace: в нем работают запросы без API-ключа
+// и лежат данные, созданные до появления workspaces
+const DefaultWorkspaceID int64 = 1
+
+// Роли участников workspace: от полного доступа к только чтению.
+// Права ролей описаны в пакете access
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// AnonymousRole - роль запросов без API-ключа в workspace по умолчанию
+const AnonymousRole = RoleEditor
+
+// IsValidRole проверяет роль участника workspace
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleAdmin, RoleEditor, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// Quota - ограничения workspace, 0 - без ограничения. Клики и запросы API
+// считаются за календарный месяц (UTC)
+type Quota struct {
+	Links               int64 `json:"links"`
+	ClicksPerMonth      int64 `json:"clicks_per_month"`
+	APIRequestsPerMonth int64 `json:"api_requests_per_month"`
+}
+
+// Workspace - изолированное пространство ссылок, доменов и API-ключей
+type Workspace struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Quota Quota  `json:"quota"`
+	// FallbackURL - запасное назначение ссылок workspace, у которых нет
+	// собственного (см. URL.FallbackURL)
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// BannedAt - когда workspace заблокирован модерацией (nil - активен).
+	// Запросы с ключами заблокированного workspace отклоняются
+	BannedAt  *time.Time `json:"banned_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usage - использование квот workspace
+type Usage struct {
+	Links                int64 `json:"links"`
+	ClicksThisMonth      int64 `json:"clicks_this_month"`
+	APIRequestsThisMonth int64 `json:"api_requests_this_month"`
+}
+
+// WorkspaceResponse - workspace вместе с использованием квот
+type WorkspaceResponse struct {
+	Workspace
+	Usage Usage `json:"usage"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Quota Quota  `json:"quota"`
+}
+
+// UpdateWorkspaceRequest - изменение настроек workspace. Незаданные (nil)
+// поля остаются прежними
+type UpdateWorkspaceRequest struct {
+	// FallbackURL - запасное назначение ссылок, пустая строка удаляет его
+	FallbackURL *string `json:"fallback_url,omitempty"`
+}
+
+// CreateWorkspaceResponse - новый workspace и его первый API-ключ
+type CreateWorkspaceResponse struct {
+	Workspace
+	APIKey APIKeyResponse `json:"api_key"`
+}
+
+// APIKey - ключ доступа к API workspace с правами роли Role. Хранится
+// только хэш ключа, Prefix позволяет узнать ключ в списке
+type APIKey struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Name        string    `json:"name,omitempty"`
+	Role        string    `json:"role"`
+	Prefix      string    `json:"prefix"`
+	KeyHash     string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name,omitempty"`
+	// Role - роль ключа (по умолчанию editor)
+	Role string `json:"role,omitempty"`
+}
+
+// APIKeyResponse - ключ возвращается целиком только один раз, при создании
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key,omitempty"`
+}
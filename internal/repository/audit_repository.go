@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+type PostgresAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditRepository(db *sql.DB) AuditRepository {
+	return &PostgresAuditRepository{
+		db: db,
+	}
+}
+
+// appendAuditQuery добавляет запись журнала аудита
+const appendAuditQuery = `
+	INSERT INTO audit_log (workspace_id, actor, request_id, ip, action,
+		resource_type, resource_id, before, after, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id
+	`
+
+// appendAuditArgs возвращает аргументы для appendAuditQuery
+func appendAuditArgs(entry *model.AuditEntry) []any {
+	return []any{
+		entry.WorkspaceID,
+		entry.Actor,
+		entry.RequestID,
+		entry.IP,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		jsonOrNull(entry.Before),
+		jsonOrNull(entry.After),
+		entry.CreatedAt,
+	}
+}
+
+func (r *PostgresAuditRepository) Append(ctx context.Context, entry *model.AuditEntry) error {
+	err := r.db.QueryRowContext(ctx, appendAuditQuery, appendAuditArgs(entry)...).Scan(&entry.ID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to append audit entry",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// writeAudit собирает запись журнала аудита и добавляет ее в транзакции tx,
+// в которой записано изменение. nil - записывать нечего
+func writeAudit(ctx context.Context, tx *sql.Tx, pending model.PendingAudit) error {
+	if pending == nil {
+		return nil
+	}
+
+	entry, err := pending()
+	if err != nil {
+		return apperrors.NewBusinessError("AUDIT_ERROR", "failed to build audit entry", err)
+	}
+
+	if err := tx.QueryRowContext(ctx, appendAuditQuery, appendAuditArgs(entry)...).Scan(&entry.ID); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to append audit entry", err)
+	}
+
+	return nil
+}
+
+// List возвращает записи workspace от новых к старым. Условия фильтра
+// добавляются в запрос только если заданы
+func (r *PostgresAuditRepository) List(ctx context.Context, workspaceID int64, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	conditions := []string{"workspace_id = $1"}
+	args := []any{workspaceID}
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		where("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		where("resource_id = $%d", filter.ResourceID)
+	}
+	if filter.Actor != "" {
+		where("actor = $%d", filter.Actor)
+	}
+	if filter.Since != nil {
+		where("created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		where("created_at < $%d", *filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		where("id < $%d", filter.BeforeID)
+	}
+
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf(`
+	SELECT id, workspace_id, actor, request_id, ip, action, resource_type,
+		resource_id, before, after, created_at
+	FROM audit_log
+	WHERE %s
+	ORDER BY id DESC
+	LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list audit entries",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	entries := make([]model.AuditEntry, 0)
+	for rows.Next() {
+		var entry model.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.WorkspaceID,
+			&entry.Actor,
+			&entry.RequestID,
+			&entry.IP,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&before,
+			&after,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan audit entry",
+				err,
+			)
+		}
+		entry.Before, entry.After = before, after
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list audit entries",
+			err,
+		)
+	}
+
+	return entries, nil
+}
+
+// jsonOrNull передает пустой JSON как NULL
+func jsonOrNull(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
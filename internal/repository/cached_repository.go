@@ -28,60 +28,95 @@ func NewCachedURLRepository(db *sql.DB, cache *cache.RedisClient) URLRepository
 
 // Create создает новую запись URL
 func (r *CachedURLRepository) Create(ctx context.Context, url *model.URL) error {
-	// Атомарная вставка
-	query := `
-	INSERT INTO urls (original_url, short_code, created_at)
-	VALUES ($1, $2, $3)
-	ON CONFLICT (short_code) DO NOTHING
-	RETURNING id
-	`
-
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		url.OriginalURL,
-		url.ShortCode,
-		url.CreatedAt,
-	).Scan(&url.ID)
-
-	if err == sql.ErrNoRows {
-		return apperrors.ErrShortCodeExists
-	}
-
-	if err != nil {
-		return apperrors.NewBusinessError(
-			"DATABASE_ERROR",
-			"failed to create URL",
-			err,
-		)
+	// Атомарная вставка вместе с правилами маршрутизации
+	if err := insertURL(ctx, r.db, url); err != nil {
+		return err
 	}
 
 	// Кэшируем созданный URL
-	cacheKey := cache.CacheKeys.URL(url.ShortCode)
-	if err := r.cache.Set(ctx, cacheKey, url); err != nil {
+	if err := r.cacheURL(ctx, url, r.cache.DefaultTTL()); err != nil {
 		// Логируем ошибку кэша, но не прерываем операцию
 		log.Printf("Failed to cache URL: %v", err)
 	}
 
 	// Также кэшируем маппинг original URL -> short code для быстрого поиска дубликатов
-	reverseCacheKey := cache.CacheKeys.ShortCode(url.OriginalURL)
-	if err := r.cache.SetString(ctx, reverseCacheKey, url.ShortCode); err != nil {
+	domainCache := r.cacheFor(url.Domain)
+	reverseCacheKey := domainCache.GetKeyBuilder().ShortCode(url.OriginalURL)
+	if err := domainCache.SetString(ctx, reverseCacheKey, url.ShortCode); err != nil {
 		log.Printf("Failed to cache reverse mapping: %v", err)
 	}
 
 	return nil
 }
 
+// cacheURL кэширует URL, ограничивая TTL ближайшей сменой состояния ссылки
+// (активация или истечение). В кэше хранятся сами границы окна активности,
+// а не готовый ответ, но короткий TTL гарантирует, что запись перечитается
+// из БД вовремя даже если расписание ссылки изменили
+func (r *CachedURLRepository) cacheURL(ctx context.Context, url *model.URL, ttl time.Duration) error {
+	if next, ok := url.NextTransition(time.Now()); ok {
+		if until := time.Until(next); until < ttl {
+			ttl = until
+		}
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	linkCache := r.linkCacheFor(url.WorkspaceID, url.Domain)
+	if err := linkCache.SetWithTTL(ctx, linkCache.GetKeyBuilder().URL(url.ShortCode), url, ttl); err != nil {
+		return err
+	}
+
+	domainCache := r.cacheFor(url.Domain)
+	return domainCache.SetWithTTL(ctx, domainCache.GetKeyBuilder().Route(url.ShortCode), url.WorkspaceID, ttl)
+}
+
+// cachedURL читает ссылку из кэша: по коду на домене находится workspace,
+// а по нему - запись ссылки в namespace этого workspace
+func (r *CachedURLRepository) cachedURL(ctx context.Context, domain, shortCode string) (*model.URL, error) {
+	domainCache := r.cacheFor(domain)
+	var workspaceID int64
+	if err := domainCache.Get(ctx, domainCache.GetKeyBuilder().Route(shortCode), &workspaceID); err != nil {
+		return nil, err
+	}
+
+	linkCache := r.linkCacheFor(workspaceID, domain)
+	var url model.URL
+	if err := linkCache.Get(ctx, linkCache.GetKeyBuilder().URL(shortCode), &url); err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// invalidate удаляет ссылку из кэша: следующее чтение пойдет в БД
+func (r *CachedURLRepository) invalidate(ctx context.Context, workspaceID int64, domain, shortCode string) {
+	linkCache := r.linkCacheFor(workspaceID, domain)
+	if err := linkCache.Delete(ctx, linkCache.GetKeyBuilder().URL(shortCode)); err != nil {
+		log.Printf("Failed to invalidate URL cache: %v", err)
+	}
+}
+
+// cacheFor возвращает клиент кэша с ключами в namespace домена: одинаковые
+// коды на разных доменах - разные ссылки. Основной домен остается без namespace
+func (r *CachedURLRepository) cacheFor(domain string) *cache.RedisClient {
+	return r.cache.WithNamespace(domain)
+}
+
+// linkCacheFor возвращает клиент для записей ссылок: ключи в namespace
+// workspace, а внутри него - домена (ws:7:brnd.link:url:abc123)
+func (r *CachedURLRepository) linkCacheFor(workspaceID int64, domain string) *cache.RedisClient {
+	return r.cache.ForWorkspace(workspaceID).WithNamespace(domain)
+}
+
 // GetByShortCode получает URL по короткому коду
-func (r *CachedURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
+func (r *CachedURLRepository) GetByShortCode(ctx context.Context, domain, shortCode string) (*model.URL, error) {
 	// Сначала проверяем кэш
-	cacheKey := cache.CacheKeys.URL(shortCode)
-	var cachedURL model.URL
-
-	err := r.cache.Get(ctx, cacheKey, &cachedURL)
+	cachedURL, err := r.cachedURL(ctx, domain, shortCode)
 	if err == nil {
 		// Cache hit - возвращаем из кэша
-		return &cachedURL, nil
+		return cachedURL, nil
 	}
 
 	if err != cache.ErrCacheMiss {
@@ -90,20 +125,9 @@ func (r *CachedURLRepository) GetByShortCode(ctx context.Context, shortCode stri
 	}
 
 	// Cache miss - идем в БД
-	query := `
-	SELECT id, original_url, short_code, click_count, created_at
-	FROM urls
-	WHERE short_code = $1
-	`
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE ` + byDomainAndShortCode + ` AND deleted_at IS NULL`
 
-	url := &model.URL{}
-	err = r.db.QueryRowContext(ctx, query, shortCode).Scan(
-		&url.ID,
-		&url.OriginalURL,
-		&url.ShortCode,
-		&url.ClickCount,
-		&url.CreatedAt,
-	)
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, domain, shortCode))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("URL with short code '%s': %w", shortCode, apperrors.ErrURLNotFound)
@@ -118,32 +142,131 @@ func (r *CachedURLRepository) GetByShortCode(ctx context.Context, shortCode stri
 	}
 
 	// Кэшируем результат
-	if err := r.cache.Set(ctx, cacheKey, url); err != nil {
+	if err := r.cacheURL(ctx, url, r.cache.DefaultTTL()); err != nil {
 		log.Printf("Failed to cache URL: %v", err)
 	}
 
 	// Синхронизируем счетчик кликов с кэшем
-	if err := r.cache.SetClickCount(ctx, shortCode, url.ClickCount); err != nil {
+	if err := r.cacheFor(domain).SetClickCount(ctx, shortCode, url.ClickCount); err != nil {
 		log.Printf("Failed to cache click count: %v", err)
 	}
 
 	return url, nil
 }
 
+// GetForWorkspace получает ссылку workspace всегда из БД: API изменяет
+// ссылку на основе прочитанного состояния, и оно должно быть актуальным.
+// Удаленные ссылки тоже находятся - их можно восстановить
+func (r *CachedURLRepository) GetForWorkspace(ctx context.Context, workspaceID int64, domain, shortCode string) (*model.URL, error) {
+	return getForWorkspace(ctx, r.db, workspaceID, domain, shortCode)
+}
+
+// Update сохраняет ссылку и удаляет ее из кэша: следующий переход прочитает
+// новые настройки (или не найдет удаленную ссылку)
+func (r *CachedURLRepository) Update(ctx context.Context, url *model.URL, prevVersion int) error {
+	if err := updateURL(ctx, r.db, url, prevVersion); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, url.WorkspaceID, url.Domain, url.ShortCode)
+
+	return nil
+}
+
+// List возвращает ссылки workspace (список не кэшируется)
+func (r *CachedURLRepository) List(ctx context.Context, workspaceID int64, filter model.URLFilter) ([]*model.URL, error) {
+	return listURLs(ctx, r.db, workspaceID, filter)
+}
+
+// UpdateMetadata сохраняет карточку страницы назначения и сбрасывает кэш ссылки
+func (r *CachedURLRepository) UpdateMetadata(ctx context.Context, url *model.URL) (bool, error) {
+	updated, err := updateMetadata(ctx, r.db, url)
+	if err != nil || !updated {
+		return updated, err
+	}
+
+	r.invalidate(ctx, url.WorkspaceID, url.Domain, url.ShortCode)
+
+	return true, nil
+}
+
+// ClaimHealthChecks выбирает ссылки для проверки назначения (всегда из БД)
+func (r *CachedURLRepository) ClaimHealthChecks(ctx context.Context, dueBefore, now time.Time, limit int) ([]*model.URL, error) {
+	return claimHealthChecks(ctx, r.db, dueBefore, now, limit)
+}
+
+// UpdateHealth сохраняет результат проверки назначения и сбрасывает кэш ссылки
+func (r *CachedURLRepository) UpdateHealth(ctx context.Context, url *model.URL, events ...model.PendingEvent) (bool, error) {
+	updated, err := updateHealth(ctx, r.db, url, events)
+	if err != nil || !updated {
+		return updated, err
+	}
+
+	r.invalidate(ctx, url.WorkspaceID, url.Domain, url.ShortCode)
+
+	return true, nil
+}
+
+// GetByID читает ссылку для модерации (всегда из БД)
+func (r *CachedURLRepository) GetByID(ctx context.Context, id int64) (*model.URL, error) {
+	return getURLByID(ctx, r.db, id)
+}
+
+// UpdateModeration сохраняет решение модерации и сразу удаляет ссылку из
+// кэша: приостановленная ссылка не должна открываться из кэша до истечения TTL
+func (r *CachedURLRepository) UpdateModeration(ctx context.Context, url *model.URL) error {
+	if err := updateModeration(ctx, r.db, url); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, url.WorkspaceID, url.Domain, url.ShortCode)
+
+	return nil
+}
+
+// ModerateCreator блокирует ссылки автора и удаляет каждую из кэша
+func (r *CachedURLRepository) ModerateCreator(ctx context.Context, workspaceID int64, creatorHash string, moderation model.Moderation) ([]*model.URL, error) {
+	urls, err := moderateCreator(ctx, r.db, workspaceID, creatorHash, moderation)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, url := range urls {
+		r.invalidate(ctx, url.WorkspaceID, url.Domain, url.ShortCode)
+	}
+
+	return urls, nil
+}
+
+// ListVersions возвращает ревизии ссылки (история не кэшируется)
+func (r *CachedURLRepository) ListVersions(ctx context.Context, urlID int64) ([]model.LinkVersion, error) {
+	return listVersions(ctx, r.db, urlID)
+}
+
+// GetVersion возвращает ревизию ссылки
+func (r *CachedURLRepository) GetVersion(ctx context.Context, urlID int64, version int) (*model.LinkVersion, error) {
+	return getVersion(ctx, r.db, urlID, version)
+}
+
+// CountByWorkspace считает ссылки workspace (для квоты - всегда из БД)
+func (r *CachedURLRepository) CountByWorkspace(ctx context.Context, workspaceID int64) (int64, error) {
+	return countByWorkspace(ctx, r.db, workspaceID)
+}
+
 // ExistsByShortCode проверяет существование короткого кода
-func (r *CachedURLRepository) ExistsByShortCode(ctx context.Context, shortCode string) (bool, error) {
+func (r *CachedURLRepository) ExistsByShortCode(ctx context.Context, domain, shortCode string) (bool, error) {
 	// Сначала проверяем кэш
-	cacheKey := cache.CacheKeys.URL(shortCode)
-	exists, err := r.cache.Exists(ctx, cacheKey)
+	domainCache := r.cacheFor(domain)
+	exists, err := domainCache.Exists(ctx, domainCache.GetKeyBuilder().Route(shortCode))
 	if err == nil && exists {
 		return true, nil
 	}
 
 	// Проверяем в БД
-	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)`
+	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE ` + byDomainAndShortCode + `)`
 
 	var dbExists bool
-	err = r.db.QueryRowContext(ctx, query, shortCode).Scan(&dbExists)
+	err = r.db.QueryRowContext(ctx, query, domain, shortCode).Scan(&dbExists)
 	if err != nil {
 		return false, apperrors.NewBusinessError(
 			"DATABASE_ERROR",
@@ -156,72 +279,69 @@ func (r *CachedURLRepository) ExistsByShortCode(ctx context.Context, shortCode s
 }
 
 // IncrementClickCount увеличивает счетчик кликов
-func (r *CachedURLRepository) IncrementClickCount(ctx context.Context, id int64) error {
-	// Обновляем в БД
-	query := `
-	UPDATE urls
-	SET click_count = click_count + 1
-	WHERE id = $1
-	RETURNING short_code, click_count
-	`
-
-	var shortCode string
-	var newCount int64
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&shortCode, &newCount)
+func (r *CachedURLRepository) IncrementClickCount(ctx context.Context, id int64, events ...model.PendingEvent) error {
+	// Обновляем в БД вместе с событиями outbox
+	rollup, err := rollupClick(ctx, r.db, incrementClickQuery, id, events)
 	if err == sql.ErrNoRows {
 		return fmt.Errorf("URL with ID %d: %w", id, apperrors.ErrURLNotFound)
 	}
-
 	if err != nil {
-		return apperrors.NewBusinessError(
-			"DATABASE_ERROR",
-			"failed to increment click count",
-			err,
-		)
+		return err
 	}
 
-	// Обновляем счетчик в кэше
-	if err := r.cache.SetClickCount(ctx, shortCode, newCount); err != nil {
-		log.Printf("Failed to update click count in cache: %v", err)
+	// Инвалидируем кэш URL чтобы при следующем запросе обновился click_count
+	r.syncClickCount(ctx, rollup)
+	return nil
+}
+
+// ConsumeClick атомарно засчитывает переход по ссылке с лимитом кликов.
+// Источник истины - условный UPDATE в БД, кэш только обновляется после него
+func (r *CachedURLRepository) ConsumeClick(ctx context.Context, id int64, events ...model.PendingEvent) (int64, error) {
+	rollup, err := rollupClick(ctx, r.db, consumeClickQuery, id, events)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("URL with ID %d: %w", id, apperrors.ErrURLExhausted)
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	// Инвалидируем кэш URL чтобы при следующем запросе обновился click_count
-	cacheKey := cache.CacheKeys.URL(shortCode)
-	if err := r.cache.Delete(ctx, cacheKey); err != nil {
-		log.Printf("Failed to invalidate URL cache: %v", err)
+	// Инвалидируем кэш URL, чтобы исчерпанная ссылка сразу отдавала 410
+	r.syncClickCount(ctx, rollup)
+	return rollup.count, nil
+}
+
+// syncClickCount обновляет счетчик кликов в кэше и удаляет закэшированную
+// ссылку, чтобы следующее чтение получило новый click_count
+func (r *CachedURLRepository) syncClickCount(ctx context.Context, rollup *clickRollup) {
+	domainCache := r.cacheFor(rollup.domain)
+	if err := domainCache.SetClickCount(ctx, rollup.shortCode, rollup.count); err != nil {
+		log.Printf("Failed to update click count in cache: %v", err)
 	}
 
-	return nil
+	r.invalidate(ctx, rollup.workspaceID, rollup.domain, rollup.shortCode)
 }
 
-// GetByOriginalURL ищет существующий короткий код для URL (для предотвращения дубликатов)
+// GetByOriginalURL ищет существующий короткий код для URL на основном домене
+// (для предотвращения дубликатов)
 func (r *CachedURLRepository) GetByOriginalURL(ctx context.Context, originalURL string) (*model.URL, error) {
 	// Проверяем кэш обратного маппинга
-	reverseCacheKey := cache.CacheKeys.ShortCode(originalURL)
+	reverseCacheKey := r.cache.GetKeyBuilder().ShortCode(originalURL)
 	shortCode, err := r.cache.GetString(ctx, reverseCacheKey)
 	if err == nil && shortCode != "" {
 		// Нашли в кэше, получаем полный URL
-		return r.GetByShortCode(ctx, shortCode)
+		return r.GetByShortCode(ctx, "", shortCode)
 	}
 
 	// Ищем в БД
 	query := `
-	SELECT id, original_url, short_code, click_count, created_at
+	SELECT ` + urlColumns + `
 	FROM urls
-	WHERE original_url = $1
+	WHERE original_url = $1 AND domain_id IS NULL
 	ORDER BY created_at DESC
 	LIMIT 1
 	`
 
-	url := &model.URL{}
-	err = r.db.QueryRowContext(ctx, query, originalURL).Scan(
-		&url.ID,
-		&url.OriginalURL,
-		&url.ShortCode,
-		&url.ClickCount,
-		&url.CreatedAt,
-	)
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, originalURL))
 
 	if err == sql.ErrNoRows {
 		return nil, apperrors.ErrURLNotFound
@@ -240,15 +360,15 @@ func (r *CachedURLRepository) GetByOriginalURL(ctx context.Context, originalURL
 		log.Printf("Failed to cache reverse mapping: %v", err)
 	}
 
-	cacheKey := cache.CacheKeys.URL(url.ShortCode)
-	if err := r.cache.Set(ctx, cacheKey, url); err != nil {
+	if err := r.cacheURL(ctx, url, r.cache.DefaultTTL()); err != nil {
 		log.Printf("Failed to cache URL: %v", err)
 	}
 
 	return url, nil
 }
 
-// BatchIncrementClickCount для массового обновления счетчиков (из Redis в БД)
+// BatchIncrementClickCount для массового обновления счетчиков (из Redis в БД).
+// Ключи - коды ссылок основного домена
 func (r *CachedURLRepository) BatchIncrementClickCount(ctx context.Context, updates map[string]int64) error {
 	if len(updates) == 0 {
 		return nil
@@ -263,7 +383,7 @@ func (r *CachedURLRepository) BatchIncrementClickCount(ctx context.Context, upda
 	stmt, err := tx.PrepareContext(ctx, `
 		UPDATE urls 
 		SET click_count = click_count + $1 
-		WHERE short_code = $2
+		WHERE short_code = $2 AND domain_id IS NULL
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -279,11 +399,13 @@ func (r *CachedURLRepository) BatchIncrementClickCount(ctx context.Context, upda
 	return tx.Commit()
 }
 
-// WarmupCache предзагружает популярные URL в кэш
+// WarmupCache предзагружает популярные URL в кэш. Удаленные и ограниченные
+// модерацией ссылки не загружаются: из кэша они открывались бы до истечения TTL
 func (r *CachedURLRepository) WarmupCache(ctx context.Context, limit int) error {
 	query := `
-	SELECT id, original_url, short_code, click_count, created_at
+	SELECT ` + urlColumns + `
 	FROM urls
+	WHERE deleted_at IS NULL AND moderation_status = ''
 	ORDER BY click_count DESC, created_at DESC
 	LIMIT $1
 	`
@@ -296,14 +418,13 @@ func (r *CachedURLRepository) WarmupCache(ctx context.Context, limit int) error
 
 	count := 0
 	for rows.Next() {
-		var url model.URL
-		if err := rows.Scan(&url.ID, &url.OriginalURL, &url.ShortCode, &url.ClickCount, &url.CreatedAt); err != nil {
+		url, err := scanURL(rows)
+		if err != nil {
 			log.Printf("Failed to scan URL: %v", err)
 			continue
 		}
 
-		cacheKey := cache.CacheKeys.URL(url.ShortCode)
-		if err := r.cache.SetWithTTL(ctx, cacheKey, &url, 24*time.Hour); err != nil {
+		if err := r.cacheURL(ctx, url, 24*time.Hour); err != nil {
 			log.Printf("Failed to cache URL %s: %v", url.ShortCode, err)
 		} else {
 			count++
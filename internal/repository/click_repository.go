@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+// Измерения, по которым можно группировать переходы
+const (
+	DimensionCountry = "country"
+	DimensionCity    = "city"
+	DimensionVariant = "variant"
+	// DimensionBot группирует переходы ботов по сигнатуре
+	DimensionBot = "bot"
+)
+
+// clickDimension - SQL-выражение измерения и условие на учитываемые переходы
+type clickDimension struct {
+	expression string
+	filter     string
+}
+
+// clickDimensions сопоставляет измерение с SQL. Значения подставляются
+// в запрос, поэтому принимаются только известные измерения. Переходы без
+// значения (нет базы GeoIP, ссылка без вариантов) не группируются, переходы
+// ботов учитываются только в своем измерении
+var clickDimensions = map[string]clickDimension{
+	DimensionCountry: {"country", "country <> '' AND bot = ''"},
+	// Один и тот же город может быть в разных странах
+	DimensionCity:    {"city || ', ' || country", "city <> '' AND bot = ''"},
+	DimensionVariant: {"variant", "variant <> '' AND bot = ''"},
+	DimensionBot:     {"bot", "bot <> ''"},
+}
+
+type PostgresClickRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresClickRepository(db *sql.DB) ClickRepository {
+	return &PostgresClickRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresClickRepository) Create(ctx context.Context, event *model.ClickEvent) error {
+	query := `
+	INSERT INTO click_events (url_id, occurred_at, referrer, user_agent, country, region, city, variant, bot)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		event.URLID,
+		event.OccurredAt,
+		event.Referrer,
+		event.UserAgent,
+		event.Country,
+		event.Region,
+		event.City,
+		event.Variant,
+		event.Bot,
+	).Scan(&event.ID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to save click event",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresClickRepository) CountBy(ctx context.Context, urlID int64, dimension string, limit int) ([]model.StatBucket, error) {
+	dim, ok := clickDimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown click dimension %q", dimension)
+	}
+
+	query := `
+	SELECT ` + dim.expression + ` AS value, COUNT(*) AS clicks
+	FROM click_events
+	WHERE url_id = $1 AND ` + dim.filter + `
+	GROUP BY value
+	ORDER BY clicks DESC, value
+	LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, urlID, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to count clicks",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	buckets := make([]model.StatBucket, 0)
+	for rows.Next() {
+		var bucket model.StatBucket
+		if err := rows.Scan(&bucket.Value, &bucket.Clicks); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan click stats",
+				err,
+			)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read click stats",
+			err,
+		)
+	}
+
+	return buckets, nil
+}
+
+func (r *PostgresClickRepository) CountBotClicks(ctx context.Context, urlID int64) (int64, error) {
+	query := `SELECT COUNT(*) FROM click_events WHERE url_id = $1 AND bot <> ''`
+
+	var count int64
+	if err := r.db.QueryRowContext(ctx, query, urlID).Scan(&count); err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to count bot clicks",
+			err,
+		)
+	}
+
+	return count, nil
+}
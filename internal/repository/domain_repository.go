@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+type PostgresDomainRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresDomainRepository(db *sql.DB) DomainRepository {
+	return &PostgresDomainRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresDomainRepository) Create(ctx context.Context, domain *model.Domain) error {
+	query := `
+	INSERT INTO domains (workspace_id, hostname, created_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (hostname) DO NOTHING
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query, domain.WorkspaceID, domain.Hostname, domain.CreatedAt).Scan(&domain.ID)
+	if err == sql.ErrNoRows {
+		return apperrors.ErrDomainExists
+	}
+
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to create domain",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresDomainRepository) GetByHostname(ctx context.Context, hostname string) (*model.Domain, error) {
+	query := `SELECT id, workspace_id, hostname, created_at FROM domains WHERE hostname = $1`
+
+	domain := &model.Domain{}
+	err := r.db.QueryRowContext(ctx, query, hostname).Scan(&domain.ID, &domain.WorkspaceID, &domain.Hostname, &domain.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("domain '%s': %w", hostname, apperrors.ErrDomainNotFound)
+	}
+
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get domain",
+			err,
+		)
+	}
+
+	return domain, nil
+}
+
+func (r *PostgresDomainRepository) List(ctx context.Context, workspaceID int64) ([]model.Domain, error) {
+	query := `SELECT id, workspace_id, hostname, created_at FROM domains WHERE workspace_id = $1 ORDER BY hostname`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list domains",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	domains := make([]model.Domain, 0)
+	for rows.Next() {
+		var domain model.Domain
+		if err := rows.Scan(&domain.ID, &domain.WorkspaceID, &domain.Hostname, &domain.CreatedAt); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan domain",
+				err,
+			)
+		}
+		domains = append(domains, domain)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read domains",
+			err,
+		)
+	}
+
+	return domains, nil
+}
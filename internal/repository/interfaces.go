@@ -2,12 +2,168 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"github.com/Kosench/go-url-shortener/internal/model"
 )
 
+// URLRepository хранит ссылки. Короткий код уникален в пределах домена,
+// domain - имя брендированного домена, пустая строка - основной домен
 type URLRepository interface {
+	// Create и Update записывают url.Events в outbox в той же транзакции
 	Create(ctx context.Context, url *model.URL) error
-	GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error)
-	ExistsByShortCode(ctx context.Context, shortCode string) (bool, error)
-	IncrementClickCount(ctx context.Context, id int64) error
+	// GetByShortCode ищет ссылку для редиректа: домен и код однозначно
+	// определяют ссылку и ее workspace
+	GetByShortCode(ctx context.Context, domain, shortCode string) (*model.URL, error)
+	// GetForWorkspace ищет ссылку только среди ссылок workspace (для API),
+	// включая удаленные
+	GetForWorkspace(ctx context.Context, workspaceID int64, domain, shortCode string) (*model.URL, error)
+	CountByWorkspace(ctx context.Context, workspaceID int64) (int64, error)
+	// List возвращает неудаленные ссылки workspace по фильтру
+	List(ctx context.Context, workspaceID int64, filter model.URLFilter) ([]*model.URL, error)
+	// Update сохраняет изменяемые поля ссылки, заменяя правила и варианты,
+	// если ее ревизия все еще prevVersion, иначе возвращает ErrURLConflict.
+	// Если url.Version - новый номер, сохраняется ревизия настроек
+	Update(ctx context.Context, url *model.URL, prevVersion int) error
+	// UpdateMetadata сохраняет url.URLMetadata, если назначение ссылки все
+	// еще url.OriginalURL. false - ссылки нет или назначение сменилось
+	UpdateMetadata(ctx context.Context, url *model.URL) (bool, error)
+	// ClaimHealthChecks выбирает до limit активных ссылок, назначение которых
+	// не проверялось с dueBefore, и отмечает их проверенными в now, чтобы
+	// другие экземпляры сервиса их не взяли
+	ClaimHealthChecks(ctx context.Context, dueBefore, now time.Time, limit int) ([]*model.URL, error)
+	// UpdateHealth сохраняет url.Health и записывает events в outbox, если
+	// назначение ссылки все еще url.OriginalURL. false - ссылки нет или
+	// назначение сменилось
+	UpdateHealth(ctx context.Context, url *model.URL, events ...model.PendingEvent) (bool, error)
+	// GetByID ищет ссылку в любом workspace, включая удаленные (для модерации)
+	GetByID(ctx context.Context, id int64) (*model.URL, error)
+	// UpdateModeration сохраняет url.Moderation. Решение по заблокированной
+	// ссылке не меняется - тогда возвращается ErrURLSuspended
+	UpdateModeration(ctx context.Context, url *model.URL) error
+	// ModerateCreator применяет moderation ко всем не заблокированным ссылкам
+	// workspace, а если задан creatorHash - только к ссылкам этого автора.
+	// Возвращает измененные ссылки
+	ModerateCreator(ctx context.Context, workspaceID int64, creatorHash string, moderation model.Moderation) ([]*model.URL, error)
+	// ListVersions возвращает ревизии ссылки от новых к старым
+	ListVersions(ctx context.Context, urlID int64) ([]model.LinkVersion, error)
+	// GetVersion возвращает ErrVersionNotFound, если ревизии нет
+	GetVersion(ctx context.Context, urlID int64, version int) (*model.LinkVersion, error)
+	ExistsByShortCode(ctx context.Context, domain, shortCode string) (bool, error)
+	// IncrementClickCount засчитывает переход и записывает events в outbox
+	// в одной транзакции
+	IncrementClickCount(ctx context.Context, id int64, events ...model.PendingEvent) error
+	// ConsumeClick атомарно засчитывает переход по ссылке с лимитом кликов.
+	// Возвращает ErrURLExhausted, если лимит уже исчерпан (events тогда
+	// не записываются)
+	ConsumeClick(ctx context.Context, id int64, events ...model.PendingEvent) (int64, error)
+}
+
+// ClickRepository хранит события переходов для аналитики
+type ClickRepository interface {
+	Create(ctx context.Context, event *model.ClickEvent) error
+	// CountBy группирует переходы ссылки по измерению (country, city)
+	// и возвращает limit самых частых значений
+	CountBy(ctx context.Context, urlID int64, dimension string, limit int) ([]model.StatBucket, error)
+	// CountBotClicks возвращает число переходов ботов по ссылке
+	CountBotClicks(ctx context.Context, urlID int64) (int64, error)
+}
+
+// VisitorRepository считает уникальных посетителей ссылок по отпечаткам
+// посетителей (HyperLogLog в Redis или таблица отпечатков в Postgres)
+type VisitorRepository interface {
+	// AddVisitor учитывает посетителя ссылки за день day (UTC)
+	AddVisitor(ctx context.Context, urlID int64, day time.Time, fingerprint string) error
+	// CountVisitors возвращает число уникальных посетителей за все время
+	CountVisitors(ctx context.Context, urlID int64) (int64, error)
+	// CountDailyVisitors возвращает уникальных посетителей по дням с from
+	// по to включительно, дни без посетителей пропускаются
+	CountDailyVisitors(ctx context.Context, urlID int64, from, to time.Time) ([]model.DailyVisitors, error)
+}
+
+// DomainRepository хранит брендированные домены
+type DomainRepository interface {
+	// Create возвращает ErrDomainExists, если домен уже зарегистрирован
+	Create(ctx context.Context, domain *model.Domain) error
+	// GetByHostname ищет домен по заголовку Host, в любом workspace
+	GetByHostname(ctx context.Context, hostname string) (*model.Domain, error)
+	List(ctx context.Context, workspaceID int64) ([]model.Domain, error)
+}
+
+// WorkspaceRepository хранит workspaces и их квоты
+type WorkspaceRepository interface {
+	Create(ctx context.Context, workspace *model.Workspace) error
+	GetByID(ctx context.Context, id int64) (*model.Workspace, error)
+	UpdateQuota(ctx context.Context, id int64, quota model.Quota) error
+	UpdateFallbackURL(ctx context.Context, id int64, fallbackURL string) error
+	// Ban блокирует workspace с момента at
+	Ban(ctx context.Context, id int64, at time.Time) error
+}
+
+// ModerationRepository хранит жалобы на ссылки и заблокированных авторов
+// анонимных ссылок. Решения по самим ссылкам хранит URLRepository
+type ModerationRepository interface {
+	// CreateReport сохраняет жалобу. Если у отправителя уже есть открытая
+	// жалоба на ссылку, новая не создается и возвращается false
+	CreateReport(ctx context.Context, report *model.AbuseReport) (bool, error)
+	// Queue возвращает до limit ссылок с открытыми жалобами: сначала
+	// ссылки с большим числом жалоб
+	Queue(ctx context.Context, limit int) ([]model.ReportSummary, error)
+	// ListReports возвращает limit последних жалоб на ссылку
+	ListReports(ctx context.Context, urlID int64, limit int) ([]model.AbuseReport, error)
+	// ResolveReports закрывает открытые жалобы на ссылку со статусом status
+	// и возвращает их число
+	ResolveReports(ctx context.Context, urlID int64, status string, at time.Time) (int64, error)
+	BanCreator(ctx context.Context, creatorHash, reason string, at time.Time) error
+	IsCreatorBanned(ctx context.Context, creatorHash string) (bool, error)
+}
+
+// APIKeyRepository хранит хэши API-ключей workspaces
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	// GetByHash возвращает ErrUnauthorized для неизвестного ключа
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	List(ctx context.Context, workspaceID int64) ([]model.APIKey, error)
+	Delete(ctx context.Context, workspaceID, id int64) error
+}
+
+// AuditRepository - журнал аудита, записи только добавляются
+type AuditRepository interface {
+	Append(ctx context.Context, entry *model.AuditEntry) error
+	List(ctx context.Context, workspaceID int64, filter model.AuditFilter) ([]model.AuditEntry, error)
+}
+
+// WebhookRepository хранит подписки на события, их доставки и доставки,
+// исчерпавшие попытки (dead letters)
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *model.Webhook) error
+	List(ctx context.Context, workspaceID int64) ([]model.Webhook, error)
+	// Delete возвращает ErrWebhookNotFound, если подписки нет в workspace
+	Delete(ctx context.Context, workspaceID, id int64) error
+	CreateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	// GetDelivery возвращает ErrDeliveryNotFound, если доставки нет в workspace
+	GetDelivery(ctx context.Context, workspaceID, id int64) (*model.WebhookDelivery, error)
+	// ListDeliveries возвращает limit последних доставок подписки
+	ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error)
+	// ClaimDue выбирает до limit доставок, время попытки которых наступило,
+	// и откладывает их до leaseUntil, чтобы другие экземпляры сервиса их не взяли.
+	// У выбранных доставок заполнен Target
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error)
+	// SaveAttempt сохраняет результат попытки доставки. Доставка в состоянии
+	// DeliveryDead одновременно копируется в dead letters
+	SaveAttempt(ctx context.Context, delivery *model.WebhookDelivery) error
+}
+
+// OutboxRepository читает outbox доменных событий для публикации. События
+// добавляются репозиториями в транзакциях породивших их изменений
+type OutboxRepository interface {
+	// ClaimDue выбирает до limit неопубликованных событий, время попытки
+	// которых наступило, в порядке записи и откладывает их до leaseUntil,
+	// чтобы другие экземпляры сервиса их не взяли
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []int64, publishedAt time.Time) error
+	// SaveFailure сохраняет число попыток, время следующей и ошибку
+	SaveFailure(ctx context.Context, event *model.OutboxEvent) error
+	// PurgePublished удаляет события, опубликованные раньше before
+	PurgePublished(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+type PostgresModerationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresModerationRepository(db *sql.DB) ModerationRepository {
+	return &PostgresModerationRepository{
+		db: db,
+	}
+}
+
+// CreateReport вставляет жалобу. Уникальный индекс открытых жалоб
+// отправителя превращает повторную жалобу в пустую вставку
+func (r *PostgresModerationRepository) CreateReport(ctx context.Context, report *model.AbuseReport) (bool, error) {
+	query := `
+	INSERT INTO abuse_reports (url_id, reason, details, reporter_hash, status, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (url_id, reporter_hash) WHERE status = 'open' DO NOTHING
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		report.URLID,
+		report.Reason,
+		report.Details,
+		report.ReporterHash,
+		report.Status,
+		report.CreatedAt,
+	).Scan(&report.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to create abuse report",
+			err,
+		)
+	}
+
+	return true, nil
+}
+
+// Queue группирует открытые жалобы по ссылкам. Число жалоб по причинам
+// собирается подзапросом в JSON-объект
+func (r *PostgresModerationRepository) Queue(ctx context.Context, limit int) ([]model.ReportSummary, error) {
+	query := `
+	SELECT url_id, COUNT(*), MIN(created_at), MAX(created_at),
+		(SELECT json_object_agg(reason, count) FROM (
+			SELECT reason, COUNT(*) AS count FROM abuse_reports o
+			WHERE o.url_id = r.url_id AND o.status = 'open'
+			GROUP BY reason
+		) reasons)
+	FROM abuse_reports r
+	WHERE status = 'open'
+	GROUP BY url_id
+	ORDER BY COUNT(*) DESC, MAX(created_at) DESC
+	LIMIT $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list moderation queue",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	summaries := make([]model.ReportSummary, 0)
+	for rows.Next() {
+		var summary model.ReportSummary
+		var reasons []byte
+		if err := rows.Scan(&summary.URLID, &summary.OpenReports, &summary.FirstReportedAt,
+			&summary.LastReportedAt, &reasons); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan moderation queue",
+				err,
+			)
+		}
+		if err := json.Unmarshal(reasons, &summary.Reasons); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to decode report reasons",
+				err,
+			)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read moderation queue",
+			err,
+		)
+	}
+
+	return summaries, nil
+}
+
+func (r *PostgresModerationRepository) ListReports(ctx context.Context, urlID int64, limit int) ([]model.AbuseReport, error) {
+	query := `
+	SELECT id, url_id, reason, details, reporter_hash, status, created_at, resolved_at
+	FROM abuse_reports
+	WHERE url_id = $1
+	ORDER BY id DESC
+	LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, urlID, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list abuse reports",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	reports := make([]model.AbuseReport, 0)
+	for rows.Next() {
+		var report model.AbuseReport
+		if err := rows.Scan(&report.ID, &report.URLID, &report.Reason, &report.Details,
+			&report.ReporterHash, &report.Status, &report.CreatedAt, &report.ResolvedAt); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan abuse report",
+				err,
+			)
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read abuse reports",
+			err,
+		)
+	}
+
+	return reports, nil
+}
+
+func (r *PostgresModerationRepository) ResolveReports(ctx context.Context, urlID int64, status string, at time.Time) (int64, error) {
+	query := `
+	UPDATE abuse_reports
+	SET status = $2, resolved_at = $3
+	WHERE url_id = $1 AND status = 'open'
+	`
+
+	result, err := r.db.ExecContext(ctx, query, urlID, status, at)
+	if err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to resolve abuse reports",
+			err,
+		)
+	}
+
+	resolved, err := result.RowsAffected()
+	if err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	return resolved, nil
+}
+
+func (r *PostgresModerationRepository) BanCreator(ctx context.Context, creatorHash, reason string, at time.Time) error {
+	query := `
+	INSERT INTO banned_creators (creator_hash, reason, created_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (creator_hash) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, creatorHash, reason, at); err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to ban creator",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresModerationRepository) IsCreatorBanned(ctx context.Context, creatorHash string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM banned_creators WHERE creator_hash = $1)`
+
+	var banned bool
+	if err := r.db.QueryRowContext(ctx, query, creatorHash).Scan(&banned); err != nil {
+		return false, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to check banned creator",
+			err,
+		)
+	}
+
+	return banned, nil
+}
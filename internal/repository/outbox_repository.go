@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+const insertOutboxEventQuery = `
+	INSERT INTO outbox_events (event_id, workspace_id, type, payload, created_at, next_attempt_at)
+	VALUES ($1, $2, $3, $4, $5, $5)
+	`
+
+// writeOutbox собирает события и добавляет их в outbox в транзакции tx,
+// в которой записано породившее их изменение
+func writeOutbox(ctx context.Context, tx *sql.Tx, events []model.PendingEvent) error {
+	for _, pending := range events {
+		event, err := pending()
+		if err != nil {
+			return apperrors.NewBusinessError("EVENT_ERROR", "failed to build outbox event", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, insertOutboxEventQuery,
+			event.EventID,
+			event.WorkspaceID,
+			event.Type,
+			string(event.Payload),
+			event.CreatedAt,
+		); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to write outbox event", err)
+		}
+	}
+
+	return nil
+}
+
+type PostgresOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOutboxRepository(db *sql.DB) OutboxRepository {
+	return &PostgresOutboxRepository{
+		db: db,
+	}
+}
+
+// ClaimDue откладывает выбранные события до leaseUntil одним запросом.
+// FOR UPDATE SKIP LOCKED не дает двум экземплярам взять одно событие
+func (r *PostgresOutboxRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	query := `
+	UPDATE outbox_events
+	SET next_attempt_at = $2
+	WHERE id IN (
+		SELECT id FROM outbox_events
+		WHERE published_at IS NULL AND next_attempt_at <= $1
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, event_id, workspace_id, type, payload, created_at, attempts, next_attempt_at, last_error
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to claim outbox events",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	events := make([]model.OutboxEvent, 0)
+	for rows.Next() {
+		var event model.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(
+			&event.ID,
+			&event.EventID,
+			&event.WorkspaceID,
+			&event.Type,
+			&payload,
+			&event.CreatedAt,
+			&event.Attempts,
+			&event.NextAttemptAt,
+			&event.LastError,
+		); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan outbox event",
+				err,
+			)
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to claim outbox events",
+			err,
+		)
+	}
+
+	// UPDATE ... RETURNING не гарантирует порядок строк
+	sortOutboxEvents(events)
+	return events, nil
+}
+
+func (r *PostgresOutboxRepository) MarkPublished(ctx context.Context, ids []int64, publishedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `UPDATE outbox_events SET published_at = $2, attempts = attempts + 1, last_error = '' WHERE id = ANY($1)`
+
+	if _, err := r.db.ExecContext(ctx, query, ids, publishedAt); err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to mark outbox events published",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresOutboxRepository) SaveFailure(ctx context.Context, event *model.OutboxEvent) error {
+	query := `UPDATE outbox_events SET attempts = $2, next_attempt_at = $3, last_error = $4 WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, event.ID, event.Attempts, event.NextAttemptAt, event.LastError); err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to save outbox event attempt",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresOutboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM outbox_events WHERE published_at IS NOT NULL AND published_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to purge outbox events",
+			err,
+		)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	return deleted, nil
+}
+
+// sortOutboxEvents упорядочивает события в порядке записи
+func sortOutboxEvents(events []model.OutboxEvent) {
+	slices.SortFunc(events, func(a, b model.OutboxEvent) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
@@ -4,69 +4,434 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Kosench/go-url-shortener/internal/model"
 
 	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
 )
 
-type PostgresURLRepository struct {
-	db *sql.DB
-}
+// urlColumns - список колонок urls в порядке, ожидаемом scanURL.
+// Правила маршрутизации собираются подзапросом в одну JSON-колонку, чтобы
+// ссылка читалась (и кэшировалась) целиком одним запросом
+const urlColumns = `id, original_url, short_code, click_count, created_at,
+	password_hash, owner_token_hash, max_clicks, not_before, not_after,
+	preview_mode, redirect_type, forward_query, query_conflict, forward_path,
+	utm_template,
+	(SELECT COALESCE(json_agg(json_build_object(
+		'kind', r.kind, 'value', r.value, 'destination', r.destination
+	) ORDER BY r.position), '[]'::json)
+	FROM url_routing_rules r WHERE r.url_id = urls.id) AS routing_rules,
+	sticky_variants,
+	(SELECT COALESCE(json_agg(json_build_object(
+		'name', v.name, 'destination', v.destination, 'weight', v.weight
+	) ORDER BY v.position), '[]'::json)
+	FROM url_variants v WHERE v.url_id = urls.id) AS variants,
+	domain_id, ` + urlDomainColumn + `, workspace_id, disabled_at, deleted_at, version,
+	title, description, image_url, og_title, og_description, og_image,
+	health_status, health_latency_ms, health_final_url, health_error,
+	health_failures, health_checked_at, broken_since, fallback_url,
+	moderation_status, moderation_reason, moderated_at, creator_hash`
 
-func NewPostgresURLRepository(db *sql.DB) URLRepository {
-	return &PostgresURLRepository{
-		db: db,
-	}
-}
+// urlDomainColumn - имя брендированного домена ссылки (пусто - основной домен)
+const urlDomainColumn = `COALESCE((SELECT d.hostname FROM domains d WHERE d.id = urls.domain_id), '') AS domain`
 
-func (r *PostgresURLRepository) Create(ctx context.Context, url *model.URL) error {
-	// Атомарная вставка: если short_code уже существует, RETURNING не вернёт строк -> sql.ErrNoRows
-	query := `
-	INSERT INTO urls (original_url, short_code, created_at)
-	VALUES ($1, $2, $3)
-	ON CONFLICT (short_code) DO NOTHING
+// byDomainAndShortCode - условие поиска ссылки по имени домена ($1, пусто -
+// основной домен) и короткому коду ($2). Левая часть совпадает с выражением
+// уникального индекса, незарегистрированный домен не находит ничего
+const byDomainAndShortCode = `COALESCE(domain_id, 0) = CASE WHEN $1::text = '' THEN 0
+		ELSE (SELECT d.id FROM domains d WHERE d.hostname = $1::text) END
+	AND short_code = $2`
+
+// insertURLQuery - атомарная вставка: если short_code уже занят на домене,
+// RETURNING не вернёт строк -> sql.ErrNoRows
+const insertURLQuery = `
+	INSERT INTO urls (original_url, short_code, created_at,
+		password_hash, owner_token_hash, max_clicks, not_before, not_after,
+		preview_mode, redirect_type, forward_query, query_conflict, forward_path,
+		utm_template, sticky_variants, domain_id, workspace_id, version,
+		og_title, og_description, og_image, fallback_url, creator_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+		$19, $20, $21, $22, $23)
+	ON CONFLICT (COALESCE(domain_id, 0), short_code) DO NOTHING
 	RETURNING id
 	`
 
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
+// insertURLArgs возвращает аргументы для insertURLQuery
+func insertURLArgs(url *model.URL) []any {
+	return []any{
 		url.OriginalURL,
 		url.ShortCode,
 		url.CreatedAt,
-	).Scan(&url.ID)
+		url.PasswordHash,
+		url.OwnerTokenHash,
+		url.MaxClicks,
+		url.NotBefore,
+		url.NotAfter,
+		url.PreviewMode,
+		url.RedirectType,
+		url.ForwardQuery,
+		url.QueryConflict,
+		url.ForwardPath,
+		url.UTMTemplate,
+		url.StickyVariants,
+		url.DomainID,
+		url.WorkspaceID,
+		url.Version,
+		url.SocialPreview.Title,
+		url.SocialPreview.Description,
+		url.SocialPreview.ImageURL,
+		url.FallbackURL,
+		url.CreatorHash,
+	}
+}
+
+const insertRoutingRuleQuery = `
+	INSERT INTO url_routing_rules (url_id, position, kind, value, destination)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+const insertVariantQuery = `
+	INSERT INTO url_variants (url_id, position, name, destination, weight)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+// insertVersionQuery сохраняет ревизию настроек ссылки
+const insertVersionQuery = `
+	INSERT INTO link_versions (url_id, version, settings, created_at)
+	VALUES ($1, $2, $3, NOW())
+	`
+
+// insertURL вставляет ссылку вместе с правилами маршрутизации, вариантами,
+// первой ревизией, событиями outbox и записью аудита в одной транзакции.
+// Занятый short_code возвращается как ErrShortCodeExists
+func insertURL(ctx context.Context, db *sql.DB, url *model.URL) error {
+	if url.Version == 0 {
+		url.Version = 1
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := reserveLink(ctx, tx, url.WorkspaceID, url.LinkQuota); err != nil {
+		return err
+	}
 
+	err = tx.QueryRowContext(ctx, insertURLQuery, insertURLArgs(url)...).Scan(&url.ID)
 	if err == sql.ErrNoRows {
 		// конфликт уникальности short_code
 		return apperrors.ErrShortCodeExists
 	}
+	if err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create URL", err)
+	}
+
+	for i, rule := range url.Rules {
+		if _, err := tx.ExecContext(ctx, insertRoutingRuleQuery, url.ID, i, rule.Kind, rule.Value, rule.Destination); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create routing rule", err)
+		}
+	}
+
+	for i, variant := range url.Variants {
+		if _, err := tx.ExecContext(ctx, insertVariantQuery, url.ID, i, variant.Name, variant.Destination, variant.Weight); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create variant", err)
+		}
+	}
 
+	if _, err := tx.ExecContext(ctx, insertVersionQuery, url.ID, url.Version, url.Settings()); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create link version", err)
+	}
+
+	if err := writeOutbox(ctx, tx, url.Events); err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, url.Audit); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to commit URL", err)
+	}
+
+	return nil
+}
+
+// reserveLink проверяет квоту ссылок workspace в транзакции tx. Блокировка
+// строки workspace выстраивает параллельные создания в очередь, поэтому
+// каждое следующее видит уже вставленные ссылки и квота не превышается
+func reserveLink(ctx context.Context, tx *sql.Tx, workspaceID, limit int64) error {
+	if limit == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM workspaces WHERE id = $1 FOR UPDATE`, workspaceID); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to lock workspace", err)
+	}
+
+	var count int64
+	if err := tx.QueryRowContext(ctx, countByWorkspaceQuery, workspaceID).Scan(&count); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to count workspace URLs", err)
+	}
+
+	if count >= limit {
+		return fmt.Errorf("workspace %d links: %w", workspaceID, apperrors.ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// updateURLQuery сохраняет изменяемые поля ссылки. Код, домен, workspace,
+// пароль и счетчик переходов не меняются. Условие на прежнюю ревизию не
+// дает параллельному изменению перезаписать ссылку мимо истории ревизий
+const updateURLQuery = `
+	UPDATE urls
+	SET original_url = $2, max_clicks = $3, not_before = $4, not_after = $5,
+		preview_mode = $6, redirect_type = $7, forward_query = $8,
+		query_conflict = $9, forward_path = $10, utm_template = $11,
+		sticky_variants = $12, disabled_at = $13, deleted_at = $14, version = $15,
+		og_title = $16, og_description = $17, og_image = $18, fallback_url = $19,
+		-- Проверки прежнего назначения к новому не относятся
+		health_status = CASE WHEN original_url = $2 THEN health_status ELSE 0 END,
+		health_latency_ms = CASE WHEN original_url = $2 THEN health_latency_ms ELSE 0 END,
+		health_final_url = CASE WHEN original_url = $2 THEN health_final_url ELSE '' END,
+		health_error = CASE WHEN original_url = $2 THEN health_error ELSE '' END,
+		health_failures = CASE WHEN original_url = $2 THEN health_failures ELSE 0 END,
+		health_checked_at = CASE WHEN original_url = $2 THEN health_checked_at END,
+		broken_since = CASE WHEN original_url = $2 THEN broken_since END
+	WHERE id = $1 AND version = $20
+	`
+
+// updateURL сохраняет ссылку, прочитанную в ревизии prevVersion, заменяет
+// ее правила маршрутизации и варианты, добавляет ревизию url.Version (если
+// номер новый), события outbox и запись аудита в одной транзакции. Если ссылку успели
+// изменить после чтения, возвращает ErrURLConflict
+func updateURL(ctx context.Context, db *sql.DB, url *model.URL, prevVersion int) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return apperrors.NewBusinessError(
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Восстановление удаленной ссылки снова занимает место в квоте
+	if err := reserveLink(ctx, tx, url.WorkspaceID, url.LinkQuota); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, updateURLQuery,
+		url.ID,
+		url.OriginalURL,
+		url.MaxClicks,
+		url.NotBefore,
+		url.NotAfter,
+		url.PreviewMode,
+		url.RedirectType,
+		url.ForwardQuery,
+		url.QueryConflict,
+		url.ForwardPath,
+		url.UTMTemplate,
+		url.StickyVariants,
+		url.DisabledAt,
+		url.DeletedAt,
+		url.Version,
+		url.SocialPreview.Title,
+		url.SocialPreview.Description,
+		url.SocialPreview.ImageURL,
+		url.FallbackURL,
+		prevVersion,
+	)
+	if err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to update URL", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to get rows affected", err)
+	}
+	// Ссылка только что прочитана, поэтому пропавшая строка - тоже гонка
+	if rowsAffected == 0 {
+		return fmt.Errorf("URL with ID %d: %w", url.ID, apperrors.ErrURLConflict)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_routing_rules WHERE url_id = $1`, url.ID); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to replace routing rules", err)
+	}
+	for i, rule := range url.Rules {
+		if _, err := tx.ExecContext(ctx, insertRoutingRuleQuery, url.ID, i, rule.Kind, rule.Value, rule.Destination); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create routing rule", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_variants WHERE url_id = $1`, url.ID); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to replace variants", err)
+	}
+	for i, variant := range url.Variants {
+		if _, err := tx.ExecContext(ctx, insertVariantQuery, url.ID, i, variant.Name, variant.Destination, variant.Weight); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create variant", err)
+		}
+	}
+
+	// Смена только состояния ссылки (отключение, удаление) ревизию не создает
+	if url.Version != prevVersion {
+		if _, err := tx.ExecContext(ctx, insertVersionQuery, url.ID, url.Version, url.Settings()); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create link version", err)
+		}
+	}
+
+	if err := writeOutbox(ctx, tx, url.Events); err != nil {
+		return err
+	}
+
+	if err := writeAudit(ctx, tx, url.Audit); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to commit URL", err)
+	}
+
+	return nil
+}
+
+// listVersions возвращает ревизии ссылки от новых к старым
+func listVersions(ctx context.Context, db *sql.DB, urlID int64) ([]model.LinkVersion, error) {
+	query := `SELECT version, settings, created_at FROM link_versions WHERE url_id = $1 ORDER BY version DESC`
+
+	rows, err := db.QueryContext(ctx, query, urlID)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
 			"DATABASE_ERROR",
-			"failed to create URL",
+			"failed to list link versions",
 			err,
 		)
 	}
+	defer rows.Close()
 
-	return nil
+	versions := make([]model.LinkVersion, 0)
+	for rows.Next() {
+		var version model.LinkVersion
+		if err := rows.Scan(&version.Version, &version.Settings, &version.CreatedAt); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan link version",
+				err,
+			)
+		}
+		versions = append(versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list link versions",
+			err,
+		)
+	}
+
+	return versions, nil
 }
 
-func (r *PostgresURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
-	query := `
-	SELECT id, original_url, short_code, click_count, created_at
-	FROM urls
-	WHERE short_code = $1
-	`
+// getVersion возвращает ревизию ссылки, ErrVersionNotFound - если ее нет
+func getVersion(ctx context.Context, db *sql.DB, urlID int64, number int) (*model.LinkVersion, error) {
+	query := `SELECT version, settings, created_at FROM link_versions WHERE url_id = $1 AND version = $2`
+
+	version := &model.LinkVersion{}
+	err := db.QueryRowContext(ctx, query, urlID, number).Scan(&version.Version, &version.Settings, &version.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("version %d of URL %d: %w", number, urlID, apperrors.ErrVersionNotFound)
+	}
+
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get link version",
+			err,
+		)
+	}
+
+	return version, nil
+}
 
+// rowScanner - общий интерфейс для *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanURL читает строку, выбранную с колонками urlColumns
+func scanURL(row rowScanner) (*model.URL, error) {
 	url := &model.URL{}
-	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(
+	err := row.Scan(
 		&url.ID,
 		&url.OriginalURL,
 		&url.ShortCode,
 		&url.ClickCount,
-		&url.CreatedAt)
+		&url.CreatedAt,
+		&url.PasswordHash,
+		&url.OwnerTokenHash,
+		&url.MaxClicks,
+		&url.NotBefore,
+		&url.NotAfter,
+		&url.PreviewMode,
+		&url.RedirectType,
+		&url.ForwardQuery,
+		&url.QueryConflict,
+		&url.ForwardPath,
+		&url.UTMTemplate,
+		&url.Rules,
+		&url.StickyVariants,
+		&url.Variants,
+		&url.DomainID,
+		&url.Domain,
+		&url.WorkspaceID,
+		&url.DisabledAt,
+		&url.DeletedAt,
+		&url.Version,
+		&url.Title,
+		&url.Description,
+		&url.ImageURL,
+		&url.SocialPreview.Title,
+		&url.SocialPreview.Description,
+		&url.SocialPreview.ImageURL,
+		&url.Health.StatusCode,
+		&url.Health.LatencyMs,
+		&url.Health.FinalURL,
+		&url.Health.Error,
+		&url.Health.Failures,
+		&url.Health.CheckedAt,
+		&url.Health.BrokenSince,
+		&url.FallbackURL,
+		&url.Moderation.Status,
+		&url.Moderation.Reason,
+		&url.Moderation.At,
+		&url.CreatorHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+type PostgresURLRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresURLRepository(db *sql.DB) URLRepository {
+	return &PostgresURLRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresURLRepository) Create(ctx context.Context, url *model.URL) error {
+	return insertURL(ctx, r.db, url)
+}
+
+func (r *PostgresURLRepository) GetByShortCode(ctx context.Context, domain, shortCode string) (*model.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE ` + byDomainAndShortCode + ` AND deleted_at IS NULL`
+
+	url, err := scanURL(r.db.QueryRowContext(ctx, query, domain, shortCode))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("URL with short code '%s': %w", shortCode, apperrors.ErrURLNotFound)
@@ -83,35 +448,317 @@ func (r *PostgresURLRepository) GetByShortCode(ctx context.Context, shortCode st
 	return url, nil
 }
 
-func (r *PostgresURLRepository) ExistsByShortCode(ctx context.Context, shortCode string) (bool, error) {
-	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)`
+func (r *PostgresURLRepository) GetForWorkspace(ctx context.Context, workspaceID int64, domain, shortCode string) (*model.URL, error) {
+	return getForWorkspace(ctx, r.db, workspaceID, domain, shortCode)
+}
+
+// getForWorkspace читает ссылку workspace из БД, включая удаленные
+func getForWorkspace(ctx context.Context, db *sql.DB, workspaceID int64, domain, shortCode string) (*model.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE ` + byDomainAndShortCode + ` AND workspace_id = $3`
+
+	url, err := scanURL(db.QueryRowContext(ctx, query, domain, shortCode, workspaceID))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("URL with short code '%s': %w", shortCode, apperrors.ErrURLNotFound)
+	}
 
-	var exists bool
-	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(&exists)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get URL",
+			err,
+		)
+	}
+
+	return url, nil
+}
+
+func (r *PostgresURLRepository) CountByWorkspace(ctx context.Context, workspaceID int64) (int64, error) {
+	return countByWorkspace(ctx, r.db, workspaceID)
+}
+
+// countByWorkspace считает ссылки workspace для проверки квоты. Удаленные
+// ссылки квоту не занимают
+// countByWorkspaceQuery считает неудаленные ссылки workspace для квоты
+const countByWorkspaceQuery = `SELECT COUNT(*) FROM urls WHERE workspace_id = $1 AND deleted_at IS NULL`
+
+func countByWorkspace(ctx context.Context, db *sql.DB, workspaceID int64) (int64, error) {
+	var count int64
+	if err := db.QueryRowContext(ctx, countByWorkspaceQuery, workspaceID).Scan(&count); err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to count workspace URLs",
+			err,
+		)
+	}
+
+	return count, nil
+}
+
+func (r *PostgresURLRepository) List(ctx context.Context, workspaceID int64, filter model.URLFilter) ([]*model.URL, error) {
+	return listURLs(ctx, r.db, workspaceID, filter)
+}
+
+// listURLs возвращает ссылки workspace от новых к старым. Поиск - подстрока
+// без учета регистра, символы % и _ в запросе ищутся буквально
+func listURLs(ctx context.Context, db *sql.DB, workspaceID int64, filter model.URLFilter) ([]*model.URL, error) {
+	conditions := []string{"workspace_id = $1", "deleted_at IS NULL"}
+	args := []any{workspaceID}
+
+	if filter.BeforeID > 0 {
+		args = append(args, filter.BeforeID)
+		conditions = append(conditions, fmt.Sprintf("id < $%d", len(args)))
+	}
+	if filter.Broken {
+		conditions = append(conditions, "broken_since IS NOT NULL")
+	}
+	if filter.Query != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf(
+			"(short_code ILIKE $%[1]d OR original_url ILIKE $%[1]d OR title ILIKE $%[1]d OR description ILIKE $%[1]d)",
+			len(args)))
+	}
+
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf(`SELECT `+urlColumns+` FROM urls WHERE %s ORDER BY id DESC LIMIT $%d`,
+		strings.Join(conditions, " AND "), len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list URLs",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	urls := make([]*model.URL, 0)
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan URL",
+				err,
+			)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read URLs",
+			err,
+		)
+	}
+
+	return urls, nil
+}
+
+// likeEscaper экранирует спецсимволы шаблона LIKE (экранирующий символ
+// по умолчанию - обратная косая черта)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *PostgresURLRepository) Update(ctx context.Context, url *model.URL, prevVersion int) error {
+	return updateURL(ctx, r.db, url, prevVersion)
+}
+
+func (r *PostgresURLRepository) UpdateMetadata(ctx context.Context, url *model.URL) (bool, error) {
+	return updateMetadata(ctx, r.db, url)
+}
+
+// updateMetadata сохраняет карточку страницы, только если назначение ссылки
+// не сменилось, пока страница загружалась. Ревизия при этом не создается:
+// карточка не относится к настройкам ссылки
+func updateMetadata(ctx context.Context, db *sql.DB, url *model.URL) (bool, error) {
+	query := `
+	UPDATE urls
+	SET title = $3, description = $4, image_url = $5
+	WHERE id = $1 AND original_url = $2
+	`
+
+	result, err := db.ExecContext(ctx, query, url.ID, url.OriginalURL, url.Title, url.Description, url.ImageURL)
 	if err != nil {
 		return false, apperrors.NewBusinessError(
 			"DATABASE_ERROR",
-			"failed to check short code existence",
+			"failed to update URL metadata",
 			err,
 		)
 	}
 
-	return exists, nil
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to update URL metadata",
+			err,
+		)
+	}
+
+	return updated > 0, nil
+}
+
+func (r *PostgresURLRepository) ClaimHealthChecks(ctx context.Context, dueBefore, now time.Time, limit int) ([]*model.URL, error) {
+	return claimHealthChecks(ctx, r.db, dueBefore, now, limit)
+}
+
+// claimHealthChecksQuery отмечает выбранные ссылки проверенными в now, чтобы
+// другие экземпляры сервиса их не взяли. Проверяются только веб-адреса:
+// deep link приложений не открыть HTTP-запросом
+const claimHealthChecksQuery = `
+	UPDATE urls
+	SET health_checked_at = $2
+	WHERE id IN (
+		SELECT id FROM urls
+		WHERE deleted_at IS NULL AND disabled_at IS NULL AND moderation_status = ''
+			AND (health_checked_at IS NULL OR health_checked_at < $1)
+			AND original_url ~* '^https?://'
+		ORDER BY health_checked_at NULLS FIRST, id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + urlColumns
+
+func claimHealthChecks(ctx context.Context, db *sql.DB, dueBefore, now time.Time, limit int) ([]*model.URL, error) {
+	rows, err := db.QueryContext(ctx, claimHealthChecksQuery, dueBefore, now, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to claim URL health checks",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	urls := make([]*model.URL, 0)
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan URL",
+				err,
+			)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to claim URL health checks",
+			err,
+		)
+	}
+
+	return urls, nil
 }
 
-func (r *PostgresURLRepository) IncrementClickCount(ctx context.Context, id int64) error {
+func (r *PostgresURLRepository) UpdateHealth(ctx context.Context, url *model.URL, events ...model.PendingEvent) (bool, error) {
+	return updateHealth(ctx, r.db, url, events)
+}
+
+// updateHealth сохраняет результат проверки, только если назначение ссылки
+// не сменилось, пока шла проверка. События пишутся в outbox в той же
+// транзакции
+func updateHealth(ctx context.Context, db *sql.DB, url *model.URL, events []model.PendingEvent) (bool, error) {
 	query := `
 	UPDATE urls
-	SET click_count = click_count + 1
-	WHERE id = $1
+	SET health_status = $3, health_latency_ms = $4, health_final_url = $5,
+		health_error = $6, health_failures = $7, health_checked_at = $8,
+		broken_since = $9
+	WHERE id = $1 AND original_url = $2
 	`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, apperrors.NewBusinessError("DATABASE_ERROR", "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	health := url.Health
+	result, err := tx.ExecContext(ctx, query, url.ID, url.OriginalURL,
+		health.StatusCode, health.LatencyMs, health.FinalURL, health.Error,
+		health.Failures, health.CheckedAt, health.BrokenSince)
+	if err != nil {
+		return false, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to update URL health",
+			err,
+		)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to update URL health",
+			err,
+		)
+	}
+	if updated == 0 {
+		return false, nil
+	}
+
+	if err := writeOutbox(ctx, tx, events); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, apperrors.NewBusinessError("DATABASE_ERROR", "failed to commit URL health", err)
+	}
+
+	return true, nil
+}
+
+func (r *PostgresURLRepository) GetByID(ctx context.Context, id int64) (*model.URL, error) {
+	return getURLByID(ctx, r.db, id)
+}
+
+// getURLByID читает ссылку любого workspace, включая удаленные
+func getURLByID(ctx context.Context, db *sql.DB, id int64) (*model.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE id = $1`
+
+	url, err := scanURL(db.QueryRowContext(ctx, query, id))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("URL with ID %d: %w", id, apperrors.ErrURLNotFound)
+	}
+
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get URL",
+			err,
+		)
+	}
+
+	return url, nil
+}
+
+func (r *PostgresURLRepository) UpdateModeration(ctx context.Context, url *model.URL) error {
+	return updateModeration(ctx, r.db, url)
+}
+
+// updateModeration сохраняет решение модерации. Блокировка окончательна:
+// заблокированную ссылку не изменить
+func updateModeration(ctx context.Context, db *sql.DB, url *model.URL) error {
+	query := `
+	UPDATE urls
+	SET moderation_status = $2, moderation_reason = $3, moderated_at = $4
+	WHERE id = $1 AND moderation_status <> 'banned'
+	`
+
+	moderation := url.Moderation
+	result, err := db.ExecContext(ctx, query, url.ID, moderation.Status, moderation.Reason, moderation.At)
 	if err != nil {
 		return apperrors.NewBusinessError(
 			"DATABASE_ERROR",
-			"failed to increment click count",
-			err)
+			"failed to update URL moderation",
+			err,
+		)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -124,8 +771,160 @@ func (r *PostgresURLRepository) IncrementClickCount(ctx context.Context, id int6
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("URL with ID %d: %w", id, apperrors.ErrURLNotFound)
+		return fmt.Errorf("URL with ID %d: %w", url.ID, apperrors.ErrURLSuspended)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (r *PostgresURLRepository) ModerateCreator(ctx context.Context, workspaceID int64, creatorHash string, moderation model.Moderation) ([]*model.URL, error) {
+	return moderateCreator(ctx, r.db, workspaceID, creatorHash, moderation)
+}
+
+// moderateCreator применяет решение модерации ко всем еще не заблокированным
+// ссылкам workspace (creatorHash пуст) или автора анонимных ссылок и
+// возвращает их
+func moderateCreator(ctx context.Context, db *sql.DB, workspaceID int64, creatorHash string, moderation model.Moderation) ([]*model.URL, error) {
+	query := `
+	UPDATE urls
+	SET moderation_status = $3, moderation_reason = $4, moderated_at = $5
+	WHERE workspace_id = $1 AND ($2 = '' OR creator_hash = $2)
+		AND moderation_status <> 'banned'
+	RETURNING ` + urlColumns
+
+	rows, err := db.QueryContext(ctx, query, workspaceID, creatorHash, moderation.Status, moderation.Reason, moderation.At)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to moderate creator URLs",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	urls := make([]*model.URL, 0)
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan URL",
+				err,
+			)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to moderate creator URLs",
+			err,
+		)
+	}
+
+	return urls, nil
+}
+
+func (r *PostgresURLRepository) ListVersions(ctx context.Context, urlID int64) ([]model.LinkVersion, error) {
+	return listVersions(ctx, r.db, urlID)
+}
+
+func (r *PostgresURLRepository) GetVersion(ctx context.Context, urlID int64, version int) (*model.LinkVersion, error) {
+	return getVersion(ctx, r.db, urlID, version)
+}
+
+func (r *PostgresURLRepository) ExistsByShortCode(ctx context.Context, domain, shortCode string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE ` + byDomainAndShortCode + `)`
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, domain, shortCode).Scan(&exists)
+	if err != nil {
+		return false, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to check short code existence",
+			err,
+		)
+	}
+
+	return exists, nil
+}
+
+// clickRollup - счетчик ссылки после засчитанного перехода
+type clickRollup struct {
+	workspaceID int64
+	shortCode   string
+	domain      string
+	count       int64
+}
+
+// incrementClickQuery засчитывает переход без ограничений
+const incrementClickQuery = `
+	UPDATE urls
+	SET click_count = click_count + 1
+	WHERE id = $1
+	RETURNING workspace_id, short_code, click_count, ` + urlDomainColumn
+
+func (r *PostgresURLRepository) IncrementClickCount(ctx context.Context, id int64, events ...model.PendingEvent) error {
+	_, err := rollupClick(ctx, r.db, incrementClickQuery, id, events)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("URL with ID %d: %w", id, apperrors.ErrURLNotFound)
+	}
+
+	return err
+}
+
+// consumeClickQuery засчитывает переход только пока лимит не исчерпан.
+// Условие в WHERE выполняется под блокировкой строки, поэтому два
+// параллельных перехода по одноразовой ссылке не могут пройти оба
+const consumeClickQuery = `
+	UPDATE urls
+	SET click_count = click_count + 1
+	WHERE id = $1 AND (max_clicks = 0 OR click_count < max_clicks)
+	RETURNING workspace_id, short_code, click_count, ` + urlDomainColumn
+
+func (r *PostgresURLRepository) ConsumeClick(ctx context.Context, id int64, events ...model.PendingEvent) (int64, error) {
+	rollup, err := rollupClick(ctx, r.db, consumeClickQuery, id, events)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("URL with ID %d: %w", id, apperrors.ErrURLExhausted)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rollup.count, nil
+}
+
+// rollupClick выполняет query (incrementClickQuery или consumeClickQuery)
+// и записывает события перехода в outbox в одной транзакции. Если переход
+// не засчитан, возвращает sql.ErrNoRows
+func rollupClick(ctx context.Context, db *sql.DB, query string, id int64, events []model.PendingEvent) (*clickRollup, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, apperrors.NewBusinessError("DATABASE_ERROR", "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	rollup := &clickRollup{}
+	err = tx.QueryRowContext(ctx, query, id).Scan(&rollup.workspaceID, &rollup.shortCode, &rollup.count, &rollup.domain)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to count click",
+			err,
+		)
+	}
+
+	if err := writeOutbox(ctx, tx, events); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, apperrors.NewBusinessError("DATABASE_ERROR", "failed to commit click", err)
+	}
+
+	return rollup, nil
+}
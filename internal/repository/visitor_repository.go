@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/cache"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// visitorDayTTL - сколько хранятся дневные HyperLogLog посетителей в Redis
+const visitorDayTTL = 90 * 24 * time.Hour
+
+// RedisVisitorRepository считает уникальных посетителей в HyperLogLog:
+// ключ на каждый день и общий ключ за все время. Погрешность около 0.8%
+type RedisVisitorRepository struct {
+	redis *cache.RedisClient
+	keys  *cache.KeyBuilder
+}
+
+func NewRedisVisitorRepository(redis *cache.RedisClient) VisitorRepository {
+	return &RedisVisitorRepository{
+		redis: redis,
+		keys:  redis.GetKeyBuilder(),
+	}
+}
+
+func (r *RedisVisitorRepository) AddVisitor(ctx context.Context, urlID int64, day time.Time, fingerprint string) error {
+	dayKey := r.keys.UniqueVisitors(urlID, day.UTC().Format(model.VisitorDayFormat))
+	if err := r.redis.AddToHyperLogLog(ctx, dayKey, visitorDayTTL, fingerprint); err != nil {
+		return err
+	}
+	return r.redis.AddToHyperLogLog(ctx, r.keys.UniqueVisitors(urlID, ""), 0, fingerprint)
+}
+
+func (r *RedisVisitorRepository) CountVisitors(ctx context.Context, urlID int64) (int64, error) {
+	counts, err := r.redis.CountHyperLogLogs(ctx, []string{r.keys.UniqueVisitors(urlID, "")})
+	if err != nil {
+		return 0, err
+	}
+	return counts[0], nil
+}
+
+func (r *RedisVisitorRepository) CountDailyVisitors(ctx context.Context, urlID int64, from, to time.Time) ([]model.DailyVisitors, error) {
+	var days []string
+	for day := truncateDay(from); !day.After(truncateDay(to)); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(model.VisitorDayFormat))
+	}
+
+	keys := make([]string, len(days))
+	for i, day := range days {
+		keys[i] = r.keys.UniqueVisitors(urlID, day)
+	}
+	counts, err := r.redis.CountHyperLogLogs(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	daily := make([]model.DailyVisitors, 0)
+	for i, count := range counts {
+		if count > 0 {
+			daily = append(daily, model.DailyVisitors{Date: days[i], Visitors: count})
+		}
+	}
+	return daily, nil
+}
+
+// PostgresVisitorRepository хранит отпечатки посетителей по дням, если
+// Redis недоступен. Счет точный, но таблица растет с числом посетителей
+type PostgresVisitorRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresVisitorRepository(db *sql.DB) VisitorRepository {
+	return &PostgresVisitorRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresVisitorRepository) AddVisitor(ctx context.Context, urlID int64, day time.Time, fingerprint string) error {
+	query := `
+	INSERT INTO url_visitors (url_id, day, fingerprint)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, urlID, day.UTC().Format(model.VisitorDayFormat), fingerprint); err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to save visitor",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresVisitorRepository) CountVisitors(ctx context.Context, urlID int64) (int64, error) {
+	query := `SELECT COUNT(DISTINCT fingerprint) FROM url_visitors WHERE url_id = $1`
+
+	var count int64
+	if err := r.db.QueryRowContext(ctx, query, urlID).Scan(&count); err != nil {
+		return 0, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to count visitors",
+			err,
+		)
+	}
+
+	return count, nil
+}
+
+func (r *PostgresVisitorRepository) CountDailyVisitors(ctx context.Context, urlID int64, from, to time.Time) ([]model.DailyVisitors, error) {
+	query := `
+	SELECT to_char(day, 'YYYY-MM-DD'), COUNT(*)
+	FROM url_visitors
+	WHERE url_id = $1 AND day BETWEEN $2 AND $3
+	GROUP BY day
+	ORDER BY day
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, urlID,
+		from.UTC().Format(model.VisitorDayFormat),
+		to.UTC().Format(model.VisitorDayFormat))
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to count daily visitors",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	daily := make([]model.DailyVisitors, 0)
+	for rows.Next() {
+		var day model.DailyVisitors
+		if err := rows.Scan(&day.Date, &day.Visitors); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan daily visitors",
+				err,
+			)
+		}
+		daily = append(daily, day)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read daily visitors",
+			err,
+		)
+	}
+
+	return daily, nil
+}
+
+// truncateDay возвращает начало дня t в UTC
+func truncateDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
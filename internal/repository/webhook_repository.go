@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+type PostgresWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookRepository(db *sql.DB) WebhookRepository {
+	return &PostgresWebhookRepository{
+		db: db,
+	}
+}
+
+// deliveryColumns - колонки webhook_deliveries в порядке полей scanDelivery
+const deliveryColumns = `d.id, d.webhook_id, d.workspace_id, d.event, d.payload, d.status,
+	d.attempts, d.next_attempt_at, d.response_status, d.last_error, d.created_at, d.delivered_at`
+
+func (r *PostgresWebhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	query := `
+	INSERT INTO webhooks (workspace_id, url, events, secret, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		webhook.WorkspaceID,
+		webhook.URL,
+		webhook.Events,
+		webhook.Secret,
+		webhook.CreatedAt,
+	).Scan(&webhook.ID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to create webhook",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresWebhookRepository) List(ctx context.Context, workspaceID int64) ([]model.Webhook, error) {
+	query := `
+	SELECT id, workspace_id, url, events, secret, created_at
+	FROM webhooks
+	WHERE workspace_id = $1
+	ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list webhooks",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	webhooks := make([]model.Webhook, 0)
+	for rows.Next() {
+		var webhook model.Webhook
+		if err := rows.Scan(
+			&webhook.ID,
+			&webhook.WorkspaceID,
+			&webhook.URL,
+			&webhook.Events,
+			&webhook.Secret,
+			&webhook.CreatedAt,
+		); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan webhook",
+				err,
+			)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list webhooks",
+			err,
+		)
+	}
+
+	return webhooks, nil
+}
+
+func (r *PostgresWebhookRepository) Delete(ctx context.Context, workspaceID, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1 AND workspace_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, workspaceID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to delete webhook",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook %d: %w", id, apperrors.ErrWebhookNotFound)
+	}
+
+	return nil
+}
+
+func (r *PostgresWebhookRepository) CreateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, workspace_id, event, payload, status,
+		attempts, next_attempt_at, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		delivery.WebhookID,
+		delivery.WorkspaceID,
+		delivery.Event,
+		string(delivery.Payload),
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+	).Scan(&delivery.ID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to create webhook delivery",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresWebhookRepository) GetDelivery(ctx context.Context, workspaceID, id int64) (*model.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d WHERE d.id = $1 AND d.workspace_id = $2`
+
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, query, id, workspaceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("delivery %d: %w", id, apperrors.ErrDeliveryNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get webhook delivery",
+			err,
+		)
+	}
+
+	return delivery, nil
+}
+
+func (r *PostgresWebhookRepository) ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	query := `
+	SELECT ` + deliveryColumns + `
+	FROM webhook_deliveries d
+	WHERE d.webhook_id = $1 AND d.workspace_id = $2
+	ORDER BY d.id DESC
+	LIMIT $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, webhookID, workspaceID, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list webhook deliveries",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan webhook delivery",
+				err,
+			)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list webhook deliveries",
+			err,
+		)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDue откладывает выбранные доставки до leaseUntil одним запросом.
+// FOR UPDATE SKIP LOCKED не дает двум экземплярам взять одну доставку
+func (r *PostgresWebhookRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = $2
+	FROM webhooks w
+	WHERE w.id = d.webhook_id AND d.id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + deliveryColumns + `, w.url, w.secret
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to claim webhook deliveries",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		var payload []byte
+		target := &model.Webhook{}
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.WorkspaceID,
+			&delivery.Event,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+			&target.URL,
+			&target.Secret,
+		); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan webhook delivery",
+				err,
+			)
+		}
+		delivery.Payload = payload
+		target.ID, target.WorkspaceID = delivery.WebhookID, delivery.WorkspaceID
+		delivery.Target = target
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to claim webhook deliveries",
+			err,
+		)
+	}
+
+	return deliveries, nil
+}
+
+func (r *PostgresWebhookRepository) SaveAttempt(ctx context.Context, delivery *model.WebhookDelivery) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE webhook_deliveries
+	SET status = $2, attempts = $3, next_attempt_at = $4, response_status = $5,
+		last_error = $6, delivered_at = $7
+	WHERE id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.DeliveredAt,
+	)
+	if err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to save webhook delivery", err)
+	}
+
+	if delivery.Status == model.DeliveryDead {
+		deadLetterQuery := `
+		INSERT INTO webhook_dead_letters (delivery_id, webhook_id, workspace_id, url, event,
+			payload, attempts, last_error)
+		SELECT d.id, d.webhook_id, d.workspace_id, w.url, d.event, d.payload, d.attempts, d.last_error
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.id = $1
+		`
+		if _, err := tx.ExecContext(ctx, deadLetterQuery, delivery.ID); err != nil {
+			return apperrors.NewBusinessError("DATABASE_ERROR", "failed to create dead letter", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apperrors.NewBusinessError("DATABASE_ERROR", "failed to commit webhook delivery", err)
+	}
+
+	return nil
+}
+
+// scanDelivery читает строку с колонками deliveryColumns
+func scanDelivery(row rowScanner) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	var payload []byte
+	if err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.WorkspaceID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	); err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return &delivery, nil
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+type PostgresWorkspaceRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresWorkspaceRepository(db *sql.DB) WorkspaceRepository {
+	return &PostgresWorkspaceRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresWorkspaceRepository) Create(ctx context.Context, workspace *model.Workspace) error {
+	query := `
+	INSERT INTO workspaces (name, max_links, max_clicks_per_month, max_api_requests_per_month, fallback_url, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		workspace.Name,
+		workspace.Quota.Links,
+		workspace.Quota.ClicksPerMonth,
+		workspace.Quota.APIRequestsPerMonth,
+		workspace.FallbackURL,
+		workspace.CreatedAt,
+	).Scan(&workspace.ID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to create workspace",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresWorkspaceRepository) GetByID(ctx context.Context, id int64) (*model.Workspace, error) {
+	query := `
+	SELECT id, name, max_links, max_clicks_per_month, max_api_requests_per_month, fallback_url,
+		banned_at, created_at
+	FROM workspaces
+	WHERE id = $1
+	`
+
+	workspace := &model.Workspace{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.Quota.Links,
+		&workspace.Quota.ClicksPerMonth,
+		&workspace.Quota.APIRequestsPerMonth,
+		&workspace.FallbackURL,
+		&workspace.BannedAt,
+		&workspace.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("workspace %d: %w", id, apperrors.ErrWorkspaceNotFound)
+	}
+
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get workspace",
+			err,
+		)
+	}
+
+	return workspace, nil
+}
+
+func (r *PostgresWorkspaceRepository) UpdateQuota(ctx context.Context, id int64, quota model.Quota) error {
+	query := `
+	UPDATE workspaces
+	SET max_links = $2, max_clicks_per_month = $3, max_api_requests_per_month = $4
+	WHERE id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, quota.Links, quota.ClicksPerMonth, quota.APIRequestsPerMonth)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to update workspace quota",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("workspace %d: %w", id, apperrors.ErrWorkspaceNotFound)
+	}
+
+	return nil
+}
+
+func (r *PostgresWorkspaceRepository) UpdateFallbackURL(ctx context.Context, id int64, fallbackURL string) error {
+	query := `UPDATE workspaces SET fallback_url = $2 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, fallbackURL)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to update workspace fallback URL",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("workspace %d: %w", id, apperrors.ErrWorkspaceNotFound)
+	}
+
+	return nil
+}
+
+func (r *PostgresWorkspaceRepository) Ban(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE workspaces SET banned_at = COALESCE(banned_at, $2) WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, at)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to ban workspace",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("workspace %d: %w", id, apperrors.ErrWorkspaceNotFound)
+	}
+
+	return nil
+}
+
+type PostgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &PostgresAPIKeyRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresAPIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	query := `
+	INSERT INTO api_keys (workspace_id, name, role, prefix, key_hash, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query, key.WorkspaceID, key.Name, key.Role, key.Prefix, key.KeyHash, key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to create API key",
+			err,
+		)
+	}
+
+	return nil
+}
+
+func (r *PostgresAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	query := `
+	SELECT id, workspace_id, name, role, prefix, key_hash, created_at
+	FROM api_keys
+	WHERE key_hash = $1
+	`
+
+	key := &model.APIKey{}
+	err := r.db.QueryRowContext(ctx, query, keyHash).Scan(
+		&key.ID, &key.WorkspaceID, &key.Name, &key.Role, &key.Prefix, &key.KeyHash, &key.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrUnauthorized
+	}
+
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get API key",
+			err,
+		)
+	}
+
+	return key, nil
+}
+
+func (r *PostgresAPIKeyRepository) List(ctx context.Context, workspaceID int64) ([]model.APIKey, error) {
+	query := `
+	SELECT id, workspace_id, name, role, prefix, key_hash, created_at
+	FROM api_keys
+	WHERE workspace_id = $1
+	ORDER BY created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to list API keys",
+			err,
+		)
+	}
+	defer rows.Close()
+
+	keys := make([]model.APIKey, 0)
+	for rows.Next() {
+		var key model.APIKey
+		if err := rows.Scan(&key.ID, &key.WorkspaceID, &key.Name, &key.Role, &key.Prefix, &key.KeyHash, &key.CreatedAt); err != nil {
+			return nil, apperrors.NewBusinessError(
+				"DATABASE_ERROR",
+				"failed to scan API key",
+				err,
+			)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to read API keys",
+			err,
+		)
+	}
+
+	return keys, nil
+}
+
+func (r *PostgresAPIKeyRepository) Delete(ctx context.Context, workspaceID, id int64) error {
+	query := `DELETE FROM api_keys WHERE id = $1 AND workspace_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, workspaceID)
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to delete API key",
+			err,
+		)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.NewBusinessError(
+			"DATABASE_ERROR",
+			"failed to get rows affected",
+			err,
+		)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key %d: %w", id, apperrors.ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package safehttp - HTTP-клиент для запросов по адресам, которые задают
+// пользователи (назначения ссылок, получатели webhooks). Клиент не
+// подключается к внутренним адресам: loopback, частным сетям, link-local
+// (в том числе к метаданным облака 169.254.169.254). Адрес проверяется в момент подключения, уже после
+// разрешения имени, поэтому защиту не обойти редиректом или DNS rebinding
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxRedirects = 5
+	dialTimeout         = 5 * time.Second
+)
+
+// ErrForbiddenAddress - адрес назначения не является публичным
+var ErrForbiddenAddress = errors.New("destination address is not public")
+
+// nonPublicPrefixes - специальные диапазоны, которых нет среди проверок
+// netip.Addr: общий адрес провайдера (CGNAT), сети для тестов и бенчмарков
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublicAddr сообщает, что адрес доступен из интернета и к нему можно
+// подключаться по запросу пользователя
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsUnspecified() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost проверяет, что host (имя или IP-адрес) указывает только на
+// публичные адреса. Это ранний отказ при сохранении адреса пользователя:
+// клиент NewClient все равно проверяет адрес при каждом подключении
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublicAddr(addr) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !IsPublicAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, host, addr)
+		}
+	}
+	return nil
+}
+
+// Options - настройки клиента
+type Options struct {
+	// Timeout - время на весь запрос, включая редиректы и чтение тела
+	Timeout time.Duration
+	// MaxRedirects - сколько редиректов клиент проходит (0 - по умолчанию 5,
+	// отрицательное значение - редиректы не выполняются)
+	MaxRedirects int
+}
+
+// NewClient создает клиент, который подключается только к публичным адресам
+// и проходит только редиректы на http и https
+func NewClient(opts Options) *http.Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = defaultMaxRedirects
+	}
+
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: checkAddress,
+	}
+
+	transport := &http.Transport{
+		// Прокси подключался бы к назначению вместо нас, минуя проверку адреса
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: opts.Timeout,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// checkAddress вызывается перед подключением к уже разрешенному адресу
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	if !IsPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+	}
+	return nil
+}
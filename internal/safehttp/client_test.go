@@ -0,0 +1,67 @@
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestNewClient_RefusesInternalAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{})
+	resp, err := client.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("Get() expected error for loopback address")
+	}
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Get() error = %v, want ErrForbiddenAddress", err)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "169.254.169.254", "::1", "10.0.0.1", "localhost"} {
+		if err := CheckHost(context.Background(), host); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckHost(%s) error = %v, want ErrForbiddenAddress", host, err)
+		}
+	}
+
+	if err := CheckHost(context.Background(), "8.8.8.8"); err != nil {
+		t.Errorf("CheckHost(8.8.8.8) unexpected error = %v", err)
+	}
+}
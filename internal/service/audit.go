@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/access"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+
+	// systemActor - операции вне запроса к API (фоновые задачи)
+	systemActor = "system"
+)
+
+// AuditLog записывает изменения ссылок, доменов, API-ключей и workspaces
+// в журнал аудита. Участник, ID запроса и IP берутся из контекста
+type AuditLog struct {
+	repo repository.AuditRepository
+	now  func() time.Time
+}
+
+func NewAuditLog(repo repository.AuditRepository) *AuditLog {
+	return &AuditLog{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// Record добавляет запись об операции над ресурсом. before и after -
+// состояние ресурса до и после операции (nil - ресурса не было или не стало),
+// в журнал попадают только изменившиеся поля. Операция уже выполнена,
+// поэтому ошибка записи только логируется. nil-журнал ничего не записывает.
+// Изменения ссылок записываются через Pending вместе с самим изменением
+func (a *AuditLog) Record(ctx context.Context, workspaceID int64, action, resourceType, resourceID string, before, after any) {
+	if a == nil {
+		return
+	}
+
+	entry, err := a.entry(ctx, workspaceID, action, resourceType, resourceID, before, after)
+	if err != nil {
+		log.Printf("Failed to build audit diff for %s %s: %v", resourceType, resourceID, err)
+		return
+	}
+	if err := a.repo.Append(ctx, entry); err != nil {
+		log.Printf("Failed to record audit entry %s %s %s: %v", action, resourceType, resourceID, err)
+	}
+}
+
+// Pending откладывает запись об операции до транзакции, в которой
+// репозиторий сохраняет изменение (model.URL.Audit): изменение без записи
+// о нем не сохранится. after вызывается внутри транзакции, когда ID уже
+// присвоены. nil-журнал возвращает nil
+func (a *AuditLog) Pending(ctx context.Context, workspaceID int64, action, resourceType, resourceID string, before any, after func() any) model.PendingAudit {
+	if a == nil {
+		return nil
+	}
+	return func() (*model.AuditEntry, error) {
+		return a.entry(ctx, workspaceID, action, resourceType, resourceID, before, after())
+	}
+}
+
+// entry собирает запись журнала: участник, ID запроса и IP - из контекста
+func (a *AuditLog) entry(ctx context.Context, workspaceID int64, action, resourceType, resourceID string, before, after any) (*model.AuditEntry, error) {
+	beforeJSON, afterJSON, err := auditDiff(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	actor := systemActor
+	if p, ok := access.FromContext(ctx); ok {
+		actor = p.Actor()
+	}
+	request := access.RequestInfoFromContext(ctx)
+
+	return &model.AuditEntry{
+		WorkspaceID:  workspaceID,
+		Actor:        actor,
+		RequestID:    request.ID,
+		IP:           request.IP,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Before:       beforeJSON,
+		After:        afterJSON,
+		CreatedAt:    a.now(),
+	}, nil
+}
+
+// List возвращает страницу журнала workspace от новых записей к старым
+func (a *AuditLog) List(ctx context.Context, workspaceID int64, filter model.AuditFilter) (*model.AuditPage, error) {
+	if err := validateAuditFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	// Одна лишняя запись показывает, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	entries, err := a.repo.List(ctx, workspaceID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = page.Entries[limit-1].ID
+	}
+
+	return page, nil
+}
+
+func validateAuditFilter(filter *model.AuditFilter) error {
+	switch filter.Action {
+	case "", model.AuditCreate, model.AuditUpdate, model.AuditDisable,
+		model.AuditEnable, model.AuditDelete, model.AuditRestore, model.AuditRollback,
+		model.AuditSuspend, model.AuditUnsuspend, model.AuditBan:
+	default:
+		return apperrors.NewValidationError("action",
+			"action must be one of create, update, disable, enable, delete, restore, rollback, suspend, unsuspend, ban")
+	}
+
+	switch filter.ResourceType {
+	case "", model.AuditResourceLink, model.AuditResourceDomain,
+		model.AuditResourceAPIKey, model.AuditResourceWorkspace, model.AuditResourceWebhook:
+	default:
+		return apperrors.NewValidationError("resource_type", "resource_type must be one of link, domain, api_key, workspace, webhook")
+	}
+
+	if filter.Since != nil && filter.Until != nil && !filter.Until.After(*filter.Since) {
+		return apperrors.NewValidationError("until", "until must be later than since")
+	}
+
+	if filter.Limit < 0 || filter.Limit > maxAuditPageSize {
+		return apperrors.NewValidationError("limit", "limit must be between 1 and 200")
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+
+	return nil
+}
+
+// auditDiff сравнивает JSON-представления ресурса и оставляет только поля,
+// значения которых отличаются. Если одного из состояний нет, другое
+// записывается целиком
+func auditDiff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	if before == nil || after == nil {
+		beforeJSON, err := marshalOrNil(before)
+		if err != nil {
+			return nil, nil, err
+		}
+		afterJSON, err := marshalOrNil(after)
+		if err != nil {
+			return nil, nil, err
+		}
+		return beforeJSON, afterJSON, nil
+	}
+
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedBefore := make(map[string]json.RawMessage)
+	changedAfter := make(map[string]json.RawMessage)
+	for name, value := range beforeFields {
+		if other, ok := afterFields[name]; !ok || !bytes.Equal(value, other) {
+			changedBefore[name] = value
+		}
+	}
+	for name, value := range afterFields {
+		if other, ok := beforeFields[name]; !ok || !bytes.Equal(value, other) {
+			changedAfter[name] = value
+		}
+	}
+
+	beforeJSON, err := json.Marshal(changedBefore)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := json.Marshal(changedAfter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+// sameJSON сообщает, что JSON-представления a и b совпадают: так nil и
+// пустые списки не считаются изменением
+func sameJSON(a, b any) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+func marshalOrNil(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// jsonFields возвращает поля верхнего уровня JSON-представления v
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
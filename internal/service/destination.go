@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"time"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// DestinationFor вычисляет итоговое назначение редиректа для конкретного
+// перехода: выбирает назначение по правилам маршрутизации или вариант
+// A/B-теста (записывается в visit.Variant), дописывает путь
+// после короткого кода и пробрасывает query string, если это разрешено
+// настройками ссылки, и подставляет UTM-шаблон
+func (s *URLService) DestinationFor(url *model.URL, visit *model.Visit) (string, error) {
+	extraPath := visit.ExtraPath
+	if extraPath == "/" {
+		extraPath = ""
+	}
+
+	// Без forward_path ссылка /abc123/extra не существует
+	if extraPath != "" && !url.ForwardPath {
+		return "", fmt.Errorf("URL with short code '%s' and path '%s': %w", url.ShortCode, extraPath, apperrors.ErrURLNotFound)
+	}
+
+	base := s.routeDestination(url, visit)
+	visit.Primary = base == url.OriginalURL
+
+	forwardQuery := url.ForwardQuery && len(visit.Query) > 0
+	if extraPath == "" && !forwardQuery && len(url.UTMTemplate) == 0 {
+		return base, nil
+	}
+
+	destination, err := neturl.Parse(base)
+	if err != nil {
+		return "", apperrors.NewBusinessError("INVALID_DESTINATION", "failed to parse destination URL", err)
+	}
+
+	// У opaque-ссылок (tg:resolve?...) нет иерархического пути
+	if extraPath != "" && destination.Opaque == "" {
+		destination = destination.JoinPath(extraPath)
+	}
+
+	if len(url.UTMTemplate) == 0 && !forwardQuery {
+		return destination.String(), nil
+	}
+
+	// UTM-шаблон задан владельцем ссылки, поэтому он считается частью
+	// назначения и при конфликте с запросом подчиняется той же политике.
+	// Собственные параметры назначения остаются в исходной записи
+	query := parseRawQuery(destination.RawQuery)
+	query = applyUTMTemplate(query, url.UTMTemplate, utmValues(url, visit, time.Now()))
+
+	if forwardQuery {
+		policy := url.QueryConflict
+		if policy == "" {
+			policy = model.DefaultQueryConflict
+		}
+		query = mergeQuery(query, visit.Query, policy)
+	}
+	destination.RawQuery = query.String()
+
+	return destination.String(), nil
+}
+
+// mergeQuery добавляет к параметрам назначения параметры запроса. Параметры,
+// которые есть только с одной стороны, попадают в результат всегда
+func mergeQuery(destination rawQuery, request neturl.Values, policy string) rawQuery {
+	added := make(neturl.Values, len(request))
+	for key, values := range request {
+		if destination.has(key) {
+			switch policy {
+			case model.QueryConflictOverride:
+				destination = destination.without(key)
+			case model.QueryConflictAppend:
+			default:
+				continue
+			}
+		}
+		added[key] = values
+	}
+
+	return destination.add(added)
+}
+
+// rawQuery - параметры query string в том виде, в каком они записаны в
+// назначении. В отличие от url.Values сохраняет порядок и кодирование
+// параметров, поэтому ссылка с нестандартной query string не искажается
+type rawQuery []queryParam
+
+type queryParam struct {
+	key string // декодированное имя для сравнения
+	raw string // исходная запись name=value
+}
+
+// parseRawQuery разбивает query string на параметры без перекодирования
+func parseRawQuery(raw string) rawQuery {
+	if raw == "" {
+		return nil
+	}
+
+	parts := strings.Split(raw, "&")
+	query := make(rawQuery, 0, len(parts))
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if decoded, err := neturl.QueryUnescape(key); err == nil {
+			key = decoded
+		}
+		query = append(query, queryParam{key: key, raw: part})
+	}
+	return query
+}
+
+// has сообщает, есть ли в query параметр с именем key
+func (q rawQuery) has(key string) bool {
+	for _, param := range q {
+		if param.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// without возвращает query без параметров с именем key
+func (q rawQuery) without(key string) rawQuery {
+	result := make(rawQuery, 0, len(q))
+	for _, param := range q {
+		if param.key != key {
+			result = append(result, param)
+		}
+	}
+	return result
+}
+
+// add дописывает параметры в конец query в порядке имен
+func (q rawQuery) add(values neturl.Values) rawQuery {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range values[key] {
+			q = append(q, queryParam{
+				key: key,
+				raw: neturl.QueryEscape(key) + "=" + neturl.QueryEscape(value),
+			})
+		}
+	}
+	return q
+}
+
+func (q rawQuery) String() string {
+	parts := make([]string, len(q))
+	for i, param := range q {
+		parts[i] = param.raw
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+const (
+	// domainCacheTTL - сколько помнить результат проверки заголовка Host,
+	// чтобы каждый редирект не обращался к таблице доменов
+	domainCacheTTL = time.Minute
+	// domainCacheSize - ограничение на число запомненных хостов: заголовок
+	// Host задает клиент, и без ограничения кэш можно раздуть
+	domainCacheSize = 1024
+)
+
+// CreateDomain регистрирует брендированный домен workspace. DNS домена
+// должен указывать на этот сервис - это остается на стороне владельца
+func (s *URLService) CreateDomain(ctx context.Context, workspaceID int64, req *model.CreateDomainRequest) (*model.Domain, error) {
+	if s.domainRepo == nil {
+		return nil, apperrors.NewBusinessError("DOMAINS_DISABLED", "branded domains are not configured", nil)
+	}
+
+	hostname := utils.NormalizeHost(req.Hostname)
+	if err := utils.ValidateHostname(hostname); err != nil {
+		return nil, err
+	}
+
+	if hostname == s.defaultHost {
+		return nil, apperrors.NewValidationError("hostname", "hostname is already the default domain")
+	}
+
+	domain := &model.Domain{
+		WorkspaceID: workspaceID,
+		Hostname:    hostname,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.domainRepo.Create(ctx, domain); err != nil {
+		return nil, err
+	}
+
+	// Хост мог быть запомнен как незарегистрированный
+	s.domains.forget(hostname)
+
+	s.audit.Record(ctx, workspaceID, model.AuditCreate, model.AuditResourceDomain, domain.Hostname, nil, domain)
+
+	return domain, nil
+}
+
+// ListDomains возвращает брендированные домены workspace
+func (s *URLService) ListDomains(ctx context.Context, workspaceID int64) ([]model.Domain, error) {
+	if s.domainRepo == nil {
+		return []model.Domain{}, nil
+	}
+	return s.domainRepo.List(ctx, workspaceID)
+}
+
+// ResolveDomain определяет домен ссылок по заголовку Host запроса.
+// Основной и любые незарегистрированные хосты (IP, localhost) ведут
+// на основной домен - для него возвращается пустая строка
+func (s *URLService) ResolveDomain(ctx context.Context, host string) (string, error) {
+	host = utils.NormalizeHost(host)
+	if host == "" || host == s.defaultHost || s.domainRepo == nil {
+		return "", nil
+	}
+
+	now := time.Now()
+	if domain, ok := s.domains.get(host, now); ok {
+		return domain, nil
+	}
+
+	domain, err := s.domainRepo.GetByHostname(ctx, host)
+	if errors.Is(err, apperrors.ErrDomainNotFound) {
+		s.domains.set(host, "", now)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.domains.set(host, domain.Hostname, now)
+	return domain.Hostname, nil
+}
+
+// lookupDomain находит домен workspace, явно указанный при создании ссылки.
+// Для основного домена возвращает nil
+func (s *URLService) lookupDomain(ctx context.Context, workspaceID int64, name string) (*model.Domain, error) {
+	name = s.domainName(name)
+	if name == "" {
+		return nil, nil
+	}
+
+	if s.domainRepo == nil {
+		return nil, apperrors.NewValidationError("domain", "branded domains are not configured")
+	}
+
+	// Домен другого workspace для этого workspace не существует
+	domain, err := s.domainRepo.GetByHostname(ctx, name)
+	if errors.Is(err, apperrors.ErrDomainNotFound) || (err == nil && domain.WorkspaceID != workspaceID) {
+		return nil, apperrors.NewValidationError("domain", "domain is not registered: "+name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return domain, nil
+}
+
+// domainName приводит имя домена из API к виду, в котором его ищет
+// репозиторий: основной домен можно указать явно или не указывать
+func (s *URLService) domainName(name string) string {
+	name = utils.NormalizeHost(name)
+	if name == s.defaultHost {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+// validateFallbackURL проверяет запасное назначение. На него ведет обычный
+// HTTP-редирект, поэтому допускаются только http(s)-адреса. Пусто - нет
+func validateFallbackURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if err := utils.ValidateURL(raw); err != nil {
+		return "", apperrors.NewValidationError("fallback_url", validationMessage(err))
+	}
+	return utils.SanitizeInput(raw), nil
+}
+
+// FallbackFor возвращает запасное назначение ссылки: собственное, а если его
+// нет - запасное назначение workspace. Пусто - запасного назначения нет
+func (s *URLService) FallbackFor(ctx context.Context, url *model.URL) string {
+	if url.FallbackURL != "" {
+		return url.FallbackURL
+	}
+	if s.workspaces == nil {
+		return ""
+	}
+
+	workspace, err := s.workspaces.GetWorkspace(ctx, url.WorkspaceID)
+	if err != nil {
+		log.Printf("Failed to get fallback URL of workspace %d: %v", url.WorkspaceID, err)
+		return ""
+	}
+	return workspace.FallbackURL
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/safehttp"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+const (
+	defaultHealthTimeout          = 10 * time.Second
+	defaultHealthRecheckInterval  = 6 * time.Hour
+	defaultHealthPollInterval     = time.Minute
+	defaultHealthBatchSize        = 100
+	defaultHealthWorkers          = 4
+	defaultHealthHostInterval     = time.Second
+	defaultHealthFailureThreshold = 3
+
+	healthUserAgent = "Mozilla/5.0 (compatible; go-url-shortener-health/1.0)"
+
+	// healthDrainBytes - сколько байт тела дочитывается, чтобы соединение
+	// вернулось в пул
+	healthDrainBytes      = 4 << 10
+	maxHealthErrorLength  = 500
+	maxHealthFinalURLSize = 2048
+	// hostLimiterPruneSize - при таком числе хостов прошедшие слоты удаляются
+	hostLimiterPruneSize = 1024
+)
+
+// HealthConfig - настройки HealthChecker
+type HealthConfig struct {
+	// Client выполняет проверки. По умолчанию - клиент safehttp, который
+	// не ходит на внутренние адреса
+	Client *http.Client
+	// Timeout - время на одну проверку (для клиента по умолчанию)
+	Timeout time.Duration
+	// RecheckInterval - как часто перепроверяется назначение одной ссылки
+	RecheckInterval time.Duration
+	// PollInterval - как часто выбираются ссылки, которые пора проверить
+	PollInterval time.Duration
+	BatchSize    int
+	Workers      int
+	// HostInterval - минимальная пауза между запросами к одному хосту, чтобы
+	// проверки ссылок на один сайт не выглядели как атака
+	HostInterval time.Duration
+	// FailureThreshold - после скольких неудачных проверок подряд назначение
+	// признается недоступным: одна неудача бывает случайной
+	FailureThreshold int
+	// ExcludedHosts - хосты (вместе с поддоменами), которые не проверяются:
+	// сайты, запретившие автоматические запросы
+	ExcludedHosts []string
+}
+
+// HealthChecker периодически проверяет, что страницы назначения ссылок
+// отвечают, и отмечает ссылки с недоступным назначением. Когда назначение
+// становится недоступным, публикуется событие link.broken
+type HealthChecker struct {
+	urls             *URLService
+	client           *http.Client
+	recheckInterval  time.Duration
+	pollInterval     time.Duration
+	batchSize        int
+	workers          int
+	failureThreshold int
+	excludedHosts    []string
+	limiter          *hostLimiter
+
+	// now - текущее время (подменяется в тестах)
+	now func() time.Time
+}
+
+// NewHealthChecker создает проверку назначений ссылок сервиса urls,
+// незаданные поля HealthConfig заменяются значениями по умолчанию
+func NewHealthChecker(urls *URLService, cfg HealthConfig) *HealthChecker {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHealthTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = safehttp.NewClient(safehttp.Options{Timeout: cfg.Timeout})
+	}
+	if cfg.RecheckInterval <= 0 {
+		cfg.RecheckInterval = defaultHealthRecheckInterval
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultHealthPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultHealthBatchSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultHealthWorkers
+	}
+	if cfg.HostInterval <= 0 {
+		cfg.HostInterval = defaultHealthHostInterval
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultHealthFailureThreshold
+	}
+
+	excluded := make([]string, 0, len(cfg.ExcludedHosts))
+	for _, host := range cfg.ExcludedHosts {
+		if host = utils.NormalizeHost(host); host != "" {
+			excluded = append(excluded, host)
+		}
+	}
+
+	return &HealthChecker{
+		urls:             urls,
+		client:           cfg.Client,
+		recheckInterval:  cfg.RecheckInterval,
+		pollInterval:     cfg.PollInterval,
+		batchSize:        cfg.BatchSize,
+		workers:          cfg.Workers,
+		failureThreshold: cfg.FailureThreshold,
+		excludedHosts:    excluded,
+		limiter:          newHostLimiter(cfg.HostInterval),
+		now:              time.Now,
+	}
+}
+
+// Run проверяет ссылки, которые пора проверить, раз в PollInterval, пока
+// не отменен ctx
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Полная пачка - вероятно, есть еще ссылки: проверяем без паузы
+			for {
+				checked, err := h.CheckDue(ctx)
+				if err != nil {
+					log.Printf("Failed to check link destinations: %v", err)
+				}
+				if err != nil || checked < h.batchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// CheckDue проверяет пачку ссылок, назначение которых не проверялось
+// дольше RecheckInterval, и возвращает их число
+func (h *HealthChecker) CheckDue(ctx context.Context) (int, error) {
+	now := h.now()
+	urls, err := h.urls.urlRepo.ClaimHealthChecks(ctx, now.Add(-h.recheckInterval), now, h.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan *model.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < min(h.workers, len(urls)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range jobs {
+				h.check(ctx, url)
+			}
+		}()
+	}
+
+send:
+	for _, url := range urls {
+		select {
+		case jobs <- url:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return len(urls), nil
+}
+
+// check проверяет назначение ссылки и сохраняет результат
+func (h *HealthChecker) check(ctx context.Context, url *model.URL) {
+	parsed, err := neturl.Parse(url.OriginalURL)
+	if err != nil {
+		return
+	}
+	host := utils.NormalizeHost(parsed.Host)
+	if h.isExcluded(host) {
+		return
+	}
+
+	if err := h.limiter.wait(ctx, host); err != nil {
+		return
+	}
+	result := h.Probe(ctx, url.OriginalURL)
+	// Остановка сервиса - не ошибка назначения
+	if ctx.Err() != nil {
+		return
+	}
+
+	h.record(ctx, url, result)
+}
+
+// record сохраняет результат проверки. Назначение признается недоступным
+// после FailureThreshold неудач подряд, первая удачная проверка снимает отметку
+func (h *HealthChecker) record(ctx context.Context, url *model.URL, result model.LinkHealth) {
+	now := h.now().UTC()
+	health := result
+	health.CheckedAt = &now
+
+	broke := false
+	if health.Error == "" {
+		health.Failures = 0
+		health.BrokenSince = nil
+	} else {
+		health.Failures = url.Health.Failures + 1
+		health.BrokenSince = url.Health.BrokenSince
+		if health.BrokenSince == nil && health.Failures >= h.failureThreshold {
+			health.BrokenSince = &now
+			broke = true
+		}
+	}
+
+	checked := *url
+	checked.Health = health
+
+	var events []model.PendingEvent
+	if broke {
+		events = append(events, pendingEvent(url.WorkspaceID, model.EventLinkBroken, func() any {
+			return h.urls.toResponse(&checked, true)
+		}))
+	}
+
+	updated, err := h.urls.urlRepo.UpdateHealth(ctx, &checked, events...)
+	if err != nil {
+		log.Printf("Failed to save health of %s: %v", url.ShortCode, err)
+		return
+	}
+	if !updated {
+		return
+	}
+
+	switch {
+	case broke:
+		log.Printf("Destination of %s is broken: %s", url.ShortCode, health.Error)
+		h.urls.webhooks.Publish(ctx, url.WorkspaceID, model.EventLinkBroken, h.urls.toResponse(&checked, true))
+	case url.Health.IsBroken() && !health.IsBroken():
+		log.Printf("Destination of %s is available again", url.ShortCode)
+	}
+}
+
+// Probe проверяет адрес запросом HEAD, а если он не удался - GET: часть
+// серверов не поддерживает HEAD или отвечает на него иначе. Error
+// результата пуст, если назначение доступно
+func (h *HealthChecker) Probe(ctx context.Context, rawURL string) model.LinkHealth {
+	result, ok := h.request(ctx, http.MethodHead, rawURL)
+	if !ok && ctx.Err() == nil {
+		result, _ = h.request(ctx, http.MethodGet, rawURL)
+	}
+	return result
+}
+
+func (h *HealthChecker) request(ctx context.Context, method, rawURL string) (model.LinkHealth, bool) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return model.LinkHealth{Error: healthError(err)}, false
+	}
+	req.Header.Set("User-Agent", healthUserAgent)
+
+	started := time.Now()
+	resp, err := h.client.Do(req)
+	latency := time.Since(started).Milliseconds()
+	if err != nil {
+		return model.LinkHealth{LatencyMs: latency, Error: healthError(err)}, false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, healthDrainBytes))
+
+	result := model.LinkHealth{
+		StatusCode: resp.StatusCode,
+		LatencyMs:  latency,
+	}
+	if finalURL := resp.Request.URL.String(); len(finalURL) <= maxHealthFinalURLSize {
+		result.FinalURL = finalURL
+	}
+
+	if isDestinationFailure(resp.StatusCode) {
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		return result, false
+	}
+	return result, true
+}
+
+// isDestinationFailure сообщает, что статус означает неработающую страницу.
+// 401, 403 и 429 отвечает живой сайт, который не пускает проверку
+func isDestinationFailure(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= http.StatusBadRequest
+}
+
+// healthError - текст ошибки запроса без адреса назначения
+func healthError(err error) string {
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return truncateText(err.Error(), maxHealthErrorLength)
+}
+
+// isExcluded сообщает, что хост или его родительский домен исключен из проверок
+func (h *HealthChecker) isExcluded(host string) bool {
+	for _, excluded := range h.excludedHosts {
+		if host == excluded || strings.HasSuffix(host, "."+excluded) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostLimiter выдает запросам к одному хосту слоты не чаще interval
+type hostLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{
+		interval: interval,
+		next:     make(map[string]time.Time),
+	}
+}
+
+// wait ждет слота для запроса к host или отмены ctx
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := now
+	if next, ok := l.next[host]; ok && next.After(now) {
+		slot = next
+	}
+	l.next[host] = slot.Add(l.interval)
+
+	// Прошедшие слоты больше не нужны
+	if len(l.next) > hostLimiterPruneSize {
+		for h, next := range l.next {
+			if !next.After(now) {
+				delete(l.next, h)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+// UpdateURL меняет настройки ссылки workspace (см. model.UpdateURLRequest)
+func (s *URLService) UpdateURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, req *model.UpdateURLRequest) (*model.URLResponse, error) {
+	return s.mutateURL(ctx, workspaceID, domain, shortCode, ownerToken, model.AuditUpdate, func(url *model.URL) error {
+		return applyURLUpdate(url, req, time.Now())
+	})
+}
+
+// DisableURL отключает ссылку: переходы по ней отвечают 410, пока ссылку
+// не включат снова
+func (s *URLService) DisableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	return s.mutateURL(ctx, workspaceID, domain, shortCode, ownerToken, model.AuditDisable, func(url *model.URL) error {
+		if url.DisabledAt == nil {
+			now := time.Now().UTC()
+			url.DisabledAt = &now
+		}
+		return nil
+	})
+}
+
+// EnableURL включает отключенную ссылку
+func (s *URLService) EnableURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	return s.mutateURL(ctx, workspaceID, domain, shortCode, ownerToken, model.AuditEnable, func(url *model.URL) error {
+		url.DisabledAt = nil
+		return nil
+	})
+}
+
+// DeleteURL удаляет ссылку: она перестает находиться по коду и не занимает
+// квоту, но код остается за ней и ссылку можно восстановить
+func (s *URLService) DeleteURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) error {
+	_, err := s.mutateURL(ctx, workspaceID, domain, shortCode, ownerToken, model.AuditDelete, func(url *model.URL) error {
+		now := time.Now().UTC()
+		url.DeletedAt = &now
+		return nil
+	})
+	return err
+}
+
+// RestoreURL восстанавливает удаленную ссылку, если квота workspace позволяет
+func (s *URLService) RestoreURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
+	var linkQuota int64
+	response, err := s.mutateURL(ctx, workspaceID, domain, shortCode, ownerToken, model.AuditRestore, func(url *model.URL) error {
+		if url.DeletedAt == nil {
+			return nil
+		}
+		if s.workspaces != nil {
+			var err error
+			if linkQuota, err = s.workspaces.CheckLinkQuota(ctx, workspaceID); err != nil {
+				return err
+			}
+		}
+		url.DeletedAt = nil
+		url.LinkQuota = linkQuota
+		return nil
+	})
+	return response, linkQuotaError(err, linkQuota)
+}
+
+// ListURLVersions возвращает ревизии настроек ссылки от новых к старым
+func (s *URLService) ListURLVersions(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) ([]model.LinkVersion, error) {
+	if shortCode == "" {
+		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
+	}
+
+	url, err := s.urlRepo.GetForWorkspace(ctx, workspaceID, s.domainName(domain), shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.canManage(workspaceID, url, ownerToken) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	return s.urlRepo.ListVersions(ctx, url.ID)
+}
+
+// RollbackURL возвращает ссылке настройки ревизии version. Откат сам
+// становится новой ревизией, поэтому его тоже можно отменить
+func (s *URLService) RollbackURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string, version int) (*model.URLResponse, error) {
+	if version <= 0 {
+		return nil, apperrors.NewValidationError("version", "version must be positive")
+	}
+
+	return s.mutateURL(ctx, workspaceID, domain, shortCode, ownerToken, model.AuditRollback, func(url *model.URL) error {
+		revision, err := s.urlRepo.GetVersion(ctx, url.ID, version)
+		if err != nil {
+			return err
+		}
+		url.ApplySettings(revision.Settings)
+		return nil
+	})
+}
+
+// mutateURL читает ссылку workspace, применяет к ее копии change и сохраняет
+// результат вместе с событием outbox и записью операции action в журнале
+// аудита. Если change ничего не изменил, ссылка не сохраняется и запись
+// в журнале не появляется. Если ссылку изменили параллельно, возвращается
+// ErrURLConflict - запрос можно повторить.
+// Удаленную ссылку можно только восстановить
+func (s *URLService) mutateURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken, action string,
+	change func(url *model.URL) error) (*model.URLResponse, error) {
+	if shortCode == "" {
+		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
+	}
+
+	url, err := s.urlRepo.GetForWorkspace(ctx, workspaceID, s.domainName(domain), shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.canManage(workspaceID, url, ownerToken) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	if url.IsDeleted() && action != model.AuditRestore {
+		return nil, apperrors.ErrURLNotFound
+	}
+
+	// Решение модерации снимает только модератор: ограниченную ссылку
+	// владелец может лишь удалить
+	if url.Moderation.IsRestricted() && action != model.AuditDelete {
+		return nil, apperrors.ErrURLSuspended
+	}
+
+	updated := *url
+	if err := change(&updated); err != nil {
+		return nil, err
+	}
+
+	// Проверки прежнего назначения к новому не относятся
+	if updated.OriginalURL != url.OriginalURL {
+		updated.Health = model.LinkHealth{}
+	}
+
+	// Изменение назначения или настроек - новая ревизия ссылки
+	if !sameJSON(url.Settings(), updated.Settings()) {
+		updated.Version = url.Version + 1
+	}
+
+	before, after := s.toResponse(url, true), s.toResponse(&updated, true)
+	if sameJSON(before, after) {
+		return before, nil
+	}
+
+	event := model.EventLinkUpdated
+	if action == model.AuditDelete {
+		event = model.EventLinkDeleted
+	}
+	updated.Events = []model.PendingEvent{pendingEvent(workspaceID, event, func() any {
+		return after
+	})}
+	updated.Audit = s.audit.Pending(ctx, workspaceID, action, model.AuditResourceLink, linkResourceID(&updated), before, func() any {
+		return after
+	})
+
+	if err := s.urlRepo.Update(ctx, &updated, url.Version); err != nil {
+		return nil, err
+	}
+
+	s.webhooks.Publish(ctx, workspaceID, event, after)
+	if updated.OriginalURL != url.OriginalURL {
+		s.previews.Enqueue(&updated)
+	}
+
+	return after, nil
+}
+
+// applyURLUpdate применяет заданные поля запроса к ссылке и проверяет
+// результат по тем же правилам, что и при создании
+func applyURLUpdate(url *model.URL, req *model.UpdateURLRequest, now time.Time) error {
+	if req.RedirectType != nil {
+		if *req.RedirectType != "" && !model.IsValidRedirectType(*req.RedirectType) {
+			return apperrors.NewValidationError("redirect_type", "redirect_type must be one of 301, 302, 307, 308, meta, js")
+		}
+		url.RedirectType = *req.RedirectType
+	}
+
+	// Собственные схемы приложений открываются только HTML-редиректом
+	validate := utils.ValidateURL
+	if model.IsPageRedirect(url.RedirectType) {
+		validate = utils.ValidateAppLink
+	}
+
+	// Смена типа редиректа может сделать недопустимыми прежние назначения,
+	// поэтому они проверяются заново
+	if req.URL != nil || req.RedirectType != nil {
+		destination := url.OriginalURL
+		if req.URL != nil {
+			destination = *req.URL
+		}
+		if err := validate(destination); err != nil {
+			return err
+		}
+		url.OriginalURL = utils.SanitizeInput(destination)
+	}
+
+	if req.MaxClicks != nil {
+		if *req.MaxClicks < 0 {
+			return apperrors.NewValidationError("max_clicks", "max_clicks cannot be negative")
+		}
+		url.MaxClicks = *req.MaxClicks
+	}
+
+	if req.ClearSchedule {
+		url.NotBefore, url.NotAfter = nil, nil
+	}
+	if req.NotBefore != nil || req.NotAfter != nil {
+		if req.NotBefore != nil {
+			url.NotBefore = utcOrNil(req.NotBefore)
+		}
+		if req.NotAfter != nil {
+			url.NotAfter = utcOrNil(req.NotAfter)
+		}
+		if err := validateActivationWindow(url.NotBefore, url.NotAfter, now); err != nil {
+			return err
+		}
+	}
+
+	if req.PreviewMode != nil {
+		url.PreviewMode = *req.PreviewMode
+	}
+	if req.ForwardQuery != nil {
+		url.ForwardQuery = *req.ForwardQuery
+	}
+	if req.ForwardPath != nil {
+		url.ForwardPath = *req.ForwardPath
+	}
+	if req.StickyVariants != nil {
+		url.StickyVariants = *req.StickyVariants
+	}
+
+	if req.QueryConflict != nil {
+		if *req.QueryConflict != "" && !model.IsValidQueryConflict(*req.QueryConflict) {
+			return apperrors.NewValidationError("query_conflict", "query_conflict must be one of destination, request, append")
+		}
+		url.QueryConflict = *req.QueryConflict
+	}
+
+	if req.UTMTemplate != nil {
+		if err := validateUTMTemplate(*req.UTMTemplate); err != nil {
+			return err
+		}
+		url.UTMTemplate = *req.UTMTemplate
+	}
+
+	if req.FallbackURL != nil {
+		fallbackURL, err := validateFallbackURL(*req.FallbackURL)
+		if err != nil {
+			return err
+		}
+		url.FallbackURL = fallbackURL
+	}
+
+	if req.SocialPreview != nil {
+		preview, err := validateSocialPreview(req.SocialPreview)
+		if err != nil {
+			return err
+		}
+		url.SocialPreview = preview
+	}
+
+	if req.Rules != nil || req.RedirectType != nil {
+		rules := []model.RoutingRule(url.Rules)
+		if req.Rules != nil {
+			rules = *req.Rules
+		}
+		validated, err := validateRoutingRules(rules, validate)
+		if err != nil {
+			return err
+		}
+		url.Rules = validated
+	}
+
+	if req.Variants != nil || req.RedirectType != nil {
+		variants := []model.Variant(url.Variants)
+		if req.Variants != nil {
+			variants = *req.Variants
+		}
+		validated, err := validateVariants(variants, validate)
+		if err != nil {
+			return err
+		}
+		url.Variants = validated
+	}
+
+	return nil
+}
+
+// linkResourceID - идентификатор ссылки в журнале аудита: код, а для
+// брендированного домена - домен и код (go.brand.com/sale)
+func linkResourceID(url *model.URL) string {
+	if url.Domain == "" {
+		return url.ShortCode
+	}
+	return url.Domain + "/" + url.ShortCode
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/cache"
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+const (
+	// liveBufferSize - сколько переходов ждут отправки подписчику. Переходы
+	// сверх буфера медленному подписчику не отправляются
+	liveBufferSize = 64
+	// liveResubscribeDelay - пауза перед повторной подпиской на канал
+	liveResubscribeDelay = 5 * time.Second
+)
+
+// LiveClicks рассылает переходы подписчикам потоков SSE. Переходы проходят
+// через канал pub/sub, поэтому подписчик получает переходы, засчитанные
+// любым экземпляром сервиса
+type LiveClicks struct {
+	pubsub  cache.PubSub
+	channel string
+
+	mu          sync.Mutex
+	subscribers map[*liveSubscriber]struct{}
+	closed      bool
+}
+
+// liveSubscriber - поток переходов ссылки urlID (0 - всех ссылок workspace)
+type liveSubscriber struct {
+	workspaceID int64
+	urlID       int64
+	clicks      chan model.ClickEvent
+}
+
+// liveMessage - переход в канале pub/sub. WorkspaceID у ClickEvent не
+// сериализуется, поэтому передается отдельно
+type liveMessage struct {
+	WorkspaceID int64            `json:"workspace_id"`
+	Click       model.ClickEvent `json:"click"`
+}
+
+// NewLiveClicks создает рассылку переходов через pubsub (Redis или in-memory)
+func NewLiveClicks(pubsub cache.PubSub, keys *cache.KeyBuilder) *LiveClicks {
+	if keys == nil {
+		keys = cache.DefaultKeyBuilder
+	}
+	return &LiveClicks{
+		pubsub:      pubsub,
+		channel:     keys.LiveClicks(),
+		subscribers: make(map[*liveSubscriber]struct{}),
+	}
+}
+
+// Run читает канал pub/sub и раздает переходы подписчикам этого экземпляра,
+// пока не отменен ctx. После отмены каналы подписчиков закрываются, чтобы
+// потоки SSE завершились до остановки сервера
+func (l *LiveClicks) Run(ctx context.Context) {
+	defer l.close()
+
+	for {
+		messages, err := l.pubsub.Subscribe(ctx, l.channel)
+		if err != nil {
+			log.Printf("Failed to subscribe to live clicks: %v", err)
+		} else {
+			for message := range messages {
+				l.dispatch(message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(liveResubscribeDelay):
+		}
+	}
+}
+
+// Publish отправляет переход в канал pub/sub. Ошибка не мешает учету
+// перехода и только записывается в лог
+func (l *LiveClicks) Publish(ctx context.Context, event *model.ClickEvent) {
+	if l == nil {
+		return
+	}
+
+	message, err := json.Marshal(liveMessage{WorkspaceID: event.WorkspaceID, Click: *event})
+	if err != nil {
+		log.Printf("Failed to encode live click: %v", err)
+		return
+	}
+	if err := l.pubsub.Publish(ctx, l.channel, message); err != nil {
+		log.Printf("Failed to publish live click: %v", err)
+	}
+}
+
+// Subscribe подписывает на переходы по ссылке urlID workspace (urlID == 0 -
+// по всем ссылкам). stop отменяет подписку. Без рассылки (nil) переходы
+// не приходят
+func (l *LiveClicks) Subscribe(workspaceID, urlID int64) (clicks <-chan model.ClickEvent, stop func()) {
+	if l == nil {
+		return nil, func() {}
+	}
+
+	subscriber := &liveSubscriber{
+		workspaceID: workspaceID,
+		urlID:       urlID,
+		clicks:      make(chan model.ClickEvent, liveBufferSize),
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		close(subscriber.clicks)
+	} else {
+		l.subscribers[subscriber] = struct{}{}
+	}
+	l.mu.Unlock()
+
+	var once sync.Once
+	return subscriber.clicks, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subscribers, subscriber)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// close закрывает каналы всех подписчиков
+func (l *LiveClicks) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	for subscriber := range l.subscribers {
+		close(subscriber.clicks)
+		delete(l.subscribers, subscriber)
+	}
+}
+
+// dispatch отправляет переход подходящим подписчикам
+func (l *LiveClicks) dispatch(message []byte) {
+	var decoded liveMessage
+	if err := json.Unmarshal(message, &decoded); err != nil {
+		log.Printf("Failed to decode live click: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for subscriber := range l.subscribers {
+		if subscriber.workspaceID != decoded.WorkspaceID {
+			continue
+		}
+		if subscriber.urlID != 0 && subscriber.urlID != decoded.Click.URLID {
+			continue
+		}
+		select {
+		case subscriber.clicks <- decoded.Click:
+		default:
+		}
+	}
+}
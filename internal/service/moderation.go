@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Kosench/go-url-shortener/internal/access"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+const (
+	maxReportDetailsLength    = 1000
+	maxModerationReasonLength = 500
+
+	defaultModerationQueueLimit = 50
+	maxModerationQueueLimit     = 200
+	// moderationReportsLimit - сколько последних жалоб на ссылку видит модератор
+	moderationReportsLimit = 100
+
+	// Отпечатки IP авторов ссылок и отправителей жалоб различаются, чтобы
+	// их нельзя было сопоставить между собой
+	creatorHashKind  = "creator"
+	reporterHashKind = "reporter"
+)
+
+var errModerationDisabled = apperrors.NewBusinessError("MODERATION_DISABLED", "moderation is not configured", nil)
+
+// ReportURL принимает жалобу посетителя на ссылку. Повторная жалоба того же
+// посетителя, пока открыта прежняя, принимается, но не сохраняется
+func (s *URLService) ReportURL(ctx context.Context, domain, shortCode string, req *model.CreateReportRequest) error {
+	if s.moderation == nil {
+		return errModerationDisabled
+	}
+
+	if !model.IsValidReportReason(req.Reason) {
+		return apperrors.NewValidationError("reason", "reason must be one of phishing, malware, spam, other")
+	}
+	details := strings.TrimSpace(req.Details)
+	if utf8.RuneCountInString(details) > maxReportDetailsLength {
+		return apperrors.NewValidationError("details", "details are too long (max 1000 characters)")
+	}
+
+	url, err := s.urlRepo.GetByShortCode(ctx, s.domainName(domain), shortCode)
+	if err != nil {
+		return err
+	}
+
+	report := &model.AbuseReport{
+		URLID:        url.ID,
+		Reason:       req.Reason,
+		Details:      utils.SanitizeInput(details),
+		ReporterHash: s.requesterHash(ctx, reporterHashKind),
+		Status:       model.ReportOpen,
+		CreatedAt:    time.Now().UTC(),
+	}
+	created, err := s.moderation.CreateReport(ctx, report)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Abuse report on %s: %s", url.ShortCode, report.Reason)
+	}
+
+	return nil
+}
+
+// ModerationQueue возвращает ссылки с открытыми жалобами, сначала ссылки
+// с большим числом жалоб
+func (s *URLService) ModerationQueue(ctx context.Context, limit int) ([]model.ModerationItem, error) {
+	if s.moderation == nil {
+		return nil, errModerationDisabled
+	}
+
+	if limit <= 0 {
+		limit = defaultModerationQueueLimit
+	}
+	limit = min(limit, maxModerationQueueLimit)
+
+	summaries, err := s.moderation.Queue(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.ModerationItem, 0, len(summaries))
+	for _, summary := range summaries {
+		url, err := s.urlRepo.GetByID(ctx, summary.URLID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, model.ModerationItem{URL: s.toResponse(url, true), ReportSummary: summary})
+	}
+
+	return items, nil
+}
+
+// ListReports возвращает последние жалобы на ссылку
+func (s *URLService) ListReports(ctx context.Context, urlID int64) ([]model.AbuseReport, error) {
+	if s.moderation == nil {
+		return nil, errModerationDisabled
+	}
+
+	if _, err := s.urlRepo.GetByID(ctx, urlID); err != nil {
+		return nil, err
+	}
+
+	return s.moderation.ListReports(ctx, urlID, moderationReportsLimit)
+}
+
+// DismissReports отклоняет открытые жалобы на ссылку без мер
+func (s *URLService) DismissReports(ctx context.Context, urlID int64) (*model.URLResponse, error) {
+	if s.moderation == nil {
+		return nil, errModerationDisabled
+	}
+
+	url, err := s.urlRepo.GetByID(ctx, urlID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.moderation.ResolveReports(ctx, urlID, model.ReportDismissed, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return s.toResponse(url, true), nil
+}
+
+// SuspendURL приостанавливает ссылку: вместо редиректа она показывает
+// предупреждение, пока модератор не снимет приостановку
+func (s *URLService) SuspendURL(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error) {
+	if s.moderation == nil {
+		return nil, errModerationDisabled
+	}
+
+	reason, err := validateModerationReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.urlRepo.GetByID(ctx, urlID)
+	if err != nil {
+		return nil, err
+	}
+	if url.Moderation.IsBanned() {
+		return nil, apperrors.NewValidationError("status", "link is already banned")
+	}
+
+	return s.moderate(ctx, url, model.ModerationSuspended, reason, time.Now().UTC())
+}
+
+// UnsuspendURL снимает приостановку ссылки. Блокировка не снимается
+func (s *URLService) UnsuspendURL(ctx context.Context, urlID int64) (*model.URLResponse, error) {
+	url, err := s.urlRepo.GetByID(ctx, urlID)
+	if err != nil {
+		return nil, err
+	}
+
+	if url.Moderation.IsBanned() {
+		return nil, apperrors.NewValidationError("status", "banned links cannot be reinstated")
+	}
+	if !url.Moderation.IsRestricted() {
+		return s.toResponse(url, true), nil
+	}
+
+	updated := *url
+	updated.Moderation = model.Moderation{}
+	if err := s.urlRepo.UpdateModeration(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	before, after := s.toResponse(url, true), s.toResponse(&updated, true)
+	s.audit.Record(ctx, url.WorkspaceID, model.AuditUnsuspend, model.AuditResourceLink, linkResourceID(url), before, after)
+	return after, nil
+}
+
+// BanURL блокирует ссылку навсегда, а с BanCreator - и ее автора со всеми
+// его ссылками: workspace целиком или автора анонимных ссылок по IP
+func (s *URLService) BanURL(ctx context.Context, urlID int64, req *model.ModerationRequest) (*model.URLResponse, error) {
+	if s.moderation == nil {
+		return nil, errModerationDisabled
+	}
+
+	reason, err := validateModerationReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.urlRepo.GetByID(ctx, urlID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ссылки, созданные до учета авторов, не связать с автором
+	anonymous := url.WorkspaceID == model.DefaultWorkspaceID
+	if req.BanCreator && anonymous && url.CreatorHash == "" {
+		return nil, apperrors.NewValidationError("ban_creator", "creator of this link is unknown")
+	}
+
+	now := time.Now().UTC()
+	response := s.toResponse(url, true)
+	if !url.Moderation.IsBanned() {
+		response, err = s.moderate(ctx, url, model.ModerationBanned, reason, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !req.BanCreator {
+		return response, nil
+	}
+
+	var creatorHash string
+	if anonymous {
+		creatorHash = url.CreatorHash
+		if err := s.moderation.BanCreator(ctx, creatorHash, reason, now); err != nil {
+			return nil, err
+		}
+	} else if s.workspaces != nil {
+		if err := s.workspaces.BanWorkspace(ctx, url.WorkspaceID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	moderation := model.Moderation{Status: model.ModerationBanned, Reason: reason, At: &now}
+	banned, err := s.urlRepo.ModerateCreator(ctx, url.WorkspaceID, creatorHash, moderation)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range banned {
+		s.audit.Record(ctx, link.WorkspaceID, model.AuditBan, model.AuditResourceLink, linkResourceID(link), nil, s.toResponse(link, true))
+	}
+	log.Printf("Banned creator of %s with %d more links", url.ShortCode, len(banned))
+
+	return response, nil
+}
+
+// moderate сохраняет решение модерации и закрывает открытые жалобы на ссылку
+func (s *URLService) moderate(ctx context.Context, url *model.URL, status, reason string, now time.Time) (*model.URLResponse, error) {
+	updated := *url
+	updated.Moderation = model.Moderation{Status: status, Reason: reason, At: &now}
+	if err := s.urlRepo.UpdateModeration(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.moderation.ResolveReports(ctx, url.ID, model.ReportActioned, now); err != nil {
+		log.Printf("Failed to resolve abuse reports on %s: %v", url.ShortCode, err)
+	}
+
+	action := model.AuditSuspend
+	if status == model.ModerationBanned {
+		action = model.AuditBan
+	}
+	before, after := s.toResponse(url, true), s.toResponse(&updated, true)
+	s.audit.Record(ctx, url.WorkspaceID, action, model.AuditResourceLink, linkResourceID(url), before, after)
+	log.Printf("Link %s is %s by moderation", url.ShortCode, status)
+
+	return after, nil
+}
+
+// checkCreator отклоняет создание ссылки заблокированным автором
+func (s *URLService) checkCreator(ctx context.Context, creatorHash string) error {
+	if s.moderation == nil || creatorHash == "" {
+		return nil
+	}
+
+	banned, err := s.moderation.IsCreatorBanned(ctx, creatorHash)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return apperrors.ErrBanned
+	}
+	return nil
+}
+
+// requesterHash - отпечаток IP клиента запроса (пусто вне HTTP-запроса).
+// Отпечаток подписывается секретом сервиса, поэтому блокировки авторов
+// переживают рестарт, только если secret_key задан в конфигурации
+func (s *URLService) requesterHash(ctx context.Context, kind string) string {
+	ip := access.RequestInfoFromContext(ctx).IP
+	if ip == "" {
+		return ""
+	}
+	return s.signer.Fingerprint(kind, ip)
+}
+
+// validateModerationReason проверяет причину решения модератора
+func validateModerationReason(raw string) (string, error) {
+	reason := strings.TrimSpace(raw)
+	if utf8.RuneCountInString(reason) > maxModerationReasonLength {
+		return "", apperrors.NewValidationError("reason", "reason is too long (max 500 characters)")
+	}
+	return utils.SanitizeInput(reason), nil
+}
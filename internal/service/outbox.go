@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/repository"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+const (
+	defaultOutboxBatchSize    = 100
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxBaseBackoff  = 5 * time.Second
+	defaultOutboxMaxBackoff   = 10 * time.Minute
+	defaultOutboxRetention    = 7 * 24 * time.Hour
+
+	// outboxLease - на сколько откладываются выбранные для публикации события,
+	// чтобы их не взял другой экземпляр сервиса
+	outboxLease = time.Minute
+	// outboxPurgeInterval - как часто удаляются опубликованные события
+	outboxPurgeInterval = time.Hour
+)
+
+// EventSink - приемник доменных событий из outbox (stdout, файл, HTTP,
+// Redis Streams, webhooks). Публикация не транзакционна: при ошибке любого
+// приемника пачка публикуется всем приемникам заново, поэтому получатели
+// должны отбрасывать дубли по ID события
+type EventSink interface {
+	// Name - имя приемника для логов
+	Name() string
+	// Publish публикует события в порядке записи
+	Publish(ctx context.Context, events []model.OutboxEvent) error
+}
+
+// OutboxConfig - настройки OutboxRelay
+type OutboxConfig struct {
+	// BatchSize - сколько событий публикуется за один проход
+	BatchSize    int
+	PollInterval time.Duration
+	// BaseBackoff - пауза после первой неудачной публикации, дальше она
+	// удваивается до MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Retention - сколько хранить опубликованные события
+	Retention time.Duration
+}
+
+// OutboxRelay публикует события, записанные в outbox вместе с изменениями
+// ссылок и счетчиков переходов, во все приемники
+type OutboxRelay struct {
+	repo         repository.OutboxRepository
+	sinks        []EventSink
+	batchSize    int
+	pollInterval time.Duration
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	retention    time.Duration
+
+	// now - текущее время (подменяется в тестах)
+	now func() time.Time
+}
+
+// NewOutboxRelay создает relay, незаданные поля OutboxConfig заменяются
+// значениями по умолчанию
+func NewOutboxRelay(repo repository.OutboxRepository, sinks []EventSink, cfg OutboxConfig) *OutboxRelay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultOutboxBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultOutboxPollInterval
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaultOutboxBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultOutboxMaxBackoff
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultOutboxRetention
+	}
+
+	return &OutboxRelay{
+		repo:         repo,
+		sinks:        sinks,
+		batchSize:    cfg.BatchSize,
+		pollInterval: cfg.PollInterval,
+		baseBackoff:  cfg.BaseBackoff,
+		maxBackoff:   cfg.MaxBackoff,
+		retention:    cfg.Retention,
+		now:          time.Now,
+	}
+}
+
+// Run публикует накопившиеся события раз в PollInterval и раз в час
+// удаляет старые опубликованные, пока не отменен ctx
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	purge := time.NewTicker(outboxPurgeInterval)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Полная пачка - вероятно, есть еще события: публикуем без паузы
+			for {
+				published, err := r.PublishDue(ctx)
+				if err != nil {
+					log.Printf("Failed to publish outbox events: %v", err)
+				}
+				if err != nil || published < r.batchSize || ctx.Err() != nil {
+					break
+				}
+			}
+		case <-purge.C:
+			if _, err := r.repo.PurgePublished(ctx, r.now().Add(-r.retention)); err != nil {
+				log.Printf("Failed to purge outbox events: %v", err)
+			}
+		}
+	}
+}
+
+// PublishDue публикует пачку событий, время которых наступило, и возвращает
+// число опубликованных. Если приемник вернул ошибку, пачка откладывается
+// с экспоненциальной паузой
+func (r *OutboxRelay) PublishDue(ctx context.Context) (int, error) {
+	now := r.now()
+	events, err := r.repo.ClaimDue(ctx, now, now.Add(outboxLease), r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := r.publish(ctx, events); err != nil {
+		r.postpone(ctx, events, err)
+		return 0, err
+	}
+
+	ids := make([]int64, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+	if err := r.repo.MarkPublished(ctx, ids, r.now()); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// publish передает события всем приемникам. Ошибка одного приемника
+// не мешает остальным получить события
+func (r *OutboxRelay) publish(ctx context.Context, events []model.OutboxEvent) error {
+	var errs []error
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, events); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postpone откладывает неопубликованные события до следующей попытки
+func (r *OutboxRelay) postpone(ctx context.Context, events []model.OutboxEvent, cause error) {
+	now := r.now()
+	for i := range events {
+		event := &events[i]
+		event.Attempts++
+		event.NextAttemptAt = now.Add(r.backoff(event.Attempts))
+		event.LastError = truncateError(cause)
+		if err := r.repo.SaveFailure(ctx, event); err != nil {
+			log.Printf("Failed to save outbox event %s attempt: %v", event.EventID, err)
+		}
+	}
+}
+
+// backoff - пауза перед следующей попыткой после attempts неудачных
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	delay := r.baseBackoff
+	for i := 1; i < attempts && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.maxBackoff)
+}
+
+// newEvent собирает доменное событие с новым ID. Тело события - WebhookEvent,
+// его получают и подписки webhooks, и остальные приемники
+func newEvent(workspaceID int64, eventType string, data any, now time.Time) (*model.OutboxEvent, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := utils.GenerateToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &model.OutboxEvent{
+		EventID:     "evt_" + id,
+		WorkspaceID: workspaceID,
+		Type:        eventType,
+		CreatedAt:   now.UTC(),
+	}
+	event.Payload, err = json.Marshal(model.WebhookEvent{
+		ID:          event.EventID,
+		Type:        eventType,
+		WorkspaceID: workspaceID,
+		CreatedAt:   event.CreatedAt,
+		Data:        raw,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// pendingEvent откладывает сборку события до записи в outbox: data
+// вызывается в транзакции, когда изменение уже записано
+func pendingEvent(workspaceID int64, eventType string, data func() any) model.PendingEvent {
+	return func() (*model.OutboxEvent, error) {
+		return newEvent(workspaceID, eventType, data(), time.Now())
+	}
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/repository"
+	"github.com/Kosench/go-url-shortener/internal/safehttp"
+)
+
+const (
+	defaultPreviewTimeout   = 5 * time.Second
+	defaultPreviewMaxBytes  = 512 << 10
+	defaultPreviewWorkers   = 2
+	defaultPreviewQueueSize = 256
+
+	// previewUserAgent - часть сайтов отдает теги Open Graph только
+	// клиентам, похожим на превью мессенджеров
+	previewUserAgent = "Mozilla/5.0 (compatible; go-url-shortener-preview/1.0)"
+
+	maxPreviewTitleLength       = 300
+	maxPreviewDescriptionLength = 1000
+	maxPreviewImageURLLength    = 2048
+)
+
+// PreviewConfig - настройки LinkPreviews
+type PreviewConfig struct {
+	// Client загружает страницы назначения. По умолчанию - клиент
+	// safehttp, который не ходит на внутренние адреса
+	Client *http.Client
+	// Timeout - время на загрузку страницы (для клиента по умолчанию)
+	Timeout time.Duration
+	// MaxBytes - сколько байт страницы читается: теги Open Graph находятся
+	// в <head>, дальше читать не нужно
+	MaxBytes int64
+	// Workers - число параллельных загрузок, QueueSize - длина очереди.
+	// Ссылки сверх очереди остаются без карточки
+	Workers   int
+	QueueSize int
+}
+
+// LinkPreviews загружает в фоне заголовок, описание и картинку страниц
+// назначения и сохраняет их в ссылке
+type LinkPreviews struct {
+	repo     repository.URLRepository
+	client   *http.Client
+	maxBytes int64
+	workers  int
+	queue    chan model.URL
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewLinkPreviews создает загрузчик, незаданные поля PreviewConfig
+// заменяются значениями по умолчанию
+func NewLinkPreviews(repo repository.URLRepository, cfg PreviewConfig) *LinkPreviews {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPreviewTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = safehttp.NewClient(safehttp.Options{Timeout: cfg.Timeout})
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultPreviewMaxBytes
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultPreviewWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultPreviewQueueSize
+	}
+
+	return &LinkPreviews{
+		repo:     repo,
+		client:   cfg.Client,
+		maxBytes: cfg.MaxBytes,
+		workers:  cfg.Workers,
+		queue:    make(chan model.URL, cfg.QueueSize),
+	}
+}
+
+// Enqueue ставит ссылку в очередь загрузки карточки (неблокирующе).
+// Назначения без http(s), например deep link приложения, пропускаются
+func (p *LinkPreviews) Enqueue(url *model.URL) {
+	if p == nil || !isWebURL(url.OriginalURL) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	job := model.URL{
+		ID:          url.ID,
+		ShortCode:   url.ShortCode,
+		Domain:      url.Domain,
+		OriginalURL: url.OriginalURL,
+	}
+	select {
+	case p.queue <- job:
+	default:
+		log.Printf("Link preview queue is full, skipping %s", url.ShortCode)
+	}
+}
+
+// Run загружает карточки из очереди, пока не отменен ctx
+func (p *LinkPreviews) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.queue:
+					p.refresh(ctx, &job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// refresh загружает карточку и сохраняет ее, если назначение не сменилось
+func (p *LinkPreviews) refresh(ctx context.Context, url *model.URL) {
+	metadata, err := p.Fetch(ctx, url.OriginalURL)
+	if err != nil {
+		log.Printf("Failed to fetch link preview for %s: %v", url.ShortCode, err)
+		return
+	}
+
+	url.URLMetadata = *metadata
+	if _, err := p.repo.UpdateMetadata(ctx, url); err != nil {
+		log.Printf("Failed to save link preview for %s: %v", url.ShortCode, err)
+	}
+}
+
+// Fetch загружает страницу и разбирает теги Open Graph в <head>. Страница
+// без HTML возвращает пустую карточку
+func (p *LinkPreviews) Fetch(ctx context.Context, rawURL string) (*model.URLMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", previewUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return &model.URLMetadata{}, nil
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, p.maxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMetadata(body, resp.Request.URL), nil
+}
+
+// parseMetadata читает <head> страницы. Теги og: важнее twitter:, те важнее
+// <title> и meta description
+func parseMetadata(body io.Reader, base *neturl.URL) *model.URLMetadata {
+	// Значения по приоритету источника: 0 - og, 1 - twitter, 2 - обычные теги
+	var titles, descriptions, images [3]string
+	inTitle := false
+
+	tokenizer := html.NewTokenizer(body)
+loop:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				break loop
+			case "title":
+				inTitle = true
+			case "meta":
+				key, content := metaAttributes(token)
+				switch key {
+				case "og:title":
+					titles[0] = content
+				case "twitter:title":
+					titles[1] = content
+				case "og:description":
+					descriptions[0] = content
+				case "twitter:description":
+					descriptions[1] = content
+				case "description":
+					descriptions[2] = content
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if images[0] == "" {
+						images[0] = content
+					}
+				case "twitter:image", "twitter:image:src":
+					images[1] = content
+				}
+			}
+		case html.TextToken:
+			if inTitle && titles[2] == "" {
+				titles[2] = string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	return &model.URLMetadata{
+		Title:       truncateText(firstNonEmpty(titles[:]), maxPreviewTitleLength),
+		Description: truncateText(firstNonEmpty(descriptions[:]), maxPreviewDescriptionLength),
+		ImageURL:    resolveImageURL(firstNonEmpty(images[:]), base),
+	}
+}
+
+// metaAttributes возвращает имя (property или name, в нижнем регистре)
+// и значение content тега <meta>
+func metaAttributes(token html.Token) (key, content string) {
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	return key, content
+}
+
+func firstNonEmpty(values []string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncateText схлопывает пробелы и обрезает текст до limit символов
+func truncateText(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+// resolveImageURL делает адрес картинки абсолютным. Принимаются только
+// http(s): картинку будут загружать браузеры и мессенджеры
+func resolveImageURL(raw string, base *neturl.URL) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || base == nil {
+		return ""
+	}
+
+	image, err := base.Parse(raw)
+	if err != nil || !isWebURL(image.String()) {
+		return ""
+	}
+
+	resolved := image.String()
+	if len(resolved) > maxPreviewImageURLLength {
+		return ""
+	}
+	return resolved
+}
+
+// validateSocialPreview проверяет карточку, заданную владельцем ссылки.
+// Картинку загружают мессенджеры, поэтому она должна быть http(s)-адресом
+func validateSocialPreview(preview *model.URLMetadata) (model.URLMetadata, error) {
+	if preview == nil {
+		return model.URLMetadata{}, nil
+	}
+
+	validated := model.URLMetadata{
+		Title:       strings.TrimSpace(preview.Title),
+		Description: strings.TrimSpace(preview.Description),
+		ImageURL:    strings.TrimSpace(preview.ImageURL),
+	}
+
+	if utf8.RuneCountInString(validated.Title) > maxPreviewTitleLength {
+		return model.URLMetadata{}, apperrors.NewValidationError("social_preview.title",
+			fmt.Sprintf("title must be at most %d characters", maxPreviewTitleLength))
+	}
+	if utf8.RuneCountInString(validated.Description) > maxPreviewDescriptionLength {
+		return model.URLMetadata{}, apperrors.NewValidationError("social_preview.description",
+			fmt.Sprintf("description must be at most %d characters", maxPreviewDescriptionLength))
+	}
+	if validated.ImageURL != "" && (len(validated.ImageURL) > maxPreviewImageURLLength || !isWebURL(validated.ImageURL)) {
+		return model.URLMetadata{}, apperrors.NewValidationError("social_preview.image_url",
+			"image_url must be an http(s) URL of at most 2048 characters")
+	}
+
+	return validated, nil
+}
+
+// isWebURL сообщает, что адрес ведет на веб-страницу (http или https)
+func isWebURL(raw string) bool {
+	parsed, err := neturl.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return parsed.Scheme == "http" || parsed.Scheme == "https"
+}
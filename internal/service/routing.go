@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+// maxRoutingRules - ограничение на число правил маршрутизации одной ссылки
+const maxRoutingRules = 20
+
+// validateRoutingRules проверяет правила новой ссылки и возвращает их
+// с очищенными назначениями. validate - та же проверка, что и для
+// основного назначения (HTTP или deep link в зависимости от типа редиректа)
+func validateRoutingRules(rules []model.RoutingRule, validate func(string) error) (model.RoutingRules, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	if len(rules) > maxRoutingRules {
+		return nil, apperrors.NewValidationError("rules", fmt.Sprintf("cannot have more than %d routing rules", maxRoutingRules))
+	}
+
+	sanitized := make(model.RoutingRules, 0, len(rules))
+	for i, rule := range rules {
+		// Коды стран и регионов принимаем в любом регистре
+		if rule.Kind == model.RuleKindCountry || rule.Kind == model.RuleKindRegion {
+			rule.Value = strings.ToUpper(rule.Value)
+		}
+
+		if !model.IsValidRoutingRule(rule.Kind, rule.Value) {
+			return nil, apperrors.NewValidationError("rules", fmt.Sprintf("rule %d: unsupported condition %s=%q", i, rule.Kind, rule.Value))
+		}
+
+		if err := validate(rule.Destination); err != nil {
+			return nil, apperrors.NewValidationError("rules", fmt.Sprintf("rule %d destination: %s", i, validationMessage(err)))
+		}
+
+		sanitized = append(sanitized, model.RoutingRule{
+			Kind:        rule.Kind,
+			Value:       rule.Value,
+			Destination: utils.SanitizeInput(rule.Destination),
+		})
+	}
+
+	return sanitized, nil
+}
+
+// validationMessage возвращает текст ошибки проверки без имени поля, чтобы
+// вложить его в ошибку другого поля
+func validationMessage(err error) string {
+	var validationErr *apperrors.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Message
+	}
+	return err.Error()
+}
+
+// routeDestination выбирает базовое назначение для перехода: первое
+// подходящее правило, затем вариант A/B-теста, затем основное назначение.
+// Выбранный вариант записывается в visit.Variant
+func (s *URLService) routeDestination(url *model.URL, visit *model.Visit) string {
+	if destination, ok := matchRule(url, visit); ok {
+		return destination
+	}
+
+	if len(url.Variants) > 0 {
+		variant := s.pickVariant(url, visit)
+		visit.Variant = variant.Name
+		return variant.Destination
+	}
+
+	return url.OriginalURL
+}
+
+// matchRule возвращает назначение первого правила, подходящего посетителю
+func matchRule(url *model.URL, visit *model.Visit) (string, bool) {
+	if len(url.Rules) == 0 {
+		return "", false
+	}
+
+	ua := utils.ParseUserAgent(visit.UserAgent)
+	for _, rule := range url.Rules {
+		var actual string
+		switch rule.Kind {
+		case model.RuleKindOS:
+			actual = ua.OS
+		case model.RuleKindDevice:
+			actual = ua.Device
+		case model.RuleKindCountry:
+			actual = visit.Country
+		case model.RuleKindRegion:
+			actual = visit.Region
+		}
+
+		if actual != "" && actual == rule.Value {
+			return rule.Destination, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache - небольшой in-process кэш с истечением записей для данных,
+// которые читаются на каждом запросе, а меняются редко (домены, квоты).
+// Размер ограничен: при переполнении кэш очищается целиком
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]ttlCacheEntry[V]
+}
+
+type ttlCacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration, size int) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]ttlCacheEntry[V]),
+	}
+}
+
+func (c *ttlCache[V]) get(key string, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache[V]) set(key string, value V, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		clear(c.entries)
+	}
+	c.entries[key] = ttlCacheEntry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *ttlCache[V]) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
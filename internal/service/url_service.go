@@ -4,35 +4,267 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/Kosench/go-url-shortener/internal/cache"
 	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
 	"github.com/Kosench/go-url-shortener/internal/model"
 	"github.com/Kosench/go-url-shortener/internal/repository"
 	"github.com/Kosench/go-url-shortener/internal/utils"
 )
 
+const (
+	defaultUnlockTTL               = 30 * time.Minute
+	defaultMaxPasswordAttempts     = 5
+	defaultMaxLinkPasswordAttempts = 50
+	defaultPasswordAttemptWindow   = 15 * time.Minute
+)
+
+// Config - дополнительные настройки URLService
+type Config struct {
+	// SecretKey - ключ для подписи cookie разблокированных ссылок.
+	// Если не задан, генерируется случайный (cookie не переживут рестарт)
+	SecretKey string
+	// UnlockTTL - время жизни cookie после ввода верного пароля
+	UnlockTTL time.Duration
+	// MaxPasswordAttempts - число попыток ввода пароля с одного IP
+	// за PasswordAttemptWindow
+	MaxPasswordAttempts int
+	// MaxLinkPasswordAttempts - число попыток ввода пароля ссылки со всех
+	// IP вместе за PasswordAttemptWindow
+	MaxLinkPasswordAttempts int
+	PasswordAttemptWindow   time.Duration
+	// RateLimiter - счетчики попыток ввода пароля (Redis или in-memory)
+	RateLimiter cache.RateLimiter
+	// ClickRepository - хранилище событий переходов. Если не задано,
+	// считается только общий click_count
+	ClickRepository repository.ClickRepository
+	// DomainRepository - брендированные домены. Если не задано, ссылки
+	// создаются только на основном домене (baseURL)
+	DomainRepository repository.DomainRepository
+	// Workspaces - квоты и запасные назначения workspaces. Если не задано,
+	// квоты не проверяются, а запасное назначение берется только у ссылки
+	Workspaces *WorkspaceService
+	// KeyBuilder - построитель ключей кэша с namespace приложения
+	KeyBuilder *cache.KeyBuilder
+	// Audit - журнал изменений ссылок и доменов (nil - не ведется)
+	Audit *AuditLog
+	// Webhooks - доставка событий ссылок подпискам workspace напрямую, без
+	// outbox (nil - не доставляются). Репозитории на Postgres записывают
+	// события в outbox сами, тогда подписки подключаются к OutboxRelay
+	// через WebhookService.Sink, а это поле не задается
+	Webhooks *WebhookService
+	// LiveClicks - рассылка переходов потокам SSE (nil - потоки пустые)
+	LiveClicks *LiveClicks
+	// VisitorRepository - уникальные посетители ссылок (nil - не считаются)
+	VisitorRepository repository.VisitorRepository
+	// Previews - фоновая загрузка карточек страниц назначения (nil - карточки
+	// не загружаются)
+	Previews *LinkPreviews
+	// Moderation - жалобы на ссылки и заблокированные авторы (nil - жалобы
+	// не принимаются, модерация недоступна)
+	Moderation repository.ModerationRepository
+}
+
 type URLService struct {
 	urlRepo    repository.URLRepository
 	baseURL    string
 	maxRetries int
+
+	// baseScheme/defaultHost - схема и хост основного домена из baseURL
+	baseScheme  string
+	defaultHost string
+	domainRepo  repository.DomainRepository
+	domains     *ttlCache[string]
+	workspaces  *WorkspaceService
+	keys        *cache.KeyBuilder
+	audit       *AuditLog
+	webhooks    *WebhookService
+	live        *LiveClicks
+	previews    *LinkPreviews
+	moderation  repository.ModerationRepository
+
+	signer                  *utils.Signer
+	unlockTTL               time.Duration
+	maxPasswordAttempts     int
+	maxLinkPasswordAttempts int
+	passwordAttemptWindow   time.Duration
+	rateLimiter             cache.RateLimiter
+	clickRepo               repository.ClickRepository
+	visitors                repository.VisitorRepository
+
+	// randomIntN выбирает вариант A/B-теста (подменяется в тестах)
+	randomIntN func(n int) int
 }
 
 func NewURLService(urlRepo repository.URLRepository, baseURL string) *URLService {
+	return NewURLServiceWithConfig(urlRepo, baseURL, Config{})
+}
+
+// NewURLServiceWithConfig создает сервис с дополнительными настройками,
+// незаданные поля Config заменяются значениями по умолчанию
+func NewURLServiceWithConfig(urlRepo repository.URLRepository, baseURL string, cfg Config) *URLService {
+	if cfg.SecretKey == "" {
+		secret, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Printf("Failed to generate secret key: %v", err)
+		}
+		cfg.SecretKey = secret
+	}
+	if cfg.UnlockTTL <= 0 {
+		cfg.UnlockTTL = defaultUnlockTTL
+	}
+	if cfg.MaxPasswordAttempts <= 0 {
+		cfg.MaxPasswordAttempts = defaultMaxPasswordAttempts
+	}
+	if cfg.MaxLinkPasswordAttempts <= 0 {
+		cfg.MaxLinkPasswordAttempts = defaultMaxLinkPasswordAttempts
+	}
+	if cfg.PasswordAttemptWindow <= 0 {
+		cfg.PasswordAttemptWindow = defaultPasswordAttemptWindow
+	}
+	if cfg.RateLimiter == nil {
+		cfg.RateLimiter = cache.NewMemoryRateLimiter()
+	}
+	if cfg.KeyBuilder == nil {
+		cfg.KeyBuilder = cache.DefaultKeyBuilder
+	}
+
+	baseScheme, defaultHost := "https", ""
+	if parsed, err := url.Parse(baseURL); err == nil {
+		if parsed.Scheme != "" {
+			baseScheme = parsed.Scheme
+		}
+		defaultHost = utils.NormalizeHost(parsed.Host)
+	}
+
 	return &URLService{
-		urlRepo:    urlRepo,
-		baseURL:    baseURL,
-		maxRetries: 5,
+		urlRepo:                 urlRepo,
+		baseURL:                 baseURL,
+		maxRetries:              5,
+		baseScheme:              baseScheme,
+		defaultHost:             defaultHost,
+		domainRepo:              cfg.DomainRepository,
+		domains:                 newTTLCache[string](domainCacheTTL, domainCacheSize),
+		workspaces:              cfg.Workspaces,
+		keys:                    cfg.KeyBuilder,
+		audit:                   cfg.Audit,
+		webhooks:                cfg.Webhooks,
+		live:                    cfg.LiveClicks,
+		previews:                cfg.Previews,
+		moderation:              cfg.Moderation,
+		signer:                  utils.NewSigner(cfg.SecretKey),
+		unlockTTL:               cfg.UnlockTTL,
+		maxPasswordAttempts:     cfg.MaxPasswordAttempts,
+		maxLinkPasswordAttempts: cfg.MaxLinkPasswordAttempts,
+		passwordAttemptWindow:   cfg.PasswordAttemptWindow,
+		rateLimiter:             cfg.RateLimiter,
+		clickRepo:               cfg.ClickRepository,
+		visitors:                cfg.VisitorRepository,
+		randomIntN:              rand.IntN,
 	}
 }
 
-func (s *URLService) CreateShortURL(ctx context.Context, req *model.CreateURLRequest) (*model.URLResponse, error) {
-	if err := utils.ValidateURL(req.URL); err != nil {
+// CreateShortURL создает ссылку в workspace, проверяя его квоту на число ссылок
+func (s *URLService) CreateShortURL(ctx context.Context, workspaceID int64, req *model.CreateURLRequest) (*model.URLResponse, error) {
+	if req.RedirectType != "" && !model.IsValidRedirectType(req.RedirectType) {
+		return nil, apperrors.NewValidationError("redirect_type", "redirect_type must be one of 301, 302, 307, 308, meta, js")
+	}
+
+	// Собственные схемы приложений открываются только HTML-редиректом
+	validate := utils.ValidateURL
+	if model.IsPageRedirect(req.RedirectType) {
+		validate = utils.ValidateAppLink
+	}
+
+	if err := validate(req.URL); err != nil {
 		return nil, err
 	}
 
 	sanitizedURL := utils.SanitizeInput(req.URL)
 
+	if req.MaxClicks < 0 {
+		return nil, apperrors.NewValidationError("max_clicks", "max_clicks cannot be negative")
+	}
+
+	if err := validateActivationWindow(req.NotBefore, req.NotAfter, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if req.QueryConflict != "" && !model.IsValidQueryConflict(req.QueryConflict) {
+		return nil, apperrors.NewValidationError("query_conflict", "query_conflict must be one of destination, request, append")
+	}
+
+	if err := validateUTMTemplate(req.UTMTemplate); err != nil {
+		return nil, err
+	}
+
+	rules, err := validateRoutingRules(req.Rules, validate)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := validateVariants(req.Variants, validate)
+	if err != nil {
+		return nil, err
+	}
+
+	socialPreview, err := validateSocialPreview(req.SocialPreview)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackURL, err := validateFallbackURL(req.FallbackURL)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := s.lookupDomain(ctx, workspaceID, req.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var linkQuota int64
+	if s.workspaces != nil {
+		if linkQuota, err = s.workspaces.CheckLinkQuota(ctx, workspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Автор анонимной ссылки определяется по IP: так блокируется автор
+	// ссылок без API-ключа. Автор остальных ссылок - их workspace
+	var creatorHash string
+	if workspaceID == model.DefaultWorkspaceID {
+		creatorHash = s.requesterHash(ctx, creatorHashKind)
+		if err := s.checkCreator(ctx, creatorHash); err != nil {
+			return nil, err
+		}
+	}
+
+	var passwordHash string
+	if req.Password != "" {
+		if err := utils.ValidatePassword(req.Password); err != nil {
+			return nil, err
+		}
+
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			return nil, apperrors.NewBusinessError("PASSWORD_HASH", "failed to hash password", err)
+		}
+		passwordHash = hash
+	}
+
+	// Токен владельца позволяет видеть назначение защищенной ссылки через API
+	ownerToken, err := utils.GenerateToken(24)
+	if err != nil {
+		return nil, apperrors.NewBusinessError("TOKEN_GENERATION", "failed to generate owner token", err)
+	}
+
 	var lastErr error
 	for attempt := 0; attempt < s.maxRetries; attempt++ {
 		code, err := utils.GenerateShortCode()
@@ -42,11 +274,40 @@ func (s *URLService) CreateShortURL(ctx context.Context, req *model.CreateURLReq
 		}
 
 		url := &model.URL{
-			OriginalURL: sanitizedURL,
-			ShortCode:   code,
-			ClickCount:  0,
-			CreatedAt:   time.Now(),
+			OriginalURL:    sanitizedURL,
+			ShortCode:      code,
+			WorkspaceID:    workspaceID,
+			ClickCount:     0,
+			CreatedAt:      time.Now(),
+			PasswordHash:   passwordHash,
+			OwnerTokenHash: utils.HashToken(ownerToken),
+			MaxClicks:      req.MaxClicks,
+			NotBefore:      utcOrNil(req.NotBefore),
+			NotAfter:       utcOrNil(req.NotAfter),
+			PreviewMode:    req.PreviewMode,
+			RedirectType:   req.RedirectType,
+			ForwardQuery:   req.ForwardQuery,
+			QueryConflict:  req.QueryConflict,
+			ForwardPath:    req.ForwardPath,
+			UTMTemplate:    req.UTMTemplate,
+			Rules:          rules,
+			Variants:       variants,
+			StickyVariants: req.StickyVariants,
+			SocialPreview:  socialPreview,
+			FallbackURL:    fallbackURL,
+			CreatorHash:    creatorHash,
+			LinkQuota:      linkQuota,
 		}
+		if domain != nil {
+			url.DomainID = &domain.ID
+			url.Domain = domain.Hostname
+		}
+		url.Events = []model.PendingEvent{pendingEvent(workspaceID, model.EventLinkCreated, func() any {
+			return s.toResponse(url, true)
+		})}
+		url.Audit = s.audit.Pending(ctx, workspaceID, model.AuditCreate, model.AuditResourceLink, linkResourceID(url), nil, func() any {
+			return s.toResponse(url, true)
+		})
 
 		if err := s.urlRepo.Create(ctx, url); err != nil {
 			// Если код уже занят — пробуем снова
@@ -55,18 +316,16 @@ func (s *URLService) CreateShortURL(ctx context.Context, req *model.CreateURLReq
 				continue
 			}
 			// любая другая ошибка — возвращаем вверх
-			return nil, err
+			return nil, linkQuotaError(err, linkQuota)
 		}
 
-		// Усп��х
-		return &model.URLResponse{
-			ID:          url.ID,
-			ShortCode:   code,
-			OriginalURL: url.OriginalURL,
-			ShortURL:    s.buildShortURL(code),
-			ClickCount:  url.ClickCount,
-			CreatedAt:   url.CreatedAt,
-		}, nil
+		// Успех
+		response := s.toResponse(url, true)
+		s.webhooks.Publish(ctx, workspaceID, model.EventLinkCreated, response)
+		s.previews.Enqueue(url)
+
+		response.OwnerToken = ownerToken
+		return response, nil
 	}
 
 	// Не получилось за maxRetries попыток
@@ -77,32 +336,95 @@ func (s *URLService) CreateShortURL(ctx context.Context, req *model.CreateURLReq
 	)
 }
 
-func (s *URLService) GetURL(ctx context.Context, shortCode string) (*model.URLResponse, error) {
+// GetURL возвращает информацию о ссылке workspace. Назначение защищенной
+// паролем или еще не активированной ссылки раскрывается только владельцу
+// (см. canManage)
+func (s *URLService) GetURL(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLResponse, error) {
 	if shortCode == "" {
 		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
 	}
 
-	url, err := s.urlRepo.GetByShortCode(ctx, shortCode)
+	url, err := s.urlRepo.GetForWorkspace(ctx, workspaceID, s.domainName(domain), shortCode)
 	if err != nil {
 		return nil, err
 	}
 
-	return &model.URLResponse{
-		ID:          url.ID,
-		ShortCode:   url.ShortCode,
-		OriginalURL: url.OriginalURL,
-		ShortURL:    s.buildShortURL(url.ShortCode),
-		ClickCount:  url.ClickCount,
-		CreatedAt:   url.CreatedAt,
-	}, nil
+	response := s.toResponse(url, s.canManage(workspaceID, url, ownerToken))
+	if s.visitors != nil {
+		if response.UniqueClicks, err = s.visitors.CountVisitors(ctx, url.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
 }
 
-func (s *URLService) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
+const (
+	defaultURLPageSize = 50
+	maxURLPageSize     = 200
+	maxURLQueryLength  = 200
+)
+
+// ListURLs возвращает страницу ссылок workspace с поиском по коду,
+// назначению, заголовку и описанию. Общий workspace по умолчанию
+// не перечисляется: в нем ссылки разных анонимных владельцев
+func (s *URLService) ListURLs(ctx context.Context, workspaceID int64, filter model.URLFilter) (*model.URLPage, error) {
+	if workspaceID == model.DefaultWorkspaceID {
+		return nil, apperrors.ErrForbidden
+	}
+
+	filter.Query = strings.TrimSpace(filter.Query)
+	if utf8.RuneCountInString(filter.Query) > maxURLQueryLength {
+		return nil, apperrors.NewValidationError("q", fmt.Sprintf("q must be at most %d characters", maxURLQueryLength))
+	}
+	switch {
+	case filter.Limit <= 0:
+		filter.Limit = defaultURLPageSize
+	case filter.Limit > maxURLPageSize:
+		filter.Limit = maxURLPageSize
+	}
+
+	// Одна лишняя ссылка показывает, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	urls, err := s.urlRepo.List(ctx, workspaceID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.URLPage{URLs: make([]*model.URLResponse, 0, len(urls))}
+	if len(urls) > limit {
+		urls = urls[:limit]
+		page.NextCursor = urls[limit-1].ID
+	}
+	for _, url := range urls {
+		page.URLs = append(page.URLs, s.toResponse(url, true))
+	}
+
+	return page, nil
+}
+
+// GetPublicURL возвращает информацию о ссылке для посетителей любого домена:
+// скрытое назначение не раскрывается
+func (s *URLService) GetPublicURL(ctx context.Context, domain, shortCode string) (*model.URLResponse, error) {
+	if shortCode == "" {
+		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
+	}
+
+	url, err := s.urlRepo.GetByShortCode(ctx, s.domainName(domain), shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toResponse(url, false), nil
+}
+
+func (s *URLService) GetOriginalURL(ctx context.Context, domain, shortCode string) (string, error) {
 	if shortCode == "" {
 		return "", apperrors.NewValidationError("shortCode", "short code cannot be empty")
 	}
 
-	url, err := s.urlRepo.GetByShortCode(ctx, shortCode)
+	url, err := s.urlRepo.GetByShortCode(ctx, s.domainName(domain), shortCode)
 	if err != nil {
 		return "", err
 	}
@@ -110,12 +432,154 @@ func (s *URLService) GetOriginalURL(ctx context.Context, shortCode string) (stri
 	return url.OriginalURL, nil
 }
 
-func (s *URLService) RecordClick(ctx context.Context, shortCode string) error {
+// ResolveURL возвращает ссылку целиком для принятия решения о редиректе
+func (s *URLService) ResolveURL(ctx context.Context, domain, shortCode string) (*model.URL, error) {
+	if shortCode == "" {
+		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
+	}
+
+	return s.urlRepo.GetByShortCode(ctx, s.domainName(domain), shortCode)
+}
+
+// CheckAvailability проверяет, что ссылка включена (иначе ErrURLDisabled),
+// и окно активности: до not_before возвращает ErrURLNotYetActive, после
+// not_after - ErrURLExpired
+func (s *URLService) CheckAvailability(url *model.URL) error {
+	if url.IsDeleted() {
+		return apperrors.ErrURLNotFound
+	}
+
+	// Решение модерации важнее решений владельца ссылки
+	if url.Moderation.IsRestricted() {
+		return apperrors.ErrURLSuspended
+	}
+
+	if url.IsDisabled() {
+		return apperrors.ErrURLDisabled
+	}
+
+	now := time.Now()
+
+	if url.IsPendingAt(now) {
+		return apperrors.ErrURLNotYetActive
+	}
+
+	if url.IsExpiredAt(now) {
+		return apperrors.ErrURLExpired
+	}
+
+	return nil
+}
+
+// IsOwner проверяет токен владельца ссылки
+func (s *URLService) IsOwner(url *model.URL, ownerToken string) bool {
+	return utils.TokenMatchesHash(ownerToken, url.OwnerTokenHash)
+}
+
+// canManage проверяет право на закрытые данные ссылки. Запрос собственного
+// workspace уже подтвержден API-ключом, а общий workspace по умолчанию
+// доступен анонимно, поэтому в нем нужен токен владельца ссылки
+func (s *URLService) canManage(workspaceID int64, url *model.URL, ownerToken string) bool {
+	return workspaceID != model.DefaultWorkspaceID || s.IsOwner(url, ownerToken)
+}
+
+// VerifyPassword проверяет пароль защищенной ссылки. Попытки ограничиваются
+// для каждой пары (ссылка, IP) и для ссылки в целом, чтобы пароль нельзя
+// было подобрать перебором, в том числе с множества адресов
+func (s *URLService) VerifyPassword(ctx context.Context, url *model.URL, password, clientIP string) error {
+	if !url.IsPasswordProtected() {
+		return nil
+	}
+
+	keys := s.keys.WithNamespace(url.Domain)
+	if !s.admitPasswordAttempt(ctx, keys.PasswordAttempts(url.ShortCode, clientIP), s.maxPasswordAttempts) {
+		return apperrors.ErrTooManyAttempts
+	}
+	// Попытки с уже заблокированного IP до общего счетчика не доходят:
+	// один адрес не может исчерпать лимит ссылки для всех
+	if !s.admitPasswordAttempt(ctx, keys.LinkPasswordAttempts(url.ShortCode), s.maxLinkPasswordAttempts) {
+		return apperrors.ErrTooManyAttempts
+	}
+
+	ok, err := utils.CheckPassword(url.PasswordHash, password)
+	if err != nil {
+		return apperrors.NewBusinessError("PASSWORD_CHECK", "failed to check password", err)
+	}
+
+	if !ok {
+		return apperrors.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// admitPasswordAttempt засчитывает попытку в счетчике key и сообщает,
+// укладывается ли она в limit
+func (s *URLService) admitPasswordAttempt(ctx context.Context, key string, limit int) bool {
+	attempts, err := s.rateLimiter.IncrementRateLimit(ctx, key, s.passwordAttemptWindow)
+	if err != nil {
+		// Без счетчика перебор не ограничить - отказываем
+		log.Printf("Password rate limit error: %v", err)
+		return false
+	}
+	return attempts <= int64(limit)
+}
+
+// IssueUnlockToken выдает подписанный токен для cookie, чтобы повторные
+// переходы по защищенной ссылке не требовали пароль
+func (s *URLService) IssueUnlockToken(url *model.URL) (string, time.Time) {
+	expiresAt := time.Now().Add(s.unlockTTL)
+	return s.signer.Sign(unlockMessage(url), expiresAt), expiresAt
+}
+
+// VerifyUnlockToken проверяет токен из cookie
+func (s *URLService) VerifyUnlockToken(url *model.URL, token string) bool {
+	if token == "" {
+		return false
+	}
+	return s.signer.Verify(unlockMessage(url), token, time.Now())
+}
+
+// unlockMessage привязывает токен к ссылке и текущему паролю:
+// смена пароля делает ранее выданные cookie недействительными
+func unlockMessage(url *model.URL) string {
+	return "unlock:" + url.ShortCode + ":" + url.PasswordHash
+}
+
+// AdmitClick учитывает переход в месячной квоте кликов workspace ссылки.
+// При исчерпанной квоте возвращает QuotaError
+func (s *URLService) AdmitClick(ctx context.Context, url *model.URL) error {
+	if s.workspaces == nil {
+		return nil
+	}
+	return s.workspaces.AdmitClick(ctx, url.WorkspaceID)
+}
+
+// ConsumeClick синхронно засчитывает переход по ссылке с лимитом кликов
+// и записывает событие перехода в outbox (event == nil - без события).
+// Для исчерпанной ссылки возвращает ErrURLExhausted
+func (s *URLService) ConsumeClick(ctx context.Context, url *model.URL, event *model.ClickEvent) error {
+	// Счетчик только растет, поэтому даже устаревшее значение из кэша
+	// позволяет сразу отказать, не обращаясь к БД
+	if url.IsExhausted() {
+		return apperrors.ErrURLExhausted
+	}
+
+	count, err := s.urlRepo.ConsumeClick(ctx, url.ID, clickEvents(event)...)
+	if err != nil {
+		return err
+	}
+
+	url.ClickCount = count
+	return nil
+}
+
+func (s *URLService) RecordClick(ctx context.Context, domain, shortCode string) error {
 	if shortCode == "" {
 		return apperrors.NewValidationError("shortCode", "short code cannot be empty")
 	}
 
-	url, err := s.urlRepo.GetByShortCode(ctx, shortCode)
+	url, err := s.urlRepo.GetByShortCode(ctx, s.domainName(domain), shortCode)
 	if err != nil {
 		return err
 	}
@@ -123,6 +587,242 @@ func (s *URLService) RecordClick(ctx context.Context, shortCode string) error {
 	return s.urlRepo.IncrementClickCount(ctx, url.ID)
 }
 
-func (s *URLService) buildShortURL(shortCode string) string {
-	return fmt.Sprintf("%s/%s", s.baseURL, shortCode)
-}
\ No newline at end of file
+// TrackClick засчитывает переход вместе с событием outbox и сохраняет
+// переход для аналитики. Переход ссылки с лимитом уже засчитан ConsumeClick
+// (event.Counted). Переход бота только сохраняется: он не попадает
+// в счетчик, уникальных посетителей, вебхуки и поток переходов
+func (s *URLService) TrackClick(ctx context.Context, event *model.ClickEvent) error {
+	if event.Bot != "" {
+		if s.clickRepo == nil {
+			return nil
+		}
+		return s.clickRepo.Create(ctx, event)
+	}
+
+	if !event.Counted {
+		if err := s.urlRepo.IncrementClickCount(ctx, event.URLID, clickEvents(event)...); err != nil {
+			return err
+		}
+	}
+
+	if s.clickRepo != nil {
+		if err := s.clickRepo.Create(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	if s.visitors != nil {
+		// Уникальные посетители приблизительны, сбой их учета не отменяет переход
+		fingerprint := s.signer.Fingerprint(event.ClientIP, event.UserAgent)
+		if err := s.visitors.AddVisitor(ctx, event.URLID, event.OccurredAt, fingerprint); err != nil {
+			log.Printf("Failed to count unique visitor for %s: %v", event.ShortCode, err)
+		}
+	}
+
+	s.webhooks.Publish(ctx, event.WorkspaceID, model.EventLinkClicked, event)
+	s.live.Publish(ctx, event)
+	return nil
+}
+
+// clickEvents возвращает событие перехода для записи в outbox
+func clickEvents(event *model.ClickEvent) []model.PendingEvent {
+	if event == nil {
+		return nil
+	}
+	return []model.PendingEvent{pendingEvent(event.WorkspaceID, model.EventLinkClicked, func() any {
+		return event
+	})}
+}
+
+const (
+	// statsBreakdownLimit - сколько самых частых стран и городов возвращать
+	statsBreakdownLimit = 20
+	// statsUniqueDays - за сколько последних дней возвращать уникальных посетителей
+	statsUniqueDays = 30
+)
+
+// GetStats возвращает статистику переходов. Разбивка по географии раскрывает
+// аудиторию ссылки, поэтому доступна только владельцу
+func (s *URLService) GetStats(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (*model.URLStats, error) {
+	if shortCode == "" {
+		return nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
+	}
+
+	url, err := s.urlRepo.GetForWorkspace(ctx, workspaceID, s.domainName(domain), shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.canManage(workspaceID, url, ownerToken) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	stats := &model.URLStats{
+		ShortCode:   url.ShortCode,
+		TotalClicks: url.ClickCount,
+		DailyUnique: []model.DailyVisitors{},
+		Countries:   []model.StatBucket{},
+		Cities:      []model.StatBucket{},
+		Variants:    []model.StatBucket{},
+		Bots:        []model.StatBucket{},
+	}
+
+	if s.visitors != nil {
+		if stats.UniqueClicks, err = s.visitors.CountVisitors(ctx, url.ID); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if stats.DailyUnique, err = s.visitors.CountDailyVisitors(ctx, url.ID, now.AddDate(0, 0, 1-statsUniqueDays), now); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.clickRepo == nil {
+		return stats, nil
+	}
+
+	if stats.Countries, err = s.clickRepo.CountBy(ctx, url.ID, repository.DimensionCountry, statsBreakdownLimit); err != nil {
+		return nil, err
+	}
+	if stats.Cities, err = s.clickRepo.CountBy(ctx, url.ID, repository.DimensionCity, statsBreakdownLimit); err != nil {
+		return nil, err
+	}
+	if stats.Variants, err = s.clickRepo.CountBy(ctx, url.ID, repository.DimensionVariant, maxVariants); err != nil {
+		return nil, err
+	}
+	if stats.BotClicks, err = s.clickRepo.CountBotClicks(ctx, url.ID); err != nil {
+		return nil, err
+	}
+	if stats.Bots, err = s.clickRepo.CountBy(ctx, url.ID, repository.DimensionBot, statsBreakdownLimit); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// WatchClicks подписывает на переходы по ссылке в реальном времени. Как и
+// статистика, поток раскрывает аудиторию ссылки и доступен только владельцу.
+// stop отменяет подписку
+func (s *URLService) WatchClicks(ctx context.Context, workspaceID int64, domain, shortCode, ownerToken string) (<-chan model.ClickEvent, func(), error) {
+	if shortCode == "" {
+		return nil, nil, apperrors.NewValidationError("shortCode", "short code cannot be empty")
+	}
+
+	url, err := s.urlRepo.GetForWorkspace(ctx, workspaceID, s.domainName(domain), shortCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !s.canManage(workspaceID, url, ownerToken) {
+		return nil, nil, apperrors.ErrForbidden
+	}
+
+	clicks, stop := s.live.Subscribe(workspaceID, url.ID)
+	return clicks, stop, nil
+}
+
+// WatchWorkspaceClicks подписывает на переходы по всем ссылкам workspace
+func (s *URLService) WatchWorkspaceClicks(ctx context.Context, workspaceID int64) (<-chan model.ClickEvent, func(), error) {
+	clicks, stop := s.live.Subscribe(workspaceID, 0)
+	return clicks, stop, nil
+}
+
+// toResponse формирует ответ API. Если revealDestination == false,
+// назначение защищенной или еще не активированной ссылки не попадает в ответ
+func (s *URLService) toResponse(url *model.URL, revealDestination bool) *model.URLResponse {
+	response := &model.URLResponse{
+		ID:                url.ID,
+		ShortCode:         url.ShortCode,
+		OriginalURL:       url.OriginalURL,
+		ShortURL:          s.buildShortURL(url),
+		ClickCount:        url.ClickCount,
+		CreatedAt:         url.CreatedAt,
+		PasswordProtected: url.IsPasswordProtected(),
+		MaxClicks:         url.MaxClicks,
+		Exhausted:         url.IsExhausted(),
+		NotBefore:         url.NotBefore,
+		NotAfter:          url.NotAfter,
+		PreviewMode:       url.PreviewMode,
+		RedirectType:      url.RedirectType,
+		ForwardQuery:      url.ForwardQuery,
+		QueryConflict:     url.QueryConflict,
+		ForwardPath:       url.ForwardPath,
+		UTMTemplate:       url.UTMTemplate,
+		Rules:             url.Rules,
+		Variants:          url.Variants,
+		StickyVariants:    url.StickyVariants,
+		Domain:            url.Domain,
+		DisabledAt:        url.DisabledAt,
+		DeletedAt:         url.DeletedAt,
+		Version:           url.Version,
+		URLMetadata:       url.URLMetadata,
+		SocialPreview:     url.SocialPreview,
+		FallbackURL:       url.FallbackURL,
+	}
+
+	// Карточка страницы, запасной адрес и UTM-шаблон раскрывают назначение
+	// так же, как сам адрес. Назначение ссылки с лимитом кликов нельзя
+	// узнать, не потратив клик
+	hidden := url.IsPasswordProtected() || url.IsClickLimited() ||
+		url.IsPendingAt(time.Now()) || url.Moderation.IsRestricted()
+	if hidden && !revealDestination {
+		response.OriginalURL = ""
+		response.Rules = nil
+		response.Variants = nil
+		response.URLMetadata = model.URLMetadata{}
+		response.FallbackURL = ""
+		response.UTMTemplate = nil
+	}
+
+	// Причину решения модерации видят владелец и модератор, посетители -
+	// только само решение
+	if url.Moderation.IsRestricted() {
+		moderation := url.Moderation
+		if !revealDestination {
+			moderation.Reason = ""
+		}
+		response.Moderation = &moderation
+	}
+
+	// Результат проверки (с адресом после редиректов) видит только владелец
+	if revealDestination && url.Health.CheckedAt != nil {
+		health := url.Health
+		response.Health = &health
+	}
+
+	return response
+}
+
+// validateActivationWindow проверяет границы окна активности новой ссылки
+func validateActivationWindow(notBefore, notAfter *time.Time, now time.Time) error {
+	if notAfter == nil {
+		return nil
+	}
+
+	if !notAfter.After(now) {
+		return apperrors.NewValidationError("not_after", "not_after must be in the future")
+	}
+
+	if notBefore != nil && !notAfter.After(*notBefore) {
+		return apperrors.NewValidationError("not_after", "not_after must be later than not_before")
+	}
+
+	return nil
+}
+
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// buildShortURL строит короткую ссылку на домене ссылки. Брендированные
+// домены обслуживаются по той же схеме, что и основной
+func (s *URLService) buildShortURL(url *model.URL) string {
+	if url.Domain == "" {
+		return fmt.Sprintf("%s/%s", s.baseURL, url.ShortCode)
+	}
+	return fmt.Sprintf("%s://%s/%s", s.baseScheme, url.Domain, url.ShortCode)
+}
@@ -2,28 +2,52 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Kosench/go-url-shortener/internal/access"
+	"github.com/Kosench/go-url-shortener/internal/cache"
 	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
 	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/safehttp"
+	"github.com/Kosench/go-url-shortener/internal/utils"
 )
 
 type mockURLRepository struct {
+	mu         sync.Mutex
 	urls       map[string]*model.URL
+	versions   map[int64][]model.LinkVersion
 	shouldFail bool
 	failCount  int
 	callCount  int
+	// outbox - события, записанные вместе с изменениями
+	outbox []model.OutboxEvent
+	// audit - журнал, в который попадают записи аудита изменений
+	audit *mockAuditRepository
 }
 
 func newMockURLRepository() *mockURLRepository {
 	return &mockURLRepository{
-		urls: make(map[string]*model.URL),
+		urls:     make(map[string]*model.URL),
+		versions: make(map[int64][]model.LinkVersion),
 	}
 }
 
 func (m *mockURLRepository) Create(ctx context.Context, url *model.URL) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.shouldFail {
 		return errors.New("database error")
 	}
@@ -33,52 +57,356 @@ func (m *mockURLRepository) Create(ctx context.Context, url *model.URL) error {
 		return apperrors.ErrShortCodeExists
 	}
 
-	if _, exists := m.urls[url.ShortCode]; exists {
+	if _, exists := m.urls[mockURLKey(url.Domain, url.ShortCode)]; exists {
 		return apperrors.ErrShortCodeExists
 	}
 
+	// Как DEFAULT колонки workspace_id
+	if url.WorkspaceID == 0 {
+		url.WorkspaceID = model.DefaultWorkspaceID
+	}
+
+	if err := m.reserveLink(url); err != nil {
+		return err
+	}
+
 	url.ID = int64(len(m.urls) + 1)
-	m.urls[url.ShortCode] = url
+	m.urls[mockURLKey(url.Domain, url.ShortCode)] = url
+	m.addVersion(url)
+	if err := m.writeOutbox(url.Events); err != nil {
+		return err
+	}
+	return m.writeAudit(url.Audit)
+}
+
+// writeOutbox собирает события так же, как репозиторий внутри транзакции
+func (m *mockURLRepository) writeOutbox(events []model.PendingEvent) error {
+	for _, pending := range events {
+		event, err := pending()
+		if err != nil {
+			return err
+		}
+		event.ID = int64(len(m.outbox) + 1)
+		m.outbox = append(m.outbox, *event)
+	}
+	return nil
+}
+
+// writeAudit добавляет запись аудита так же, как репозиторий внутри транзакции
+func (m *mockURLRepository) writeAudit(pending model.PendingAudit) error {
+	if pending == nil {
+		return nil
+	}
+	entry, err := pending()
+	if err != nil {
+		return err
+	}
+	if m.audit != nil {
+		return m.audit.Append(context.Background(), entry)
+	}
 	return nil
 }
 
-func (m *mockURLRepository) GetByShortCode(ctx context.Context, shortCode string) (*model.URL, error) {
+// addVersion повторяет вставку ревизии
+func (m *mockURLRepository) addVersion(url *model.URL) {
+	if url.Version == 0 {
+		url.Version = 1
+	}
+	m.versions[url.ID] = append(m.versions[url.ID], model.LinkVersion{Version: url.Version, Settings: url.Settings(), CreatedAt: time.Now()})
+}
+
+func (m *mockURLRepository) ListVersions(ctx context.Context, urlID int64) ([]model.LinkVersion, error) {
+	versions := make([]model.LinkVersion, 0)
+	for i := len(m.versions[urlID]) - 1; i >= 0; i-- {
+		versions = append(versions, m.versions[urlID][i])
+	}
+	return versions, nil
+}
+
+func (m *mockURLRepository) GetVersion(ctx context.Context, urlID int64, version int) (*model.LinkVersion, error) {
+	for _, v := range m.versions[urlID] {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, apperrors.ErrVersionNotFound
+}
+
+// mockURLKey - ключ ссылки в моке: код уникален в пределах домена
+func mockURLKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+func (m *mockURLRepository) GetByShortCode(ctx context.Context, domain, shortCode string) (*model.URL, error) {
 	if m.shouldFail {
 		return nil, errors.New("database error")
 	}
 
-	url, exists := m.urls[shortCode]
-	if !exists {
+	url, exists := m.urls[mockURLKey(domain, shortCode)]
+	if !exists || url.IsDeleted() {
 		return nil, apperrors.ErrURLNotFound
 	}
 
 	return url, nil
 }
 
-func (m *mockURLRepository) ExistsByShortCode(ctx context.Context, shortCode string) (bool, error) {
+func (m *mockURLRepository) GetForWorkspace(ctx context.Context, workspaceID int64, domain, shortCode string) (*model.URL, error) {
+	url, exists := m.urls[mockURLKey(domain, shortCode)]
+	if !exists || url.WorkspaceID != workspaceID {
+		return nil, apperrors.ErrURLNotFound
+	}
+	return url, nil
+}
+
+// Update повторяет условный UPDATE: ссылка сохраняется, только если ее
+// ревизия не изменилась с чтения
+func (m *mockURLRepository) Update(ctx context.Context, url *model.URL, prevVersion int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := mockURLKey(url.Domain, url.ShortCode)
+	stored, exists := m.urls[key]
+	if !exists || stored.Version != prevVersion {
+		return apperrors.ErrURLConflict
+	}
+	if err := m.reserveLink(url); err != nil {
+		return err
+	}
+	m.urls[key] = url
+	if url.Version != prevVersion {
+		m.addVersion(url)
+	}
+	if err := m.writeOutbox(url.Events); err != nil {
+		return err
+	}
+	return m.writeAudit(url.Audit)
+}
+
+// List повторяет выборку Postgres: неудаленные ссылки workspace от новых
+// к старым, поиск - подстрока без учета регистра
+func (m *mockURLRepository) List(ctx context.Context, workspaceID int64, filter model.URLFilter) ([]*model.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	query := strings.ToLower(filter.Query)
+	urls := make([]*model.URL, 0)
+	for _, url := range m.urls {
+		if url.WorkspaceID != workspaceID || url.IsDeleted() {
+			continue
+		}
+		if filter.BeforeID > 0 && url.ID >= filter.BeforeID {
+			continue
+		}
+		if filter.Broken && !url.Health.IsBroken() {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(url.ShortCode+" "+url.OriginalURL+" "+url.Title+" "+url.Description), query) {
+			continue
+		}
+		urls = append(urls, url)
+	}
+
+	slices.SortFunc(urls, func(a, b *model.URL) int { return int(b.ID - a.ID) })
+	if len(urls) > filter.Limit {
+		urls = urls[:filter.Limit]
+	}
+	return urls, nil
+}
+
+func (m *mockURLRepository) UpdateMetadata(ctx context.Context, url *model.URL) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.urls {
+		if stored.ID == url.ID && stored.OriginalURL == url.OriginalURL {
+			stored.URLMetadata = url.URLMetadata
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClaimHealthChecks повторяет выборку Postgres: давно не проверенные
+// активные веб-ссылки первыми
+func (m *mockURLRepository) ClaimHealthChecks(ctx context.Context, dueBefore, now time.Time, limit int) ([]*model.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]*model.URL, 0)
+	for _, url := range m.urls {
+		if url.IsDeleted() || url.IsDisabled() || !isWebURL(url.OriginalURL) {
+			continue
+		}
+		if url.Health.CheckedAt != nil && !url.Health.CheckedAt.Before(dueBefore) {
+			continue
+		}
+		due = append(due, url)
+	}
+
+	slices.SortFunc(due, func(a, b *model.URL) int {
+		switch {
+		case a.Health.CheckedAt == nil && b.Health.CheckedAt != nil:
+			return -1
+		case a.Health.CheckedAt != nil && b.Health.CheckedAt == nil:
+			return 1
+		case a.Health.CheckedAt != nil && !a.Health.CheckedAt.Equal(*b.Health.CheckedAt):
+			return a.Health.CheckedAt.Compare(*b.Health.CheckedAt)
+		}
+		return int(a.ID - b.ID)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*model.URL, 0, len(due))
+	for _, url := range due {
+		checkedAt := now
+		url.Health.CheckedAt = &checkedAt
+		copied := *url
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (m *mockURLRepository) UpdateHealth(ctx context.Context, url *model.URL, events ...model.PendingEvent) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.urls {
+		if stored.ID == url.ID && stored.OriginalURL == url.OriginalURL {
+			stored.Health = url.Health
+			return true, m.writeOutbox(events)
+		}
+	}
+	return false, nil
+}
+
+// GetByID возвращает копию: решения модерации сравнивают старое и новое состояние
+func (m *mockURLRepository) GetByID(ctx context.Context, id int64) (*model.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, url := range m.urls {
+		if url.ID == id {
+			copied := *url
+			return &copied, nil
+		}
+	}
+	return nil, apperrors.ErrURLNotFound
+}
+
+// UpdateModeration повторяет условный UPDATE: заблокированную ссылку не изменить
+func (m *mockURLRepository) UpdateModeration(ctx context.Context, url *model.URL) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.urls {
+		if stored.ID == url.ID {
+			if stored.Moderation.IsBanned() {
+				return apperrors.ErrURLSuspended
+			}
+			stored.Moderation = url.Moderation
+			return nil
+		}
+	}
+	return apperrors.ErrURLNotFound
+}
+
+func (m *mockURLRepository) ModerateCreator(ctx context.Context, workspaceID int64, creatorHash string, moderation model.Moderation) ([]*model.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var moderated []*model.URL
+	for _, stored := range m.urls {
+		if stored.WorkspaceID != workspaceID || stored.Moderation.IsBanned() {
+			continue
+		}
+		if creatorHash != "" && stored.CreatorHash != creatorHash {
+			continue
+		}
+		stored.Moderation = moderation
+		copied := *stored
+		moderated = append(moderated, &copied)
+	}
+	return moderated, nil
+}
+
+func (m *mockURLRepository) CountByWorkspace(ctx context.Context, workspaceID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.countLinks(workspaceID), nil
+}
+
+func (m *mockURLRepository) countLinks(workspaceID int64) int64 {
+	var count int64
+	for _, url := range m.urls {
+		if url.WorkspaceID == workspaceID && !url.IsDeleted() {
+			count++
+		}
+	}
+	return count
+}
+
+// reserveLink повторяет проверку квоты ссылок в транзакции репозитория
+func (m *mockURLRepository) reserveLink(url *model.URL) error {
+	if url.LinkQuota > 0 && m.countLinks(url.WorkspaceID) >= url.LinkQuota {
+		return apperrors.ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (m *mockURLRepository) ExistsByShortCode(ctx context.Context, domain, shortCode string) (bool, error) {
 	if m.shouldFail {
 		return false, errors.New("database error")
 	}
 
-	_, exists := m.urls[shortCode]
+	_, exists := m.urls[mockURLKey(domain, shortCode)]
 	return exists, nil
 }
 
-func (m *mockURLRepository) IncrementClickCount(ctx context.Context, urlID int64) error {
+func (m *mockURLRepository) IncrementClickCount(ctx context.Context, urlID int64, events ...model.PendingEvent) error {
 	if m.shouldFail {
 		return errors.New("database error")
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for _, url := range m.urls {
 		if url.ID == urlID {
 			url.ClickCount++
-			return nil
+			return m.writeOutbox(events)
 		}
 	}
 
 	return apperrors.ErrURLNotFound
 }
 
+// ConsumeClick повторяет условный UPDATE: проверка и инкремент под одной блокировкой
+func (m *mockURLRepository) ConsumeClick(ctx context.Context, urlID int64, events ...model.PendingEvent) (int64, error) {
+	if m.shouldFail {
+		return 0, errors.New("database error")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, url := range m.urls {
+		if url.ID == urlID {
+			if url.MaxClicks > 0 && url.ClickCount >= url.MaxClicks {
+				return 0, apperrors.ErrURLExhausted
+			}
+			url.ClickCount++
+			return url.ClickCount, m.writeOutbox(events)
+		}
+	}
+
+	return 0, apperrors.ErrURLNotFound
+}
+
 func TestNewURLService(t *testing.T) {
 	repo := newMockURLRepository()
 	baseURL := "http://localhost:8080"
@@ -135,7 +463,7 @@ func TestURLService_CreateShortURL(t *testing.T) {
 			repo := newMockURLRepository()
 			service := NewURLService(repo, "http://localhost:8080")
 
-			response, err := service.CreateShortURL(context.Background(), tt.request)
+			response, err := service.CreateShortURL(context.Background(), model.DefaultWorkspaceID, tt.request)
 
 			if tt.wantErr {
 				if err == nil {
@@ -184,6 +512,7 @@ func TestURLService_GetURL(t *testing.T) {
 
 	url := &model.URL{
 		ID:          1,
+		WorkspaceID: model.DefaultWorkspaceID,
 		ShortCode:   "abc123",
 		OriginalURL: "https://example.com",
 		ClickCount:  5,
@@ -192,7 +521,7 @@ func TestURLService_GetURL(t *testing.T) {
 	repo.urls["abc123"] = url
 
 	t.Run("existing URL", func(t *testing.T) {
-		response, err := service.GetURL(context.Background(), "abc123")
+		response, err := service.GetURL(context.Background(), model.DefaultWorkspaceID, "", "abc123", "")
 		if err != nil {
 			t.Errorf("GetURL() unexpected error = %v", err)
 			return
@@ -208,7 +537,7 @@ func TestURLService_GetURL(t *testing.T) {
 	})
 
 	t.Run("non-existing URL", func(t *testing.T) {
-		_, err := service.GetURL(context.Background(), "notfound")
+		_, err := service.GetURL(context.Background(), model.DefaultWorkspaceID, "", "notfound", "")
 		if err == nil {
 			t.Error("GetURL() expected error, got nil")
 		}
@@ -219,7 +548,7 @@ func TestURLService_GetURL(t *testing.T) {
 	})
 
 	t.Run("empty shortCode", func(t *testing.T) {
-		_, err := service.GetURL(context.Background(), "")
+		_, err := service.GetURL(context.Background(), model.DefaultWorkspaceID, "", "", "")
 		if err == nil {
 			t.Error("GetURL() expected error for empty shortCode")
 		}
@@ -244,7 +573,7 @@ func TestURLService_GetOriginalURL(t *testing.T) {
 	repo.urls["abc123"] = url
 
 	t.Run("existing URL", func(t *testing.T) {
-		originalURL, err := service.GetOriginalURL(context.Background(), "abc123")
+		originalURL, err := service.GetOriginalURL(context.Background(), "", "abc123")
 		if err != nil {
 			t.Errorf("GetOriginalURL() unexpected error = %v", err)
 			return
@@ -256,7 +585,7 @@ func TestURLService_GetOriginalURL(t *testing.T) {
 	})
 
 	t.Run("non-existing URL", func(t *testing.T) {
-		_, err := service.GetOriginalURL(context.Background(), "notfound")
+		_, err := service.GetOriginalURL(context.Background(), "", "notfound")
 		if err == nil {
 			t.Error("GetOriginalURL() expected error, got nil")
 		}
@@ -281,7 +610,7 @@ func TestURLService_RecordClick(t *testing.T) {
 	repo.urls["abc123"] = url
 
 	t.Run("existing URL", func(t *testing.T) {
-		err := service.RecordClick(context.Background(), "abc123")
+		err := service.RecordClick(context.Background(), "", "abc123")
 		if err != nil {
 			t.Errorf("RecordClick() unexpected error = %v", err)
 		}
@@ -292,7 +621,7 @@ func TestURLService_RecordClick(t *testing.T) {
 	})
 
 	t.Run("non-existing URL", func(t *testing.T) {
-		err := service.RecordClick(context.Background(), "notfound")
+		err := service.RecordClick(context.Background(), "", "notfound")
 		if err == nil {
 			t.Error("RecordClick() expected error, got nil")
 		}
@@ -303,7 +632,7 @@ func TestURLService_RecordClick(t *testing.T) {
 	})
 
 	t.Run("empty shortCode", func(t *testing.T) {
-		err := service.RecordClick(context.Background(), "")
+		err := service.RecordClick(context.Background(), "", "")
 		if err == nil {
 			t.Error("RecordClick() expected error for empty shortCode")
 		}
@@ -320,7 +649,7 @@ func TestURLService_CreateShortURL_RetryLogic(t *testing.T) {
 	service := NewURLService(repo, "http://localhost:8080")
 
 	request := &model.CreateURLRequest{URL: "https://example.com"}
-	response, err := service.CreateShortURL(context.Background(), request)
+	response, err := service.CreateShortURL(context.Background(), model.DefaultWorkspaceID, request)
 
 	if err != nil {
 		t.Errorf("CreateShortURL() with retry logic failed: %v", err)
@@ -335,4 +664,3121 @@ func TestURLService_CreateShortURL_RetryLogic(t *testing.T) {
 	if response.ShortCode == "" {
 		t.Error("CreateShortURL() response.ShortCode is empty")
 	}
-}
\ No newline at end of file
+}
+func TestURLService_PasswordProtected(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{
+		SecretKey:           "test-secret",
+		MaxPasswordAttempts: 3,
+	})
+	ctx := context.Background()
+
+	created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL:      "https://example.com/secret",
+		Password: "hunter2",
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+
+	if !created.PasswordProtected {
+		t.Error("CreateShortURL() response.PasswordProtected = false, want true")
+	}
+
+	if created.OwnerToken == "" {
+		t.Fatal("CreateShortURL() response.OwnerToken is empty")
+	}
+
+	stored := repo.urls[created.ShortCode]
+	if stored.PasswordHash == "" || stored.PasswordHash == "hunter2" {
+		t.Errorf("CreateShortURL() stored PasswordHash = %q, want bcrypt hash", stored.PasswordHash)
+	}
+
+	t.Run("GetURL hides destination from non-owner", func(t *testing.T) {
+		response, err := service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, "")
+		if err != nil {
+			t.Fatalf("GetURL() unexpected error = %v", err)
+		}
+
+		if response.OriginalURL != "" {
+			t.Errorf("GetURL() leaked OriginalURL = %s", response.OriginalURL)
+		}
+
+		if response.OwnerToken != "" {
+			t.Error("GetURL() should never return owner token")
+		}
+	})
+
+	t.Run("GetURL reveals destination to owner", func(t *testing.T) {
+		response, err := service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, created.OwnerToken)
+		if err != nil {
+			t.Fatalf("GetURL() unexpected error = %v", err)
+		}
+
+		if response.OriginalURL != "https://example.com/secret" {
+			t.Errorf("GetURL() OriginalURL = %s, want https://example.com/secret", response.OriginalURL)
+		}
+	})
+
+	t.Run("VerifyPassword", func(t *testing.T) {
+		if err := service.VerifyPassword(ctx, stored, "wrong", "10.0.0.1"); !errors.Is(err, apperrors.ErrInvalidPassword) {
+			t.Errorf("VerifyPassword() with wrong password error = %v, want ErrInvalidPassword", err)
+		}
+
+		if err := service.VerifyPassword(ctx, stored, "hunter2", "10.0.0.1"); err != nil {
+			t.Errorf("VerifyPassword() with correct password error = %v", err)
+		}
+	})
+
+	t.Run("VerifyPassword throttles per IP", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_ = service.VerifyPassword(ctx, stored, "wrong", "10.0.0.2")
+		}
+
+		if err := service.VerifyPassword(ctx, stored, "hunter2", "10.0.0.2"); !errors.Is(err, apperrors.ErrTooManyAttempts) {
+			t.Errorf("VerifyPassword() after limit error = %v, want ErrTooManyAttempts", err)
+		}
+
+		if err := service.VerifyPassword(ctx, stored, "hunter2", "10.0.0.3"); err != nil {
+			t.Errorf("VerifyPassword() from another IP error = %v", err)
+		}
+	})
+
+	t.Run("VerifyPassword throttles per link", func(t *testing.T) {
+		limited := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{
+			MaxPasswordAttempts:     3,
+			MaxLinkPasswordAttempts: 4,
+		})
+
+		// Перебор с разных адресов: каждому IP хватает своего лимита
+		for i := 0; i < 4; i++ {
+			_ = limited.VerifyPassword(ctx, stored, "wrong", fmt.Sprintf("198.51.100.%d", i))
+		}
+		if err := limited.VerifyPassword(ctx, stored, "hunter2", "198.51.100.99"); !errors.Is(err, apperrors.ErrTooManyAttempts) {
+			t.Errorf("VerifyPassword() after link limit error = %v, want ErrTooManyAttempts", err)
+		}
+	})
+
+	t.Run("unlock token", func(t *testing.T) {
+		token, expiresAt := service.IssueUnlockToken(stored)
+		if !expiresAt.After(time.Now()) {
+			t.Error("IssueUnlockToken() expiry should be in the future")
+		}
+
+		if !service.VerifyUnlockToken(stored, token) {
+			t.Error("VerifyUnlockToken() should accept issued token")
+		}
+
+		changed := *stored
+		changed.PasswordHash = "other-hash"
+		if service.VerifyUnlockToken(&changed, token) {
+			t.Error("VerifyUnlockToken() should reject token after password change")
+		}
+	})
+}
+
+func TestURLService_CreateShortURL_InvalidPassword(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+
+	_, err := service.CreateShortURL(context.Background(), model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL:      "https://example.com",
+		Password: "abc",
+	})
+	if !apperrors.IsValidationError(err) {
+		t.Errorf("CreateShortURL() expected validation error, got %v", err)
+	}
+}
+
+func TestURLService_ConsumeClick(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, "http://localhost:8080")
+	ctx := context.Background()
+
+	t.Run("one-time link under concurrency", func(t *testing.T) {
+		created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:       "https://example.com/invite",
+			MaxClicks: 1,
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded, exhausted := 0, 0
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				// Каждый посетитель получает свою копию ссылки, как из кэша
+				repo.mu.Lock()
+				link := *repo.urls[created.ShortCode]
+				repo.mu.Unlock()
+
+				err := service.ConsumeClick(ctx, &link, nil)
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					succeeded++
+				case errors.Is(err, apperrors.ErrURLExhausted):
+					exhausted++
+				default:
+					t.Errorf("ConsumeClick() unexpected error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if succeeded != 1 || exhausted != 19 {
+			t.Errorf("ConsumeClick() succeeded = %d, exhausted = %d, want 1 and 19", succeeded, exhausted)
+		}
+
+		response, _ := service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, "")
+		if !response.Exhausted {
+			t.Error("GetURL() response.Exhausted = false, want true")
+		}
+	})
+
+	t.Run("limit of three", func(t *testing.T) {
+		created, _ := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:       "https://example.com/limited",
+			MaxClicks: 3,
+		})
+		link := repo.urls[created.ShortCode]
+
+		for i := 0; i < 3; i++ {
+			if err := service.ConsumeClick(ctx, link, nil); err != nil {
+				t.Fatalf("ConsumeClick() #%d unexpected error = %v", i+1, err)
+			}
+		}
+
+		if err := service.ConsumeClick(ctx, link, nil); !errors.Is(err, apperrors.ErrURLExhausted) {
+			t.Errorf("ConsumeClick() after limit error = %v, want ErrURLExhausted", err)
+		}
+	})
+
+	t.Run("destination hidden from non-owner", func(t *testing.T) {
+		created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:         "https://example.com/secret",
+			MaxClicks:   1,
+			FallbackURL: "https://example.com/fallback",
+			Rules:       []model.RoutingRule{{Kind: model.RuleKindOS, Value: model.OSiOS, Destination: "https://apps.apple.com/app/id1"}},
+			Variants:    []model.Variant{{Destination: "https://example.com/a"}, {Destination: "https://example.com/b"}},
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+
+		// Узнать назначение можно только переходом, который расходует клик
+		public, err := service.GetPublicURL(ctx, "", created.ShortCode)
+		if err != nil {
+			t.Fatalf("GetPublicURL() unexpected error = %v", err)
+		}
+		anonymous, err := service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, "")
+		if err != nil {
+			t.Fatalf("GetURL() unexpected error = %v", err)
+		}
+		for name, response := range map[string]*model.URLResponse{"GetPublicURL": public, "GetURL": anonymous} {
+			if response.OriginalURL != "" || response.FallbackURL != "" || response.Variants != nil || response.Rules != nil {
+				t.Errorf("%s() leaked destination of click-limited link: %+v", name, response)
+			}
+		}
+
+		owner, _ := service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, created.OwnerToken)
+		if owner.OriginalURL != "https://example.com/secret" || owner.FallbackURL == "" || len(owner.Variants) != 2 || len(owner.Rules) != 1 {
+			t.Errorf("GetURL() for owner = %+v, want full destination", owner)
+		}
+
+		if repo.urls[created.ShortCode].ClickCount != 0 {
+			t.Error("GetURL() should not consume a click")
+		}
+	})
+
+	t.Run("negative limit", func(t *testing.T) {
+		_, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:       "https://example.com",
+			MaxClicks: -1,
+		})
+		if !apperrors.IsValidationError(err) {
+			t.Errorf("CreateShortURL() expected validation error, got %v", err)
+		}
+	})
+}
+
+func TestURLService_ActivationWindow(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLService(repo, "http://localhost:8080")
+	ctx := context.Background()
+
+	now := time.Now()
+	hourAgo := now.Add(-time.Hour)
+	inHour := now.Add(time.Hour)
+	inTwoHours := now.Add(2 * time.Hour)
+
+	t.Run("validation", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			notBefore *time.Time
+			notAfter  *time.Time
+			wantErr   bool
+		}{
+			{"no window", nil, nil, false},
+			{"future activation", &inHour, nil, false},
+			{"valid window", &inHour, &inTwoHours, false},
+			{"not_after in the past", nil, &hourAgo, true},
+			{"not_after before not_before", &inTwoHours, &inHour, true},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+					URL:       "https://example.com",
+					NotBefore: tt.notBefore,
+					NotAfter:  tt.notAfter,
+				})
+				if (err != nil) != tt.wantErr {
+					t.Errorf("CreateShortURL() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil && !apperrors.IsValidationError(err) {
+					t.Errorf("CreateShortURL() expected validation error, got %T", err)
+				}
+			})
+		}
+	})
+
+	t.Run("pending destination hidden from non-owner", func(t *testing.T) {
+		created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:         "https://example.com/launch",
+			NotBefore:   &inHour,
+			FallbackURL: "https://example.com/launch-soon",
+			UTMTemplate: model.UTMTemplate{"utm_campaign": "launch"},
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+
+		response, _ := service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, "")
+		if response.OriginalURL != "" {
+			t.Errorf("GetURL() leaked OriginalURL of pending link: %s", response.OriginalURL)
+		}
+		if response.FallbackURL != "" || response.UTMTemplate != nil {
+			t.Errorf("GetURL() leaked FallbackURL = %q, UTMTemplate = %v of pending link", response.FallbackURL, response.UTMTemplate)
+		}
+
+		response, _ = service.GetURL(ctx, model.DefaultWorkspaceID, "", created.ShortCode, created.OwnerToken)
+		if response.OriginalURL != "https://example.com/launch" {
+			t.Errorf("GetURL() for owner OriginalURL = %s", response.OriginalURL)
+		}
+		if response.FallbackURL != "https://example.com/launch-soon" || response.UTMTemplate["utm_campaign"] != "launch" {
+			t.Errorf("GetURL() for owner FallbackURL = %q, UTMTemplate = %v", response.FallbackURL, response.UTMTemplate)
+		}
+	})
+
+	t.Run("availability", func(t *testing.T) {
+		tests := []struct {
+			name string
+			url  *model.URL
+			want error
+		}{
+			{"always active", &model.URL{}, nil},
+			{"pending", &model.URL{NotBefore: &inHour}, apperrors.ErrURLNotYetActive},
+			{"inside window", &model.URL{NotBefore: &hourAgo, NotAfter: &inHour}, nil},
+			{"expired", &model.URL{NotAfter: &hourAgo}, apperrors.ErrURLExpired},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := service.CheckAvailability(tt.url); !errors.Is(err, tt.want) {
+					t.Errorf("CheckAvailability() error = %v, want %v", err, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestURLService_CreateShortURL_RedirectType(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		url          string
+		redirectType string
+		wantErr      bool
+	}{
+		{"default type", "https://example.com", "", false},
+		{"permanent", "https://example.com", model.RedirectPermanent, false},
+		{"unknown type", "https://example.com", "303", true},
+		{"deep link with meta", "myapp://open", model.RedirectMetaRefresh, false},
+		{"deep link with js", "myapp://open", model.RedirectJavaScript, false},
+		{"deep link with status redirect", "myapp://open", model.RedirectFound, true},
+		{"javascript scheme with meta", "javascript:alert(1)", model.RedirectMetaRefresh, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+				URL:          tt.url,
+				RedirectType: tt.redirectType,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateShortURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && response.RedirectType != tt.redirectType {
+				t.Errorf("CreateShortURL() RedirectType = %q, want %q", response.RedirectType, tt.redirectType)
+			}
+		})
+	}
+}
+
+func TestURLService_DestinationFor(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+
+	tests := []struct {
+		name    string
+		url     model.URL
+		visit   model.Visit
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "no passthrough ignores query",
+			url:   model.URL{OriginalURL: "https://example.com/page"},
+			visit: model.Visit{Query: neturl.Values{"a": {"1"}}},
+			want:  "https://example.com/page",
+		},
+		{
+			name:    "extra path without forward_path",
+			url:     model.URL{ShortCode: "abc123", OriginalURL: "https://example.com"},
+			visit:   model.Visit{ExtraPath: "/docs"},
+			wantErr: apperrors.ErrURLNotFound,
+		},
+		{
+			name:  "trailing slash is not extra path",
+			url:   model.URL{OriginalURL: "https://example.com"},
+			visit: model.Visit{ExtraPath: "/"},
+			want:  "https://example.com",
+		},
+		{
+			name:  "forward path",
+			url:   model.URL{OriginalURL: "https://example.com/base", ForwardPath: true},
+			visit: model.Visit{ExtraPath: "/docs/intro"},
+			want:  "https://example.com/base/docs/intro",
+		},
+		{
+			name:  "forward query adds new params",
+			url:   model.URL{OriginalURL: "https://example.com?ref=site", ForwardQuery: true},
+			visit: model.Visit{Query: neturl.Values{"utm_source": {"mail"}}},
+			want:  "https://example.com?ref=site&utm_source=mail",
+		},
+		{
+			name:  "conflict keeps destination by default",
+			url:   model.URL{OriginalURL: "https://example.com?ref=site", ForwardQuery: true},
+			visit: model.Visit{Query: neturl.Values{"ref": {"mail"}}},
+			want:  "https://example.com?ref=site",
+		},
+		{
+			name: "conflict overridden by request",
+			url: model.URL{
+				OriginalURL:   "https://example.com?ref=site",
+				ForwardQuery:  true,
+				QueryConflict: model.QueryConflictOverride,
+			},
+			visit: model.Visit{Query: neturl.Values{"ref": {"mail"}}},
+			want:  "https://example.com?ref=mail",
+		},
+		{
+			name: "conflict appends values",
+			url: model.URL{
+				OriginalURL:   "https://example.com?ref=site",
+				ForwardQuery:  true,
+				QueryConflict: model.QueryConflictAppend,
+			},
+			visit: model.Visit{Query: neturl.Values{"ref": {"mail"}}},
+			want:  "https://example.com?ref=site&ref=mail",
+		},
+		{
+			name:  "destination query kept as written",
+			url:   model.URL{OriginalURL: "https://example.com?z=1&a=x%2Fy&flag", ForwardQuery: true},
+			visit: model.Visit{Query: neturl.Values{"z": {"2"}}},
+			want:  "https://example.com?z=1&a=x%2Fy&flag",
+		},
+		{
+			name:  "forwarded params appended after destination query",
+			url:   model.URL{OriginalURL: "https://example.com?z=1&a=x%2Fy&flag", ForwardQuery: true},
+			visit: model.Visit{Query: neturl.Values{"q": {"a b"}, "c": {"&"}}},
+			want:  "https://example.com?z=1&a=x%2Fy&flag&c=%26&q=a+b",
+		},
+		{
+			name:  "path and query together",
+			url:   model.URL{OriginalURL: "https://example.com", ForwardPath: true, ForwardQuery: true},
+			visit: model.Visit{ExtraPath: "/a", Query: neturl.Values{"b": {"c"}}},
+			want:  "https://example.com/a?b=c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.DestinationFor(&tt.url, &tt.visit)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DestinationFor() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DestinationFor() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DestinationFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLService_CreateShortURL_QueryConflict(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+
+	_, err := service.CreateShortURL(context.Background(), model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL:           "https://example.com",
+		ForwardQuery:  true,
+		QueryConflict: "merge",
+	})
+	if !apperrors.IsValidationError(err) {
+		t.Errorf("CreateShortURL() error = %v, want validation error", err)
+	}
+}
+
+func TestURLService_CreateShortURL_UTMTemplate(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		template model.UTMTemplate
+		wantErr  bool
+	}{
+		{"static values", model.UTMTemplate{"utm_source": "newsletter", "utm_medium": "email"}, false},
+		{"known placeholders", model.UTMTemplate{"utm_source": "{referrer_host}", "utm_content": "{short_code}-{country}"}, false},
+		{"unknown placeholder", model.UTMTemplate{"utm_source": "{city}"}, true},
+		{"unclosed brace", model.UTMTemplate{"utm_source": "{country"}, true},
+		{"empty name", model.UTMTemplate{" ": "x"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+				URL:         "https://example.com",
+				UTMTemplate: tt.template,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateShortURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !apperrors.IsValidationError(err) {
+				t.Errorf("CreateShortURL() error = %v, want validation error", err)
+			}
+			if err == nil && len(response.UTMTemplate) != len(tt.template) {
+				t.Errorf("CreateShortURL() UTMTemplate = %v, want %v", response.UTMTemplate, tt.template)
+			}
+		})
+	}
+}
+
+func TestURLService_DestinationFor_UTMTemplate(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	date := time.Now().UTC().Format(time.DateOnly)
+
+	tests := []struct {
+		name  string
+		url   model.URL
+		visit model.Visit
+		want  string
+	}{
+		{
+			name: "placeholders expanded",
+			url: model.URL{
+				ShortCode:   "abc123",
+				OriginalURL: "https://example.com/page",
+				UTMTemplate: model.UTMTemplate{
+					"utm_source":   "{referrer_host}",
+					"utm_campaign": "{short_code}-{date}",
+					"utm_term":     "{country}",
+				},
+			},
+			visit: model.Visit{Referrer: "https://news.example.org/article", Location: model.Location{Country: "DE"}},
+			want:  "https://example.com/page?utm_campaign=abc123-" + date + "&utm_source=news.example.org&utm_term=DE",
+		},
+		{
+			name: "empty value skipped",
+			url: model.URL{
+				OriginalURL: "https://example.com",
+				UTMTemplate: model.UTMTemplate{"utm_source": "{referrer_host}", "utm_medium": "social"},
+			},
+			want: "https://example.com?utm_medium=social",
+		},
+		{
+			name: "template overrides destination params",
+			url: model.URL{
+				OriginalURL: "https://example.com?utm_source=old&id=7",
+				UTMTemplate: model.UTMTemplate{"utm_source": "new"},
+			},
+			want: "https://example.com?id=7&utm_source=new",
+		},
+		{
+			name: "request cannot override template by default",
+			url: model.URL{
+				OriginalURL:  "https://example.com",
+				ForwardQuery: true,
+				UTMTemplate:  model.UTMTemplate{"utm_source": "newsletter"},
+			},
+			visit: model.Visit{Query: neturl.Values{"utm_source": {"spam"}, "x": {"1"}}},
+			want:  "https://example.com?utm_source=newsletter&x=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.DestinationFor(&tt.url, &tt.visit)
+			if err != nil {
+				t.Fatalf("DestinationFor() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DestinationFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLService_RoutingRules(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	ctx := context.Background()
+
+	rules := []model.RoutingRule{
+		{Kind: model.RuleKindOS, Value: model.OSiOS, Destination: "https://apps.apple.com/app/id1"},
+		{Kind: model.RuleKindOS, Value: model.OSAndroid, Destination: "https://play.google.com/store/apps/details?id=app"},
+		{Kind: model.RuleKindDevice, Value: model.DeviceMobile, Destination: "https://m.example.com"},
+	}
+
+	response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL:   "https://example.com",
+		Rules: rules,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	if len(response.Rules) != len(rules) {
+		t.Fatalf("CreateShortURL() Rules = %v, want %d rules", response.Rules, len(rules))
+	}
+
+	url, err := service.ResolveURL(ctx, "", response.ShortCode)
+	if err != nil {
+		t.Fatalf("ResolveURL() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"iOS", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148", "https://apps.apple.com/app/id1"},
+		{"Android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile Safari/537.36", "https://play.google.com/store/apps/details?id=app"},
+		{"other mobile", "Mozilla/5.0 (Mobile; rv:48.0) Gecko/48.0 Firefox/48.0", "https://m.example.com"},
+		{"desktop", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0", "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visit := &model.Visit{UserAgent: tt.userAgent}
+			got, err := service.DestinationFor(url, visit)
+			if err != nil {
+				t.Fatalf("DestinationFor() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DestinationFor() = %s, want %s", got, tt.want)
+			}
+			if visit.Primary != (tt.want == url.OriginalURL) {
+				t.Errorf("DestinationFor() Primary = %v for %s", visit.Primary, got)
+			}
+		})
+	}
+
+	t.Run("invalid rules", func(t *testing.T) {
+		invalid := [][]model.RoutingRule{
+			{{Kind: "browser", Value: "chrome", Destination: "https://example.com"}},
+			{{Kind: model.RuleKindOS, Value: "symbian", Destination: "https://example.com"}},
+			{{Kind: model.RuleKindOS, Value: model.OSiOS, Destination: "ftp://example.com"}},
+		}
+
+		for _, rules := range invalid {
+			_, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+				URL:   "https://example.com",
+				Rules: rules,
+			})
+			if !apperrors.IsValidationError(err) {
+				t.Errorf("CreateShortURL(%v) error = %v, want validation error", rules, err)
+			}
+		}
+	})
+
+	t.Run("rules hidden for protected link", func(t *testing.T) {
+		response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:      "https://example.com",
+			Password: "secret",
+			Rules:    rules,
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+
+		info, err := service.GetURL(ctx, model.DefaultWorkspaceID, "", response.ShortCode, "")
+		if err != nil {
+			t.Fatalf("GetURL() unexpected error = %v", err)
+		}
+		if len(info.Rules) != 0 {
+			t.Errorf("GetURL() Rules = %v, want hidden", info.Rules)
+		}
+	})
+}
+
+type mockClickRepository struct {
+	mu     sync.Mutex
+	events []*model.ClickEvent
+}
+
+func (m *mockClickRepository) Create(ctx context.Context, event *model.ClickEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockClickRepository) CountBy(ctx context.Context, urlID int64, dimension string, limit int) ([]model.StatBucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[string]int64)
+	var order []string
+	for _, event := range m.events {
+		if event.URLID != urlID {
+			continue
+		}
+		value := event.Country
+		switch dimension {
+		case "city":
+			value = event.City
+		case "variant":
+			value = event.Variant
+		case "bot":
+			value = event.Bot
+		}
+		// Как и в Postgres, переходы ботов видны только в разбивке по ботам
+		if value == "" || (dimension != "bot" && event.Bot != "") {
+			continue
+		}
+		if counts[value] == 0 {
+			order = append(order, value)
+		}
+		counts[value]++
+	}
+
+	buckets := make([]model.StatBucket, 0, len(order))
+	for _, value := range order {
+		buckets = append(buckets, model.StatBucket{Value: value, Clicks: counts[value]})
+	}
+	return buckets, nil
+}
+
+func (m *mockClickRepository) CountBotClicks(ctx context.Context, urlID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, event := range m.events {
+		if event.URLID == urlID && event.Bot != "" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestURLService_GeoRules(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+
+	response, err := service.CreateShortURL(context.Background(), model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL: "https://example.com",
+		Rules: []model.RoutingRule{
+			{Kind: model.RuleKindRegion, Value: "us-ca", Destination: "https://example.com/california"},
+			{Kind: model.RuleKindCountry, Value: "us", Destination: "https://example.com/us"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	if response.Rules[0].Value != "US-CA" || response.Rules[1].Value != "US" {
+		t.Errorf("CreateShortURL() rules = %v, want upper-case codes", response.Rules)
+	}
+
+	url, err := service.ResolveURL(context.Background(), "", response.ShortCode)
+	if err != nil {
+		t.Fatalf("ResolveURL() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		location model.Location
+		want     string
+	}{
+		{"region", model.Location{Country: "US", Region: "US-CA"}, "https://example.com/california"},
+		{"country", model.Location{Country: "US", Region: "US-NY"}, "https://example.com/us"},
+		{"other country", model.Location{Country: "DE"}, "https://example.com"},
+		{"unknown location", model.Location{}, "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.DestinationFor(url, &model.Visit{Location: tt.location})
+			if err != nil {
+				t.Fatalf("DestinationFor() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DestinationFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, value := range []string{"USA", "U1", "US_CA", "USCA"} {
+		kind := model.RuleKindCountry
+		if len(value) > 3 {
+			kind = model.RuleKindRegion
+		}
+		_, err := service.CreateShortURL(context.Background(), model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:   "https://example.com",
+			Rules: []model.RoutingRule{{Kind: kind, Value: value, Destination: "https://example.com"}},
+		})
+		if !apperrors.IsValidationError(err) {
+			t.Errorf("CreateShortURL(%s=%s) error = %v, want validation error", kind, value, err)
+		}
+	}
+}
+
+func TestURLService_TrackClickAndStats(t *testing.T) {
+	repo := newMockURLRepository()
+	clicks := &mockClickRepository{}
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{ClickRepository: clicks})
+	ctx := context.Background()
+
+	response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	url, _ := service.ResolveURL(ctx, "", response.ShortCode)
+
+	visits := []model.Location{
+		{Country: "DE", City: "Berlin"},
+		{Country: "DE", City: "Munich"},
+		{Country: "FR", City: "Paris"},
+		{},
+	}
+	for _, location := range visits {
+		event := model.NewClickEvent(url, &model.Visit{Location: location}, time.Now())
+		if err := service.TrackClick(ctx, event); err != nil {
+			t.Fatalf("TrackClick() unexpected error = %v", err)
+		}
+	}
+
+	// Уже засчитанный ConsumeClick переход не увеличивает счетчик повторно
+	counted := model.NewClickEvent(url, &model.Visit{}, time.Now())
+	counted.Counted = true
+	if err := service.TrackClick(ctx, counted); err != nil {
+		t.Fatalf("TrackClick() unexpected error = %v", err)
+	}
+
+	// Переход бота сохраняется, но не засчитывается
+	bots := []string{"slackbot", "slackbot", "burst"}
+	for _, bot := range bots {
+		event := model.NewClickEvent(url, &model.Visit{Location: model.Location{Country: "US"}, Bot: bot}, time.Now())
+		if err := service.TrackClick(ctx, event); err != nil {
+			t.Fatalf("TrackClick() unexpected error = %v", err)
+		}
+	}
+
+	if len(clicks.events) != 8 {
+		t.Errorf("TrackClick() saved %d events, want 8", len(clicks.events))
+	}
+
+	t.Run("not owner", func(t *testing.T) {
+		_, err := service.GetStats(ctx, model.DefaultWorkspaceID, "", response.ShortCode, "wrong")
+		if !errors.Is(err, apperrors.ErrForbidden) {
+			t.Errorf("GetStats() error = %v, want ErrForbidden", err)
+		}
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		stats, err := service.GetStats(ctx, model.DefaultWorkspaceID, "", response.ShortCode, response.OwnerToken)
+		if err != nil {
+			t.Fatalf("GetStats() unexpected error = %v", err)
+		}
+		if stats.TotalClicks != 4 {
+			t.Errorf("GetStats() TotalClicks = %d, want 4", stats.TotalClicks)
+		}
+		if len(stats.Countries) != 2 || stats.Countries[0] != (model.StatBucket{Value: "DE", Clicks: 2}) {
+			t.Errorf("GetStats() Countries = %v", stats.Countries)
+		}
+		if len(stats.Cities) != 3 {
+			t.Errorf("GetStats() Cities = %v", stats.Cities)
+		}
+		if stats.BotClicks != 3 {
+			t.Errorf("GetStats() BotClicks = %d, want 3", stats.BotClicks)
+		}
+		if len(stats.Bots) != 2 || stats.Bots[0] != (model.StatBucket{Value: "slackbot", Clicks: 2}) {
+			t.Errorf("GetStats() Bots = %v", stats.Bots)
+		}
+	})
+}
+
+// mockVisitorRepository считает посетителей точно, как таблица Postgres
+type mockVisitorRepository struct {
+	// days - отпечатки посетителей ссылки по дням
+	days map[int64]map[string]map[string]bool
+}
+
+func (m *mockVisitorRepository) AddVisitor(ctx context.Context, urlID int64, day time.Time, fingerprint string) error {
+	if m.days == nil {
+		m.days = make(map[int64]map[string]map[string]bool)
+	}
+	if m.days[urlID] == nil {
+		m.days[urlID] = make(map[string]map[string]bool)
+	}
+	date := day.UTC().Format(model.VisitorDayFormat)
+	if m.days[urlID][date] == nil {
+		m.days[urlID][date] = make(map[string]bool)
+	}
+	m.days[urlID][date][fingerprint] = true
+	return nil
+}
+
+func (m *mockVisitorRepository) CountVisitors(ctx context.Context, urlID int64) (int64, error) {
+	unique := make(map[string]bool)
+	for _, visitors := range m.days[urlID] {
+		for fingerprint := range visitors {
+			unique[fingerprint] = true
+		}
+	}
+	return int64(len(unique)), nil
+}
+
+func (m *mockVisitorRepository) CountDailyVisitors(ctx context.Context, urlID int64, from, to time.Time) ([]model.DailyVisitors, error) {
+	daily := make([]model.DailyVisitors, 0)
+	for day := from.UTC(); day.Format(model.VisitorDayFormat) <= to.UTC().Format(model.VisitorDayFormat); day = day.AddDate(0, 0, 1) {
+		date := day.Format(model.VisitorDayFormat)
+		if visitors := len(m.days[urlID][date]); visitors > 0 {
+			daily = append(daily, model.DailyVisitors{Date: date, Visitors: int64(visitors)})
+		}
+	}
+	return daily, nil
+}
+
+func TestURLService_UniqueVisitors(t *testing.T) {
+	visitors := &mockVisitorRepository{}
+	service := NewURLServiceWithConfig(newMockURLRepository(), "http://localhost:8080", Config{VisitorRepository: visitors})
+	ctx := context.Background()
+
+	response, _ := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com"})
+	url, _ := service.ResolveURL(ctx, "", response.ShortCode)
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	visits := []struct {
+		ip, userAgent string
+		at            time.Time
+	}{
+		{"203.0.113.1", "Firefox", yesterday},
+		{"203.0.113.1", "Firefox", now},
+		// Обновление страницы тем же посетителем
+		{"203.0.113.1", "Firefox", now},
+		{"203.0.113.2", "Firefox", now},
+	}
+	for _, visit := range visits {
+		event := model.NewClickEvent(url, &model.Visit{ClientIP: visit.ip, UserAgent: visit.userAgent}, visit.at)
+		if err := service.TrackClick(ctx, event); err != nil {
+			t.Fatalf("TrackClick() unexpected error = %v", err)
+		}
+	}
+
+	link, err := service.GetURL(ctx, model.DefaultWorkspaceID, "", response.ShortCode, "")
+	if err != nil {
+		t.Fatalf("GetURL() unexpected error = %v", err)
+	}
+	if link.ClickCount != 4 || link.UniqueClicks != 2 {
+		t.Errorf("GetURL() clicks = %d, unique = %d, want 4 and 2", link.ClickCount, link.UniqueClicks)
+	}
+
+	stats, err := service.GetStats(ctx, model.DefaultWorkspaceID, "", response.ShortCode, response.OwnerToken)
+	if err != nil {
+		t.Fatalf("GetStats() unexpected error = %v", err)
+	}
+	want := []model.DailyVisitors{
+		{Date: yesterday.UTC().Format(model.VisitorDayFormat), Visitors: 1},
+		{Date: now.UTC().Format(model.VisitorDayFormat), Visitors: 2},
+	}
+	if stats.UniqueClicks != 2 || !slices.Equal(stats.DailyUnique, want) {
+		t.Errorf("GetStats() unique = %d, daily = %v, want 2 and %v", stats.UniqueClicks, stats.DailyUnique, want)
+	}
+
+	// Адрес посетителя хранится только в виде отпечатка
+	for _, days := range visitors.days {
+		for _, fingerprints := range days {
+			for fingerprint := range fingerprints {
+				if strings.Contains(fingerprint, "203.0.113") {
+					t.Errorf("fingerprint %q contains the client IP", fingerprint)
+				}
+			}
+		}
+	}
+}
+
+func TestURLService_Variants(t *testing.T) {
+	clicks := &mockClickRepository{}
+	service := NewURLServiceWithConfig(newMockURLRepository(), "http://localhost:8080", Config{ClickRepository: clicks})
+	ctx := context.Background()
+
+	response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL: "https://example.com",
+		Variants: []model.Variant{
+			{Destination: "https://example.com/a", Weight: 3},
+			{Name: "landing-v2", Destination: "https://example.com/b"},
+		},
+		StickyVariants: true,
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+
+	wantVariants := []model.Variant{
+		{Name: "a", Destination: "https://example.com/a", Weight: 3},
+		{Name: "landing-v2", Destination: "https://example.com/b", Weight: 1},
+	}
+	if len(response.Variants) != 2 || response.Variants[0] != wantVariants[0] || response.Variants[1] != wantVariants[1] {
+		t.Fatalf("CreateShortURL() Variants = %v, want %v", response.Variants, wantVariants)
+	}
+
+	url, _ := service.ResolveURL(ctx, "", response.ShortCode)
+
+	t.Run("weighted choice", func(t *testing.T) {
+		tests := []struct {
+			roll        int
+			wantVariant string
+		}{
+			{0, "a"},
+			{2, "a"},
+			{3, "landing-v2"},
+		}
+
+		for _, tt := range tests {
+			service.randomIntN = func(n int) int {
+				if n != 4 {
+					t.Errorf("randomIntN(%d), want total weight 4", n)
+				}
+				return tt.roll
+			}
+
+			visit := &model.Visit{}
+			destination, err := service.DestinationFor(url, visit)
+			if err != nil {
+				t.Fatalf("DestinationFor() unexpected error = %v", err)
+			}
+			if visit.Variant != tt.wantVariant {
+				t.Errorf("roll %d: Variant = %q, want %q", tt.roll, visit.Variant, tt.wantVariant)
+			}
+			want, _ := url.Variants.Find(tt.wantVariant)
+			if destination != want.Destination {
+				t.Errorf("roll %d: DestinationFor() = %s, want %s", tt.roll, destination, want.Destination)
+			}
+		}
+	})
+
+	t.Run("sticky variant", func(t *testing.T) {
+		service.randomIntN = func(n int) int { return 0 }
+
+		visit := &model.Visit{StickyVariant: "landing-v2"}
+		destination, _ := service.DestinationFor(url, visit)
+		if destination != "https://example.com/b" || visit.Variant != "landing-v2" {
+			t.Errorf("DestinationFor() = %s (%s), want sticky variant", destination, visit.Variant)
+		}
+
+		// Удаленный из ссылки вариант выбирается заново
+		visit = &model.Visit{StickyVariant: "gone"}
+		if destination, _ = service.DestinationFor(url, visit); destination != "https://example.com/a" {
+			t.Errorf("DestinationFor() = %s, want re-rolled variant", destination)
+		}
+	})
+
+	t.Run("rules take precedence", func(t *testing.T) {
+		withRule := *url
+		withRule.Rules = model.RoutingRules{{Kind: model.RuleKindCountry, Value: "DE", Destination: "https://example.de"}}
+
+		visit := &model.Visit{Location: model.Location{Country: "DE"}}
+		destination, _ := service.DestinationFor(&withRule, visit)
+		if destination != "https://example.de" || visit.Variant != "" {
+			t.Errorf("DestinationFor() = %s (%q), want rule destination without variant", destination, visit.Variant)
+		}
+	})
+
+	t.Run("stats per variant", func(t *testing.T) {
+		for _, name := range []string{"a", "a", "landing-v2"} {
+			event := model.NewClickEvent(url, &model.Visit{Variant: name}, time.Now())
+			if err := service.TrackClick(ctx, event); err != nil {
+				t.Fatalf("TrackClick() unexpected error = %v", err)
+			}
+		}
+
+		stats, err := service.GetStats(ctx, model.DefaultWorkspaceID, "", response.ShortCode, response.OwnerToken)
+		if err != nil {
+			t.Fatalf("GetStats() unexpected error = %v", err)
+		}
+		want := []model.StatBucket{{Value: "a", Clicks: 2}, {Value: "landing-v2", Clicks: 1}}
+		if len(stats.Variants) != 2 || stats.Variants[0] != want[0] || stats.Variants[1] != want[1] {
+			t.Errorf("GetStats() Variants = %v, want %v", stats.Variants, want)
+		}
+	})
+
+	t.Run("invalid variants", func(t *testing.T) {
+		invalid := [][]model.Variant{
+			{{Name: "a", Destination: "https://example.com"}, {Name: "a", Destination: "https://example.org"}},
+			{{Name: "bad name", Destination: "https://example.com"}},
+			{{Destination: "https://example.com", Weight: -1}},
+			{{Destination: "https://example.com", Weight: 1001}},
+			{{Destination: "not a url"}},
+		}
+
+		for _, variants := range invalid {
+			_, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+				URL:      "https://example.com",
+				Variants: variants,
+			})
+			if !apperrors.IsValidationError(err) {
+				t.Errorf("CreateShortURL(%v) error = %v, want validation error", variants, err)
+			}
+		}
+	})
+}
+
+type mockDomainRepository struct {
+	domains map[string]*model.Domain
+	lookups int
+}
+
+func newMockDomainRepository(hostnames ...string) *mockDomainRepository {
+	repo := &mockDomainRepository{domains: make(map[string]*model.Domain)}
+	for _, hostname := range hostnames {
+		repo.Create(context.Background(), &model.Domain{WorkspaceID: model.DefaultWorkspaceID, Hostname: hostname})
+	}
+	return repo
+}
+
+func (m *mockDomainRepository) Create(ctx context.Context, domain *model.Domain) error {
+	if _, exists := m.domains[domain.Hostname]; exists {
+		return apperrors.ErrDomainExists
+	}
+	domain.ID = int64(len(m.domains) + 1)
+	m.domains[domain.Hostname] = domain
+	return nil
+}
+
+func (m *mockDomainRepository) GetByHostname(ctx context.Context, hostname string) (*model.Domain, error) {
+	m.lookups++
+	domain, exists := m.domains[hostname]
+	if !exists {
+		return nil, apperrors.ErrDomainNotFound
+	}
+	return domain, nil
+}
+
+func (m *mockDomainRepository) List(ctx context.Context, workspaceID int64) ([]model.Domain, error) {
+	domains := make([]model.Domain, 0, len(m.domains))
+	for _, domain := range m.domains {
+		if domain.WorkspaceID == workspaceID {
+			domains = append(domains, *domain)
+		}
+	}
+	return domains, nil
+}
+
+func TestURLService_Domains(t *testing.T) {
+	repo := newMockURLRepository()
+	domains := newMockDomainRepository("go.brand.com")
+	service := NewURLServiceWithConfig(repo, "https://sho.rt", Config{DomainRepository: domains})
+	ctx := context.Background()
+
+	t.Run("short url on link domain", func(t *testing.T) {
+		response, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+			URL:    "https://example.com",
+			Domain: "Go.Brand.com",
+		})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+		if response.Domain != "go.brand.com" || response.ShortURL != "https://go.brand.com/"+response.ShortCode {
+			t.Errorf("CreateShortURL() Domain = %q, ShortURL = %s", response.Domain, response.ShortURL)
+		}
+
+		if _, err := service.ResolveURL(ctx, "go.brand.com", response.ShortCode); err != nil {
+			t.Errorf("ResolveURL() on link domain error = %v", err)
+		}
+		if _, err := service.ResolveURL(ctx, "", response.ShortCode); !errors.Is(err, apperrors.ErrURLNotFound) {
+			t.Errorf("ResolveURL() on default domain error = %v, want ErrURLNotFound", err)
+		}
+
+		response, _ = service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com", Domain: "sho.rt"})
+		if response.Domain != "" || response.ShortURL != "https://sho.rt/"+response.ShortCode {
+			t.Errorf("CreateShortURL() on default domain Domain = %q, ShortURL = %s", response.Domain, response.ShortURL)
+		}
+	})
+
+	t.Run("same code on different domains", func(t *testing.T) {
+		for _, domain := range []string{"", "go.brand.com"} {
+			err := repo.Create(ctx, &model.URL{ShortCode: "sale", Domain: domain, OriginalURL: "https://example.com/" + domain})
+			if err != nil {
+				t.Fatalf("Create(%q) unexpected error = %v", domain, err)
+			}
+		}
+
+		url, err := service.ResolveURL(ctx, "go.brand.com", "sale")
+		if err != nil || url.OriginalURL != "https://example.com/go.brand.com" {
+			t.Errorf("ResolveURL() = %v, %v, want branded link", url, err)
+		}
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		_, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com", Domain: "brnd.link"})
+		if !apperrors.IsValidationError(err) {
+			t.Errorf("CreateShortURL() error = %v, want validation error", err)
+		}
+	})
+
+	t.Run("resolve host header", func(t *testing.T) {
+		tests := []struct {
+			host string
+			want string
+		}{
+			{"go.brand.com", "go.brand.com"},
+			{"GO.BRAND.COM:443", "go.brand.com"},
+			{"sho.rt", ""},
+			{"127.0.0.1:8080", ""},
+			{"unknown.example", ""},
+		}
+
+		for _, tt := range tests {
+			got, err := service.ResolveDomain(ctx, tt.host)
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveDomain(%q) = %q, %v, want %q", tt.host, got, err, tt.want)
+			}
+		}
+
+		// Повторные запросы обслуживаются из кэша
+		lookups := domains.lookups
+		service.ResolveDomain(ctx, "go.brand.com")
+		service.ResolveDomain(ctx, "unknown.example")
+		if domains.lookups != lookups {
+			t.Errorf("ResolveDomain() made %d repository lookups, want cached", domains.lookups-lookups)
+		}
+	})
+
+	t.Run("create domain", func(t *testing.T) {
+		// Незарегистрированный хост уже в кэше - регистрация должна его сбросить
+		if got, _ := service.ResolveDomain(ctx, "brnd.link"); got != "" {
+			t.Fatalf("ResolveDomain() = %q before registration", got)
+		}
+
+		domain, err := service.CreateDomain(ctx, model.DefaultWorkspaceID, &model.CreateDomainRequest{Hostname: "BRND.link"})
+		if err != nil {
+			t.Fatalf("CreateDomain() unexpected error = %v", err)
+		}
+		if domain.Hostname != "brnd.link" {
+			t.Errorf("CreateDomain() Hostname = %s, want brnd.link", domain.Hostname)
+		}
+		if got, _ := service.ResolveDomain(ctx, "brnd.link"); got != "brnd.link" {
+			t.Errorf("ResolveDomain() after registration = %q", got)
+		}
+
+		if _, err := service.CreateDomain(ctx, model.DefaultWorkspaceID, &model.CreateDomainRequest{Hostname: "brnd.link"}); !errors.Is(err, apperrors.ErrDomainExists) {
+			t.Errorf("CreateDomain() duplicate error = %v, want ErrDomainExists", err)
+		}
+		for _, hostname := range []string{"sho.rt", "localhost", "10.0.0.1"} {
+			if _, err := service.CreateDomain(ctx, model.DefaultWorkspaceID, &model.CreateDomainRequest{Hostname: hostname}); !apperrors.IsValidationError(err) {
+				t.Errorf("CreateDomain(%s) error = %v, want validation error", hostname, err)
+			}
+		}
+	})
+}
+
+type mockWorkspaceRepository struct {
+	workspaces map[int64]*model.Workspace
+	lookups    int
+}
+
+func newMockWorkspaceRepository(workspaces ...*model.Workspace) *mockWorkspaceRepository {
+	repo := &mockWorkspaceRepository{workspaces: make(map[int64]*model.Workspace)}
+	repo.Create(context.Background(), &model.Workspace{Name: "default"})
+	for _, workspace := range workspaces {
+		repo.Create(context.Background(), workspace)
+	}
+	return repo
+}
+
+func (m *mockWorkspaceRepository) Create(ctx context.Context, workspace *model.Workspace) error {
+	workspace.ID = int64(len(m.workspaces) + 1)
+	m.workspaces[workspace.ID] = workspace
+	return nil
+}
+
+func (m *mockWorkspaceRepository) GetByID(ctx context.Context, id int64) (*model.Workspace, error) {
+	m.lookups++
+	workspace, exists := m.workspaces[id]
+	if !exists {
+		return nil, apperrors.ErrWorkspaceNotFound
+	}
+	copied := *workspace
+	return &copied, nil
+}
+
+func (m *mockWorkspaceRepository) UpdateQuota(ctx context.Context, id int64, quota model.Quota) error {
+	workspace, exists := m.workspaces[id]
+	if !exists {
+		return apperrors.ErrWorkspaceNotFound
+	}
+	workspace.Quota = quota
+	return nil
+}
+
+func (m *mockWorkspaceRepository) UpdateFallbackURL(ctx context.Context, id int64, fallbackURL string) error {
+	workspace, exists := m.workspaces[id]
+	if !exists {
+		return apperrors.ErrWorkspaceNotFound
+	}
+	workspace.FallbackURL = fallbackURL
+	return nil
+}
+
+func (m *mockWorkspaceRepository) Ban(ctx context.Context, id int64, at time.Time) error {
+	workspace, exists := m.workspaces[id]
+	if !exists {
+		return apperrors.ErrWorkspaceNotFound
+	}
+	if workspace.BannedAt == nil {
+		workspace.BannedAt = &at
+	}
+	return nil
+}
+
+type mockAPIKeyRepository struct {
+	keys []*model.APIKey
+}
+
+func (m *mockAPIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	key.ID = int64(len(m.keys) + 1)
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *mockAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	for _, key := range m.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return nil, apperrors.ErrUnauthorized
+}
+
+func (m *mockAPIKeyRepository) List(ctx context.Context, workspaceID int64) ([]model.APIKey, error) {
+	keys := make([]model.APIKey, 0)
+	for _, key := range m.keys {
+		if key.WorkspaceID == workspaceID {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockAPIKeyRepository) Delete(ctx context.Context, workspaceID, id int64) error {
+	for i, key := range m.keys {
+		if key.ID == id && key.WorkspaceID == workspaceID {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.ErrAPIKeyNotFound
+}
+
+func TestWorkspaceService_APIKeys(t *testing.T) {
+	workspaces := newMockWorkspaceRepository()
+	keys := &mockAPIKeyRepository{}
+	service := NewWorkspaceService(workspaces, keys, newMockURLRepository(), WorkspaceConfig{})
+	ctx := context.Background()
+
+	created, err := service.CreateWorkspace(ctx, &model.CreateWorkspaceRequest{
+		Name:  " Acme ",
+		Quota: model.Quota{Links: 10},
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() unexpected error = %v", err)
+	}
+	if created.Name != "Acme" || created.APIKey.Key == "" {
+		t.Fatalf("CreateWorkspace() = %+v, want trimmed name and API key", created)
+	}
+	if keys.keys[0].KeyHash == created.APIKey.Key {
+		t.Error("CreateWorkspace() stored API key in plain text")
+	}
+
+	workspace, key, err := service.Authenticate(ctx, created.APIKey.Key)
+	if err != nil || workspace.ID != created.ID || key.Role != model.RoleOwner {
+		t.Errorf("Authenticate() = %v, %v, %v, want owner key of workspace %d", workspace, key, err, created.ID)
+	}
+
+	for _, key := range []string{"", "sk_unknown", "not-a-key"} {
+		if _, _, err := service.Authenticate(ctx, key); !errors.Is(err, apperrors.ErrUnauthorized) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrUnauthorized", key, err)
+		}
+	}
+
+	// Ключ другого workspace удалить нельзя
+	if err := service.DeleteAPIKey(ctx, model.DefaultWorkspaceID, created.APIKey.ID); !errors.Is(err, apperrors.ErrAPIKeyNotFound) {
+		t.Errorf("DeleteAPIKey() from other workspace error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := service.DeleteAPIKey(ctx, created.ID, created.APIKey.ID); err != nil {
+		t.Fatalf("DeleteAPIKey() unexpected error = %v", err)
+	}
+	if _, _, err := service.Authenticate(ctx, created.APIKey.Key); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("Authenticate() with revoked key error = %v, want ErrUnauthorized", err)
+	}
+
+	viewer, err := service.CreateAPIKey(ctx, created.ID, &model.CreateAPIKeyRequest{Role: model.RoleViewer})
+	if err != nil || viewer.Role != model.RoleViewer {
+		t.Errorf("CreateAPIKey() viewer = %+v, %v", viewer, err)
+	}
+	if key, _ := service.CreateAPIKey(ctx, created.ID, &model.CreateAPIKeyRequest{}); key.Role != model.RoleEditor {
+		t.Errorf("CreateAPIKey() default Role = %s, want %s", key.Role, model.RoleEditor)
+	}
+	if _, err := service.CreateAPIKey(ctx, created.ID, &model.CreateAPIKeyRequest{Role: "root"}); !apperrors.IsValidationError(err) {
+		t.Errorf("CreateAPIKey() unknown role error = %v, want validation error", err)
+	}
+
+	if _, err := service.CreateWorkspace(ctx, &model.CreateWorkspaceRequest{Name: "x", Quota: model.Quota{Links: -1}}); !apperrors.IsValidationError(err) {
+		t.Errorf("CreateWorkspace() negative quota error = %v, want validation error", err)
+	}
+}
+
+func TestWorkspaceService_Quotas(t *testing.T) {
+	limited := &model.Workspace{Name: "limited", Quota: model.Quota{Links: 2, ClicksPerMonth: 3, APIRequestsPerMonth: 2}}
+	workspaces := newMockWorkspaceRepository(limited)
+	repo := newMockURLRepository()
+	workspaceService := NewWorkspaceService(workspaces, &mockAPIKeyRepository{}, repo, WorkspaceConfig{})
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{Workspaces: workspaceService})
+	ctx := context.Background()
+
+	now := time.Date(2026, time.October, 31, 23, 0, 0, 0, time.UTC)
+	workspaceService.now = func() time.Time { return now }
+
+	t.Run("links", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			response, err := service.CreateShortURL(ctx, limited.ID, &model.CreateURLRequest{URL: "https://example.com"})
+			if err != nil {
+				t.Fatalf("CreateShortURL() #%d unexpected error = %v", i+1, err)
+			}
+			if stored := repo.urls[response.ShortCode]; stored.WorkspaceID != limited.ID {
+				t.Errorf("CreateShortURL() WorkspaceID = %d, want %d", stored.WorkspaceID, limited.ID)
+			}
+		}
+
+		_, err := service.CreateShortURL(ctx, limited.ID, &model.CreateURLRequest{URL: "https://example.com"})
+		var quotaErr *apperrors.QuotaError
+		if !errors.As(err, &quotaErr) || quotaErr.Resource != QuotaLinks || quotaErr.Limit != 2 {
+			t.Errorf("CreateShortURL() over quota error = %v, want links QuotaError", err)
+		}
+
+		// Квота одного workspace не влияет на другие
+		if _, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com"}); err != nil {
+			t.Errorf("CreateShortURL() in default workspace error = %v", err)
+		}
+	})
+
+	t.Run("concurrent creates", func(t *testing.T) {
+		busy := &model.Workspace{Name: "busy", Quota: model.Quota{Links: 3}}
+		if err := workspaces.Create(ctx, busy); err != nil {
+			t.Fatal(err)
+		}
+
+		// Все запросы проходят предварительную проверку до первой вставки,
+		// квоту соблюдает только проверка при вставке
+		gated := &gatedURLRepository{mockURLRepository: repo}
+		gated.arrived.Add(20)
+		service := NewURLServiceWithConfig(gated, "http://localhost:8080", Config{Workspaces: workspaceService})
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		created, rejected := 0, 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := service.CreateShortURL(ctx, busy.ID, &model.CreateURLRequest{URL: "https://example.com"})
+
+				mu.Lock()
+				defer mu.Unlock()
+				var quotaErr *apperrors.QuotaError
+				switch {
+				case err == nil:
+					created++
+				case errors.As(err, &quotaErr) && quotaErr.Resource == QuotaLinks && quotaErr.Limit == 3:
+					rejected++
+				default:
+					t.Errorf("CreateShortURL() unexpected error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if created != 3 || rejected != 17 {
+			t.Errorf("CreateShortURL() created = %d, rejected = %d, want 3 and 17", created, rejected)
+		}
+		if count, _ := repo.CountByWorkspace(ctx, busy.ID); count != 3 {
+			t.Errorf("CountByWorkspace() = %d, want 3", count)
+		}
+	})
+
+	t.Run("isolation", func(t *testing.T) {
+		var code string
+		for shortCode, url := range repo.urls {
+			if url.WorkspaceID == limited.ID {
+				code = shortCode
+			}
+		}
+
+		if _, err := service.GetURL(ctx, model.DefaultWorkspaceID, "", code, ""); !errors.Is(err, apperrors.ErrURLNotFound) {
+			t.Errorf("GetURL() from other workspace error = %v, want ErrURLNotFound", err)
+		}
+		if _, err := service.GetStats(ctx, model.DefaultWorkspaceID, "", code, ""); !errors.Is(err, apperrors.ErrURLNotFound) {
+			t.Errorf("GetStats() from other workspace error = %v, want ErrURLNotFound", err)
+		}
+
+		// Запрос workspace подтвержден API-ключом - токен владельца не нужен
+		if _, err := service.GetStats(ctx, limited.ID, "", code, ""); err != nil {
+			t.Errorf("GetStats() in own workspace error = %v", err)
+		}
+	})
+
+	t.Run("clicks per month", func(t *testing.T) {
+		url := &model.URL{WorkspaceID: limited.ID}
+		for i := 0; i < 3; i++ {
+			if err := service.AdmitClick(ctx, url); err != nil {
+				t.Fatalf("AdmitClick() #%d unexpected error = %v", i+1, err)
+			}
+		}
+		if err := service.AdmitClick(ctx, url); !errors.Is(err, apperrors.ErrQuotaExceeded) {
+			t.Errorf("AdmitClick() over quota error = %v, want ErrQuotaExceeded", err)
+		}
+
+		// Новый месяц - новый счетчик
+		now = now.Add(2 * time.Hour)
+		if err := service.AdmitClick(ctx, url); err != nil {
+			t.Errorf("AdmitClick() in next month error = %v", err)
+		}
+	})
+
+	t.Run("api requests and usage", func(t *testing.T) {
+		workspace, _ := workspaceService.GetWorkspace(ctx, limited.ID)
+		for i := 0; i < 2; i++ {
+			if err := workspaceService.ConsumeAPIRequest(ctx, workspace); err != nil {
+				t.Fatalf("ConsumeAPIRequest() #%d unexpected error = %v", i+1, err)
+			}
+		}
+		if err := workspaceService.ConsumeAPIRequest(ctx, workspace); !errors.Is(err, apperrors.ErrQuotaExceeded) {
+			t.Errorf("ConsumeAPIRequest() over quota error = %v, want ErrQuotaExceeded", err)
+		}
+
+		described, err := workspaceService.DescribeWorkspace(ctx, limited.ID)
+		if err != nil {
+			t.Fatalf("DescribeWorkspace() unexpected error = %v", err)
+		}
+		want := model.Usage{Links: 2, ClicksThisMonth: 1, APIRequestsThisMonth: 3}
+		if described.Usage != want {
+			t.Errorf("DescribeWorkspace() Usage = %+v, want %+v", described.Usage, want)
+		}
+	})
+
+	t.Run("update quota", func(t *testing.T) {
+		updated, err := workspaceService.UpdateQuota(ctx, limited.ID, model.Quota{})
+		if err != nil || updated.Quota != (model.Quota{}) {
+			t.Fatalf("UpdateQuota() = %v, %v", updated, err)
+		}
+
+		// Кэш сброшен: снятая квота действует сразу
+		if _, err := service.CreateShortURL(ctx, limited.ID, &model.CreateURLRequest{URL: "https://example.com"}); err != nil {
+			t.Errorf("CreateShortURL() after removing quota error = %v", err)
+		}
+
+		if _, err := workspaceService.UpdateQuota(ctx, 42, model.Quota{}); !errors.Is(err, apperrors.ErrWorkspaceNotFound) {
+			t.Errorf("UpdateQuota() unknown workspace error = %v, want ErrWorkspaceNotFound", err)
+		}
+	})
+}
+
+type mockAuditRepository struct {
+	entries []model.AuditEntry
+}
+
+func (m *mockAuditRepository) Append(ctx context.Context, entry *model.AuditEntry) error {
+	entry.ID = int64(len(m.entries) + 1)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *mockAuditRepository) List(ctx context.Context, workspaceID int64, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	entries := make([]model.AuditEntry, 0)
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entry := m.entries[i]
+		if entry.WorkspaceID != workspaceID ||
+			(filter.Action != "" && entry.Action != filter.Action) ||
+			(filter.ResourceID != "" && entry.ResourceID != filter.ResourceID) ||
+			(filter.BeforeID > 0 && entry.ID >= filter.BeforeID) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func TestURLService_Lifecycle(t *testing.T) {
+	repo := newMockURLRepository()
+	audit := &mockAuditRepository{}
+	repo.audit = audit
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{Audit: NewAuditLog(audit)})
+	ctx := access.WithRequestInfo(
+		access.WithPrincipal(context.Background(), access.Principal{WorkspaceID: 1, Role: model.RoleEditor, KeyID: 7}),
+		access.RequestInfo{ID: "req-1", IP: "203.0.113.9"},
+	)
+
+	created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	code, token := created.ShortCode, created.OwnerToken
+
+	t.Run("owner token required in default workspace", func(t *testing.T) {
+		if _, err := service.DisableURL(ctx, model.DefaultWorkspaceID, "", code, "wrong"); !errors.Is(err, apperrors.ErrForbidden) {
+			t.Errorf("DisableURL() without owner token error = %v, want ErrForbidden", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		destination := "https://example.org/new"
+		maxClicks := int64(5)
+		updated, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{
+			URL:       &destination,
+			MaxClicks: &maxClicks,
+		})
+		if err != nil {
+			t.Fatalf("UpdateURL() unexpected error = %v", err)
+		}
+		if updated.OriginalURL != destination || updated.MaxClicks != 5 {
+			t.Errorf("UpdateURL() = %+v, want new destination and max_clicks", updated)
+		}
+
+		invalid := "javascript:alert(1)"
+		if _, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{URL: &invalid}); err == nil {
+			t.Error("UpdateURL() with invalid URL expected error")
+		}
+		negative := int64(-1)
+		if _, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{MaxClicks: &negative}); !apperrors.IsValidationError(err) {
+			t.Errorf("UpdateURL() negative max_clicks error = %v, want validation error", err)
+		}
+		if repo.urls[code].OriginalURL != destination {
+			t.Error("UpdateURL() with invalid request changed the link")
+		}
+	})
+
+	t.Run("disable and enable", func(t *testing.T) {
+		if _, err := service.DisableURL(ctx, model.DefaultWorkspaceID, "", code, token); err != nil {
+			t.Fatalf("DisableURL() unexpected error = %v", err)
+		}
+		url, _ := service.ResolveURL(ctx, "", code)
+		if err := service.CheckAvailability(url); !errors.Is(err, apperrors.ErrURLDisabled) {
+			t.Errorf("CheckAvailability() of disabled link error = %v, want ErrURLDisabled", err)
+		}
+
+		// Повторное отключение ничего не меняет и не попадает в журнал
+		entries := len(audit.entries)
+		if _, err := service.DisableURL(ctx, model.DefaultWorkspaceID, "", code, token); err != nil {
+			t.Fatalf("DisableURL() again unexpected error = %v", err)
+		}
+		if len(audit.entries) != entries {
+			t.Error("DisableURL() of disabled link recorded an audit entry")
+		}
+
+		if _, err := service.EnableURL(ctx, model.DefaultWorkspaceID, "", code, token); err != nil {
+			t.Fatalf("EnableURL() unexpected error = %v", err)
+		}
+		url, _ = service.ResolveURL(ctx, "", code)
+		if err := service.CheckAvailability(url); err != nil {
+			t.Errorf("CheckAvailability() of enabled link error = %v", err)
+		}
+	})
+
+	t.Run("delete and restore", func(t *testing.T) {
+		if err := service.DeleteURL(ctx, model.DefaultWorkspaceID, "", code, token); err != nil {
+			t.Fatalf("DeleteURL() unexpected error = %v", err)
+		}
+		if _, err := service.ResolveURL(ctx, "", code); !errors.Is(err, apperrors.ErrURLNotFound) {
+			t.Errorf("ResolveURL() of deleted link error = %v, want ErrURLNotFound", err)
+		}
+		if _, err := service.DisableURL(ctx, model.DefaultWorkspaceID, "", code, token); !errors.Is(err, apperrors.ErrURLNotFound) {
+			t.Errorf("DisableURL() of deleted link error = %v, want ErrURLNotFound", err)
+		}
+
+		restored, err := service.RestoreURL(ctx, model.DefaultWorkspaceID, "", code, token)
+		if err != nil || restored.DeletedAt != nil {
+			t.Fatalf("RestoreURL() = %+v, %v, want restored link", restored, err)
+		}
+		if _, err := service.ResolveURL(ctx, "", code); err != nil {
+			t.Errorf("ResolveURL() of restored link error = %v", err)
+		}
+	})
+
+	t.Run("audit entries", func(t *testing.T) {
+		var actions []string
+		for _, entry := range audit.entries {
+			actions = append(actions, entry.Action)
+			if entry.Actor != "api_key:7" || entry.RequestID != "req-1" || entry.IP != "203.0.113.9" || entry.ResourceID != code {
+				t.Errorf("audit entry = %+v, want actor, request and link of the request", entry)
+			}
+		}
+		want := []string{"create", "update", "disable", "enable", "delete", "restore"}
+		if len(actions) != len(want) {
+			t.Fatalf("audit actions = %v, want %v", actions, want)
+		}
+		for i := range want {
+			if actions[i] != want[i] {
+				t.Fatalf("audit actions = %v, want %v", actions, want)
+			}
+		}
+
+		// В записи изменения только изменившиеся поля
+		update := audit.entries[1]
+		if string(update.Before) != `{"original_url":"https://example.com","version":1}` ||
+			string(update.After) != `{"max_clicks":5,"original_url":"https://example.org/new","version":2}` {
+			t.Errorf("update diff = %s -> %s", update.Before, update.After)
+		}
+		if audit.entries[0].Before != nil || len(audit.entries[0].After) == 0 {
+			t.Errorf("create entry = %s -> %s, want only after", audit.entries[0].Before, audit.entries[0].After)
+		}
+	})
+}
+
+func TestURLService_Versions(t *testing.T) {
+	repo := newMockURLRepository()
+	audit := &mockAuditRepository{}
+	repo.audit = audit
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{Audit: NewAuditLog(audit)})
+	ctx := context.Background()
+
+	created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com/v1"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	code, token := created.ShortCode, created.OwnerToken
+	if created.Version != 1 {
+		t.Errorf("CreateShortURL() Version = %d, want 1", created.Version)
+	}
+
+	for _, destination := range []string{"https://example.com/v2", "https://example.com/v3"} {
+		if _, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{URL: &destination}); err != nil {
+			t.Fatalf("UpdateURL() unexpected error = %v", err)
+		}
+	}
+
+	// Отключение не меняет настройки и не создает ревизию
+	if _, err := service.DisableURL(ctx, model.DefaultWorkspaceID, "", code, token); err != nil {
+		t.Fatalf("DisableURL() unexpected error = %v", err)
+	}
+
+	versions, err := service.ListURLVersions(ctx, model.DefaultWorkspaceID, "", code, token)
+	if err != nil {
+		t.Fatalf("ListURLVersions() unexpected error = %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 3 || versions[2].Settings.OriginalURL != "https://example.com/v1" {
+		t.Fatalf("ListURLVersions() = %+v, want versions 3, 2, 1", versions)
+	}
+	if _, err := service.ListURLVersions(ctx, model.DefaultWorkspaceID, "", code, "wrong"); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("ListURLVersions() without owner token error = %v, want ErrForbidden", err)
+	}
+
+	rolledBack, err := service.RollbackURL(ctx, model.DefaultWorkspaceID, "", code, token, 1)
+	if err != nil {
+		t.Fatalf("RollbackURL() unexpected error = %v", err)
+	}
+	if rolledBack.OriginalURL != "https://example.com/v1" || rolledBack.Version != 4 || rolledBack.DisabledAt == nil {
+		t.Errorf("RollbackURL() = %+v, want v1 destination as version 4, still disabled", rolledBack)
+	}
+
+	// Редирект читает текущую ревизию
+	if destination, _ := service.GetOriginalURL(ctx, "", code); destination != "https://example.com/v1" {
+		t.Errorf("GetOriginalURL() after rollback = %s, want v1 destination", destination)
+	}
+
+	if _, err := service.RollbackURL(ctx, model.DefaultWorkspaceID, "", code, token, 42); !errors.Is(err, apperrors.ErrVersionNotFound) {
+		t.Errorf("RollbackURL() to unknown version error = %v, want ErrVersionNotFound", err)
+	}
+	if _, err := service.RollbackURL(ctx, model.DefaultWorkspaceID, "", code, token, 0); !apperrors.IsValidationError(err) {
+		t.Errorf("RollbackURL() to version 0 error = %v, want validation error", err)
+	}
+
+	last := audit.entries[len(audit.entries)-1]
+	if last.Action != model.AuditRollback || string(last.After) != `{"original_url":"https://example.com/v1","version":4}` {
+		t.Errorf("rollback audit entry = %s %s", last.Action, last.After)
+	}
+
+	t.Run("concurrent update", func(t *testing.T) {
+		// Второй запрос прочитал ссылку до того, как первый ее сохранил
+		stale := *repo.urls[code]
+		racing := NewURLServiceWithConfig(&staleURLRepository{mockURLRepository: repo, stale: &stale}, "http://localhost:8080",
+			Config{Audit: NewAuditLog(audit)})
+
+		first, second := "https://example.com/first", "https://example.com/second"
+		if _, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{URL: &first}); err != nil {
+			t.Fatalf("UpdateURL() unexpected error = %v", err)
+		}
+		entries := len(audit.entries)
+		_, err := racing.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{URL: &second})
+		if !errors.Is(err, apperrors.ErrURLConflict) {
+			t.Fatalf("UpdateURL() from stale read error = %v, want ErrURLConflict", err)
+		}
+
+		// Запись аудита сохраняется вместе с изменением: отклоненное
+		// изменение в журнал не попадает, принятое - всегда
+		if len(audit.entries) != entries {
+			t.Errorf("audit entries after rejected update = %d, want %d", len(audit.entries), entries)
+		}
+		if last := audit.entries[len(audit.entries)-1]; last.Action != model.AuditUpdate || !strings.Contains(string(last.After), first) {
+			t.Errorf("last audit entry = %s %s, want update to %s", last.Action, last.After, first)
+		}
+
+		// История совпадает с действующей ссылкой
+		versions, _ := service.ListURLVersions(ctx, model.DefaultWorkspaceID, "", code, token)
+		current := repo.urls[code]
+		if versions[0].Version != current.Version || versions[0].Settings.OriginalURL != current.OriginalURL || current.OriginalURL != first {
+			t.Errorf("latest version = %+v, link = %d %s, want first writer in both", versions[0], current.Version, current.OriginalURL)
+		}
+	})
+}
+
+// gatedURLRepository задерживает вставки, пока до Create не дойдут все
+// параллельные запросы
+type gatedURLRepository struct {
+	*mockURLRepository
+	arrived sync.WaitGroup
+}
+
+func (r *gatedURLRepository) Create(ctx context.Context, url *model.URL) error {
+	r.arrived.Done()
+	r.arrived.Wait()
+	return r.mockURLRepository.Create(ctx, url)
+}
+
+// staleURLRepository отдает сервису ссылку в состоянии stale, как будто
+// параллельный запрос изменил ее между чтением и записью
+type staleURLRepository struct {
+	*mockURLRepository
+	stale *model.URL
+}
+
+func (r *staleURLRepository) GetForWorkspace(ctx context.Context, workspaceID int64, domain, shortCode string) (*model.URL, error) {
+	copied := *r.stale
+	return &copied, nil
+}
+
+func TestAuditLog_List(t *testing.T) {
+	repo := &mockAuditRepository{}
+	audit := NewAuditLog(repo)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		audit.Record(ctx, model.DefaultWorkspaceID, model.AuditCreate, model.AuditResourceDomain, "go.brand.com", nil, map[string]int{"n": i})
+	}
+	audit.Record(ctx, 2, model.AuditCreate, model.AuditResourceDomain, "other.com", nil, nil)
+
+	if repo.entries[0].Actor != "system" {
+		t.Errorf("Record() outside request Actor = %q, want system", repo.entries[0].Actor)
+	}
+
+	page, err := audit.List(ctx, model.DefaultWorkspaceID, model.AuditFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("List() unexpected error = %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].ID != 5 || page.NextCursor != 4 {
+		t.Fatalf("List() first page = %+v, want entries 5, 4 and cursor 4", page)
+	}
+
+	var ids []int64
+	for cursor := int64(0); ; {
+		page, err := audit.List(ctx, model.DefaultWorkspaceID, model.AuditFilter{Limit: 2, BeforeID: cursor})
+		if err != nil {
+			t.Fatalf("List() unexpected error = %v", err)
+		}
+		for _, entry := range page.Entries {
+			ids = append(ids, entry.ID)
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(ids) != 5 || ids[4] != 1 {
+		t.Errorf("List() pages = %v, want all 5 entries of the workspace", ids)
+	}
+
+	// Решения модерации тоже можно найти в журнале
+	audit.Record(ctx, model.DefaultWorkspaceID, model.AuditSuspend, model.AuditResourceLink, "abc123", nil, nil)
+	audit.Record(ctx, model.DefaultWorkspaceID, model.AuditUnsuspend, model.AuditResourceLink, "abc123", nil, nil)
+	audit.Record(ctx, model.DefaultWorkspaceID, model.AuditBan, model.AuditResourceWorkspace, "1", nil, nil)
+	for _, action := range []string{model.AuditSuspend, model.AuditUnsuspend, model.AuditBan} {
+		page, err := audit.List(ctx, model.DefaultWorkspaceID, model.AuditFilter{Action: action})
+		if err != nil {
+			t.Fatalf("List(action=%s) unexpected error = %v", action, err)
+		}
+		if len(page.Entries) != 1 || page.Entries[0].Action != action {
+			t.Errorf("List(action=%s) = %+v, want one %s entry", action, page.Entries, action)
+		}
+	}
+
+	for _, filter := range []model.AuditFilter{
+		{Action: "drop"},
+		{ResourceType: "user"},
+		{Limit: 1000},
+	} {
+		if _, err := audit.List(ctx, model.DefaultWorkspaceID, filter); !apperrors.IsValidationError(err) {
+			t.Errorf("List(%+v) error = %v, want validation error", filter, err)
+		}
+	}
+}
+
+type mockWebhookRepository struct {
+	mu          sync.Mutex
+	webhooks    []model.Webhook
+	deliveries  []model.WebhookDelivery
+	deadLetters []model.WebhookDelivery
+}
+
+func (m *mockWebhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webhook.ID = int64(len(m.webhooks) + 1)
+	m.webhooks = append(m.webhooks, *webhook)
+	return nil
+}
+
+func (m *mockWebhookRepository) List(ctx context.Context, workspaceID int64) ([]model.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webhooks := make([]model.Webhook, 0)
+	for _, webhook := range m.webhooks {
+		if webhook.WorkspaceID == workspaceID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookRepository) Delete(ctx context.Context, workspaceID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id && webhook.WorkspaceID == workspaceID {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.ErrWebhookNotFound
+}
+
+func (m *mockWebhookRepository) CreateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, *delivery)
+	return nil
+}
+
+func (m *mockWebhookRepository) GetDelivery(ctx context.Context, workspaceID, id int64) (*model.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id && delivery.WorkspaceID == workspaceID {
+			return &delivery, nil
+		}
+	}
+	return nil, apperrors.ErrDeliveryNotFound
+}
+
+func (m *mockWebhookRepository) ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := make([]model.WebhookDelivery, 0)
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID && m.deliveries[i].WorkspaceID == workspaceID {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := make([]model.WebhookDelivery, 0)
+	for i := range m.deliveries {
+		delivery := &m.deliveries[i]
+		if delivery.Status != model.DeliveryPending || delivery.NextAttemptAt.After(now) || len(deliveries) == limit {
+			continue
+		}
+		for _, webhook := range m.webhooks {
+			if webhook.ID == delivery.WebhookID {
+				delivery.Target = &webhook
+			}
+		}
+		lease := leaseUntil
+		delivery.NextAttemptAt = &lease
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookRepository) SaveAttempt(ctx context.Context, delivery *model.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[delivery.ID-1] = *delivery
+	if delivery.Status == model.DeliveryDead {
+		m.deadLetters = append(m.deadLetters, *delivery)
+	}
+	return nil
+}
+
+// webhookReceiver - получатель webhooks, отвечающий статусом status
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func TestWebhookService_Delivery(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := &mockWebhookRepository{}
+	webhooks := newLocalWebhookService(repo, server, WebhookConfig{})
+	urls := NewURLServiceWithConfig(newMockURLRepository(), "http://localhost:8080", Config{Webhooks: webhooks})
+	ctx := context.Background()
+
+	created, err := webhooks.CreateWebhook(ctx, model.DefaultWorkspaceID, &model.CreateWebhookRequest{
+		URL:    server.URL + "/hooks",
+		Events: []string{model.EventLinkCreated, model.EventLinkCreated},
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook() unexpected error = %v", err)
+	}
+	if len(created.Secret) < len("whsec_")+16 || len(created.Events) != 1 {
+		t.Fatalf("CreateWebhook() = %+v, want generated secret and deduplicated events", created)
+	}
+
+	link, err := urls.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	url, _ := urls.ResolveURL(ctx, "", link.ShortCode)
+	if err := urls.TrackClick(ctx, model.NewClickEvent(url, &model.Visit{}, time.Now())); err != nil {
+		t.Fatalf("TrackClick() unexpected error = %v", err)
+	}
+
+	// Подписка только на link.created: переход в очередь не попадает
+	if len(repo.deliveries) != 1 || repo.deliveries[0].Event != model.EventLinkCreated {
+		t.Fatalf("deliveries = %+v, want one link.created", repo.deliveries)
+	}
+
+	sent, err := webhooks.DeliverDue(ctx)
+	if err != nil || sent != 1 {
+		t.Fatalf("DeliverDue() = %d, %v, want 1 attempt", sent, err)
+	}
+	if repo.deliveries[0].Status != model.DeliveryDelivered || repo.deliveries[0].ResponseStatus != http.StatusOK {
+		t.Errorf("delivery = %+v, want delivered", repo.deliveries[0])
+	}
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	timestamp, _ := strconv.ParseInt(req.Header.Get(WebhookTimestampHeader), 10, 64)
+	want := "sha256=" + utils.SignWebhook(created.Secret, timestamp, body)
+	if got := req.Header.Get(WebhookSignatureHeader); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if req.URL.Path != "/hooks" || req.Header.Get(WebhookEventHeader) != model.EventLinkCreated {
+		t.Errorf("request %s with event %q", req.URL.Path, req.Header.Get(WebhookEventHeader))
+	}
+
+	var event model.WebhookEvent
+	var data model.URLResponse
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil || data.ShortCode != link.ShortCode || data.OwnerToken != "" {
+		t.Errorf("payload data = %s, want link without owner token", event.Data)
+	}
+
+	if sent, _ := webhooks.DeliverDue(ctx); sent != 0 {
+		t.Errorf("DeliverDue() repeated = %d, want 0", sent)
+	}
+}
+
+func TestWebhookService_Retries(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := &mockWebhookRepository{}
+	webhooks := newLocalWebhookService(repo, server, WebhookConfig{MaxAttempts: 3, BaseBackoff: time.Second})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	webhooks.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	webhook, err := webhooks.CreateWebhook(ctx, model.DefaultWorkspaceID, &model.CreateWebhookRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("CreateWebhook() unexpected error = %v", err)
+	}
+	webhooks.Publish(ctx, model.DefaultWorkspaceID, model.EventLinkClicked, map[string]string{"short_code": "abc"})
+
+	// Пауза удваивается после каждой неудачной попытки
+	for attempt, backoff := range []time.Duration{time.Second, 2 * time.Second} {
+		if sent, _ := webhooks.DeliverDue(ctx); sent != 1 {
+			t.Fatalf("attempt %d: DeliverDue() = %d, want 1", attempt+1, sent)
+		}
+		delivery := repo.deliveries[0]
+		if delivery.Status != model.DeliveryPending || !delivery.NextAttemptAt.Equal(now.Add(backoff)) {
+			t.Fatalf("attempt %d: delivery = %+v, want retry in %s", attempt+1, delivery, backoff)
+		}
+		if sent, _ := webhooks.DeliverDue(ctx); sent != 0 {
+			t.Fatalf("attempt %d: DeliverDue() before backoff = %d, want 0", attempt+1, sent)
+		}
+		now = now.Add(backoff)
+	}
+
+	webhooks.DeliverDue(ctx)
+	if repo.deliveries[0].Status != model.DeliveryDead || len(repo.deadLetters) != 1 {
+		t.Fatalf("delivery = %+v, want dead letter after 3 attempts", repo.deliveries[0])
+	}
+	if repo.deliveries[0].LastError == "" || repo.deliveries[0].ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("delivery = %+v, want last error and response status", repo.deliveries[0])
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		receiver.status = http.StatusNoContent
+		replay, err := webhooks.ReplayDelivery(ctx, model.DefaultWorkspaceID, webhook.ID, repo.deliveries[0].ID)
+		if err != nil {
+			t.Fatalf("ReplayDelivery() unexpected error = %v", err)
+		}
+		webhooks.DeliverDue(ctx)
+
+		deliveries, err := webhooks.ListDeliveries(ctx, model.DefaultWorkspaceID, webhook.ID, 0)
+		if err != nil {
+			t.Fatalf("ListDeliveries() unexpected error = %v", err)
+		}
+		if len(deliveries) != 2 || deliveries[0].ID != replay.ID || deliveries[0].Status != model.DeliveryDelivered {
+			t.Fatalf("ListDeliveries() = %+v, want delivered replay first", deliveries)
+		}
+		if string(deliveries[0].Payload) != string(deliveries[1].Payload) {
+			t.Error("replay should send the original payload")
+		}
+	})
+
+	t.Run("other webhook", func(t *testing.T) {
+		_, err := webhooks.ReplayDelivery(ctx, model.DefaultWorkspaceID, webhook.ID+1, repo.deliveries[0].ID)
+		if !errors.Is(err, apperrors.ErrDeliveryNotFound) {
+			t.Errorf("ReplayDelivery() error = %v, want ErrDeliveryNotFound", err)
+		}
+		if _, err := webhooks.ListDeliveries(ctx, 2, webhook.ID, 0); !errors.Is(err, apperrors.ErrWebhookNotFound) {
+			t.Errorf("ListDeliveries() other workspace error = %v, want ErrWebhookNotFound", err)
+		}
+	})
+}
+
+// newLocalWebhookService создает сервис, которому разрешено доставлять
+// события тестовому получателю server на loopback-адресе
+func newLocalWebhookService(repo *mockWebhookRepository, server *httptest.Server, cfg WebhookConfig) *WebhookService {
+	cfg.Client = server.Client()
+	webhooks := NewWebhookService(repo, cfg)
+	webhooks.checkHost = func(ctx context.Context, host string) error { return nil }
+	return webhooks
+}
+
+func TestWebhookService_InternalTargets(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := &mockWebhookRepository{}
+	webhooks := NewWebhookService(repo, WebhookConfig{})
+	ctx := context.Background()
+
+	for _, target := range []string{
+		server.URL,
+		"http://169.254.169.254/latest/meta-data",
+		"http://localhost:9200/_cat/indices",
+		"http://10.0.0.5/hooks",
+		"http://[::1]:8080/hooks",
+	} {
+		_, err := webhooks.CreateWebhook(ctx, model.DefaultWorkspaceID, &model.CreateWebhookRequest{URL: target})
+		if !apperrors.IsValidationError(err) || apperrors.GetValidationError(err).Field != "url" {
+			t.Errorf("CreateWebhook(%s) error = %v, want url validation error", target, err)
+		}
+	}
+
+	// Имя могли перенаправить на внутренний адрес после создания подписки:
+	// клиент по умолчанию все равно не подключится
+	webhooks.checkHost = func(ctx context.Context, host string) error { return nil }
+	if _, err := webhooks.CreateWebhook(ctx, model.DefaultWorkspaceID, &model.CreateWebhookRequest{URL: server.URL}); err != nil {
+		t.Fatalf("CreateWebhook() unexpected error = %v", err)
+	}
+	webhooks.Publish(ctx, model.DefaultWorkspaceID, model.EventLinkClicked, map[string]string{"short_code": "abc"})
+	webhooks.DeliverDue(ctx)
+
+	delivery := repo.deliveries[0]
+	if len(receiver.requests) != 0 || delivery.Status == model.DeliveryDelivered || delivery.ResponseStatus != 0 {
+		t.Errorf("delivery = %+v, %d requests received, want refused connection", delivery, len(receiver.requests))
+	}
+	if !strings.Contains(delivery.LastError, "not public") {
+		t.Errorf("delivery LastError = %q, want forbidden address", delivery.LastError)
+	}
+}
+
+func TestWebhookService_CreateWebhook_Validation(t *testing.T) {
+	webhooks := NewWebhookService(&mockWebhookRepository{}, WebhookConfig{})
+	// Проверяются поля запроса, а не разрешение имени
+	webhooks.checkHost = func(ctx context.Context, host string) error { return nil }
+
+	tests := []*model.CreateWebhookRequest{
+		{URL: "ftp://example.com"},
+		{URL: "https://example.com", Events: []string{"link.renamed"}},
+		{URL: "https://example.com", Secret: strings.Repeat("s", 200)},
+	}
+	for _, req := range tests {
+		if _, err := webhooks.CreateWebhook(context.Background(), model.DefaultWorkspaceID, req); !apperrors.IsValidationError(err) {
+			t.Errorf("CreateWebhook(%+v) error = %v, want validation error", req, err)
+		}
+	}
+}
+
+// mockOutboxRepository хранит события outbox в памяти
+type mockOutboxRepository struct {
+	events []model.OutboxEvent
+}
+
+func (m *mockOutboxRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	var claimed []model.OutboxEvent
+	for i := range m.events {
+		event := &m.events[i]
+		if event.PublishedAt != nil || event.NextAttemptAt.After(now) || len(claimed) == limit {
+			continue
+		}
+		event.NextAttemptAt = leaseUntil
+		claimed = append(claimed, *event)
+	}
+	return claimed, nil
+}
+
+func (m *mockOutboxRepository) MarkPublished(ctx context.Context, ids []int64, publishedAt time.Time) error {
+	for i := range m.events {
+		if slices.Contains(ids, m.events[i].ID) {
+			m.events[i].Attempts++
+			m.events[i].PublishedAt = &publishedAt
+		}
+	}
+	return nil
+}
+
+func (m *mockOutboxRepository) SaveFailure(ctx context.Context, event *model.OutboxEvent) error {
+	for i := range m.events {
+		if m.events[i].ID == event.ID {
+			m.events[i] = *event
+		}
+	}
+	return nil
+}
+
+func (m *mockOutboxRepository) PurgePublished(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// recordingSink запоминает опубликованные события и может отказывать
+type recordingSink struct {
+	events []model.OutboxEvent
+	err    error
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func TestOutboxRelay(t *testing.T) {
+	urlRepo := newMockURLRepository()
+	urls := NewURLService(urlRepo, "http://localhost:8080")
+	ctx := context.Background()
+
+	link, err := urls.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	url, _ := urls.ResolveURL(ctx, "", link.ShortCode)
+	if err := urls.TrackClick(ctx, model.NewClickEvent(url, &model.Visit{}, time.Now())); err != nil {
+		t.Fatalf("TrackClick() unexpected error = %v", err)
+	}
+
+	// Событие создания собирается после записи ссылки и содержит ее ID
+	if len(urlRepo.outbox) != 2 || urlRepo.outbox[0].Type != model.EventLinkCreated || urlRepo.outbox[1].Type != model.EventLinkClicked {
+		t.Fatalf("outbox = %+v, want link.created and link.clicked", urlRepo.outbox)
+	}
+	var envelope model.WebhookEvent
+	var data model.URLResponse
+	if err := json.Unmarshal(urlRepo.outbox[0].Payload, &envelope); err != nil || envelope.ID != urlRepo.outbox[0].EventID {
+		t.Fatalf("payload = %s, want envelope with event ID", urlRepo.outbox[0].Payload)
+	}
+	if err := json.Unmarshal(envelope.Data, &data); err != nil || data.ID != url.ID || data.OwnerToken != "" {
+		t.Errorf("payload data = %s, want link ID without owner token", envelope.Data)
+	}
+
+	repo := &mockOutboxRepository{events: urlRepo.outbox}
+	sink := &recordingSink{err: errors.New("unavailable")}
+	relay := NewOutboxRelay(repo, []EventSink{sink}, OutboxConfig{BaseBackoff: time.Second})
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	relay.now = func() time.Time { return now }
+
+	// Отказ приемника: пачка откладывается и не считается опубликованной
+	if _, err := relay.PublishDue(ctx); err == nil {
+		t.Fatal("PublishDue() expected error from sink")
+	}
+	if event := repo.events[0]; event.Attempts != 1 || event.PublishedAt != nil || !event.NextAttemptAt.Equal(now.Add(time.Second)) || event.LastError == "" {
+		t.Fatalf("event = %+v, want retry in 1s", event)
+	}
+	if published, _ := relay.PublishDue(ctx); published != 0 {
+		t.Fatalf("PublishDue() before backoff = %d, want 0", published)
+	}
+
+	sink.err = nil
+	now = now.Add(time.Second)
+	if published, err := relay.PublishDue(ctx); err != nil || published != 2 {
+		t.Fatalf("PublishDue() = %d, %v, want 2", published, err)
+	}
+	if len(sink.events) != 2 || sink.events[0].EventID != urlRepo.outbox[0].EventID || repo.events[1].PublishedAt == nil {
+		t.Errorf("sink received %+v, want both events in order", sink.events)
+	}
+	if published, _ := relay.PublishDue(ctx); published != 0 {
+		t.Errorf("PublishDue() repeated = %d, want 0", published)
+	}
+}
+
+// signalingPubSub сообщает о подписке LiveClicks.Run на канал
+type signalingPubSub struct {
+	*cache.MemoryPubSub
+	subscribed chan struct{}
+}
+
+func (p *signalingPubSub) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	messages, err := p.MemoryPubSub.Subscribe(ctx, channel)
+	close(p.subscribed)
+	return messages, err
+}
+
+func TestURLService_WatchClicks(t *testing.T) {
+	pubsub := &signalingPubSub{MemoryPubSub: cache.NewMemoryPubSub(), subscribed: make(chan struct{})}
+	live := NewLiveClicks(pubsub, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go live.Run(ctx)
+	<-pubsub.subscribed
+
+	urls := NewURLServiceWithConfig(newMockURLRepository(), "http://localhost:8080", Config{LiveClicks: live})
+	first, _ := urls.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com/a"})
+	second, _ := urls.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com/b"})
+
+	if _, _, err := urls.WatchClicks(ctx, model.DefaultWorkspaceID, "", first.ShortCode, ""); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Fatalf("WatchClicks() without owner token error = %v, want ErrForbidden", err)
+	}
+
+	linkClicks, stopLink, err := urls.WatchClicks(ctx, model.DefaultWorkspaceID, "", first.ShortCode, first.OwnerToken)
+	if err != nil {
+		t.Fatalf("WatchClicks() unexpected error = %v", err)
+	}
+	defer stopLink()
+	workspaceClicks, stopWorkspace, _ := urls.WatchWorkspaceClicks(ctx, model.DefaultWorkspaceID)
+	defer stopWorkspace()
+	otherClicks, stopOther, _ := urls.WatchWorkspaceClicks(ctx, 2)
+	defer stopOther()
+
+	for _, link := range []*model.URLResponse{second, first} {
+		url, _ := urls.ResolveURL(ctx, "", link.ShortCode)
+		if err := urls.TrackClick(ctx, model.NewClickEvent(url, &model.Visit{Location: model.Location{Country: "DE"}}, time.Now())); err != nil {
+			t.Fatalf("TrackClick() unexpected error = %v", err)
+		}
+	}
+
+	receive := func(clicks <-chan model.ClickEvent) model.ClickEvent {
+		t.Helper()
+		select {
+		case click := <-clicks:
+			return click
+		case <-time.After(time.Second):
+			t.Fatal("no live click received")
+			return model.ClickEvent{}
+		}
+	}
+
+	// Поток ссылки получает только ее переходы, поток workspace - все
+	if click := receive(linkClicks); click.ShortCode != first.ShortCode || click.Country != "DE" {
+		t.Errorf("link stream click = %+v, want %s", click, first.ShortCode)
+	}
+	if a, b := receive(workspaceClicks), receive(workspaceClicks); a.ShortCode != second.ShortCode || b.ShortCode != first.ShortCode {
+		t.Errorf("workspace stream clicks = %s, %s, want both links in order", a.ShortCode, b.ShortCode)
+	}
+	select {
+	case click := <-otherClicks:
+		t.Errorf("other workspace received click %+v", click)
+	default:
+	}
+
+	// Остановка рассылки закрывает потоки
+	cancel()
+	select {
+	case _, ok := <-linkClicks:
+		if ok {
+			t.Error("link stream received unexpected click after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Error("link stream was not closed on shutdown")
+	}
+}
+
+// previewServer отдает страницы для загрузки карточек
+func previewServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<!DOCTYPE html><html><head>
+			<title>Fallback title</title>
+			<meta name="description" content="Plain description">
+			<meta property="og:title" content="  Launch   day ">
+			<meta property="og:description" content="Everything about the launch">
+			<meta property="og:image" content="/images/cover.png">
+			</head><body><meta property="og:title" content="Body tag is ignored"></body></html>`)
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><head><title>Plain &amp; simple</title>
+			<meta name="description" content="Only standard tags">
+			<meta name="twitter:image" content="javascript:alert(1)"></head></html>`)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><head><!--"+strings.Repeat("x", 4096)+"--><title>Too far</title></head></html>")
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, "%PDF-1.4")
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLinkPreviews_Fetch(t *testing.T) {
+	server := previewServer(t)
+	previews := NewLinkPreviews(newMockURLRepository(), PreviewConfig{Client: server.Client(), MaxBytes: 1024})
+	ctx := context.Background()
+
+	tests := []struct {
+		path string
+		want model.URLMetadata
+	}{
+		{"/article", model.URLMetadata{
+			Title:       "Launch day",
+			Description: "Everything about the launch",
+			ImageURL:    server.URL + "/images/cover.png",
+		}},
+		{"/plain", model.URLMetadata{Title: "Plain & simple", Description: "Only standard tags"}},
+		// Теги за пределами MaxBytes не читаются
+		{"/large", model.URLMetadata{}},
+		{"/file.pdf", model.URLMetadata{}},
+	}
+
+	for _, tt := range tests {
+		metadata, err := previews.Fetch(ctx, server.URL+tt.path)
+		if err != nil {
+			t.Fatalf("Fetch(%s) unexpected error = %v", tt.path, err)
+		}
+		if *metadata != tt.want {
+			t.Errorf("Fetch(%s) = %+v, want %+v", tt.path, *metadata, tt.want)
+		}
+	}
+
+	if _, err := previews.Fetch(ctx, server.URL+"/missing"); err == nil {
+		t.Error("Fetch() expected error for 404 page")
+	}
+
+	// Клиент по умолчанию не ходит на внутренние адреса
+	guarded := NewLinkPreviews(newMockURLRepository(), PreviewConfig{})
+	if _, err := guarded.Fetch(ctx, server.URL+"/article"); !errors.Is(err, safehttp.ErrForbiddenAddress) {
+		t.Errorf("Fetch() loopback error = %v, want ErrForbiddenAddress", err)
+	}
+}
+
+func TestURLService_LinkPreviews(t *testing.T) {
+	server := previewServer(t)
+	repo := newMockURLRepository()
+	previews := NewLinkPreviews(repo, PreviewConfig{Client: server.Client()})
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{Previews: previews})
+	ctx := context.Background()
+
+	// Очередь разбирается синхронно, без Run
+	drain := func() {
+		t.Helper()
+		select {
+		case job := <-previews.queue:
+			previews.refresh(ctx, &job)
+		default:
+			t.Fatal("link was not queued for preview")
+		}
+	}
+
+	created, err := service.CreateShortURL(ctx, 2, &model.CreateURLRequest{URL: server.URL + "/article"})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	drain()
+
+	response, _ := service.GetURL(ctx, 2, "", created.ShortCode, "")
+	if response.Title != "Launch day" || response.ImageURL == "" {
+		t.Errorf("GetURL() metadata = %+v, want fetched card", response.URLMetadata)
+	}
+
+	// Карточка старого назначения не перезаписывает карточку нового
+	stale := model.URL{ID: response.ID, OriginalURL: server.URL + "/plain", URLMetadata: model.URLMetadata{Title: "Stale"}}
+	if updated, _ := repo.UpdateMetadata(ctx, &stale); updated {
+		t.Error("UpdateMetadata() saved metadata for a stale destination")
+	}
+
+	destination := server.URL + "/plain"
+	if _, err := service.UpdateURL(ctx, 2, "", created.ShortCode, "", &model.UpdateURLRequest{URL: &destination}); err != nil {
+		t.Fatalf("UpdateURL() unexpected error = %v", err)
+	}
+	drain()
+
+	response, _ = service.GetURL(ctx, 2, "", created.ShortCode, "")
+	if response.Title != "Plain & simple" {
+		t.Errorf("GetURL() Title after update = %q, want Plain & simple", response.Title)
+	}
+
+	// Карточка защищенной ссылки раскрывает назначение и скрыта от посторонних
+	locked, _ := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: server.URL + "/article", Password: "secret123"})
+	drain()
+	if public, _ := service.GetPublicURL(ctx, "", locked.ShortCode); public.Title != "" {
+		t.Errorf("GetPublicURL() Title = %q, want hidden", public.Title)
+	}
+
+	// Deep link приложения не загружается
+	if _, err := service.CreateShortURL(ctx, 2, &model.CreateURLRequest{URL: "tg://resolve?domain=example", RedirectType: model.RedirectMetaRefresh}); err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	if len(previews.queue) != 0 {
+		t.Error("app link was queued for preview")
+	}
+}
+
+func TestURLService_SocialPreview(t *testing.T) {
+	service := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	ctx := context.Background()
+
+	created, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{
+		URL:           "https://example.com/launch",
+		SocialPreview: &model.URLMetadata{Title: "  Launch day  ", ImageURL: "https://cdn.example.com/launch.png"},
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	if created.SocialPreview.Title != "Launch day" || created.SocialPreview.ImageURL == "" {
+		t.Errorf("CreateShortURL() SocialPreview = %+v, want trimmed card", created.SocialPreview)
+	}
+	code, token := created.ShortCode, created.OwnerToken
+
+	invalid := []*model.URLMetadata{
+		{ImageURL: "javascript:alert(1)"},
+		{ImageURL: "/relative.png"},
+		{Title: strings.Repeat("т", maxPreviewTitleLength+1)},
+		{Description: strings.Repeat("d", maxPreviewDescriptionLength+1)},
+	}
+	for _, preview := range invalid {
+		if _, err := service.CreateShortURL(ctx, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com", SocialPreview: preview}); !apperrors.IsValidationError(err) {
+			t.Errorf("CreateShortURL(%+v) error = %v, want validation error", preview, err)
+		}
+	}
+
+	updated, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{
+		SocialPreview: &model.URLMetadata{Description: "Join us"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateURL() unexpected error = %v", err)
+	}
+	if updated.SocialPreview != (model.URLMetadata{Description: "Join us"}) || updated.Version != 2 {
+		t.Errorf("UpdateURL() = %+v, want replaced card as version 2", updated.SocialPreview)
+	}
+
+	// Карточка - часть настроек ссылки и возвращается откатом
+	rolledBack, err := service.RollbackURL(ctx, model.DefaultWorkspaceID, "", code, token, 1)
+	if err != nil {
+		t.Fatalf("RollbackURL() unexpected error = %v", err)
+	}
+	if rolledBack.SocialPreview.Title != "Launch day" {
+		t.Errorf("RollbackURL() SocialPreview = %+v, want version 1 card", rolledBack.SocialPreview)
+	}
+
+	cleared, err := service.UpdateURL(ctx, model.DefaultWorkspaceID, "", code, token, &model.UpdateURLRequest{SocialPreview: &model.URLMetadata{}})
+	if err != nil {
+		t.Fatalf("UpdateURL() unexpected error = %v", err)
+	}
+	if !cleared.SocialPreview.IsZero() {
+		t.Errorf("UpdateURL() SocialPreview = %+v, want cleared", cleared.SocialPreview)
+	}
+}
+
+func TestURLService_Fallback(t *testing.T) {
+	acme := &model.Workspace{Name: "acme"}
+	workspaces := newMockWorkspaceRepository(acme)
+	repo := newMockURLRepository()
+	workspaceService := NewWorkspaceService(workspaces, &mockAPIKeyRepository{}, repo, WorkspaceConfig{})
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{Workspaces: workspaceService})
+	ctx := context.Background()
+
+	for _, fallback := range []string{"javascript:alert(1)", "/relative", "not a url"} {
+		_, err := service.CreateShortURL(ctx, acme.ID, &model.CreateURLRequest{URL: "https://example.com", FallbackURL: fallback})
+		if !apperrors.IsValidationError(err) || apperrors.GetValidationError(err).Field != "fallback_url" {
+			t.Errorf("CreateShortURL(fallback %q) error = %v, want fallback_url validation error", fallback, err)
+		}
+	}
+
+	created, err := service.CreateShortURL(ctx, acme.ID, &model.CreateURLRequest{
+		URL:         "https://example.com/sale",
+		FallbackURL: "  https://example.com/sale-over  ",
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+	if created.FallbackURL != "https://example.com/sale-over" {
+		t.Errorf("CreateShortURL() FallbackURL = %q, want trimmed URL", created.FallbackURL)
+	}
+	stored := repo.urls[created.ShortCode]
+	if got := service.FallbackFor(ctx, stored); got != "https://example.com/sale-over" {
+		t.Errorf("FallbackFor() = %q, want link fallback", got)
+	}
+
+	// Запасное назначение workspace действует, пока у ссылки нет своего
+	fallback := "https://example.com/gone"
+	updated, err := workspaceService.UpdateWorkspace(ctx, acme.ID, &model.UpdateWorkspaceRequest{FallbackURL: &fallback})
+	if err != nil || updated.FallbackURL != fallback {
+		t.Fatalf("UpdateWorkspace() = %+v, %v", updated, err)
+	}
+	invalid := "ftp://example.com"
+	if _, err := workspaceService.UpdateWorkspace(ctx, acme.ID, &model.UpdateWorkspaceRequest{FallbackURL: &invalid}); !apperrors.IsValidationError(err) {
+		t.Errorf("UpdateWorkspace(%q) error = %v, want validation error", invalid, err)
+	}
+
+	cleared := ""
+	response, err := service.UpdateURL(ctx, acme.ID, "", created.ShortCode, "", &model.UpdateURLRequest{FallbackURL: &cleared})
+	if err != nil {
+		t.Fatalf("UpdateURL() unexpected error = %v", err)
+	}
+	if response.FallbackURL != "" || response.Version != 2 {
+		t.Errorf("UpdateURL() FallbackURL = %q, version %d, want cleared as version 2", response.FallbackURL, response.Version)
+	}
+	if got := service.FallbackFor(ctx, repo.urls[created.ShortCode]); got != fallback {
+		t.Errorf("FallbackFor() = %q, want workspace fallback %q", got, fallback)
+	}
+
+	// Без сервиса workspaces остается только запасное назначение ссылки
+	standalone := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	if got := standalone.FallbackFor(ctx, &model.URL{WorkspaceID: acme.ID}); got != "" {
+		t.Errorf("FallbackFor() without workspaces = %q, want empty", got)
+	}
+}
+
+type mockModerationRepository struct {
+	reports []model.AbuseReport
+	banned  map[string]bool
+}
+
+func newMockModerationRepository() *mockModerationRepository {
+	return &mockModerationRepository{banned: make(map[string]bool)}
+}
+
+// CreateReport повторяет уникальный индекс открытых жалоб отправителя
+func (m *mockModerationRepository) CreateReport(ctx context.Context, report *model.AbuseReport) (bool, error) {
+	for _, existing := range m.reports {
+		if existing.URLID == report.URLID && existing.ReporterHash == report.ReporterHash && existing.Status == model.ReportOpen {
+			return false, nil
+		}
+	}
+	report.ID = int64(len(m.reports) + 1)
+	m.reports = append(m.reports, *report)
+	return true, nil
+}
+
+func (m *mockModerationRepository) Queue(ctx context.Context, limit int) ([]model.ReportSummary, error) {
+	byURL := make(map[int64]*model.ReportSummary)
+	var order []int64
+	for _, report := range m.reports {
+		if report.Status != model.ReportOpen {
+			continue
+		}
+		summary, exists := byURL[report.URLID]
+		if !exists {
+			summary = &model.ReportSummary{URLID: report.URLID, Reasons: make(map[string]int64), FirstReportedAt: report.CreatedAt}
+			byURL[report.URLID] = summary
+			order = append(order, report.URLID)
+		}
+		summary.OpenReports++
+		summary.Reasons[report.Reason]++
+		summary.LastReportedAt = report.CreatedAt
+	}
+
+	summaries := make([]model.ReportSummary, 0, len(order))
+	for _, urlID := range order {
+		summaries = append(summaries, *byURL[urlID])
+	}
+	slices.SortStableFunc(summaries, func(a, b model.ReportSummary) int {
+		return int(b.OpenReports - a.OpenReports)
+	})
+	return summaries[:min(limit, len(summaries))], nil
+}
+
+func (m *mockModerationRepository) ListReports(ctx context.Context, urlID int64, limit int) ([]model.AbuseReport, error) {
+	reports := make([]model.AbuseReport, 0)
+	for i := len(m.reports) - 1; i >= 0 && len(reports) < limit; i-- {
+		if m.reports[i].URLID == urlID {
+			reports = append(reports, m.reports[i])
+		}
+	}
+	return reports, nil
+}
+
+func (m *mockModerationRepository) ResolveReports(ctx context.Context, urlID int64, status string, at time.Time) (int64, error) {
+	var resolved int64
+	for i := range m.reports {
+		if m.reports[i].URLID == urlID && m.reports[i].Status == model.ReportOpen {
+			m.reports[i].Status = status
+			m.reports[i].ResolvedAt = &at
+			resolved++
+		}
+	}
+	return resolved, nil
+}
+
+func (m *mockModerationRepository) BanCreator(ctx context.Context, creatorHash, reason string, at time.Time) error {
+	m.banned[creatorHash] = true
+	return nil
+}
+
+func (m *mockModerationRepository) IsCreatorBanned(ctx context.Context, creatorHash string) (bool, error) {
+	return m.banned[creatorHash], nil
+}
+
+func TestURLService_Moderation(t *testing.T) {
+	workspaces := newMockWorkspaceRepository()
+	repo := newMockURLRepository()
+	moderation := newMockModerationRepository()
+	audit := &mockAuditRepository{}
+	repo.audit = audit
+	workspaceService := NewWorkspaceService(workspaces, &mockAPIKeyRepository{}, repo, WorkspaceConfig{})
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{
+		Workspaces: workspaceService,
+		Moderation: moderation,
+		Audit:      NewAuditLog(audit),
+	})
+	visitor := func(ip string) context.Context {
+		return access.WithRequestInfo(context.Background(), access.RequestInfo{ID: "req-" + ip, IP: ip})
+	}
+	spammer, other := visitor("203.0.113.7"), visitor("198.51.100.4")
+
+	acme, err := workspaceService.CreateWorkspace(context.Background(), &model.CreateWorkspaceRequest{Name: "acme"})
+	if err != nil {
+		t.Fatalf("CreateWorkspace() unexpected error = %v", err)
+	}
+	create := func(ctx context.Context, workspaceID int64, destination string) *model.URLResponse {
+		t.Helper()
+		created, err := service.CreateShortURL(ctx, workspaceID, &model.CreateURLRequest{URL: destination})
+		if err != nil {
+			t.Fatalf("CreateShortURL(%s) unexpected error = %v", destination, err)
+		}
+		return created
+	}
+	phishing := create(spammer, model.DefaultWorkspaceID, "https://example.com/login")
+	sibling := create(spammer, model.DefaultWorkspaceID, "https://example.com/prize")
+	innocent := create(other, model.DefaultWorkspaceID, "https://example.org")
+	corporate := create(context.Background(), acme.Workspace.ID, "https://example.net/offer")
+	corporateSibling := create(context.Background(), acme.Workspace.ID, "https://example.net/other")
+	stored := func(code string) *model.URL { return repo.urls[code] }
+
+	if stored(phishing.ShortCode).CreatorHash == "" || stored(phishing.ShortCode).CreatorHash == stored(innocent.ShortCode).CreatorHash {
+		t.Fatal("CreateShortURL() should record distinct creator hashes for anonymous links")
+	}
+	if stored(corporate.ShortCode).CreatorHash != "" {
+		t.Error("CreateShortURL() should not record creator hash for workspace links")
+	}
+
+	t.Run("report", func(t *testing.T) {
+		for _, req := range []model.CreateReportRequest{
+			{Reason: "ugly"},
+			{Reason: model.ReportSpam, Details: strings.Repeat("x", maxReportDetailsLength+1)},
+		} {
+			if err := service.ReportURL(other, "", phishing.ShortCode, &req); !apperrors.IsValidationError(err) {
+				t.Errorf("ReportURL(%+v) error = %v, want validation error", req, err)
+			}
+		}
+		if err := service.ReportURL(other, "", "missing", &model.CreateReportRequest{Reason: model.ReportSpam}); !errors.Is(err, apperrors.ErrURLNotFound) {
+			t.Errorf("ReportURL(missing) error = %v, want ErrURLNotFound", err)
+		}
+
+		// Повторная жалоба того же посетителя не удваивает счетчик
+		for _, ctx := range []context.Context{other, other, visitor("192.0.2.1")} {
+			if err := service.ReportURL(ctx, "", phishing.ShortCode, &model.CreateReportRequest{Reason: model.ReportPhishing}); err != nil {
+				t.Fatalf("ReportURL() unexpected error = %v", err)
+			}
+		}
+		if err := service.ReportURL(other, "", corporate.ShortCode, &model.CreateReportRequest{Reason: model.ReportSpam, Details: " spam\x00 "}); err != nil {
+			t.Fatalf("ReportURL() unexpected error = %v", err)
+		}
+
+		queue, err := service.ModerationQueue(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("ModerationQueue() unexpected error = %v", err)
+		}
+		if len(queue) != 2 || queue[0].URL.ShortCode != phishing.ShortCode || queue[0].OpenReports != 2 || queue[0].Reasons[model.ReportPhishing] != 2 {
+			t.Fatalf("ModerationQueue() = %+v, want phishing link first with 2 reports", queue)
+		}
+		if queue[0].URL.OriginalURL != phishing.OriginalURL {
+			t.Errorf("ModerationQueue() should reveal destination to moderators, got %q", queue[0].URL.OriginalURL)
+		}
+
+		reports, err := service.ListReports(context.Background(), stored(corporate.ShortCode).ID)
+		if err != nil || len(reports) != 1 || reports[0].Details != "spam" {
+			t.Errorf("ListReports() = %+v, %v, want one sanitized report", reports, err)
+		}
+	})
+
+	t.Run("suspend and unsuspend", func(t *testing.T) {
+		id := stored(phishing.ShortCode).ID
+		suspended, err := service.SuspendURL(context.Background(), id, &model.ModerationRequest{Reason: "credential phishing"})
+		if err != nil {
+			t.Fatalf("SuspendURL() unexpected error = %v", err)
+		}
+		if suspended.Moderation == nil || suspended.Moderation.Status != model.ModerationSuspended {
+			t.Errorf("SuspendURL() moderation = %+v, want suspended", suspended.Moderation)
+		}
+		if err := service.CheckAvailability(stored(phishing.ShortCode)); !errors.Is(err, apperrors.ErrURLSuspended) {
+			t.Errorf("CheckAvailability() error = %v, want ErrURLSuspended", err)
+		}
+
+		// Жалобы закрыты решением, ссылка ушла из очереди
+		queue, _ := service.ModerationQueue(context.Background(), 0)
+		if len(queue) != 1 || queue[0].URL.ShortCode != corporate.ShortCode {
+			t.Errorf("ModerationQueue() after suspend = %+v, want only corporate link", queue)
+		}
+
+		public, err := service.GetPublicURL(context.Background(), "", phishing.ShortCode)
+		if err != nil {
+			t.Fatalf("GetPublicURL() unexpected error = %v", err)
+		}
+		if public.OriginalURL != "" || public.Moderation == nil || public.Moderation.Reason != "" {
+			t.Errorf("GetPublicURL() = %+v, moderation %+v, want hidden destination and reason", public, public.Moderation)
+		}
+
+		destination := "https://example.com/innocent"
+		_, err = service.UpdateURL(context.Background(), model.DefaultWorkspaceID, "", phishing.ShortCode, phishing.OwnerToken,
+			&model.UpdateURLRequest{URL: &destination})
+		if !errors.Is(err, apperrors.ErrURLSuspended) {
+			t.Errorf("UpdateURL() on suspended link error = %v, want ErrURLSuspended", err)
+		}
+
+		reinstated, err := service.UnsuspendURL(context.Background(), id)
+		if err != nil || reinstated.Moderation != nil {
+			t.Fatalf("UnsuspendURL() = %+v, %v, want link without moderation", reinstated, err)
+		}
+		if err := service.CheckAvailability(stored(phishing.ShortCode)); err != nil {
+			t.Errorf("CheckAvailability() after unsuspend error = %v", err)
+		}
+
+		actions := make(map[string]int)
+		for _, entry := range audit.entries {
+			actions[entry.Action]++
+		}
+		if actions[model.AuditSuspend] != 1 || actions[model.AuditUnsuspend] != 1 {
+			t.Errorf("audit actions = %v, want one suspend and one unsuspend", actions)
+		}
+	})
+
+	t.Run("ban anonymous creator", func(t *testing.T) {
+		id := stored(phishing.ShortCode).ID
+		banned, err := service.BanURL(context.Background(), id, &model.ModerationRequest{Reason: "phishing", BanCreator: true})
+		if err != nil {
+			t.Fatalf("BanURL() unexpected error = %v", err)
+		}
+		if !banned.Moderation.IsBanned() {
+			t.Errorf("BanURL() moderation = %+v, want banned", banned.Moderation)
+		}
+		if !stored(sibling.ShortCode).Moderation.IsBanned() {
+			t.Error("BanURL() should ban other links of the same creator")
+		}
+		if stored(innocent.ShortCode).Moderation.IsRestricted() {
+			t.Error("BanURL() should not touch links of other creators")
+		}
+
+		if _, err := service.UnsuspendURL(context.Background(), id); !apperrors.IsValidationError(err) {
+			t.Errorf("UnsuspendURL() on banned link error = %v, want validation error", err)
+		}
+		if _, err := service.SuspendURL(context.Background(), id, &model.ModerationRequest{}); !apperrors.IsValidationError(err) {
+			t.Errorf("SuspendURL() on banned link error = %v, want validation error", err)
+		}
+
+		if _, err := service.CreateShortURL(spammer, model.DefaultWorkspaceID, &model.CreateURLRequest{URL: "https://example.com/again"}); !errors.Is(err, apperrors.ErrBanned) {
+			t.Errorf("CreateShortURL() by banned creator error = %v, want ErrBanned", err)
+		}
+		create(other, model.DefaultWorkspaceID, "https://example.org/fine")
+
+		// Ссылку без учтенного автора нельзя связать с автором
+		legacy := create(context.Background(), model.DefaultWorkspaceID, "https://example.com/legacy")
+		_, err = service.BanURL(context.Background(), stored(legacy.ShortCode).ID, &model.ModerationRequest{BanCreator: true})
+		if !apperrors.IsValidationError(err) || apperrors.GetValidationError(err).Field != "ban_creator" {
+			t.Errorf("BanURL() of legacy link error = %v, want ban_creator validation error", err)
+		}
+	})
+
+	t.Run("ban workspace", func(t *testing.T) {
+		if _, err := service.BanURL(context.Background(), stored(corporate.ShortCode).ID, &model.ModerationRequest{BanCreator: true}); err != nil {
+			t.Fatalf("BanURL() unexpected error = %v", err)
+		}
+		if workspaces.workspaces[acme.Workspace.ID].BannedAt == nil {
+			t.Error("BanURL() should ban the workspace of the link")
+		}
+		if !stored(corporateSibling.ShortCode).Moderation.IsBanned() {
+			t.Error("BanURL() should ban all links of the workspace")
+		}
+		if _, _, err := workspaceService.Authenticate(context.Background(), acme.APIKey.Key); !errors.Is(err, apperrors.ErrBanned) {
+			t.Errorf("Authenticate() with key of banned workspace error = %v, want ErrBanned", err)
+		}
+	})
+
+	standalone := NewURLService(newMockURLRepository(), "http://localhost:8080")
+	if err := standalone.ReportURL(context.Background(), "", "abc", &model.CreateReportRequest{Reason: model.ReportSpam}); err == nil {
+		t.Error("ReportURL() without moderation repository should fail")
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	repo := newMockURLRepository()
+	service := NewURLService(repo, "http://localhost:8080")
+	checker := NewHealthChecker(service, HealthConfig{
+		Client:           server.Client(),
+		HostInterval:     time.Millisecond,
+		FailureThreshold: 2,
+		ExcludedHosts:    []string{"Example.org"},
+	})
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	codes := make(map[string]string)
+	for _, path := range []string{"/ok", "/gone", "/no-head", "/moved", "/login"} {
+		created, err := service.CreateShortURL(ctx, 2, &model.CreateURLRequest{URL: server.URL + path})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+		codes[path] = created.ShortCode
+	}
+	excluded, _ := service.CreateShortURL(ctx, 2, &model.CreateURLRequest{URL: "https://docs.example.org/guide"})
+	// Deep link приложения не проверяется
+	if _, err := service.CreateShortURL(ctx, 2, &model.CreateURLRequest{URL: "tg://resolve?domain=example", RedirectType: model.RedirectMetaRefresh}); err != nil {
+		t.Fatalf("CreateShortURL() unexpected error = %v", err)
+	}
+
+	health := func(path string) *model.LinkHealth {
+		t.Helper()
+		response, err := service.GetURL(ctx, 2, "", codes[path], "")
+		if err != nil {
+			t.Fatalf("GetURL() unexpected error = %v", err)
+		}
+		return response.Health
+	}
+
+	if checked, err := checker.CheckDue(ctx); err != nil || checked != 6 {
+		t.Fatalf("CheckDue() = %d, %v, want 6 links", checked, err)
+	}
+
+	if h := health("/ok"); h == nil || h.StatusCode != http.StatusOK || h.Error != "" || h.IsBroken() {
+		t.Errorf("health of /ok = %+v, want available", h)
+	}
+	if h := health("/no-head"); h.StatusCode != http.StatusOK || h.Error != "" {
+		t.Errorf("health of /no-head = %+v, want GET fallback", h)
+	}
+	if h := health("/moved"); h.FinalURL != server.URL+"/ok" {
+		t.Errorf("health of /moved FinalURL = %q, want %s/ok", h.FinalURL, server.URL)
+	}
+	if h := health("/login"); h.StatusCode != http.StatusForbidden || h.Error != "" {
+		t.Errorf("health of /login = %+v, want reachable", h)
+	}
+	// Одна неудача - еще не поломка
+	if h := health("/gone"); h.Failures != 1 || h.IsBroken() || h.Error == "" {
+		t.Errorf("health of /gone = %+v, want first failure", h)
+	}
+	if response, _ := service.GetURL(ctx, 2, "", excluded.ShortCode, ""); response.Health != nil && response.Health.StatusCode != 0 {
+		t.Errorf("excluded host was checked: %+v", response.Health)
+	}
+
+	// До RecheckInterval ссылки не перепроверяются
+	if checked, _ := checker.CheckDue(ctx); checked != 0 {
+		t.Errorf("CheckDue() before recheck interval = %d, want 0", checked)
+	}
+
+	now = now.Add(defaultHealthRecheckInterval + time.Minute)
+	if _, err := checker.CheckDue(ctx); err != nil {
+		t.Fatalf("CheckDue() unexpected error = %v", err)
+	}
+
+	if h := health("/gone"); h.Failures != 2 || !h.IsBroken() {
+		t.Errorf("health of /gone = %+v, want broken", h)
+	}
+	brokenEvents := 0
+	for _, event := range repo.outbox {
+		if event.Type == model.EventLinkBroken {
+			brokenEvents++
+			if !strings.Contains(string(event.Payload), codes["/gone"]) {
+				t.Errorf("link.broken payload = %s, want /gone link", event.Payload)
+			}
+		}
+	}
+	if brokenEvents != 1 {
+		t.Errorf("link.broken events = %d, want 1", brokenEvents)
+	}
+
+	page, err := service.ListURLs(ctx, 2, model.URLFilter{Broken: true})
+	if err != nil {
+		t.Fatalf("ListURLs() unexpected error = %v", err)
+	}
+	if len(page.URLs) != 1 || page.URLs[0].ShortCode != codes["/gone"] {
+		t.Errorf("ListURLs(broken) = %+v, want only /gone", page.URLs)
+	}
+
+	// Новое назначение сбрасывает результат проверки
+	destination := server.URL + "/ok"
+	updated, err := service.UpdateURL(ctx, 2, "", codes["/gone"], "", &model.UpdateURLRequest{URL: &destination})
+	if err != nil {
+		t.Fatalf("UpdateURL() unexpected error = %v", err)
+	}
+	if updated.Health != nil {
+		t.Errorf("UpdateURL() Health = %+v, want reset", updated.Health)
+	}
+}
+
+func TestURLService_ListURLs(t *testing.T) {
+	repo := newMockURLRepository()
+	service := NewURLServiceWithConfig(repo, "http://localhost:8080", Config{})
+	ctx := context.Background()
+
+	var codes []string
+	for _, destination := range []string{"https://example.com/a", "https://example.com/b", "https://blog.example.org/post"} {
+		created, err := service.CreateShortURL(ctx, 2, &model.CreateURLRequest{URL: destination})
+		if err != nil {
+			t.Fatalf("CreateShortURL() unexpected error = %v", err)
+		}
+		codes = append(codes, created.ShortCode)
+	}
+	service.CreateShortURL(ctx, 3, &model.CreateURLRequest{URL: "https://example.com/other"})
+
+	post, _ := service.ResolveURL(ctx, "", codes[2])
+	post.URLMetadata = model.URLMetadata{Title: "Release Notes", Description: "What changed"}
+	repo.UpdateMetadata(ctx, post)
+
+	page, err := service.ListURLs(ctx, 2, model.URLFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListURLs() unexpected error = %v", err)
+	}
+	if len(page.URLs) != 2 || page.URLs[0].ShortCode != codes[2] || page.NextCursor != page.URLs[1].ID {
+		t.Fatalf("ListURLs() first page = %+v, next %d", page.URLs, page.NextCursor)
+	}
+	if page.URLs[0].Title != "Release Notes" {
+		t.Errorf("ListURLs() Title = %q, want Release Notes", page.URLs[0].Title)
+	}
+
+	page, _ = service.ListURLs(ctx, 2, model.URLFilter{Limit: 2, BeforeID: page.NextCursor})
+	if len(page.URLs) != 1 || page.URLs[0].ShortCode != codes[0] || page.NextCursor != 0 {
+		t.Errorf("ListURLs() second page = %+v, next %d", page.URLs, page.NextCursor)
+	}
+
+	page, _ = service.ListURLs(ctx, 2, model.URLFilter{Query: "release"})
+	if len(page.URLs) != 1 || page.URLs[0].ShortCode != codes[2] {
+		t.Errorf("ListURLs(q=release) = %+v", page.URLs)
+	}
+
+	if _, err := service.ListURLs(ctx, model.DefaultWorkspaceID, model.URLFilter{}); !errors.Is(err, apperrors.ErrForbidden) {
+		t.Errorf("ListURLs() default workspace error = %v, want ErrForbidden", err)
+	}
+	if _, err := service.ListURLs(ctx, 2, model.URLFilter{Query: strings.Repeat("q", 201)}); !apperrors.IsValidationError(err) {
+		t.Errorf("ListURLs() long query error = %v, want validation error", err)
+	}
+}
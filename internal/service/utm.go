@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+// Ограничения на UTM-шаблон ссылки
+const (
+	maxUTMParams      = 20
+	maxUTMKeyLength   = 64
+	maxUTMValueLength = 256
+	utmTemplateField  = "utm_template"
+)
+
+// utmPlaceholders - плейсхолдеры, доступные в значениях UTM-шаблона
+var utmPlaceholders = map[string]bool{
+	"short_code":    true,
+	"referrer":      true,
+	"referrer_host": true,
+	"country":       true,
+	"date":          true,
+}
+
+// validateUTMTemplate проверяет шаблон при создании ссылки, чтобы ошибки
+// в плейсхолдерах не всплывали только во время редиректа
+func validateUTMTemplate(template model.UTMTemplate) error {
+	if len(template) > maxUTMParams {
+		return apperrors.NewValidationError(utmTemplateField, fmt.Sprintf("utm_template cannot have more than %d parameters", maxUTMParams))
+	}
+
+	for key, value := range template {
+		if strings.TrimSpace(key) == "" {
+			return apperrors.NewValidationError(utmTemplateField, "utm_template parameter name cannot be empty")
+		}
+		if len(key) > maxUTMKeyLength {
+			return apperrors.NewValidationError(utmTemplateField, fmt.Sprintf("utm_template parameter name is too long (max %d characters)", maxUTMKeyLength))
+		}
+		if len(value) > maxUTMValueLength {
+			return apperrors.NewValidationError(utmTemplateField, fmt.Sprintf("utm_template value for %q is too long (max %d characters)", key, maxUTMValueLength))
+		}
+
+		names, err := utils.ParseTemplate(value)
+		if err != nil {
+			return apperrors.NewValidationError(utmTemplateField, fmt.Sprintf("utm_template value for %q: %v", key, err))
+		}
+		for _, name := range names {
+			if !utmPlaceholders[name] {
+				return apperrors.NewValidationError(utmTemplateField, fmt.Sprintf("utm_template value for %q uses unknown placeholder {%s}", key, name))
+			}
+		}
+	}
+
+	return nil
+}
+
+// utmValues собирает значения плейсхолдеров для конкретного перехода
+func utmValues(url *model.URL, visit *model.Visit, now time.Time) map[string]string {
+	values := map[string]string{
+		"short_code": url.ShortCode,
+		"referrer":   visit.Referrer,
+		"country":    visit.Country,
+		"date":       now.UTC().Format(time.DateOnly),
+	}
+	if referrer, err := neturl.Parse(visit.Referrer); err == nil {
+		values["referrer_host"] = referrer.Hostname()
+	}
+	return values
+}
+
+// applyUTMTemplate записывает параметры шаблона в query назначения.
+// Параметр, значение которого оказалось пустым (например, нет Referer),
+// пропускается, чтобы не оставлять в ссылке utm_source=
+func applyUTMTemplate(query rawQuery, template model.UTMTemplate, values map[string]string) rawQuery {
+	expanded := make(neturl.Values, len(template))
+	for key, tmpl := range template {
+		if value := utils.ExpandTemplate(tmpl, values); value != "" {
+			query = query.without(key)
+			expanded.Set(key, value)
+		}
+	}
+	return query.add(expanded)
+}
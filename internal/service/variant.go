@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+// Ограничения на варианты A/B-теста
+const (
+	maxVariants      = 10
+	maxVariantWeight = 1000
+)
+
+// variantNameRegex - имя варианта попадает в cookie и статистику
+var variantNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// validateVariants проверяет варианты новой ссылки. Вес по умолчанию - 1,
+// имя по умолчанию - буква по порядку (a, b, c...)
+func validateVariants(variants []model.Variant, validate func(string) error) (model.Variants, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+
+	if len(variants) > maxVariants {
+		return nil, apperrors.NewValidationError("variants", fmt.Sprintf("cannot have more than %d variants", maxVariants))
+	}
+
+	sanitized := make(model.Variants, 0, len(variants))
+	names := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		if variant.Name == "" {
+			variant.Name = string(rune('a' + i))
+		}
+		if !variantNameRegex.MatchString(variant.Name) {
+			return nil, apperrors.NewValidationError("variants", fmt.Sprintf("variant %d: name must be 1-32 letters, digits, '-' or '_'", i))
+		}
+		if names[variant.Name] {
+			return nil, apperrors.NewValidationError("variants", fmt.Sprintf("duplicate variant name %q", variant.Name))
+		}
+		names[variant.Name] = true
+
+		if variant.Weight == 0 {
+			variant.Weight = 1
+		}
+		if variant.Weight < 0 || variant.Weight > maxVariantWeight {
+			return nil, apperrors.NewValidationError("variants", fmt.Sprintf("variant %q: weight must be between 1 and %d", variant.Name, maxVariantWeight))
+		}
+
+		if err := validate(variant.Destination); err != nil {
+			return nil, apperrors.NewValidationError("variants", fmt.Sprintf("variant %q destination: %s", variant.Name, validationMessage(err)))
+		}
+
+		sanitized = append(sanitized, model.Variant{
+			Name:        variant.Name,
+			Destination: utils.SanitizeInput(variant.Destination),
+			Weight:      variant.Weight,
+		})
+	}
+
+	return sanitized, nil
+}
+
+// pickVariant выбирает вариант для перехода. Закрепленный за посетителем
+// вариант сохраняется, пока он есть в ссылке; иначе выбор случайный по весам
+func (s *URLService) pickVariant(url *model.URL, visit *model.Visit) model.Variant {
+	if url.StickyVariants && visit.StickyVariant != "" {
+		if variant, ok := url.Variants.Find(visit.StickyVariant); ok {
+			return variant
+		}
+	}
+
+	total := 0
+	for _, variant := range url.Variants {
+		total += variant.Weight
+	}
+
+	n := s.randomIntN(total)
+	for _, variant := range url.Variants {
+		if n < variant.Weight {
+			return variant
+		}
+		n -= variant.Weight
+	}
+
+	return url.Variants[len(url.Variants)-1]
+}
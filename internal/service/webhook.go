@@ -0,0 +1,519 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/repository"
+	"github.com/Kosench/go-url-shortener/internal/safehttp"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+const (
+	defaultWebhookMaxAttempts  = 8
+	defaultWebhookBaseBackoff  = 30 * time.Second
+	defaultWebhookMaxBackoff   = time.Hour
+	defaultWebhookBatchSize    = 50
+	defaultWebhookPollInterval = 5 * time.Second
+	defaultWebhookTimeout      = 10 * time.Second
+
+	// webhookLease - на сколько откладывается выбранная для отправки доставка.
+	// Больше таймаута запроса: пока идет попытка, доставку не возьмет другой экземпляр
+	webhookLease = time.Minute
+
+	// webhookCacheTTL - через сколько новая подписка начнет получать события
+	// на всех экземплярах
+	webhookCacheTTL  = 30 * time.Second
+	webhookCacheSize = 1024
+
+	// webhookSecretPrefix отличает секреты подписи от других токенов
+	webhookSecretPrefix   = "whsec_"
+	maxWebhookSecretLen   = 128
+	maxWebhookSubscribers = 20
+
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 200
+
+	// maxWebhookErrorLength - сколько символов ошибки попытки сохраняется
+	maxWebhookErrorLength = 500
+)
+
+// Заголовки запроса к получателю webhook
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookSignatureHeader - "sha256=<hex>", см. utils.SignWebhook
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookConfig - настройки WebhookService
+type WebhookConfig struct {
+	// Client отправляет запросы получателям. По умолчанию - клиент
+	// safehttp с таймаутом 10 секунд: адреса получателей задают workspaces,
+	// поэтому подключения к внутренним адресам запрещены
+	Client *http.Client
+	// MaxAttempts - после стольких неудачных попыток доставка переносится
+	// в dead letters
+	MaxAttempts int
+	// BaseBackoff - пауза после первой неудачной попытки, дальше она
+	// удваивается до MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BatchSize - сколько доставок отправляется за один проход
+	BatchSize    int
+	PollInterval time.Duration
+	// Audit - журнал изменений подписок (nil - не ведется)
+	Audit *AuditLog
+}
+
+// WebhookService управляет подписками workspaces на события, ставит события
+// в очередь доставок и отправляет их получателям с повторными попытками
+type WebhookService struct {
+	repo          repository.WebhookRepository
+	client        *http.Client
+	maxAttempts   int
+	baseBackoff   time.Duration
+	maxBackoff    time.Duration
+	batchSize     int
+	pollInterval  time.Duration
+	subscriptions *ttlCache[[]model.Webhook]
+	audit         *AuditLog
+
+	// now - текущее время (подменяется в тестах)
+	now func() time.Time
+	// checkHost проверяет хост получателя при создании подписки
+	// (подменяется в тестах)
+	checkHost func(ctx context.Context, host string) error
+}
+
+// NewWebhookService создает сервис, незаданные поля WebhookConfig
+// заменяются значениями по умолчанию
+func NewWebhookService(repo repository.WebhookRepository, cfg WebhookConfig) *WebhookService {
+	if cfg.Client == nil {
+		cfg.Client = safehttp.NewClient(safehttp.Options{Timeout: defaultWebhookTimeout})
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaultWebhookBaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultWebhookBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultWebhookPollInterval
+	}
+
+	return &WebhookService{
+		repo:          repo,
+		client:        cfg.Client,
+		maxAttempts:   cfg.MaxAttempts,
+		baseBackoff:   cfg.BaseBackoff,
+		maxBackoff:    cfg.MaxBackoff,
+		batchSize:     cfg.BatchSize,
+		pollInterval:  cfg.PollInterval,
+		subscriptions: newTTLCache[[]model.Webhook](webhookCacheTTL, webhookCacheSize),
+		audit:         cfg.Audit,
+		now:           time.Now,
+		checkHost:     safehttp.CheckHost,
+	}
+}
+
+// CreateWebhook подписывает URL на события workspace. Секрет подписи
+// возвращается только здесь
+func (s *WebhookService) CreateWebhook(ctx context.Context, workspaceID int64, req *model.CreateWebhookRequest) (*model.WebhookResponse, error) {
+	target := strings.TrimSpace(req.URL)
+	if err := utils.ValidateURL(target); err != nil {
+		return nil, err
+	}
+	if err := s.checkTarget(ctx, target); err != nil {
+		return nil, err
+	}
+
+	events, err := normalizeEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		token, err := utils.GenerateToken(24)
+		if err != nil {
+			return nil, apperrors.NewBusinessError("TOKEN_GENERATION", "failed to generate webhook secret", err)
+		}
+		secret = webhookSecretPrefix + token
+	}
+	if len(secret) > maxWebhookSecretLen {
+		return nil, apperrors.NewValidationError("secret", "secret is too long (max 128 characters)")
+	}
+
+	webhooks, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) >= maxWebhookSubscribers {
+		return nil, apperrors.NewValidationError("url", fmt.Sprintf("workspace cannot have more than %d webhooks", maxWebhookSubscribers))
+	}
+
+	webhook := &model.Webhook{
+		WorkspaceID: workspaceID,
+		URL:         target,
+		Events:      events,
+		Secret:      secret,
+		CreatedAt:   s.now(),
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	s.subscriptions.forget(workspaceKey(workspaceID))
+	s.audit.Record(ctx, workspaceID, model.AuditCreate, model.AuditResourceWebhook, strconv.FormatInt(webhook.ID, 10), nil, webhook)
+
+	return &model.WebhookResponse{Webhook: *webhook, Secret: secret}, nil
+}
+
+// ListWebhooks возвращает подписки workspace (без секретов)
+func (s *WebhookService) ListWebhooks(ctx context.Context, workspaceID int64) ([]model.Webhook, error) {
+	return s.repo.List(ctx, workspaceID)
+}
+
+// DeleteWebhook удаляет подписку вместе с ее доставками. Dead letters
+// подписки остаются
+func (s *WebhookService) DeleteWebhook(ctx context.Context, workspaceID, id int64) error {
+	webhooks, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, workspaceID, id); err != nil {
+		return err
+	}
+	s.subscriptions.forget(workspaceKey(workspaceID))
+
+	for i := range webhooks {
+		if webhooks[i].ID == id {
+			s.audit.Record(ctx, workspaceID, model.AuditDelete, model.AuditResourceWebhook, strconv.FormatInt(id, 10), &webhooks[i], nil)
+		}
+	}
+	return nil
+}
+
+// ListDeliveries возвращает последние доставки подписки, от новых к старым
+func (s *WebhookService) ListDeliveries(ctx context.Context, workspaceID, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	if limit < 0 || limit > maxDeliveryPageSize {
+		return nil, apperrors.NewValidationError("limit", "limit must be between 1 and 200")
+	}
+	if limit == 0 {
+		limit = defaultDeliveryPageSize
+	}
+
+	if _, err := s.getWebhook(ctx, workspaceID, webhookID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListDeliveries(ctx, workspaceID, webhookID, limit)
+}
+
+// ReplayDelivery ставит событие доставки в очередь заново: создается новая
+// доставка с тем же телом (и тем же ID события), попытки считаются с нуля
+func (s *WebhookService) ReplayDelivery(ctx context.Context, workspaceID, webhookID, deliveryID int64) (*model.WebhookDelivery, error) {
+	delivery, err := s.repo.GetDelivery(ctx, workspaceID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID != webhookID {
+		return nil, fmt.Errorf("delivery %d: %w", deliveryID, apperrors.ErrDeliveryNotFound)
+	}
+
+	now := s.now()
+	replay := &model.WebhookDelivery{
+		WebhookID:     delivery.WebhookID,
+		WorkspaceID:   workspaceID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        model.DeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+	if err := s.repo.CreateDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+
+	return replay, nil
+}
+
+// Publish ставит событие в очередь доставок всех подписок workspace на него.
+// Событие уже произошло, поэтому ошибки только логируются. nil-сервис
+// ничего не публикует. Если события идут через outbox, подписки получают
+// их через Sink, а Publish не вызывается
+func (s *WebhookService) Publish(ctx context.Context, workspaceID int64, event string, data any) {
+	if s == nil {
+		return
+	}
+
+	built, err := newEvent(workspaceID, event, data, s.now())
+	if err != nil {
+		log.Printf("Failed to build webhook event %s: %v", event, err)
+		return
+	}
+
+	if err := s.enqueue(ctx, built); err != nil {
+		log.Printf("Failed to enqueue webhook deliveries of %s: %v", event, err)
+	}
+}
+
+// Sink возвращает приемник outbox, который ставит события в очередь
+// доставок подписок
+func (s *WebhookService) Sink() EventSink {
+	return webhookSink{s}
+}
+
+// webhookSink - подписки webhooks как приемник событий outbox
+type webhookSink struct {
+	service *WebhookService
+}
+
+func (w webhookSink) Name() string {
+	return "webhooks"
+}
+
+// Publish создает доставки событий. Тело доставки - тело события из outbox,
+// поэтому ID события у получателя webhook тот же, что и в других приемниках
+func (w webhookSink) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	for i := range events {
+		if err := w.service.enqueue(ctx, &events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue создает доставку события каждой подписке workspace на него
+func (s *WebhookService) enqueue(ctx context.Context, event *model.OutboxEvent) error {
+	webhooks, err := s.subscribers(ctx, event.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks of workspace %d: %w", event.WorkspaceID, err)
+	}
+
+	now := s.now()
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(event.Type) {
+			continue
+		}
+
+		delivery := &model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			WorkspaceID:   event.WorkspaceID,
+			Event:         event.Type,
+			Payload:       event.Payload,
+			Status:        model.DeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		}
+		if err := s.repo.CreateDelivery(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to enqueue webhook %d delivery of %s: %w", webhook.ID, event.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// Run отправляет доставки, время которых наступило, раз в PollInterval,
+// пока не отменен ctx
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.DeliverDue(ctx); err != nil {
+				log.Printf("Failed to deliver webhooks: %v", err)
+			}
+		}
+	}
+}
+
+// DeliverDue выполняет по одной попытке для доставок, время которых
+// наступило, и возвращает число попыток
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	now := s.now()
+	deliveries, err := s.repo.ClaimDue(ctx, now, now.Add(webhookLease), s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+			s.attempt(ctx, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// attempt отправляет доставку и сохраняет результат: успех, следующую
+// попытку с экспоненциальной паузой или перенос в dead letters
+func (s *WebhookService) attempt(ctx context.Context, delivery *model.WebhookDelivery) {
+	status, err := s.send(ctx, delivery)
+
+	now := s.now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= s.maxAttempts:
+		delivery.Status = model.DeliveryDead
+		delivery.LastError = truncateError(err)
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(s.backoff(delivery.Attempts))
+		delivery.LastError = truncateError(err)
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := s.repo.SaveAttempt(ctx, delivery); err != nil {
+		log.Printf("Failed to save webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send выполняет запрос к получателю. Успех - любой ответ 2xx
+func (s *WebhookService) send(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Target.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := s.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-url-shortener-webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+utils.SignWebhook(delivery.Target.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Тело ответа не нужно, но дочитываем его, чтобы соединение вернулось в пул
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff - пауза перед следующей попыткой после attempts неудачных:
+// BaseBackoff, 2*BaseBackoff, 4*BaseBackoff... но не больше MaxBackoff
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	delay := s.baseBackoff
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxBackoff)
+}
+
+// subscribers возвращает подписки workspace. Публикация идет на каждом
+// переходе, поэтому подписки кэшируются
+func (s *WebhookService) subscribers(ctx context.Context, workspaceID int64) ([]model.Webhook, error) {
+	key, now := workspaceKey(workspaceID), s.now()
+	if webhooks, ok := s.subscriptions.get(key, now); ok {
+		return webhooks, nil
+	}
+
+	webhooks, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	s.subscriptions.set(key, webhooks, now)
+	return webhooks, nil
+}
+
+func (s *WebhookService) getWebhook(ctx context.Context, workspaceID, id int64) (*model.Webhook, error) {
+	webhooks, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		if webhooks[i].ID == id {
+			return &webhooks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("webhook %d: %w", id, apperrors.ErrWebhookNotFound)
+}
+
+// checkTarget отклоняет получателя во внутренней сети: ответы получателя
+// видны в списке доставок, и через них можно было бы исследовать сервисы,
+// недоступные снаружи
+func (s *WebhookService) checkTarget(ctx context.Context, target string) error {
+	parsed, err := neturl.Parse(target)
+	if err != nil {
+		return apperrors.NewValidationError("url", "invalid webhook URL")
+	}
+
+	if err := s.checkHost(ctx, parsed.Hostname()); err != nil {
+		if errors.Is(err, safehttp.ErrForbiddenAddress) {
+			return apperrors.NewValidationError("url", "webhook URL must point to a public address")
+		}
+		return apperrors.NewValidationError("url", "webhook host cannot be resolved")
+	}
+	return nil
+}
+
+// normalizeEvents проверяет типы событий подписки и убирает повторы
+func normalizeEvents(events []string) (model.EventTypes, error) {
+	var normalized model.EventTypes
+	seen := make(map[string]bool, len(events))
+	for _, event := range events {
+		if !model.IsValidEvent(event) {
+			return nil, apperrors.NewValidationError("events",
+				fmt.Sprintf("unknown event '%s' (expected link.created, link.updated, link.deleted, link.clicked or link.broken)", event))
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+	return normalized, nil
+}
+
+func truncateError(err error) string {
+	message := err.Error()
+	if len(message) > maxWebhookErrorLength {
+		message = message[:maxWebhookErrorLength]
+	}
+	return message
+}
+
+func workspaceKey(workspaceID int64) string {
+	return strconv.FormatInt(workspaceID, 10)
+}
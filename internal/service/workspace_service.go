@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kosench/go-url-shortener/internal/cache"
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"github.com/Kosench/go-url-shortener/internal/model"
+	"github.com/Kosench/go-url-shortener/internal/repository"
+	"github.com/Kosench/go-url-shortener/internal/utils"
+)
+
+const (
+	// workspaceCacheTTL - через сколько изменение квоты увидят все инстансы
+	workspaceCacheTTL  = time.Minute
+	workspaceCacheSize = 1024
+
+	// apiKeyPrefix отличает API-ключи от других токенов (например, токена владельца)
+	apiKeyPrefix = "sk_"
+	// apiKeyDisplayLength - сколько первых символов ключа хранится открыто
+	apiKeyDisplayLength = 10
+	maxNameLength       = 100
+)
+
+// Ресурсы, на которые действуют квоты workspace
+const (
+	QuotaLinks       = "links"
+	QuotaClicks      = "clicks"
+	QuotaAPIRequests = "api_requests"
+)
+
+// WorkspaceConfig - дополнительные настройки WorkspaceService
+type WorkspaceConfig struct {
+	// Counters - счетчики использования квот за месяц (Redis или in-memory)
+	Counters cache.RateLimiter
+	// KeyBuilder - построитель ключей с общим namespace приложения;
+	// счетчики каждого workspace лежат в его namespace (ws:ID)
+	KeyBuilder *cache.KeyBuilder
+	// Audit - журнал изменений workspaces и API-ключей (nil - не ведется)
+	Audit *AuditLog
+}
+
+// WorkspaceService управляет workspaces, их API-ключами и квотами
+type WorkspaceService struct {
+	workspaceRepo repository.WorkspaceRepository
+	apiKeyRepo    repository.APIKeyRepository
+	urlRepo       repository.URLRepository
+	counters      cache.RateLimiter
+	keys          *cache.KeyBuilder
+	workspaces    *ttlCache[*model.Workspace]
+	audit         *AuditLog
+
+	// now - текущее время (подменяется в тестах для смены месяца)
+	now func() time.Time
+}
+
+// NewWorkspaceService создает сервис, незаданные поля WorkspaceConfig
+// заменяются значениями по умолчанию
+func NewWorkspaceService(workspaceRepo repository.WorkspaceRepository, apiKeyRepo repository.APIKeyRepository,
+	urlRepo repository.URLRepository, cfg WorkspaceConfig) *WorkspaceService {
+	if cfg.Counters == nil {
+		cfg.Counters = cache.NewMemoryRateLimiter()
+	}
+	if cfg.KeyBuilder == nil {
+		cfg.KeyBuilder = cache.DefaultKeyBuilder
+	}
+
+	return &WorkspaceService{
+		workspaceRepo: workspaceRepo,
+		apiKeyRepo:    apiKeyRepo,
+		urlRepo:       urlRepo,
+		counters:      cfg.Counters,
+		keys:          cfg.KeyBuilder,
+		workspaces:    newTTLCache[*model.Workspace](workspaceCacheTTL, workspaceCacheSize),
+		audit:         cfg.Audit,
+		now:           time.Now,
+	}
+}
+
+// CreateWorkspace создает workspace и выдает ему первый API-ключ
+func (s *WorkspaceService) CreateWorkspace(ctx context.Context, req *model.CreateWorkspaceRequest) (*model.CreateWorkspaceResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, apperrors.NewValidationError("name", "name cannot be empty")
+	}
+	if len(name) > maxNameLength {
+		return nil, apperrors.NewValidationError("name", "name is too long (max 100 characters)")
+	}
+
+	if err := validateQuota(req.Quota); err != nil {
+		return nil, err
+	}
+
+	workspace := &model.Workspace{
+		Name:      name,
+		Quota:     req.Quota,
+		CreatedAt: s.now(),
+	}
+	if err := s.workspaceRepo.Create(ctx, workspace); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, workspace.ID, model.AuditCreate, model.AuditResourceWorkspace, strconv.FormatInt(workspace.ID, 10), nil, workspace)
+
+	key, err := s.CreateAPIKey(ctx, workspace.ID, &model.CreateAPIKeyRequest{Name: "default", Role: model.RoleOwner})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.CreateWorkspaceResponse{Workspace: *workspace, APIKey: *key}, nil
+}
+
+// GetWorkspace возвращает workspace. Он читается на каждом запросе API
+// и переходе (квоты), поэтому кэшируется в памяти
+func (s *WorkspaceService) GetWorkspace(ctx context.Context, id int64) (*model.Workspace, error) {
+	key := workspaceCacheKey(id)
+	now := s.now()
+	if workspace, ok := s.workspaces.get(key, now); ok {
+		return workspace, nil
+	}
+
+	workspace, err := s.workspaceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.workspaces.set(key, workspace, now)
+	return workspace, nil
+}
+
+// DescribeWorkspace возвращает workspace с использованием квот в текущем месяце
+func (s *WorkspaceService) DescribeWorkspace(ctx context.Context, id int64) (*model.WorkspaceResponse, error) {
+	workspace, err := s.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.urlRepo.CountByWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	return &model.WorkspaceResponse{
+		Workspace: *workspace,
+		Usage: model.Usage{
+			Links:                links,
+			ClicksThisMonth:      s.usage(ctx, id, QuotaClicks, now),
+			APIRequestsThisMonth: s.usage(ctx, id, QuotaAPIRequests, now),
+		},
+	}, nil
+}
+
+// UpdateQuota меняет квоты workspace
+func (s *WorkspaceService) UpdateQuota(ctx context.Context, id int64, quota model.Quota) (*model.Workspace, error) {
+	if err := validateQuota(quota); err != nil {
+		return nil, err
+	}
+
+	before, err := s.workspaceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.workspaceRepo.UpdateQuota(ctx, id, quota); err != nil {
+		return nil, err
+	}
+
+	s.workspaces.forget(workspaceCacheKey(id))
+	workspace, err := s.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, id, model.AuditUpdate, model.AuditResourceWorkspace, strconv.FormatInt(id, 10), before, workspace)
+	return workspace, nil
+}
+
+// UpdateWorkspace меняет настройки workspace: запасное назначение ссылок
+func (s *WorkspaceService) UpdateWorkspace(ctx context.Context, id int64, req *model.UpdateWorkspaceRequest) (*model.Workspace, error) {
+	before, err := s.workspaceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.FallbackURL != nil {
+		fallbackURL, err := validateFallbackURL(*req.FallbackURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.workspaceRepo.UpdateFallbackURL(ctx, id, fallbackURL); err != nil {
+			return nil, err
+		}
+	}
+
+	s.workspaces.forget(workspaceCacheKey(id))
+	workspace, err := s.GetWorkspace(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, id, model.AuditUpdate, model.AuditResourceWorkspace, strconv.FormatInt(id, 10), before, workspace)
+	return workspace, nil
+}
+
+// BanWorkspace блокирует workspace по решению модератора: его ключи
+// перестают работать. Ссылки workspace блокирует URLService.BanURL
+func (s *WorkspaceService) BanWorkspace(ctx context.Context, id int64, at time.Time) error {
+	if id == model.DefaultWorkspaceID {
+		return apperrors.NewValidationError("workspace", "default workspace cannot be banned")
+	}
+
+	before, err := s.workspaceRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.workspaceRepo.Ban(ctx, id, at); err != nil {
+		return err
+	}
+
+	s.workspaces.forget(workspaceCacheKey(id))
+	workspace, err := s.GetWorkspace(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, id, model.AuditBan, model.AuditResourceWorkspace, strconv.FormatInt(id, 10), before, workspace)
+	return nil
+}
+
+// Authenticate находит API-ключ и его workspace. Ключи заблокированного
+// workspace отклоняются с ErrBanned
+func (s *WorkspaceService) Authenticate(ctx context.Context, rawKey string) (*model.Workspace, *model.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, nil, apperrors.ErrUnauthorized
+	}
+
+	key, err := s.apiKeyRepo.GetByHash(ctx, utils.HashToken(rawKey))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workspace, err := s.GetWorkspace(ctx, key.WorkspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if workspace.BannedAt != nil {
+		return nil, nil, apperrors.ErrBanned
+	}
+
+	return workspace, key, nil
+}
+
+// CreateAPIKey выдает новый API-ключ. Сам ключ возвращается только здесь,
+// в БД хранится его хэш
+func (s *WorkspaceService) CreateAPIKey(ctx context.Context, workspaceID int64, req *model.CreateAPIKeyRequest) (*model.APIKeyResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if len(name) > maxNameLength {
+		return nil, apperrors.NewValidationError("name", "name is too long (max 100 characters)")
+	}
+
+	role := req.Role
+	if role == "" {
+		role = model.RoleEditor
+	}
+	if !model.IsValidRole(role) {
+		return nil, apperrors.NewValidationError("role", "role must be one of owner, admin, editor, viewer")
+	}
+
+	token, err := utils.GenerateToken(24)
+	if err != nil {
+		return nil, apperrors.NewBusinessError("TOKEN_GENERATION", "failed to generate API key", err)
+	}
+	rawKey := apiKeyPrefix + token
+
+	key := &model.APIKey{
+		WorkspaceID: workspaceID,
+		Name:        name,
+		Role:        role,
+		Prefix:      rawKey[:apiKeyDisplayLength],
+		KeyHash:     utils.HashToken(rawKey),
+		CreatedAt:   s.now(),
+	}
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, workspaceID, model.AuditCreate, model.AuditResourceAPIKey, strconv.FormatInt(key.ID, 10), nil, key)
+
+	return &model.APIKeyResponse{APIKey: *key, Key: rawKey}, nil
+}
+
+// ListAPIKeys возвращает ключи workspace (без самих ключей)
+func (s *WorkspaceService) ListAPIKeys(ctx context.Context, workspaceID int64) ([]model.APIKey, error) {
+	return s.apiKeyRepo.List(ctx, workspaceID)
+}
+
+// DeleteAPIKey отзывает ключ workspace
+func (s *WorkspaceService) DeleteAPIKey(ctx context.Context, workspaceID, id int64) error {
+	keys, err := s.apiKeyRepo.List(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.apiKeyRepo.Delete(ctx, workspaceID, id); err != nil {
+		return err
+	}
+
+	for i := range keys {
+		if keys[i].ID == id {
+			s.audit.Record(ctx, workspaceID, model.AuditDelete, model.AuditResourceAPIKey, strconv.FormatInt(id, 10), &keys[i], nil)
+		}
+	}
+	return nil
+}
+
+// ListAuditLog возвращает страницу журнала аудита workspace
+func (s *WorkspaceService) ListAuditLog(ctx context.Context, workspaceID int64, filter model.AuditFilter) (*model.AuditPage, error) {
+	if s.audit == nil {
+		return &model.AuditPage{Entries: []model.AuditEntry{}}, nil
+	}
+	return s.audit.List(ctx, workspaceID, filter)
+}
+
+// ConsumeAPIRequest учитывает запрос к API и проверяет месячную квоту
+func (s *WorkspaceService) ConsumeAPIRequest(ctx context.Context, workspace *model.Workspace) error {
+	return s.consume(ctx, workspace.ID, QuotaAPIRequests, workspace.Quota.APIRequestsPerMonth)
+}
+
+// AdmitClick учитывает переход по ссылке workspace и проверяет месячную квоту
+func (s *WorkspaceService) AdmitClick(ctx context.Context, workspaceID int64) error {
+	workspace, err := s.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	return s.consume(ctx, workspaceID, QuotaClicks, workspace.Quota.ClicksPerMonth)
+}
+
+// CheckLinkQuota проверяет, что workspace может создать еще одну ссылку, и
+// возвращает квоту ссылок (0 - без ограничения). Проверка заранее отсекает
+// лишнюю работу, но при параллельных созданиях квоту соблюдает только
+// повторная проверка репозитория в транзакции (model.URL.LinkQuota)
+func (s *WorkspaceService) CheckLinkQuota(ctx context.Context, workspaceID int64) (int64, error) {
+	workspace, err := s.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+	if workspace.Quota.Links == 0 {
+		return 0, nil
+	}
+
+	links, err := s.urlRepo.CountByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+	if links >= workspace.Quota.Links {
+		return 0, apperrors.NewQuotaError(QuotaLinks, workspace.Quota.Links)
+	}
+
+	return workspace.Quota.Links, nil
+}
+
+// linkQuotaError превращает отказ репозитория по квоте ссылок в QuotaError
+// с размером квоты, как у CheckLinkQuota
+func linkQuotaError(err error, limit int64) error {
+	var quotaErr *apperrors.QuotaError
+	if errors.Is(err, apperrors.ErrQuotaExceeded) && !errors.As(err, &quotaErr) {
+		return apperrors.NewQuotaError(QuotaLinks, limit)
+	}
+	return err
+}
+
+// consume увеличивает месячный счетчик ресурса. Использование считается
+// и без квоты (для отчета), а недоступные счетчики не блокируют работу
+func (s *WorkspaceService) consume(ctx context.Context, workspaceID int64, resource string, limit int64) error {
+	now := s.now()
+	count, err := s.counters.IncrementRateLimit(ctx, s.usageKey(workspaceID, resource, now), untilNextMonth(now))
+	if err != nil {
+		log.Printf("Quota counter error for workspace %d: %v", workspaceID, err)
+		return nil
+	}
+
+	if limit > 0 && count > limit {
+		return apperrors.NewQuotaError(resource, limit)
+	}
+	return nil
+}
+
+// usage возвращает использование ресурса за текущий месяц
+func (s *WorkspaceService) usage(ctx context.Context, workspaceID int64, resource string, now time.Time) int64 {
+	count, err := s.counters.GetRateLimit(ctx, s.usageKey(workspaceID, resource, now))
+	if err != nil {
+		log.Printf("Quota counter error for workspace %d: %v", workspaceID, err)
+	}
+	return count
+}
+
+// usageKey - ключ счетчика в namespace workspace, свой для каждого месяца
+func (s *WorkspaceService) usageKey(workspaceID int64, resource string, now time.Time) string {
+	return s.keys.ForWorkspace(workspaceID).Quota(resource, now.UTC().Format("2006-01"))
+}
+
+// untilNextMonth - время жизни месячного счетчика с запасом на сутки
+func untilNextMonth(now time.Time) time.Duration {
+	now = now.UTC()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return nextMonth.Sub(now) + 24*time.Hour
+}
+
+func workspaceCacheKey(id int64) string {
+	return cache.DefaultKeyBuilder.ForWorkspace(id).Build("workspace")
+}
+
+func validateQuota(quota model.Quota) error {
+	if quota.Links < 0 || quota.ClicksPerMonth < 0 || quota.APIRequestsPerMonth < 0 {
+		return apperrors.NewValidationError("quota", "quota cannot be negative")
+	}
+	return nil
+}
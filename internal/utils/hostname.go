@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+// hostnameLabelRegex - метка доменного имени: буквы, цифры и дефис не по краям
+var hostnameLabelRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NormalizeHost приводит значение заголовка Host к виду, в котором домены
+// хранятся в БД: без порта, в нижнем регистре и без завершающей точки
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// ValidateHostname проверяет имя брендированного домена. IP-адреса и имена
+// без точки (localhost) не принимаются: ссылки на них не будут работать
+// у посетителей
+func ValidateHostname(hostname string) error {
+	if hostname == "" {
+		return apperrors.NewValidationError("hostname", "hostname cannot be empty")
+	}
+
+	if len(hostname) > 253 {
+		return apperrors.NewValidationError("hostname", "hostname is too long (max 253 characters)")
+	}
+
+	if net.ParseIP(hostname) != nil {
+		return apperrors.NewValidationError("hostname", "hostname must be a domain name, not an IP address")
+	}
+
+	labels := strings.Split(hostname, ".")
+	if len(labels) < 2 {
+		return apperrors.NewValidationError("hostname", "hostname must contain at least two labels")
+	}
+
+	for _, label := range labels {
+		if !hostnameLabelRegex.MatchString(label) {
+			return apperrors.NewValidationError("hostname", "hostname contains an invalid label: "+label)
+		}
+	}
+
+	return nil
+}
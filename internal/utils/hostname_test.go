@@ -0,0 +1,47 @@
+package utils
+
+import "testing"
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"go.brand.com", "go.brand.com"},
+		{"Go.Brand.COM", "go.brand.com"},
+		{"brnd.link:8080", "brnd.link"},
+		{"brnd.link.", "brnd.link"},
+		{"[::1]:8080", "::1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeHost(tt.host); got != tt.want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		wantErr  bool
+	}{
+		{"go.brand.com", false},
+		{"brnd.link", false},
+		{"xn--80ak6aa92e.com", false},
+		{"", true},
+		{"localhost", true},
+		{"127.0.0.1", true},
+		{"-bad.com", true},
+		{"bad_label.com", true},
+		{"brand..com", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateHostname(tt.hostname)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateHostname(%q) error = %v, wantErr %v", tt.hostname, err, tt.wantErr)
+		}
+	}
+}
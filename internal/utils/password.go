@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"errors"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinPasswordLength = 4
+	// MaxPasswordLength - bcrypt учитывает только первые 72 байта
+	MaxPasswordLength = 72
+)
+
+// ValidatePassword проверяет пароль, задаваемый для ссылки
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return apperrors.NewValidationError("password", "password is too short (min 4 characters)")
+	}
+
+	if len(password) > MaxPasswordLength {
+		return apperrors.NewValidationError("password", "password is too long (max 72 bytes)")
+	}
+
+	return nil
+}
+
+// HashPassword возвращает bcrypt-хэш пароля
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword сравнивает пароль с bcrypt-хэшем
+func CheckPassword(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	apperrors "github.com/Kosench/go-url-shortener/internal/errors"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"valid password", "secret", false},
+		{"minimum length", "abcd", false},
+		{"too short", "abc", true},
+		{"empty", "", true},
+		{"too long", strings.Repeat("a", 73), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !apperrors.IsValidationError(err) {
+				t.Errorf("ValidatePassword() expected validation error, got %T", err)
+			}
+		})
+	}
+}
+
+func TestHashAndCheckPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	if hash == "secret" {
+		t.Fatal("HashPassword() returned plain password")
+	}
+
+	ok, err := CheckPassword(hash, "secret")
+	if err != nil || !ok {
+		t.Errorf("CheckPassword() with correct password = %v, %v", ok, err)
+	}
+
+	ok, err = CheckPassword(hash, "wrong")
+	if err != nil || ok {
+		t.Errorf("CheckPassword() with wrong password = %v, %v", ok, err)
+	}
+}
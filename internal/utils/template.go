@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseTemplate возвращает имена плейсхолдеров вида {name} в шаблоне.
+// Фигурные скобки без пары считаются ошибкой
+func ParseTemplate(tmpl string) ([]string, error) {
+	var names []string
+	rest := tmpl
+	for {
+		open := strings.IndexAny(rest, "{}")
+		if open == -1 {
+			return names, nil
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("unexpected '}' in template %q", tmpl)
+		}
+
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end == -1 || rest[open+1+end] != '}' {
+			return nil, fmt.Errorf("unclosed '{' in template %q", tmpl)
+		}
+
+		name := rest[open+1 : open+1+end]
+		if name == "" {
+			return nil, fmt.Errorf("empty placeholder in template %q", tmpl)
+		}
+		names = append(names, name)
+		rest = rest[open+1+end+1:]
+	}
+}
+
+// ExpandTemplate подставляет значения вместо плейсхолдеров {name}.
+// Неизвестные плейсхолдеры заменяются пустой строкой. Шаблон должен быть
+// предварительно проверен ParseTemplate
+func ExpandTemplate(tmpl string, values map[string]string) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+
+	var b strings.Builder
+	rest := tmpl
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open == -1 {
+			b.WriteString(rest)
+			return b.String()
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end == -1 {
+			b.WriteString(rest)
+			return b.String()
+		}
+
+		b.WriteString(rest[:open])
+		b.WriteString(values[rest[open+1:open+end]])
+		rest = rest[open+end+1:]
+	}
+}
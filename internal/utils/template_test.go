@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    []string
+		wantErr bool
+	}{
+		{"static value", "newsletter", nil, false},
+		{"single placeholder", "{country}", []string{"country"}, false},
+		{"mixed", "ref-{referrer_host}-{country}", []string{"referrer_host", "country"}, false},
+		{"unclosed brace", "ref-{country", nil, true},
+		{"stray closing brace", "ref}", nil, true},
+		{"nested braces", "{a{b}}", nil, true},
+		{"empty placeholder", "x{}", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTemplate(tt.tmpl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTemplate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	values := map[string]string{
+		"country":       "DE",
+		"referrer_host": "news.example.com",
+	}
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"static value", "newsletter", "newsletter"},
+		{"single placeholder", "{country}", "DE"},
+		{"mixed", "ref-{referrer_host}-{country}", "ref-news.example.com-DE"},
+		{"missing value", "x-{short_code}", "x-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandTemplate(tt.tmpl, values); got != tt.want {
+				t.Errorf("ExpandTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
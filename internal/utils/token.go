@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerateToken возвращает случайный токен из n байт в hex-представлении
+func GenerateToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken возвращает sha256-хэш токена для хранения в БД
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenMatchesHash сравнивает токен с сохраненным хэшем за постоянное время
+func TokenMatchesHash(token, hash string) bool {
+	if token == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
+
+// Signer подписывает короткоживущие значения (например, cookie) с помощью HMAC-SHA256
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner создает Signer с заданным секретом
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Sign возвращает токен вида "<unix-время истечения>.<подпись>" для сообщения message
+func (s *Signer) Sign(message string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + s.signature(message, expires)
+}
+
+// Verify проверяет подпись токена и что срок его действия не истек
+func (s *Signer) Verify(message, token string, now time.Time) bool {
+	expires, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() >= unix {
+		return false
+	}
+
+	expected := s.signature(message, expires)
+	return hmac.Equal([]byte(sig), []byte(expected))
+}
+
+func (s *Signer) signature(message, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(message))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Fingerprint возвращает hex-HMAC значений без срока действия (например,
+// отпечаток посетителя). По отпечатку нельзя восстановить исходные значения
+func (s *Signer) Fingerprint(parts ...string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	for _, part := range parts {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignWebhook возвращает hex-подпись HMAC-SHA256 тела запроса webhook.
+// Подписывается строка "<unix-время>.<тело>": получатель проверяет время
+// и не примет перехваченный запрос повторно спустя долгое время
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
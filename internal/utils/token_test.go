@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, err := GenerateToken(16)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	if len(token) != 32 {
+		t.Errorf("GenerateToken(16) length = %d, want 32", len(token))
+	}
+
+	other, _ := GenerateToken(16)
+	if token == other {
+		t.Error("GenerateToken() returned the same token twice")
+	}
+}
+
+func TestTokenMatchesHash(t *testing.T) {
+	hash := HashToken("token")
+
+	if !TokenMatchesHash("token", hash) {
+		t.Error("TokenMatchesHash() should match original token")
+	}
+
+	if TokenMatchesHash("other", hash) {
+		t.Error("TokenMatchesHash() should not match another token")
+	}
+
+	if TokenMatchesHash("", "") {
+		t.Error("TokenMatchesHash() should not match empty values")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner("secret")
+	now := time.Now()
+
+	token := signer.Sign("abc123", now.Add(time.Hour))
+
+	t.Run("valid token", func(t *testing.T) {
+		if !signer.Verify("abc123", token, now) {
+			t.Error("Verify() should accept a freshly signed token")
+		}
+	})
+
+	t.Run("other message", func(t *testing.T) {
+		if signer.Verify("xyz789", token, now) {
+			t.Error("Verify() should reject a token signed for another message")
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		if signer.Verify("abc123", token, now.Add(2*time.Hour)) {
+			t.Error("Verify() should reject an expired token")
+		}
+	})
+
+	t.Run("other secret", func(t *testing.T) {
+		if NewSigner("other").Verify("abc123", token, now) {
+			t.Error("Verify() should reject a token signed with another secret")
+		}
+	})
+
+	t.Run("malformed token", func(t *testing.T) {
+		if signer.Verify("abc123", "garbage", now) {
+			t.Error("Verify() should reject a malformed token")
+		}
+	})
+}
+
+func TestSigner_Fingerprint(t *testing.T) {
+	signer := NewSigner("secret")
+
+	fingerprint := signer.Fingerprint("203.0.113.1", "Firefox")
+	if len(fingerprint) != 64 || fingerprint != signer.Fingerprint("203.0.113.1", "Firefox") {
+		t.Fatalf("Fingerprint() = %q, want stable hex digest", fingerprint)
+	}
+
+	// Границы значений учитываются: "ab"+"c" и "a"+"bc" различаются
+	if signer.Fingerprint("ab", "c") == signer.Fingerprint("a", "bc") {
+		t.Error("Fingerprint() should separate values")
+	}
+	if NewSigner("other").Fingerprint("203.0.113.1", "Firefox") == fingerprint {
+		t.Error("Fingerprint() should depend on the secret")
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"link.created"}`)
+
+	// Ожидаемая подпись: HMAC-SHA256("whsec_test", "1700000000." + body)
+	want := "a8bc0e81c6d690227723d3996e08475a00b6e8824f86e0ac87eff09a0215ef05"
+	if got := SignWebhook("whsec_test", 1700000000, body); got != want {
+		t.Errorf("SignWebhook() = %s, want %s", got, want)
+	}
+
+	if SignWebhook("whsec_test", 1700000001, body) == want {
+		t.Error("SignWebhook() should depend on the timestamp")
+	}
+	if SignWebhook("other", 1700000000, body) == want {
+		t.Error("SignWebhook() should depend on the secret")
+	}
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+// UserAgent - признаки посетителя, извлеченные из заголовка User-Agent
+type UserAgent struct {
+	OS     string
+	Device string
+}
+
+// ParseUserAgent определяет ОС и тип устройства по User-Agent.
+// Разбор эвристический: для маршрутизации ссылок достаточно отличать
+// мобильные платформы от десктопа, точная версия браузера не нужна
+func ParseUserAgent(userAgent string) UserAgent {
+	ua := strings.ToLower(userAgent)
+
+	info := UserAgent{OS: model.OSOther, Device: model.DeviceDesktop}
+
+	switch {
+	// iPadOS 13+ представляется как Macintosh, но мобильный Safari выдает "mobile/"
+	case strings.Contains(ua, "ipad"),
+		strings.Contains(ua, "macintosh") && strings.Contains(ua, "mobile/"):
+		info.OS = model.OSiOS
+		info.Device = model.DeviceTablet
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		info.OS = model.OSiOS
+		info.Device = model.DeviceMobile
+	case strings.Contains(ua, "android"):
+		info.OS = model.OSAndroid
+		// Планшеты на Android не добавляют "mobile" в User-Agent
+		if strings.Contains(ua, "mobile") {
+			info.Device = model.DeviceMobile
+		} else {
+			info.Device = model.DeviceTablet
+		}
+	case strings.Contains(ua, "windows phone"):
+		info.OS = model.OSWindows
+		info.Device = model.DeviceMobile
+	case strings.Contains(ua, "windows"):
+		info.OS = model.OSWindows
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		info.OS = model.OSMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		info.OS = model.OSLinux
+	}
+
+	if info.OS == model.OSOther && strings.Contains(ua, "mobile") {
+		info.Device = model.DeviceMobile
+	}
+
+	return info
+}
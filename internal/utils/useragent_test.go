@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/Kosench/go-url-shortener/internal/model"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      UserAgent
+	}{
+		{
+			name:      "iPhone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			want:      UserAgent{OS: model.OSiOS, Device: model.DeviceMobile},
+		},
+		{
+			name:      "iPad desktop mode",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			want:      UserAgent{OS: model.OSiOS, Device: model.DeviceTablet},
+		},
+		{
+			name:      "Android phone",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36",
+			want:      UserAgent{OS: model.OSAndroid, Device: model.DeviceMobile},
+		},
+		{
+			name:      "Android tablet",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			want:      UserAgent{OS: model.OSAndroid, Device: model.DeviceTablet},
+		},
+		{
+			name:      "Windows desktop",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			want:      UserAgent{OS: model.OSWindows, Device: model.DeviceDesktop},
+		},
+		{
+			name:      "macOS desktop",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			want:      UserAgent{OS: model.OSMacOS, Device: model.DeviceDesktop},
+		},
+		{
+			name:      "Linux desktop",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want:      UserAgent{OS: model.OSLinux, Device: model.DeviceDesktop},
+		},
+		{
+			name:      "empty",
+			userAgent: "",
+			want:      UserAgent{OS: model.OSOther, Device: model.DeviceDesktop},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("ParseUserAgent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
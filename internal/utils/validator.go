@@ -33,6 +33,49 @@ func ValidateURL(rawURL string) error {
 	return nil
 }
 
+// blockedAppLinkSchemes - схемы, которые нельзя использовать как назначение
+// даже в режиме HTML-редиректа: они исполняют код или читают локальные данные
+var blockedAppLinkSchemes = map[string]bool{
+	"javascript": true,
+	"data":       true,
+	"vbscript":   true,
+	"file":       true,
+	"blob":       true,
+	"about":      true,
+}
+
+// ValidateAppLink проверяет назначение для meta/js-редиректа: помимо http(s)
+// разрешены собственные схемы приложений (myapp://...), кроме опасных
+func ValidateAppLink(rawURL string) error {
+	if rawURL == "" {
+		return apperrors.NewValidationError("url", "URL cannot be empty")
+	}
+
+	if len(rawURL) > 2048 {
+		return apperrors.NewValidationError("url", "URL is too long (max 2048 characters)")
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return apperrors.NewValidationError("url", fmt.Sprintf("invalid URL format: %v", err))
+	}
+
+	scheme := strings.ToLower(parsedURL.Scheme)
+	if scheme == "http" || scheme == "https" {
+		return ValidateURL(rawURL)
+	}
+
+	if scheme == "" {
+		return apperrors.NewValidationError("url", "URL must contain a scheme")
+	}
+
+	if blockedAppLinkSchemes[scheme] {
+		return apperrors.NewValidationError("url", fmt.Sprintf("URL scheme '%s' is not allowed", scheme))
+	}
+
+	return nil
+}
+
 func SanitizeInput(input string) string {
 	// Удаляем управляющие символы и обрезаем пробелы
 	result := strings.Map(func(r rune) rune {
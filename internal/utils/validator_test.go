@@ -135,4 +135,35 @@ func TestSanitizeInput(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestValidateAppLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"https URL", "https://example.com", false},
+		{"app deep link", "myapp://open?item=1", false},
+		{"app link without host", "tg:resolve?domain=test", false},
+		{"empty", "", true},
+		{"no scheme", "example.com/path", true},
+		{"javascript", "javascript:alert(1)", true},
+		{"javascript uppercase", "JavaScript:alert(1)", true},
+		{"data", "data:text/html,hi", true},
+		{"file", "file:///etc/passwd", true},
+		{"invalid http", "https://", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAppLink(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAppLink(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if err != nil && !apperrors.IsValidationError(err) {
+				t.Errorf("ValidateAppLink(%q) expected validation error, got %T", tt.url, err)
+			}
+		})
+	}
+}
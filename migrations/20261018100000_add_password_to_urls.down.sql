@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS owner_token_hash,
+    DROP COLUMN IF EXISTS password_hash;
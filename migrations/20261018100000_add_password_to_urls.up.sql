@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    ADD COLUMN password_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN owner_token_hash VARCHAR(64) NOT NULL DEFAULT '';
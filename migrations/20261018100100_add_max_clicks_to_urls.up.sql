@@ -0,0 +1,2 @@
+-- 0 означает отсутствие ограничения на число переходов
+ALTER TABLE urls ADD COLUMN max_clicks BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS chk_urls_activation_window;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS not_after,
+    DROP COLUMN IF EXISTS not_before;
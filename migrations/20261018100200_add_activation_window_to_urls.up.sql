@@ -0,0 +1,6 @@
+ALTER TABLE urls
+    ADD COLUMN not_before TIMESTAMPTZ,
+    ADD COLUMN not_after TIMESTAMPTZ;
+
+ALTER TABLE urls
+    ADD CONSTRAINT chk_urls_activation_window CHECK (not_before IS NULL OR not_after IS NULL OR not_before < not_after);
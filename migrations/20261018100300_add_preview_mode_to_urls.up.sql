@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN preview_mode BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- Пустое значение означает тип редиректа по умолчанию из конфигурации
+ALTER TABLE urls ADD COLUMN redirect_type VARCHAR(8) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    ADD COLUMN forward_query BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN query_conflict VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN forward_path BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE urls
+    ADD COLUMN utm_template JSONB NOT NULL DEFAULT '{}'::jsonb;
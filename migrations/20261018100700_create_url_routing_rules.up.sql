@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS url_routing_rules (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    destination TEXT NOT NULL,
+    UNIQUE (url_id, position)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS click_events (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    region VARCHAR(6) NOT NULL DEFAULT '',
+    city VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id_occurred_at ON click_events(url_id, occurred_at);
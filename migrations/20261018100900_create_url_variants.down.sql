@@ -0,0 +1,7 @@
+ALTER TABLE click_events
+    DROP COLUMN IF EXISTS variant;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS sticky_variants;
+
+DROP TABLE IF EXISTS url_variants;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS url_variants (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    destination TEXT NOT NULL,
+    weight INT NOT NULL CHECK (weight > 0),
+    UNIQUE (url_id, position),
+    UNIQUE (url_id, name)
+);
+
+ALTER TABLE urls
+    ADD COLUMN sticky_variants BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE click_events
+    ADD COLUMN variant VARCHAR(32) NOT NULL DEFAULT '';
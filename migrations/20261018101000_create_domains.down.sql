@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_urls_domain_short_code;
+
+-- Коды, совпадающие на разных доменах, не дадут вернуть глобальную уникальность
+DELETE FROM urls WHERE domain_id IS NOT NULL;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS domain_id;
+
+ALTER TABLE urls
+    ADD CONSTRAINT urls_short_code_key UNIQUE (short_code);
+
+CREATE INDEX IF NOT EXISTS idx_urls_short_code ON urls(short_code);
+
+DROP TABLE IF EXISTS domains;
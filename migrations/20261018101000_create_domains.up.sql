@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS domains (
+    id BIGSERIAL PRIMARY KEY,
+    hostname VARCHAR(253) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- NULL - основной домен приложения (app.base_url)
+ALTER TABLE urls
+    ADD COLUMN domain_id BIGINT REFERENCES domains(id) ON DELETE RESTRICT;
+
+-- Короткий код уникален в пределах домена
+ALTER TABLE urls
+    DROP CONSTRAINT IF EXISTS urls_short_code_key;
+
+DROP INDEX IF EXISTS idx_urls_short_code;
+
+CREATE UNIQUE INDEX idx_urls_domain_short_code ON urls (COALESCE(domain_id, 0), short_code);
@@ -0,0 +1,9 @@
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS workspace_id;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS api_keys;
+
+DROP TABLE IF EXISTS workspaces;
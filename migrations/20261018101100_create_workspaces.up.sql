@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    -- Квоты, 0 - без ограничения
+    max_links BIGINT NOT NULL DEFAULT 0,
+    max_clicks_per_month BIGINT NOT NULL DEFAULT 0,
+    max_api_requests_per_month BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Общий workspace: запросы без API-ключа и данные, созданные до workspaces
+INSERT INTO workspaces (id, name) VALUES (1, 'default') ON CONFLICT (id) DO NOTHING;
+SELECT setval('workspaces_id_seq', GREATEST((SELECT MAX(id) FROM workspaces), 1));
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_workspace_id ON api_keys(workspace_id);
+
+ALTER TABLE urls
+    ADD COLUMN workspace_id BIGINT NOT NULL DEFAULT 1 REFERENCES workspaces(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_id ON urls(workspace_id);
+
+ALTER TABLE domains
+    ADD COLUMN workspace_id BIGINT NOT NULL DEFAULT 1 REFERENCES workspaces(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_domains_workspace_id ON domains(workspace_id);
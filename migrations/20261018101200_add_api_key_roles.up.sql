@@ -0,0 +1,6 @@
+-- Роль ключа в workspace. Ключи, выданные до появления ролей, имели полный доступ
+ALTER TABLE api_keys
+    ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'owner';
+
+ALTER TABLE api_keys
+    ADD CONSTRAINT api_keys_role_check CHECK (role IN ('owner', 'admin', 'editor', 'viewer'));
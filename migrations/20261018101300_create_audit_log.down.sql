@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP TABLE IF EXISTS audit_log;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,35 @@
+-- Отключенная ссылка не выполняет редирект (410), удаленная - не находится.
+-- Обе операции обратимы, поэтому строка ссылки остается в таблице
+ALTER TABLE urls
+    ADD COLUMN disabled_at TIMESTAMPTZ NULL,
+    ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE RESTRICT,
+    -- Кто выполнил операцию: api_key:<id>, anonymous, admin или system
+    actor VARCHAR(64) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    action VARCHAR(32) NOT NULL,
+    resource_type VARCHAR(16) NOT NULL,
+    resource_id VARCHAR(255) NOT NULL,
+    -- Изменившиеся поля ресурса до и после операции
+    before JSONB NULL,
+    after JSONB NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_workspace_id ON audit_log(workspace_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(workspace_id, resource_type, resource_id);
+
+-- Журнал только дополняется: изменение и удаление записей запрещены
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
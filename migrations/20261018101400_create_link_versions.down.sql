@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS link_versions;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,40 @@
+-- Номер текущей ревизии настроек ссылки
+ALTER TABLE urls
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- Ревизии настроек ссылок: новая строка на каждое изменение назначения или
+-- настроек. Редирект читает только urls, история нужна для просмотра и отката
+CREATE TABLE IF NOT EXISTS link_versions (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    settings JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (url_id, version)
+);
+
+-- Первая ревизия существующих ссылок - их текущие настройки
+INSERT INTO link_versions (url_id, version, settings, created_at)
+SELECT u.id, 1, jsonb_strip_nulls(jsonb_build_object(
+        'original_url', u.original_url,
+        'max_clicks', NULLIF(u.max_clicks, 0),
+        'not_before', u.not_before,
+        'not_after', u.not_after,
+        'preview_mode', NULLIF(u.preview_mode, FALSE),
+        'redirect_type', NULLIF(u.redirect_type, ''),
+        'forward_query', NULLIF(u.forward_query, FALSE),
+        'query_conflict', NULLIF(u.query_conflict, ''),
+        'forward_path', NULLIF(u.forward_path, FALSE),
+        'utm_template', NULLIF(u.utm_template, '{}'::jsonb),
+        'rules', (SELECT jsonb_agg(jsonb_build_object(
+                'kind', r.kind, 'value', r.value, 'destination', r.destination
+            ) ORDER BY r.position)
+            FROM url_routing_rules r WHERE r.url_id = u.id),
+        'variants', (SELECT jsonb_agg(jsonb_build_object(
+                'name', v.name, 'destination', v.destination, 'weight', v.weight
+            ) ORDER BY v.position)
+            FROM url_variants v WHERE v.url_id = u.id),
+        'sticky_variants', NULLIF(u.sticky_variants, FALSE)
+    )), u.created_at
+FROM urls u
+ON CONFLICT (url_id, version) DO NOTHING;
@@ -0,0 +1,20 @@
+-- Outbox доменных событий: строка добавляется в одной транзакции с
+-- изменением ссылки или счетчика переходов, relay публикует ее приемникам
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL UNIQUE,
+    workspace_id BIGINT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    -- Тело события: {id, type, workspace_id, created_at, data}
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events(next_attempt_at, id)
+    WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_published_at ON outbox_events(published_at)
+    WHERE published_at IS NOT NULL;
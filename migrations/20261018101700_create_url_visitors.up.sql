@@ -0,0 +1,8 @@
+-- Отпечатки посетителей для подсчета уникальных посетителей без Redis.
+-- Хранится HMAC от адреса и User-Agent, а не сами данные посетителя
+CREATE TABLE IF NOT EXISTS url_visitors (
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    PRIMARY KEY (url_id, day, fingerprint)
+);
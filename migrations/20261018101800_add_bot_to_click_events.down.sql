@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_click_events_url_id_bot;
+ALTER TABLE click_events DROP COLUMN IF EXISTS bot;
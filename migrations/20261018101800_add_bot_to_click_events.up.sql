@@ -0,0 +1,5 @@
+-- Переходы ботов и краулеров сохраняются отдельно от переходов людей:
+-- bot - сигнатура или причина (пусто - человек)
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS bot VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id_bot ON click_events(url_id) WHERE bot <> '';
@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS image_url,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS title;
@@ -0,0 +1,6 @@
+-- Карточка страницы назначения (Open Graph) для списка ссылок, поиска
+-- и превью короткой ссылки в мессенджерах
+ALTER TABLE urls
+    ADD COLUMN title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- Карточка ссылки, заданная владельцем: заменяет карточку страницы
+-- назначения при превью в мессенджерах и соцсетях
+ALTER TABLE urls
+    ADD COLUMN og_title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN og_description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN og_image TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_urls_broken;
+DROP INDEX IF EXISTS idx_urls_health_due;
+
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS broken_since,
+    DROP COLUMN IF EXISTS health_checked_at,
+    DROP COLUMN IF EXISTS health_failures,
+    DROP COLUMN IF EXISTS health_error,
+    DROP COLUMN IF EXISTS health_final_url,
+    DROP COLUMN IF EXISTS health_latency_ms,
+    DROP COLUMN IF EXISTS health_status;
@@ -0,0 +1,16 @@
+-- Проверка доступности страниц назначения: результат последней проверки
+-- и момент, с которого назначение считается недоступным
+ALTER TABLE urls
+    ADD COLUMN health_status INT NOT NULL DEFAULT 0,
+    ADD COLUMN health_latency_ms BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN health_final_url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN health_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN health_failures INT NOT NULL DEFAULT 0,
+    ADD COLUMN health_checked_at TIMESTAMPTZ NULL,
+    ADD COLUMN broken_since TIMESTAMPTZ NULL;
+
+-- Очередь проверок: давно не проверенные ссылки первыми
+CREATE INDEX IF NOT EXISTS idx_urls_health_due ON urls(health_checked_at NULLS FIRST, id)
+    WHERE deleted_at IS NULL AND disabled_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_urls_broken ON urls(workspace_id, id)
+    WHERE broken_since IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE workspaces
+    DROP COLUMN IF EXISTS fallback_url;
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS fallback_url;
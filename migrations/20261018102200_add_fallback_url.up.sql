@@ -0,0 +1,7 @@
+-- Запасное назначение: куда ведет ссылка, если она отключена, истекла,
+-- исчерпала лимит кликов или ее назначение недоступно. У workspace -
+-- значение для ссылок без собственного
+ALTER TABLE urls
+    ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE workspaces
+    ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';
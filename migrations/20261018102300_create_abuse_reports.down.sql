@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS banned_creators;
+DROP TABLE IF EXISTS abuse_reports;
+ALTER TABLE workspaces
+    DROP COLUMN IF EXISTS banned_at;
+DROP INDEX IF EXISTS idx_urls_creator_hash;
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS creator_hash,
+    DROP COLUMN IF EXISTS moderated_at,
+    DROP COLUMN IF EXISTS moderation_reason,
+    DROP COLUMN IF EXISTS moderation_status;
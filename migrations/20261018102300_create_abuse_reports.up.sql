@@ -0,0 +1,39 @@
+-- Решение модерации по ссылке: suspended (снимается модератором) или
+-- banned (навсегда), пусто - ссылка не ограничена
+ALTER TABLE urls
+    ADD COLUMN moderation_status VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN moderation_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN moderated_at TIMESTAMPTZ NULL,
+    -- Хэш IP автора анонимной ссылки: по нему блокируется автор
+    ADD COLUMN creator_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_urls_creator_hash ON urls(creator_hash)
+    WHERE creator_hash <> '';
+
+-- Заблокированный workspace не принимает запросы API
+ALTER TABLE workspaces
+    ADD COLUMN banned_at TIMESTAMPTZ NULL;
+
+CREATE TABLE IF NOT EXISTS abuse_reports (
+    id BIGSERIAL PRIMARY KEY,
+    url_id BIGINT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    reason VARCHAR(16) NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    -- Хэш IP отправителя: одна открытая жалоба посетителя на ссылку
+    reporter_hash VARCHAR(64) NOT NULL,
+    -- open, dismissed или actioned
+    status VARCHAR(16) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_abuse_reports_open_reporter ON abuse_reports(url_id, reporter_hash)
+    WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_abuse_reports_url_id ON abuse_reports(url_id, id DESC);
+
+-- Заблокированные авторы анонимных ссылок
+CREATE TABLE IF NOT EXISTS banned_creators (
+    creator_hash VARCHAR(64) PRIMARY KEY,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);